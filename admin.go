@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+)
+
+// handleChainControl 处理 POST /chains/{name}/pause 和 POST /chains/{name}/resume
+// 请求需要带 "Authorization: Bearer <adminToken>"
+func handleChainControl(adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !authorizedAdmin(r, adminToken) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/chains/"), "/")
+		if len(parts) != 2 {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		chainName, action := parts[0], parts[1]
+		control, ok := lookupChainControl(chainName)
+		if !ok {
+			writeError(w, http.StatusNotFound, "chain not found")
+			return
+		}
+
+		var changed bool
+		switch action {
+		case "pause":
+			changed = control.pause()
+		case "resume":
+			changed = control.resume()
+		default:
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		paused, _ := control.state()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"chain": chainName, "paused": paused, "changed": changed})
+	}
+}
+
+// authorizedAdmin 判断请求是否带有 "Authorization: Bearer <adminToken>"
+// 没有 "Bearer " 前缀的请求一律拒绝，即使其中直接是 adminToken；adminToken 为空时不允许任何请求
+func authorizedAdmin(r *http.Request, adminToken string) bool {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if adminToken == "" || !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(header[len(prefix):]), []byte(adminToken)) == 1
+}
+
+// channelDelivery POST /mesons/{reqid}/alert 中单个渠道的发送结果
+type channelDelivery struct {
+	Channel   string `json:"channel"`
+	Delivered bool   `json:"delivered"`
+	Error     string `json:"error,omitempty"`
+}
+
+// handleResendAlert 处理 POST /mesons/{reqid}/alert，按数据库中的记录重新构建告警（与 constructMessage 相同）并发送
+// 渠道按告警路由选择，可以通过 channel 参数只发送到一个渠道，例如新增的渠道；请求需要带 "Authorization: Bearer <adminToken>"
+// 告警同步发送到各渠道，不经过告警队列和限流，响应中返回每个渠道的发送结果
+func handleResendAlert(adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !authorizedAdmin(r, adminToken) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		reqID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/mesons/"), "/alert")
+		if reqID == "" || strings.Contains(reqID, "/") {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+
+		meson, err := database.FindMesonByReqID(reqID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to query meson")
+			return
+		}
+		if meson == nil {
+			writeError(w, http.StatusNotFound, "meson not found")
+			return
+		}
+
+		// 按告警路由选出渠道，channel 为 "lark" 时同时匹配告警路由的 "lark:路由名"
+		alert := FromMeson(*meson)
+		channel := r.URL.Query().Get("channel")
+		var targets []Notifier
+		for _, notifier := range notifiersFor(alert) {
+			if channel == "" || notifier.Name() == channel || strings.HasPrefix(notifier.Name(), channel+":") {
+				targets = append(targets, notifier)
+			}
+		}
+		if len(targets) == 0 {
+			if channel != "" {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("alert channel %q is not configured for the chains of this meson", channel))
+				return
+			}
+			writeError(w, http.StatusServiceUnavailable, "no alert channel is configured")
+			return
+		}
+
+		observeAlert(alert.Kind)
+		logrus.Infof("Resending %s alert for ReqID %s to %d channel(s) on admin request", alert.Kind, meson.ReqID, len(targets))
+		deliveries := make([]channelDelivery, 0, len(targets))
+		for _, notifier := range targets {
+			delivery := channelDelivery{Channel: notifier.Name(), Delivered: true}
+			if err := notifier.Notify(alert); err != nil {
+				delivery.Delivered = false
+				delivery.Error = err.Error()
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"reqId": meson.ReqID, "kind": alert.Kind, "channels": deliveries})
+	}
+}
+
+// chainStatus GET /readyz 中单条链的状态
+type chainStatus struct {
+	Chain          string     `json:"chain"`
+	Paused         bool       `json:"paused"`
+	PausedSince    *time.Time `json:"pausedSince,omitempty"`
+	Started        bool       `json:"started"`
+	Stalled        bool       `json:"stalled"`
+	NextBlock      uint64     `json:"nextBlock,omitempty"`
+	LastProgressAt *time.Time `json:"lastProgressAt,omitempty"`
+}
+
+// handleReady 处理 GET /readyz，列出各链的监听状态
+// 所有未暂停的链都已开始监听且没有停滞时返回 200，否则返回 503；暂停的链不影响就绪状态
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	ready := true
+	var statuses []chainStatus
+	for _, control := range chainControlList() {
+		status := chainStatus{Chain: control.chainName}
+		paused, since := control.state()
+		if paused {
+			status.Paused = true
+			status.PausedSince = &since
+		}
+		if state, ok := chainProgressSnapshot(control.chainName); ok {
+			status.Started = true
+			status.Stalled = state.stalled
+			status.NextBlock = state.block
+			status.LastProgressAt = &state.updatedAt
+		}
+		if !status.Paused && (!status.Started || status.Stalled) {
+			ready = false
+		}
+		statuses = append(statuses, status)
+	}
+
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{"ready": ready, "chains": statuses})
+}
+
+// writeChainMetrics 输出各链监听是否暂停
+func writeChainMetrics(w io.Writer) {
+	controls := chainControlList()
+	if len(controls) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "# HELP bridge_chain_paused Whether the chain listener is paused (1) or running (0).")
+	fmt.Fprintln(w, "# TYPE bridge_chain_paused gauge")
+	for _, control := range controls {
+		value := 0
+		if paused, _ := control.state(); paused {
+			value = 1
+		}
+		fmt.Fprintf(w, "bridge_chain_paused{chain=%q} %d\n", control.chainName, value)
+	}
+}
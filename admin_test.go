@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorizedAdmin(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		adminToken    string
+		want          bool
+	}{
+		{"bearer token", "Bearer secret", "secret", true},
+		{"bare token", "secret", "secret", false},
+		{"other scheme", "Basic secret", "secret", false},
+		{"lowercase scheme", "bearer secret", "secret", false},
+		{"wrong token", "Bearer other", "secret", false},
+		{"missing header", "", "secret", false},
+		{"empty admin token", "Bearer ", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/chains/bsc/pause", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if got := authorizedAdmin(r, tt.adminToken); got != tt.want {
+				t.Errorf("authorizedAdmin(%q) = %v, want %v", tt.authorization, got, tt.want)
+			}
+		})
+	}
+}
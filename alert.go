@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/bot"
+	"meson-monitor/database"
+)
+
+const (
+	channelTelegram  = "telegram"
+	channelLark      = "lark"
+	channelSlack     = "slack"
+	channelWebhook   = "webhook"
+	channelPagerDuty = "pagerduty"
+)
+
+var (
+	alertCooldown time.Duration                // 同一 reqID 两次告警的最小间隔，为 0 时不去重
+	alertedAt     = make(map[string]time.Time) // 内存中记录的 reqID 最近告警时间
+	alertedAtLock sync.Mutex
+
+	// deliveryRecorder 不为 nil 时接收每个渠道的发送结果，失败的告警不再保存，用于 --test-alert
+	deliveryRecorder func(channel string, err error)
+)
+
+// shouldAlert 判断 Meson 是否已过告警冷却期
+// 同时参考内存记录和数据库中的 last_alerted_at，进程重启后仍能去重
+func shouldAlert(meson database.Meson, now time.Time) bool {
+	if alertCooldown <= 0 {
+		return true
+	}
+
+	alertedAtLock.Lock()
+	last, ok := alertedAt[meson.ReqID]
+	alertedAtLock.Unlock()
+
+	if meson.LastAlertedAt != nil && (!ok || meson.LastAlertedAt.After(last)) {
+		last, ok = *meson.LastAlertedAt, true
+	}
+	return !ok || now.Sub(last) >= alertCooldown
+}
+
+// markAlerted 记录 Meson 的告警时间
+func markAlerted(db database.Store, reqID string, now time.Time) {
+	if alertCooldown <= 0 {
+		return
+	}
+
+	alertedAtLock.Lock()
+	alertedAt[reqID] = now
+	alertedAtLock.Unlock()
+
+	db.MarkMesonAlerted(reqID, now)
+}
+
+// telegramPayload 重新发送 Telegram 消息所需的内容
+// ChatIDs 为空时发送到所有配置的 chat，否则只发送到其中列出的 chat
+type telegramPayload struct {
+	Message   string             `json:"message"`
+	ParseMode string             `json:"parseMode"`
+	ChatIDs   []bot.TelegramChat `json:"chatIDs,omitempty"`
+	// Keyboard 消息下方的区块浏览器按钮，为空时不附带
+	Keyboard [][]bot.InlineButton `json:"keyboard,omitempty"`
+}
+
+// larkPayload 重新发送 Lark 消息所需的内容，Content 为卡片正文
+type larkPayload struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Color   string `json:"color,omitempty"`
+	// Route 告警路由的名称，为空时发送到默认的 Lark 机器人
+	Route string `json:"route,omitempty"`
+}
+
+// slackPayload 重新发送 Slack 消息所需的内容
+type slackPayload struct {
+	Title  string           `json:"title"`
+	Time   string           `json:"time"`
+	Fields []bot.SlackField `json:"fields"`
+	// Color 附件颜色，为空时不使用附件
+	Color string `json:"color,omitempty"`
+	// Route 告警路由的名称，为空时发送到默认的 Slack 机器人
+	Route string `json:"route,omitempty"`
+}
+
+// sendTelegram 发送 Telegram 消息，未配置 Telegram 时不发送，重试后仍失败时保存到 failed_alerts 表
+// 只有部分 chat 失败时，保存的告警只会重新发送到失败的 chat
+func sendTelegram(message, parseMode string) error {
+	return sendTelegramWithKeyboard(message, parseMode, nil)
+}
+
+// sendTelegramWithKeyboard 与 sendTelegram 相同，消息下方附带 keyboard 中的按钮，重新发送时同样附带
+func sendTelegramWithKeyboard(message, parseMode string, keyboard [][]bot.InlineButton) error {
+	return sendTelegramRouted("", message, parseMode, keyboard)
+}
+
+// sendTelegramRouted 与 sendTelegramWithKeyboard 相同，route 不为空时发送到该告警路由的 chat
+// 保存的告警中记录了路由的 chat，之后修改路由配置不影响重新发送
+func sendTelegramRouted(route, message, parseMode string, keyboard [][]bot.InlineButton) error {
+	chatIDs := telegramBot.ChatIDs
+	if route != "" {
+		chatIDs = routeChats(route)
+	}
+	if telegramBot.Token == "" || len(chatIDs) == 0 {
+		return nil
+	}
+	payload := telegramPayload{Message: message, ParseMode: parseMode, Keyboard: keyboard}
+	if route != "" {
+		payload.ChatIDs = chatIDs
+	}
+	err := deliverTelegram(payload)
+	if err != nil {
+		logrus.Errorf("Failed to send Telegram message%s: %v", routeLabel(route), err)
+	}
+	recordDelivery(channelTelegram, route, remainingTelegramPayload(payload, err), err)
+	return err
+}
+
+// remainingTelegramPayload 根据发送错误只保留失败且可以重试的 chat ID
+func remainingTelegramPayload(payload telegramPayload, err error) telegramPayload {
+	if sendErr, ok := err.(*bot.SendError); ok {
+		payload.ChatIDs = sendErr.RetryableChatIDs()
+	}
+	return payload
+}
+
+// webhookPayload 重新发送 Webhook 消息所需的内容，Body 为已渲染的请求体
+type webhookPayload struct {
+	Body string `json:"body"`
+}
+
+// sendWebhook 将告警发送到 Webhook，未配置 Webhook 时不发送，重试后仍失败时保存到 failed_alerts 表
+func sendWebhook(data webhookAlert) error {
+	if webhookBot == nil {
+		return nil
+	}
+	body, err := webhookBot.Render(data)
+	if err != nil {
+		// 模板渲染失败重新发送也不会成功，不保存
+		logrus.Errorf("Failed to build webhook message: %v", err)
+		if deliveryRecorder != nil {
+			deliveryRecorder(channelWebhook, err)
+		}
+		return err
+	}
+	payload := webhookPayload{Body: string(body)}
+	err = deliverWebhook(payload)
+	if err != nil {
+		logrus.Errorf("Failed to send webhook message: %v", err)
+	}
+	recordDelivery(channelWebhook, "", payload, err)
+	return err
+}
+
+func deliverWebhook(payload webhookPayload) error {
+	if webhookBot == nil {
+		return fmt.Errorf("webhook is not configured")
+	}
+	return webhookBot.Post([]byte(payload.Body))
+}
+
+// pagerDutyPayload 重新发送 PagerDuty 事件所需的内容，Body 为已生成的请求体
+type pagerDutyPayload struct {
+	Body string `json:"body"`
+}
+
+// sendPagerDuty 触发 PagerDuty 事件，未配置 PagerDuty 时不发送，重试后仍失败时保存到 failed_alerts 表
+func sendPagerDuty(event bot.PagerDutyEvent) error {
+	if pagerDutyBot == nil {
+		return nil
+	}
+	body, err := pagerDutyBot.TriggerBody(event)
+	if err != nil {
+		logrus.Errorf("Failed to build PagerDuty event: %v", err)
+		return err
+	}
+	return postPagerDuty(body)
+}
+
+// resolvePagerDuty 跨链最终一致时解决该 reqID 之前触发的 incident，没有对应 incident 时 PagerDuty 直接忽略
+func resolvePagerDuty(reqID string) {
+	if pagerDutyBot == nil {
+		return
+	}
+	body, err := pagerDutyBot.ResolveBody(reqID)
+	if err != nil {
+		logrus.Errorf("Failed to build PagerDuty resolve event: %v", err)
+		return
+	}
+	if postPagerDuty(body) == nil {
+		logrus.Infof("Resolved PagerDuty incident for ReqID %s", reqID)
+	}
+}
+
+// resolveReconciled 之前告警过的跨链（超时或在冷却期内记录了告警时间）最终一致后，解决对应的 incident
+// 只能在最终一致的结果提交到数据库后调用。告警队列已启动时在后台发送，不等待 HTTP 请求，停止队列时等待发送完成；否则同步发送
+func resolveReconciled(meson database.Meson) {
+	if pagerDutyBot == nil || (!meson.TimedOut && meson.LastAlertedAt == nil) {
+		return
+	}
+	if queue := alerts.Load(); queue != nil {
+		queue.goSend(func() { resolvePagerDuty(meson.ReqID) })
+		return
+	}
+	resolvePagerDuty(meson.ReqID)
+}
+
+// settleMeson 处理最终一致的跨链：完成耗时计入指标，解决之前告警对应的 incident
+// 只能在最终一致的结果提交到数据库后调用
+func settleMeson(meson database.Meson, completedAt time.Time) {
+	observeSettlement(meson.ChainA, meson.ChainB, meson.Timestamp, completedAt)
+	resolveReconciled(meson)
+}
+
+// settlementNotifier 暂存最终一致的跨链的 Notifier，由 alertBuffer 实现，事务提交后再调用 settleMeson
+type settlementNotifier interface {
+	Settled(meson database.Meson, completedAt time.Time)
+}
+
+// notifySettled 在事件处理中发现跨链最终一致：notifier 为区间的 alertBuffer 时暂存到事务提交后，
+// 回滚的区间不计入指标也不解决 incident；否则立即处理
+func notifySettled(notifier Notifier, meson database.Meson, completedAt time.Time) {
+	if buffer, ok := notifier.(settlementNotifier); ok {
+		buffer.Settled(meson, completedAt)
+		return
+	}
+	settleMeson(meson, completedAt)
+}
+
+// postPagerDuty 发送已生成的事件，失败时保存到 failed_alerts 表
+func postPagerDuty(body []byte) error {
+	payload := pagerDutyPayload{Body: string(body)}
+	err := deliverPagerDuty(payload)
+	if err != nil {
+		logrus.Errorf("Failed to send PagerDuty event: %v", err)
+	}
+	recordDelivery(channelPagerDuty, "", payload, err)
+	return err
+}
+
+func deliverPagerDuty(payload pagerDutyPayload) error {
+	if pagerDutyBot == nil {
+		return fmt.Errorf("pagerduty is not configured")
+	}
+	return pagerDutyBot.Post([]byte(payload.Body))
+}
+
+// sendSlackFields 按字段发送 Slack 消息，未配置 Slack 时不发送，重试后仍失败时保存到 failed_alerts 表
+// color 为附件颜色，为空时不使用附件
+func sendSlackFields(title, time string, fields []bot.SlackField, color string) error {
+	return sendSlackFieldsRouted("", title, time, fields, color)
+}
+
+// sendSlackFieldsRouted 与 sendSlackFields 相同，route 不为空时发送到该告警路由的 Slack 机器人
+func sendSlackFieldsRouted(route, title, time string, fields []bot.SlackField, color string) error {
+	if routeSlackBot(route) == nil {
+		return nil
+	}
+	payload := slackPayload{Title: title, Time: time, Fields: fields, Color: color, Route: route}
+	err := deliverSlack(payload)
+	if err != nil {
+		logrus.Errorf("Failed to send Slack message%s: %v", routeLabel(route), err)
+	}
+	recordDelivery(channelSlack, route, payload, err)
+	return err
+}
+
+// recordDelivery 处理一次发送的结果，失败时保存到 failed_alerts 表等待重新发送
+// route 为告警路由的名称，只用于发送结果和日志中的渠道名称，重新发送所需的路由信息保存在 payload 中
+// 永久失败（如 token 无效、Webhook 已失效）重新发送也不会成功，不保存
+func recordDelivery(channel, route string, payload interface{}, err error) {
+	name := deliveryName(channel, route)
+	if deliveryRecorder != nil {
+		deliveryRecorder(name, err)
+		return
+	}
+	if err == nil {
+		return
+	}
+	if bot.IsPermanent(err) {
+		logrus.Errorf("Not queueing %s alert for redelivery, check the %s configuration: %v", name, name, err)
+		return
+	}
+	saveFailedAlert(channel, payload, err)
+}
+
+func deliverTelegram(payload telegramPayload) error {
+	chatIDs := telegramBot.ChatIDs
+	if len(payload.ChatIDs) > 0 {
+		chatIDs = payload.ChatIDs
+	}
+	return telegramBot.SendMessageWithKeyboard(chatIDs, payload.Message, payload.ParseMode, payload.Keyboard)
+}
+
+// sendLarkCard 发送正文为 content 的 Lark 消息卡片，未配置 Lark 时不发送，重试后仍失败时保存到 failed_alerts 表
+// color 为卡片标题栏的颜色模板，为空时使用默认颜色
+func sendLarkCard(title, color, content string) error {
+	return sendLarkCardRouted("", title, color, content)
+}
+
+// sendLarkCardRouted 与 sendLarkCard 相同，route 不为空时发送到该告警路由的 Lark 机器人
+func sendLarkCardRouted(route, title, color, content string) error {
+	if routeLarkBot(route).WebhookURL == "" {
+		return nil
+	}
+	payload := larkPayload{Title: title, Content: content, Color: color, Route: route}
+	err := deliverLark(payload)
+	if err != nil {
+		logrus.Errorf("Failed to send Lark message%s: %v", routeLabel(route), err)
+	}
+	recordDelivery(channelLark, route, payload, err)
+	return err
+}
+
+// deliverLark 发送 Lark 消息，payload 中的路由已从配置中删除时发送到默认的 Lark 机器人
+func deliverLark(payload larkPayload) error {
+	return routeLarkBot(payload.Route).SendCard(payload.Title, payload.Color, payload.Content)
+}
+
+// deliverSlack 发送 Slack 消息，payload 中的路由已从配置中删除时发送到默认的 Slack 机器人
+func deliverSlack(payload slackPayload) error {
+	slackBot := routeSlackBot(payload.Route)
+	if slackBot == nil {
+		return fmt.Errorf("slack is not configured")
+	}
+	return slackBot.SendFields(payload.Title, payload.Time, payload.Fields, payload.Color)
+}
+
+// saveFailedAlert 将发送失败的告警持久化，等待 retryFailedAlerts 重新发送
+func saveFailedAlert(channel string, payload interface{}, sendErr error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		logrus.Errorf("Failed to marshal failed %s alert: %v", channel, err)
+		return
+	}
+	err = database.InsertFailedAlert(channel, string(data), sendErr.Error())
+	if err != nil {
+		logrus.Errorf("Failed to persist undelivered %s alert: %v", channel, err)
+	}
+}
+
+// retryFailedAlerts 重新发送 failed_alerts 表中保存的告警，成功或永久失败后删除记录
+func retryFailedAlerts(db database.Store) {
+	alerts, err := db.FindFailedAlerts()
+	if err != nil {
+		return
+	}
+
+	for _, alert := range alerts {
+		payload, err := redeliverAlert(alert)
+		if err != nil && bot.IsPermanent(err) {
+			logrus.Errorf("Dropping %s alert %d, redelivery failed permanently, check the %s configuration: %v", alert.Channel, alert.ID, alert.Channel, err)
+			db.DeleteFailedAlert(alert.ID)
+			continue
+		}
+		if err != nil {
+			logrus.Errorf("Failed to redeliver %s alert %d: %v", alert.Channel, alert.ID, err)
+			db.UpdateFailedAlertAttempt(alert.ID, payload, err.Error())
+			continue
+		}
+		logrus.Infof("Redelivered %s alert %d", alert.Channel, alert.ID)
+		db.DeleteFailedAlert(alert.ID)
+	}
+}
+
+// redeliverAlert 重新发送一条告警，失败时返回下次需要重新发送的内容
+func redeliverAlert(alert database.FailedAlert) (string, error) {
+	switch alert.Channel {
+	case channelTelegram:
+		var payload telegramPayload
+		if err := json.Unmarshal([]byte(alert.Payload), &payload); err != nil {
+			return alert.Payload, err
+		}
+		err := deliverTelegram(payload)
+		if err != nil {
+			// 已经送达的 chat 不再重复发送
+			data, marshalErr := json.Marshal(remainingTelegramPayload(payload, err))
+			if marshalErr != nil {
+				return alert.Payload, err
+			}
+			return string(data), err
+		}
+		return alert.Payload, nil
+	case channelLark:
+		var payload larkPayload
+		if err := json.Unmarshal([]byte(alert.Payload), &payload); err != nil {
+			return alert.Payload, err
+		}
+		return alert.Payload, deliverLark(payload)
+	case channelSlack:
+		var payload slackPayload
+		if err := json.Unmarshal([]byte(alert.Payload), &payload); err != nil {
+			return alert.Payload, err
+		}
+		return alert.Payload, deliverSlack(payload)
+	case channelWebhook:
+		var payload webhookPayload
+		if err := json.Unmarshal([]byte(alert.Payload), &payload); err != nil {
+			return alert.Payload, err
+		}
+		return alert.Payload, deliverWebhook(payload)
+	case channelPagerDuty:
+		var payload pagerDutyPayload
+		if err := json.Unmarshal([]byte(alert.Payload), &payload); err != nil {
+			return alert.Payload, err
+		}
+		return alert.Payload, deliverPagerDuty(payload)
+	default:
+		return alert.Payload, fmt.Errorf("unknown alert channel: %s", alert.Channel)
+	}
+}
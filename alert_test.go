@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"meson-monitor/bot"
+	"meson-monitor/database"
+)
+
+// insertMismatchedMeson 插入两边都已记录但金额不一致的 Meson，返回 A 边的交易哈希
+func insertMismatchedMeson(t *testing.T, reqID string) string {
+	meson := database.Meson{
+		ReqID:     reqID,
+		ChainA:    "bsc",
+		Timestamp: time.Now().Unix(),
+		AmountA:   big.NewInt(1000000),
+		ActionA:   "TokenBurnExecuted",
+		TxHashA:   reqID + "-a",
+	}
+	if _, err := database.InsertMeson(meson); err != nil {
+		t.Fatal(err)
+	}
+	meson.ChainB = "eth"
+	meson.AmountB = big.NewInt(900000)
+	meson.ActionB = "TokenMintExecuted"
+	meson.TxHashB = reqID + "-b"
+	if err := database.UpdateMeson(&meson); err != nil {
+		t.Fatal(err)
+	}
+	return meson.TxHashA
+}
+
+// setAlertCooldown 设置告警冷却时间并清空内存中的告警时间，测试结束时恢复
+func setAlertCooldown(t *testing.T, cooldown time.Duration) {
+	previous := alertCooldown
+	alertCooldown = cooldown
+	alertedAtLock.Lock()
+	alertedAt = make(map[string]time.Time)
+	alertedAtLock.Unlock()
+	t.Cleanup(func() {
+		alertCooldown = previous
+	})
+}
+
+func TestDatabaseCheckAlertsOncePerCooldown(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	setAlertCooldown(t, time.Hour)
+	reqID := "cooldown"
+	txHash := insertMismatchedMeson(t, reqID)
+
+	runDatabaseCheck(db, 0)
+	runDatabaseCheck(db, 0)
+
+	if got := recorder.count(txHash); got != 1 {
+		t.Fatalf("sent %d alerts, want 1", got)
+	}
+	meson, err := database.FindMesonByReqID(reqID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meson.LastAlertedAt == nil {
+		t.Error("last_alerted_at not recorded")
+	}
+}
+
+func TestDatabaseCheckUsesStoredAlertTimeAfterRestart(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	setAlertCooldown(t, time.Hour)
+	txHash := insertMismatchedMeson(t, "restart")
+
+	runDatabaseCheck(db, 0)
+	// 进程重启后内存中的记录丢失，按数据库中的 last_alerted_at 去重
+	alertedAtLock.Lock()
+	alertedAt = make(map[string]time.Time)
+	alertedAtLock.Unlock()
+	runDatabaseCheck(db, 0)
+
+	if got := recorder.count(txHash); got != 1 {
+		t.Errorf("sent %d alerts, want 1", got)
+	}
+}
+
+func TestDatabaseCheckAlertsEveryTickWithoutCooldown(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	setAlertCooldown(t, 0)
+	txHash := insertMismatchedMeson(t, "no-cooldown")
+
+	runDatabaseCheck(db, 0)
+	runDatabaseCheck(db, 0)
+
+	if got := recorder.count(txHash); got != 2 {
+		t.Errorf("sent %d alerts, want 2", got)
+	}
+}
+
+// timeoutFailingStore 标记超时总是失败的存储，其他操作使用 Store
+type timeoutFailingStore struct {
+	database.Store
+}
+
+func (timeoutFailingStore) MarkMesonTimedOut(reqID string) error {
+	return errors.New("database is locked")
+}
+
+func TestTimeoutAlertIsSkippedWhenMarkingFails(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	setAlertCooldown(t, 0)
+	reqID := testReqID(testTokenIndex, 1000000, 1700000000)
+	processTestLogs(t, db, &recordingNotifier{}, "bsc", mesonLog(testABI(t), "bsc", actionBurn, reqID, 100, 0))
+
+	checkTimedOutMesons(timeoutFailingStore{db}, 0)
+	if kinds := recorder.Kinds(); len(kinds) != 0 {
+		t.Fatalf("sent %v although the Meson could not be marked as timed out", kinds)
+	}
+
+	// 下次检查标记成功后告警
+	checkTimedOutMesons(db, 0)
+	if kinds := recorder.Kinds(); len(kinds) != 1 || kinds[0] != AlertTimeout {
+		t.Errorf("sent %v, want one %s alert", kinds, AlertTimeout)
+	}
+	if meson := findTestMeson(t, reqID.Hex()); !meson.TimedOut {
+		t.Error("Meson was not marked as timed out")
+	}
+}
+
+func TestDatabaseCheckReadsUncheckedMesonsInBatches(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	setAlertCooldown(t, time.Hour)
+	previous := checkBatchSize
+	checkBatchSize = 2
+	t.Cleanup(func() { checkBatchSize = previous })
+
+	// 0x02 和 0x04 两边一致，检查时标记为完成；按位置分页时，这会使后面的记录被跳过
+	mismatched := []string{"0x01", "0x03", "0x05", "0x06"}
+	for _, reqID := range mismatched {
+		insertMismatchedMeson(t, reqID)
+	}
+	for _, reqID := range []string{"0x02", "0x04"} {
+		insertMismatchedMeson(t, reqID)
+		meson := findTestMeson(t, reqID)
+		meson.AmountB = meson.AmountA
+		if err := database.UpdateMeson(meson); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkUncheckedMesons(db)
+
+	alerted := map[string]bool{}
+	for _, alert := range recorder.Alerts() {
+		alerted[alert.ReqID] = true
+	}
+	if len(recorder.Alerts()) != len(mismatched) {
+		t.Errorf("sent %d alerts, want %d", len(recorder.Alerts()), len(mismatched))
+	}
+	for _, reqID := range mismatched {
+		if !alerted[reqID] {
+			t.Errorf("no alert for %s", reqID)
+		}
+	}
+	for _, reqID := range []string{"0x02", "0x04"} {
+		if meson := findTestMeson(t, reqID); !meson.IsCheck {
+			t.Errorf("%s not marked as checked", reqID)
+		}
+	}
+}
+
+func TestShouldAlertAfterCooldown(t *testing.T) {
+	setAlertCooldown(t, time.Hour)
+	now := time.Now()
+	alerted := now.Add(-2 * time.Hour)
+	if !shouldAlert(database.Meson{ReqID: "0x01", LastAlertedAt: &alerted}, now) {
+		t.Error("alert suppressed after the cooldown elapsed")
+	}
+	alerted = now.Add(-time.Minute)
+	if shouldAlert(database.Meson{ReqID: "0x01", LastAlertedAt: &alerted}, now) {
+		t.Error("alert sent within the cooldown")
+	}
+
+	// 内存中较新的告警时间优先于数据库中较早的记录
+	alerted = now.Add(-2 * time.Hour)
+	alertedAtLock.Lock()
+	alertedAt["0x01"] = now.Add(-time.Minute)
+	alertedAtLock.Unlock()
+	if shouldAlert(database.Meson{ReqID: "0x01", LastAlertedAt: &alerted}, now) {
+		t.Error("alert sent within the cooldown of the in-memory record")
+	}
+}
+
+// waitForAlerts 等待 recorder 收到至少 n 条告警，超时时测试失败
+func waitForAlerts(t *testing.T, recorder *recordingNotifier, n int, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for len(recorder.Alerts()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d alerts within %s, want %d", len(recorder.Alerts()), timeout, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCheckDatabaseRunsImmediatelyAndStopsOnDone(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	setAlertCooldown(t, 0)
+	insertMismatchedMeson(t, "immediate")
+
+	// 间隔为一小时，第一次检查不能等待 ticker
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go checkDatabase(&wg, done, db, time.Hour, 0)
+
+	waitForAlerts(t, recorder, 1, 2*time.Second)
+	close(done)
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("checkDatabase did not return after done was closed")
+	}
+	if got := len(recorder.Alerts()); got != 1 {
+		t.Errorf("ran %d checks within the first interval, want 1", got)
+	}
+}
+
+func TestCheckDatabaseRunsOnEveryTick(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	setAlertCooldown(t, 0)
+	insertMismatchedMeson(t, "every-tick")
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go checkDatabase(&wg, done, db, 20*time.Millisecond, 0)
+	defer wg.Wait()
+	defer close(done)
+
+	waitForAlerts(t, recorder, 3, 2*time.Second)
+}
+
+// pagerDutyReceiver 模拟的 PagerDuty Events API，记录收到的事件，每个请求延迟 delay 后响应
+type pagerDutyReceiver struct {
+	delay time.Duration
+
+	mu     sync.Mutex
+	events []string
+}
+
+// Events 收到的事件，格式为 "event_action dedup_key"
+func (r *pagerDutyReceiver) Events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// usePagerDuty 将 pagerDutyBot 指向 pagerDutyReceiver，测试结束时恢复
+func usePagerDuty(t *testing.T, delay time.Duration) *pagerDutyReceiver {
+	receiver := &pagerDutyReceiver{delay: delay}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event struct {
+			EventAction string `json:"event_action"`
+			DedupKey    string `json:"dedup_key"`
+		}
+		json.NewDecoder(r.Body).Decode(&event)
+		time.Sleep(receiver.delay)
+		receiver.mu.Lock()
+		receiver.events = append(receiver.events, event.EventAction+" "+event.DedupKey)
+		receiver.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+
+	previous := pagerDutyBot
+	pagerDutyBot = &bot.PagerDutyBot{RoutingKey: "test", URL: server.URL, MaxAttempts: 1}
+	t.Cleanup(func() { pagerDutyBot = previous })
+	return receiver
+}
+
+func TestReconciledIncidentIsResolvedOnlyAfterCommit(t *testing.T) {
+	db := useTestDatabase(t)
+	receiver := usePagerDuty(t, 0)
+	parsedABI := testABI(t)
+	reqID := testReqID(testTokenIndex, 1000000, 1700000000)
+
+	// 单边超时告警过，另一边出现后两边一致
+	processTestLogs(t, db, &recordingNotifier{}, "bsc", mesonLog(parsedABI, "bsc", actionBurn, reqID, 100, 0))
+	if err := db.MarkMesonTimedOut(reqID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	mint := mesonLog(parsedABI, "eth", actionMint, reqID, 200, 0)
+
+	// 区间回滚时不解决 incident
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handleLogs(tx, newAlertBuffer(&recordingNotifier{}), "eth", testChainConfig(), parsedABI, []types.Log{mint}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	if events := receiver.Events(); len(events) != 0 {
+		t.Fatalf("PagerDuty received %v before the range was committed", events)
+	}
+
+	processTestLogs(t, db, &recordingNotifier{}, "eth", mint)
+	events := receiver.Events()
+	if len(events) != 1 || events[0] != "resolve "+reqID.Hex() {
+		t.Errorf("PagerDuty received %v, want one resolve for %s", events, reqID.Hex())
+	}
+}
+
+func TestStoppingAlertQueueWaitsForResolves(t *testing.T) {
+	receiver := usePagerDuty(t, 100*time.Millisecond)
+	stop := startAlertQueue(context.Background(), 1)
+
+	// 队列运行时在后台解决，不阻塞调用方
+	start := time.Now()
+	resolveReconciled(database.Meson{ReqID: "0x01", TimedOut: true})
+	if elapsed := time.Since(start); elapsed >= receiver.delay {
+		t.Errorf("resolveReconciled blocked for %s", elapsed)
+	}
+	stop()
+	if events := receiver.Events(); len(events) != 1 || events[0] != "resolve 0x01" {
+		t.Errorf("PagerDuty received %v after the queue stopped, want the resolve for 0x01", events)
+	}
+}
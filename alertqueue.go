@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+)
+
+const (
+	// defaultAlertQueueSize 告警队列的默认容量
+	defaultAlertQueueSize = 256
+	// alertShutdownGrace 收到退出信号后等待进行中的告警发送完成的时间，超过后取消发送
+	alertShutdownGrace = 5 * time.Second
+)
+
+// alertQueue 缓冲待发送的告警，由单独的协程发送，避免 HTTP 请求阻塞事件处理
+// 队列满时丢弃最旧的告警，不阻塞入队方
+type alertQueue struct {
+	alerts  chan Alert
+	dropped atomic.Uint64
+	stop    chan struct{} // 关闭后发送协程发完队列中剩余的告警后退出
+	done    chan struct{} // 发送协程退出后关闭
+
+	// 不经过队列、在后台进行的发送，如解决 PagerDuty incident，停止队列时等待它们完成
+	sendsLock sync.Mutex
+	sends     sync.WaitGroup
+	stopped   bool
+}
+
+// alerts 运行中的告警队列，未启动时为 nil，此时告警同步发送
+var alerts atomic.Pointer[alertQueue]
+
+func newAlertQueue(size int) *alertQueue {
+	if size <= 0 {
+		size = defaultAlertQueueSize
+	}
+	return &alertQueue{
+		alerts: make(chan Alert, size),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// startAlertQueue 创建告警队列并启动发送协程，之后 sendAlert 和事件处理中的告警都只入队
+// ctx 为告警发送使用的上下文，取消后发送协程不再发送，直接退出
+// 返回的函数停止入队，发完队列中剩余的告警后返回，之后的告警同步发送
+func startAlertQueue(ctx context.Context, size int) func() {
+	queue := newAlertQueue(size)
+	go queue.run(ctx, alertFanout{})
+	alerts.Store(queue)
+	logrus.Infof("Alert queue started with capacity %d", cap(queue.alerts))
+
+	return func() {
+		alerts.CompareAndSwap(queue, nil)
+		close(queue.stop)
+		<-queue.done
+		queue.waitSends()
+	}
+}
+
+// goSend 在后台执行 send，队列停止时等待它完成；队列已停止时同步执行
+func (q *alertQueue) goSend(send func()) {
+	q.sendsLock.Lock()
+	if q.stopped {
+		q.sendsLock.Unlock()
+		send()
+		return
+	}
+	q.sends.Add(1)
+	q.sendsLock.Unlock()
+
+	go func() {
+		defer q.sends.Done()
+		send()
+	}()
+}
+
+// waitSends 不再接受后台发送，等待进行中的发送完成
+func (q *alertQueue) waitSends() {
+	q.sendsLock.Lock()
+	q.stopped = true
+	q.sendsLock.Unlock()
+	q.sends.Wait()
+}
+
+// enqueue 将告警放入队列，队列满时丢弃最旧的告警后重试
+func (q *alertQueue) enqueue(alert Alert) {
+	for {
+		select {
+		case q.alerts <- alert:
+			return
+		default:
+		}
+
+		select {
+		case oldest := <-q.alerts:
+			dropped := q.dropped.Add(1)
+			logrus.Warnf("Alert queue is full, dropped oldest %s alert for ReqID %s (%d dropped in total)", oldest.Kind, oldest.ReqID, dropped)
+		default:
+		}
+	}
+}
+
+// run 依次取出告警并通过 notifier 发送，stop 关闭后发完剩余的告警再退出
+// ctx 取消时立即退出，队列中剩余的告警不再发送
+func (q *alertQueue) run(ctx context.Context, notifier Notifier) {
+	defer close(q.done)
+	for {
+		select {
+		case alert := <-q.alerts:
+			if ctx.Err() != nil {
+				q.discard(1)
+				return
+			}
+			sendAlertTo(notifier, alert)
+		case <-q.stop:
+			q.drain(ctx, notifier)
+			return
+		case <-ctx.Done():
+			q.discard(0)
+			return
+		}
+	}
+}
+
+// drain 发送队列中剩余的告警，ctx 取消时丢弃尚未发送的告警
+func (q *alertQueue) drain(ctx context.Context, notifier Notifier) {
+	for {
+		if ctx.Err() != nil {
+			q.discard(0)
+			return
+		}
+		select {
+		case alert := <-q.alerts:
+			sendAlertTo(notifier, alert)
+		default:
+			return
+		}
+	}
+}
+
+// discard 丢弃队列中剩余的告警并记录数量，taken 为已经取出但未发送的告警数
+func (q *alertQueue) discard(taken int) {
+	if n := len(q.alerts) + taken; n > 0 {
+		logrus.Warnf("Dropping %d queued alert(s) that could not be sent before shutdown", n)
+	}
+}
+
+// Name 实现 Notifier，告警只入队，由发送协程实际发送
+func (q *alertQueue) Name() string {
+	return "queue"
+}
+
+// Notify 将告警入队后立即返回，队列已停止时同步发送
+func (q *alertQueue) Notify(alert Alert) error {
+	select {
+	case <-q.stop:
+		return alertFanout{}.Notify(alert)
+	default:
+	}
+	q.enqueue(alert)
+	return nil
+}
+
+// alertNotifier 返回处理事件时使用的 Notifier，告警队列已启动时入队，否则同步发送
+func alertNotifier() Notifier {
+	if queue := alerts.Load(); queue != nil {
+		return queue
+	}
+	return alertFanout{}
+}
+
+// alertBuffer 暂存一个区块区间处理中产生的告警，事务提交成功后由 flush 交给 notifier 发送
+// 区间回滚时直接丢弃，重新处理该区间时会再次产生相同的告警，避免告警与数据库记录不一致
+// 最终一致的跨链同样暂存，提交后才计入完成耗时并解决之前告警对应的 incident
+type alertBuffer struct {
+	notifier Notifier
+	alerts   []Alert
+	settled  []settledMeson
+}
+
+// settledMeson 区间中最终一致的跨链及其完成时间
+type settledMeson struct {
+	meson       database.Meson
+	completedAt time.Time
+}
+
+func newAlertBuffer(notifier Notifier) *alertBuffer {
+	return &alertBuffer{notifier: notifier}
+}
+
+// Name 实现 Notifier，返回实际发送告警的 Notifier 的名称
+func (b *alertBuffer) Name() string {
+	return b.notifier.Name()
+}
+
+// Notify 暂存告警，不发送
+func (b *alertBuffer) Notify(alert Alert) error {
+	b.alerts = append(b.alerts, alert)
+	return nil
+}
+
+// Settled 暂存最终一致的跨链，不计入指标也不解决 incident
+func (b *alertBuffer) Settled(meson database.Meson, completedAt time.Time) {
+	b.settled = append(b.settled, settledMeson{meson: meson, completedAt: completedAt})
+}
+
+// flush 按产生顺序发送暂存的告警，再处理最终一致的跨链，然后清空
+func (b *alertBuffer) flush() {
+	for _, alert := range b.alerts {
+		sendAlertTo(b.notifier, alert)
+	}
+	for _, settled := range b.settled {
+		settleMeson(settled.meson, settled.completedAt)
+	}
+	b.alerts = nil
+	b.settled = nil
+}
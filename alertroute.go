@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"meson-monitor/bot"
+)
+
+// AlertRoute 将指定链的告警发送到单独的渠道，负责不同链的团队只接收自己的链的告警
+// 至少需要配置一个渠道；Telegram 使用 main.botToken 对应的机器人发送到 chatIDs
+type AlertRoute struct {
+	Name        string             `json:"name"`
+	Chains      []string           `json:"chains"`
+	ChatIDs     []bot.TelegramChat `json:"chatIDs"`
+	LarkBotURL  string             `json:"lark_bot"`
+	LarkSecret  string             `json:"lark_secret"`
+	SlackBotURL string             `json:"slack_bot"`
+}
+
+// alertRoute 一个告警路由的渠道，larkBot 和 slackBot 未配置时为 nil
+type alertRoute struct {
+	name     string
+	chains   []string
+	chats    []bot.TelegramChat
+	larkBot  *bot.LarkBot
+	slackBot *bot.SlackBot
+}
+
+var (
+	// alertRoutes 配置的告警路由，按配置顺序排列，为空时所有告警发送到默认渠道
+	alertRoutes []*alertRoute
+	// chainAlertRoutes 每条链对应的告警路由，不在其中的链的告警发送到默认渠道
+	chainAlertRoutes = map[string][]*alertRoute{}
+)
+
+// loadAlertRoutes 解析配置中的告警路由并创建各路由的机器人，名称为空或重复、链名未知或没有配置渠道时报错
+func loadAlertRoutes(config *Config) ([]*alertRoute, error) {
+	var result []*alertRoute
+	names := make(map[string]bool, len(config.Main.AlertRoutes))
+	for i, route := range config.Main.AlertRoutes {
+		if route.Name == "" || strings.Contains(route.Name, ":") {
+			return nil, fmt.Errorf("main.alertRoutes[%d]: name must be non-empty and must not contain ':', got %q", i, route.Name)
+		}
+		if names[route.Name] {
+			return nil, fmt.Errorf("main.alertRoutes[%d]: duplicate name %q", i, route.Name)
+		}
+		names[route.Name] = true
+		if len(route.Chains) == 0 {
+			return nil, fmt.Errorf("main.alertRoutes[%d]: chains must not be empty", i)
+		}
+		for _, chainName := range route.Chains {
+			if _, ok := config.Chains[chainName]; !ok {
+				return nil, fmt.Errorf("main.alertRoutes[%d]: unknown chain %q", i, chainName)
+			}
+		}
+		if len(route.ChatIDs) == 0 && route.LarkBotURL == "" && route.SlackBotURL == "" {
+			return nil, fmt.Errorf("main.alertRoutes[%d]: at least one of chatIDs, lark_bot and slack_bot must be set", i)
+		}
+		if len(route.ChatIDs) > 0 && config.Main.BotToken == "" {
+			return nil, fmt.Errorf("main.alertRoutes[%d]: chatIDs requires main.botToken", i)
+		}
+
+		r := &alertRoute{name: route.Name, chains: route.Chains, chats: route.ChatIDs}
+		if route.LarkBotURL != "" {
+			r.larkBot = bot.NewLarkBot(route.LarkBotURL, route.LarkSecret)
+		}
+		if route.SlackBotURL != "" {
+			r.slackBot = bot.NewSlackBot(route.SlackBotURL)
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// configureBots 设置路由的机器人使用的 HTTP 客户端，maxAttempts 大于 0 时同时设置最大发送次数
+func (r *alertRoute) configureBots(client *http.Client, maxAttempts int) {
+	if r.larkBot != nil {
+		r.larkBot.Client = client
+		if maxAttempts > 0 {
+			r.larkBot.MaxAttempts = maxAttempts
+		}
+	}
+	if r.slackBot != nil {
+		r.slackBot.Client = client
+		if maxAttempts > 0 {
+			r.slackBot.MaxAttempts = maxAttempts
+		}
+	}
+}
+
+// routesByChain 按链汇总告警路由，一条链可以属于多个路由
+func routesByChain(routes []*alertRoute) map[string][]*alertRoute {
+	result := make(map[string][]*alertRoute)
+	for _, route := range routes {
+		for _, chainName := range route.chains {
+			result[chainName] = append(result[chainName], route)
+		}
+	}
+	return result
+}
+
+// findAlertRoute 根据名称查找告警路由，不存在时返回 nil
+func findAlertRoute(name string) *alertRoute {
+	for _, route := range alertRoutes {
+		if route.name == name {
+			return route
+		}
+	}
+	return nil
+}
+
+// notifiers 告警路由已配置的渠道
+func (r *alertRoute) notifiers() []Notifier {
+	var result []Notifier
+	if len(r.chats) > 0 {
+		result = append(result, telegramNotifier{route: r.name})
+	}
+	if r.larkBot != nil {
+		result = append(result, larkNotifier{route: r.name})
+	}
+	if r.slackBot != nil {
+		result = append(result, slackNotifier{route: r.name})
+	}
+	return result
+}
+
+// deliveryName 发送结果和日志中的渠道名称，告警路由的渠道为 "渠道:路由名"，如 "lark:bsc-team"
+func deliveryName(channel, route string) string {
+	if route == "" {
+		return channel
+	}
+	return channel + ":" + route
+}
+
+// routeLabel 日志中附加的告警路由名称，route 为空时返回空字符串
+func routeLabel(route string) string {
+	if route == "" {
+		return ""
+	}
+	return " for alert route " + route
+}
+
+// routedChannel 判断渠道是否参与告警路由，Webhook 和 PagerDuty 总是收到所有告警
+func routedChannel(name string) bool {
+	return name != channelWebhook && name != channelPagerDuty
+}
+
+// alertChains 返回告警涉及的链，按出现顺序去重
+func alertChains(alert Alert) []string {
+	var chains []string
+	seen := make(map[string]bool)
+	add := func(chainName string) {
+		if chainName != "" && !seen[chainName] {
+			seen[chainName] = true
+			chains = append(chains, chainName)
+		}
+	}
+	add(alert.Chain)
+	for _, leg := range alert.Legs {
+		add(leg.Chain)
+	}
+	return chains
+}
+
+// notifiersFor 返回告警需要发送到的渠道
+// 涉及的链配置了告警路由时发送到这些路由的渠道；涉及没有路由的链或不涉及任何链（如限流汇总）时同时发送到默认渠道
+// 跨链两边属于不同路由时两个路由都会收到，同一个路由只发送一次
+func notifiersFor(alert Alert) []Notifier {
+	if len(chainAlertRoutes) == 0 {
+		return notifiers
+	}
+
+	chains := alertChains(alert)
+	useDefault := len(chains) == 0
+	var routed []Notifier
+	seen := make(map[string]bool)
+	for _, chainName := range chains {
+		routes := chainAlertRoutes[chainName]
+		if len(routes) == 0 {
+			useDefault = true
+			continue
+		}
+		for _, route := range routes {
+			if !seen[route.name] {
+				seen[route.name] = true
+				routed = append(routed, route.notifiers()...)
+			}
+		}
+	}
+
+	var result []Notifier
+	for _, notifier := range notifiers {
+		if useDefault || !routedChannel(notifier.Name()) {
+			result = append(result, notifier)
+		}
+	}
+	return append(result, routed...)
+}
+
+// routeChats 告警路由的 Telegram chat，路由不存在时返回 nil
+func routeChats(route string) []bot.TelegramChat {
+	if r := findAlertRoute(route); r != nil {
+		return r.chats
+	}
+	return nil
+}
+
+// routeLarkBot 告警路由的 Lark 机器人，route 为空、路由已从配置中删除或未配置 Lark 时使用默认的 larkBot
+func routeLarkBot(route string) *bot.LarkBot {
+	if r := findAlertRoute(route); r != nil && r.larkBot != nil {
+		return r.larkBot
+	}
+	return larkBot
+}
+
+// routeSlackBot 告警路由的 Slack 机器人，route 为空、路由已从配置中删除或未配置 Slack 时使用默认的 slackBot
+func routeSlackBot(route string) *bot.SlackBot {
+	if r := findAlertRoute(route); r != nil && r.slackBot != nil {
+		return r.slackBot
+	}
+	return slackBot
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// startAPIServer 启动查询 Meson 记录的 HTTP 服务
+// adminToken 不为空时启用暂停/恢复链监听和重新发送告警的管理接口，超时按 serverConfig 设置
+func startAPIServer(ctx context.Context, addr, adminToken string, serverConfig HTTPServerConfig) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mesons", handleListMesons)
+	mux.HandleFunc("/mesons/", handleMesonPath(adminToken))
+	mux.HandleFunc("/mesons/by-tx/", handleGetMesonByTxHash)
+	mux.HandleFunc("/metrics", handleMetrics)
+	mux.HandleFunc("/readyz", handleReady)
+	if adminToken != "" {
+		mux.HandleFunc("/chains/", handleChainControl(adminToken))
+	}
+
+	server := newHTTPServer(addr, mux, serverConfig)
+	logrus.Infof("Starting API server on %s (read timeout %s, write timeout %s, idle timeout %s)", addr, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	})
+	defer stop()
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		logrus.Info("API server stopped")
+		return nil
+	}
+	logrus.Errorf("API server stopped: %v", err)
+	return err
+}
+
+// handleMesonPath 分发 /mesons/ 下的请求：启用管理接口时 /mesons/{reqid}/alert 重新发送告警，其余按 reqID 查询
+func handleMesonPath(adminToken string) http.HandlerFunc {
+	if adminToken == "" {
+		return handleGetMeson
+	}
+	resendAlert := handleResendAlert(adminToken)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/alert") {
+			resendAlert(w, r)
+			return
+		}
+		handleGetMeson(w, r)
+	}
+}
+
+// handleGetMeson 处理 GET /mesons/{reqid}
+func handleGetMeson(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	reqID := strings.TrimPrefix(r.URL.Path, "/mesons/")
+	if reqID == "" || strings.Contains(reqID, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	meson, err := database.FindMesonByReqID(reqID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to query meson")
+		return
+	}
+	if meson == nil {
+		writeError(w, http.StatusNotFound, "meson not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, meson)
+}
+
+// mesonByTxResponse GET /mesons/by-tx/{hash} 的响应
+// MatchedLegs 为交易哈希所在的一边（a 或 b），两边是同一笔交易时同时列出
+type mesonByTxResponse struct {
+	*database.Meson
+	MatchedLegs []string `json:"matchedLegs"`
+}
+
+// handleGetMesonByTxHash 处理 GET /mesons/by-tx/{hash}，按任意一边的交易哈希查询
+func handleGetMesonByTxHash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	hash := strings.TrimPrefix(r.URL.Path, "/mesons/by-tx/")
+	if !isTxHash(hash) {
+		writeError(w, http.StatusBadRequest, "invalid tx hash")
+		return
+	}
+	// 记录中的交易哈希为小写，统一格式后再查询
+	txHash := common.HexToHash(hash).Hex()
+
+	meson, err := database.FindMesonByTxHash(txHash)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to query meson")
+		return
+	}
+	if meson == nil {
+		writeError(w, http.StatusNotFound, "meson not found")
+		return
+	}
+
+	response := mesonByTxResponse{Meson: meson, MatchedLegs: []string{}}
+	if meson.TxHashA == txHash {
+		response.MatchedLegs = append(response.MatchedLegs, "a")
+	}
+	if meson.TxHashB == txHash {
+		response.MatchedLegs = append(response.MatchedLegs, "b")
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// isTxHash 判断是否为 0x 开头的 32 字节十六进制交易哈希
+func isTxHash(value string) bool {
+	b, err := hexutil.Decode(value)
+	return err == nil && len(b) == common.HashLength
+}
+
+// handleListMesons 处理 GET /mesons，支持 checked、chain、from、to、limit、offset 参数
+// 满足条件的总数通过 X-Total-Count 响应头返回
+func handleListMesons(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	filter, err := parseMesonFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	total, err := database.CountMesons(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to count mesons")
+		return
+	}
+
+	mesons, err := database.FindMesons(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to query mesons")
+		return
+	}
+	if mesons == nil {
+		mesons = []database.Meson{}
+	}
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	writeJSON(w, http.StatusOK, mesons)
+}
+
+// parseMesonFilter 从查询参数中解析过滤和分页条件
+func parseMesonFilter(r *http.Request) (database.MesonFilter, error) {
+	query := r.URL.Query()
+	filter := database.MesonFilter{
+		Chain: query.Get("chain"),
+		Limit: defaultPageLimit,
+	}
+
+	if v := query.Get("checked"); v != "" {
+		checked, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid checked: %s", v)
+		}
+		filter.Checked = &checked
+	}
+
+	var err error
+	if filter.From, err = parseInt64Param(query.Get("from"), "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseInt64Param(query.Get("to"), "to"); err != nil {
+		return filter, err
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, fmt.Errorf("invalid limit: %s", v)
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+		filter.Limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("invalid offset: %s", v)
+		}
+		filter.Offset = offset
+	}
+
+	return filter, nil
+}
+
+func parseInt64Param(value, name string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		logrus.Errorf("Failed to encode API response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultAuditMaxSizeMB 单个审计日志文件的默认大小上限
+	defaultAuditMaxSizeMB = 100
+
+	auditFilePrefix   = "events-"
+	auditFileSuffix   = ".jsonl"
+	auditUploadedMark = ".uploaded"
+)
+
+// AuditLogConfig 审计日志配置，将每个解析出的跨链事件追加写入本地 JSON Lines 文件，可选上传到 S3
+// 与可修改的 meson 表无关，只追加不修改；区间被重新处理时同一事件可能出现多次
+type AuditLogConfig struct {
+	// Dir 审计日志目录，为空时不启用
+	Dir string `json:"dir"`
+	// MaxSizeMB 单个文件的大小上限（MB），超过后或跨过 UTC 零点时轮转，为 0 时使用默认值 100
+	MaxSizeMB int `json:"maxSizeMB"`
+	// S3 轮转后的文件上传到的 S3 存储桶，Bucket 为空时只保存在本地
+	S3 S3Config `json:"s3"`
+}
+
+// S3Config S3 上传配置，Endpoint 为空时使用 AWS S3，否则按路径方式访问兼容 S3 的存储（如 MinIO）
+type S3Config struct {
+	Bucket          string `json:"bucket"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint"`
+	Prefix          string `json:"prefix"` // 对象名前缀，如 "bridge-audit/"
+	AccessKeyID     string `json:"accessKeyID"`
+	SecretAccessKey string `json:"secretAccessKey"`
+}
+
+// validate 检查审计日志配置
+func (c AuditLogConfig) validate() error {
+	if c.MaxSizeMB < 0 {
+		return fmt.Errorf("maxSizeMB must not be negative, got %d", c.MaxSizeMB)
+	}
+	if c.S3.Bucket == "" {
+		return nil
+	}
+	if c.Dir == "" {
+		return fmt.Errorf("s3 requires dir to be set")
+	}
+	if c.S3.Region == "" {
+		return fmt.Errorf("s3.region is required when s3.bucket is set")
+	}
+	if c.S3.AccessKeyID == "" || c.S3.SecretAccessKey == "" {
+		return fmt.Errorf("s3.accessKeyID and s3.secretAccessKey are required when s3.bucket is set")
+	}
+	return nil
+}
+
+// auditEvent 审计日志中的一条事件记录
+type auditEvent struct {
+	Chain       string `json:"chain"`
+	ReqID       string `json:"reqId"`
+	Event       string `json:"event"`
+	TokenIndex  uint8  `json:"tokenIndex"`
+	Amount      string `json:"amount"` // 最小单位的整数
+	TxHash      string `json:"txHash"`
+	Address     string `json:"address"`
+	Contract    string `json:"contract"` // 发出事件的合约地址
+	Block       uint64 `json:"block"`
+	LogIndex    uint   `json:"logIndex"`
+	CreatedTime int64  `json:"createdTime"` // reqID 中的创建时间
+	ProcessedAt string `json:"processedAt"` // 处理事件的时间，RFC3339 格式
+}
+
+// AuditSink 审计事件的输出，与 Notifier 类似，由配置决定启用哪些
+type AuditSink interface {
+	Name() string
+	Record(event auditEvent) error
+}
+
+var (
+	// auditSinks 根据配置启用的审计输出，为空时不记录
+	auditSinks     []AuditSink
+	auditSinksLock sync.RWMutex
+)
+
+// recordAuditEvent 将事件写入所有已启用的审计输出，写入失败只记录日志，不影响事件处理
+func recordAuditEvent(event auditEvent) {
+	auditSinksLock.RLock()
+	sinks := auditSinks
+	auditSinksLock.RUnlock()
+
+	for _, sink := range sinks {
+		err := sink.Record(event)
+		if err != nil {
+			logrus.Errorf("Failed to write audit event for ReqID %s to %s: %v", event.ReqID, sink.Name(), err)
+		}
+	}
+}
+
+// auditFile 按大小和日期轮转的审计日志文件
+// 每次启动写入新的文件，不修改已有的文件；轮转后的文件交给 uploader 上传
+type auditFile struct {
+	dir      string
+	maxBytes int64
+	uploader *s3Uploader
+	uploadMu sync.Mutex // 同一时间只有一个协程上传，避免重复上传同一个文件
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedOn string // 当前文件创建时的 UTC 日期
+}
+
+func (a *auditFile) Name() string {
+	return "audit log " + a.dir
+}
+
+// Record 追加一条事件并同步到磁盘，需要时先轮转文件
+func (a *auditFile) Record(event auditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now().UTC()
+	if a.file != nil && (a.size+int64(len(data)) > a.maxBytes || now.Format("20060102") != a.openedOn) {
+		a.rotate()
+	}
+	if a.file == nil {
+		err = a.open(now)
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(data)
+	a.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+// open 创建新的审计日志文件，同名文件已存在时加序号，不会写入已有的文件，调用方需持有锁
+func (a *auditFile) open(now time.Time) error {
+	base := auditFilePrefix + now.Format("20060102T150405.000Z")
+	name := filepath.Join(a.dir, base+auditFileSuffix)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+	for i := 1; os.IsExist(err); i++ {
+		name = filepath.Join(a.dir, fmt.Sprintf("%s-%d%s", base, i, auditFileSuffix))
+		file, err = os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	a.file = file
+	a.size = 0
+	a.openedOn = now.Format("20060102")
+	return nil
+}
+
+// rotate 关闭当前文件，配置了 S3 时在后台上传所有尚未上传的文件，调用方需持有锁
+func (a *auditFile) rotate() {
+	if a.file == nil {
+		return
+	}
+	err := a.file.Close()
+	if err != nil {
+		logrus.Errorf("Failed to close audit log %s: %v", a.file.Name(), err)
+	}
+	logrus.Infof("Rotated audit log %s", a.file.Name())
+	a.file = nil
+	if a.uploader != nil {
+		go a.uploadClosed()
+	}
+}
+
+// close 关闭当前文件，退出前调用
+func (a *auditFile) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+}
+
+// closedFiles 返回目录中已关闭、尚未上传的审计日志文件
+func (a *auditFile) closedFiles() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(a.dir, auditFilePrefix+"*"+auditFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	current := ""
+	if a.file != nil {
+		current = a.file.Name()
+	}
+	a.mu.Unlock()
+
+	var closed []string
+	for _, path := range paths {
+		if path == current {
+			continue
+		}
+		if _, err := os.Stat(path + auditUploadedMark); err == nil {
+			continue
+		}
+		closed = append(closed, path)
+	}
+	sort.Strings(closed)
+	return closed, nil
+}
+
+// uploadClosed 上传所有已关闭、尚未上传的文件，上传成功后写入标记文件，失败的文件在下次轮转或重启后重试
+// 本地文件保留，不会因为上传而删除
+func (a *auditFile) uploadClosed() {
+	a.uploadMu.Lock()
+	defer a.uploadMu.Unlock()
+
+	paths, err := a.closedFiles()
+	if err != nil {
+		logrus.Errorf("Failed to list audit logs in %s: %v", a.dir, err)
+		return
+	}
+	for _, path := range paths {
+		key, err := a.uploader.upload(path)
+		if err != nil {
+			logrus.Errorf("Failed to upload audit log %s: %v", path, err)
+			continue
+		}
+		err = os.WriteFile(path+auditUploadedMark, []byte(key+"\n"), 0644)
+		if err != nil {
+			logrus.Errorf("Failed to mark audit log %s as uploaded: %v", path, err)
+			continue
+		}
+		logrus.Infof("Uploaded audit log %s to s3://%s/%s", path, a.uploader.config.Bucket, key)
+	}
+}
+
+// addAuditSink 启用一个审计输出
+func addAuditSink(sink AuditSink) {
+	auditSinksLock.Lock()
+	defer auditSinksLock.Unlock()
+
+	auditSinks = append(auditSinks[:len(auditSinks):len(auditSinks)], sink)
+}
+
+// removeAuditSink 停用一个审计输出，其他输出保留
+func removeAuditSink(sink AuditSink) {
+	auditSinksLock.Lock()
+	defer auditSinksLock.Unlock()
+
+	var kept []AuditSink
+	for _, s := range auditSinks {
+		if s != sink {
+			kept = append(kept, s)
+		}
+	}
+	auditSinks = kept
+}
+
+// startAuditLog 根据配置启用审计日志，Dir 为空时不启用
+// 目录不存在时自动创建，无法创建时返回错误；配置了 S3 时先在后台上传之前留下的文件
+// 返回的函数停用审计日志并关闭文件
+func startAuditLog(config AuditLogConfig) (func(), error) {
+	if config.Dir == "" {
+		return func() {}, nil
+	}
+	err := os.MkdirAll(config.Dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory %s: %v", config.Dir, err)
+	}
+
+	maxSizeMB := config.MaxSizeMB
+	if maxSizeMB == 0 {
+		maxSizeMB = defaultAuditMaxSizeMB
+	}
+	auditLog := &auditFile{dir: config.Dir, maxBytes: int64(maxSizeMB) << 20}
+	if config.S3.Bucket != "" {
+		auditLog.uploader = newS3Uploader(config.S3)
+		go auditLog.uploadClosed()
+	}
+	addAuditSink(auditLog)
+
+	destination := "local files only"
+	if config.S3.Bucket != "" {
+		destination = "s3://" + config.S3.Bucket + "/" + strings.TrimPrefix(config.S3.Prefix, "/")
+	}
+	logrus.Infof("Writing audit log of processed events to %s (%s)", config.Dir, destination)
+
+	return func() {
+		removeAuditSink(auditLog)
+		auditLog.close()
+	}, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// logBatchWindow 第一个请求到达后等待其他链的请求加入同一批的时间
+	logBatchWindow = 50 * time.Millisecond
+	// logBatchTimeout 发送一批请求的超时时间
+	logBatchTimeout = time.Minute
+	// logBatchRetryAfter 节点拒绝批量请求后单独发送的时间，之后重新尝试合并，节点可能已经升级或更换
+	logBatchRetryAfter = time.Hour
+)
+
+// errBatchRejected 节点不支持批量请求，调用方改为单独发送
+var errBatchRejected = errors.New("JSON-RPC batch rejected by the endpoint")
+
+// logRequest 等待合并发送的一个 eth_getLogs 请求，ctx 为调用方的上下文
+type logRequest struct {
+	ctx       context.Context
+	chainName string
+	query     ethereum.FilterQuery
+	logs      []types.Log
+	err       error
+	done      chan struct{}
+}
+
+// logBatcher 将同一个 RPC 节点上多条链的 eth_getLogs 请求合并为一个 JSON-RPC 批量请求
+// 在 logBatchWindow 内到达的请求一起发送；节点拒绝批量请求后的 logBatchRetryAfter 内不合并，各链改为单独发送
+type logBatcher struct {
+	url string
+
+	mu            sync.Mutex
+	client        *rpc.Client // 第一次发送时连接，所有链共用
+	pending       []*logRequest
+	rejectedUntil time.Time // 节点拒绝批量请求后，在此之前不再合并
+	requests      int64     // 合并发送的请求数
+	trips         int64     // 实际发送的批量请求数
+}
+
+var (
+	logBatchers     = make(map[string]*logBatcher)
+	logBatchersLock sync.Mutex
+)
+
+// sharedLogBatcher 返回 RPC 节点对应的 logBatcher，配置了 batchRequests 且使用同一节点的链共用一个
+func sharedLogBatcher(url string) *logBatcher {
+	logBatchersLock.Lock()
+	defer logBatchersLock.Unlock()
+
+	batcher, ok := logBatchers[url]
+	if !ok {
+		batcher = &logBatcher{url: url}
+		logBatchers[url] = batcher
+	}
+	return batcher
+}
+
+// closeLogBatchers 关闭所有 logBatcher 的 RPC 连接并清空，Run 在监听协程退出后调用
+func closeLogBatchers() {
+	logBatchersLock.Lock()
+	defer logBatchersLock.Unlock()
+
+	for url, batcher := range logBatchers {
+		batcher.close()
+		delete(logBatchers, url)
+	}
+}
+
+// filterLogs 将请求加入当前批次并等待结果，节点不支持批量请求时返回 errBatchRejected
+// ctx 在批次发送前取消时请求从批次中移除，不会再发送
+func (b *logBatcher) filterLogs(ctx context.Context, chainName string, query ethereum.FilterQuery) ([]types.Log, error) {
+	req := &logRequest{ctx: ctx, chainName: chainName, query: query, done: make(chan struct{})}
+
+	b.mu.Lock()
+	if time.Now().Before(b.rejectedUntil) {
+		b.mu.Unlock()
+		return nil, errBatchRejected
+	}
+	b.pending = append(b.pending, req)
+	if len(b.pending) == 1 {
+		time.AfterFunc(logBatchWindow, b.flush)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-req.done:
+		return req.logs, req.err
+	case <-ctx.Done():
+		b.remove(req)
+		return nil, ctx.Err()
+	}
+}
+
+// remove 从当前批次中移除尚未发送的请求，请求已经发送时不做处理
+func (b *logBatcher) remove(req *logRequest) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, pending := range b.pending {
+		if pending == req {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// flush 发送当前批次中的所有请求，并把结果交给各个等待的调用方
+// 调用方已经取消的请求不再发送
+func (b *logBatcher) flush() {
+	b.mu.Lock()
+	var batch []*logRequest
+	for _, req := range b.pending {
+		if req.ctx.Err() != nil {
+			close(req.done)
+			continue
+		}
+		batch = append(batch, req)
+	}
+	b.pending = nil
+	if len(batch) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	client, err := b.connect()
+	b.mu.Unlock()
+	defer func() {
+		for _, req := range batch {
+			close(req.done)
+		}
+	}()
+	if err != nil {
+		for _, req := range batch {
+			req.err = err
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), logBatchTimeout)
+	defer cancel()
+
+	// 只有一个请求时单独发送，没有可以节省的往返
+	if len(batch) == 1 {
+		req := batch[0]
+		req.err = client.CallContext(ctx, &req.logs, "eth_getLogs", filterArg(req.query))
+		return
+	}
+
+	elems := make([]rpc.BatchElem, len(batch))
+	for i, req := range batch {
+		elems[i] = rpc.BatchElem{Method: "eth_getLogs", Args: []interface{}{filterArg(req.query)}, Result: &req.logs}
+	}
+	start := time.Now()
+	err = client.BatchCallContext(ctx, elems)
+	if err != nil {
+		if isBatchRejection(err) {
+			b.reject(err)
+			for _, req := range batch {
+				req.err = errBatchRejected
+			}
+			return
+		}
+		for _, req := range batch {
+			req.err = err
+		}
+		return
+	}
+	for i, req := range batch {
+		req.err = elems[i].Error
+	}
+	b.recordSavings(batch, time.Since(start))
+}
+
+// connect 返回共用的 RPC 连接，尚未连接时建立连接，调用方持有 mu
+func (b *logBatcher) connect() (*rpc.Client, error) {
+	if b.client != nil {
+		return b.client, nil
+	}
+	client, err := rpc.DialContext(context.Background(), b.url)
+	if err != nil {
+		return nil, err
+	}
+	b.client = client
+	return client, nil
+}
+
+// close 关闭共用的 RPC 连接，之后发送时重新连接
+func (b *logBatcher) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client != nil {
+		b.client.Close()
+		b.client = nil
+	}
+}
+
+// reject 记录节点不支持批量请求，之后 logBatchRetryAfter 内的请求由各链单独发送
+func (b *logBatcher) reject(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	logrus.Warnf("RPC endpoint %s rejected a JSON-RPC batch, sending individual eth_getLogs requests for %s: %v", endpointLabel(b.url), logBatchRetryAfter, err)
+	b.rejectedUntil = time.Now().Add(logBatchRetryAfter)
+}
+
+// recordSavings 记录一次批量请求节省的往返次数
+func (b *logBatcher) recordSavings(batch []*logRequest, duration time.Duration) {
+	b.mu.Lock()
+	b.requests += int64(len(batch))
+	b.trips++
+	requests, trips := b.requests, b.trips
+	b.mu.Unlock()
+
+	chains := make([]string, 0, len(batch))
+	for _, req := range batch {
+		chains = append(chains, req.chainName)
+	}
+	sort.Strings(chains)
+	logrus.Infof("Fetched logs for %d requests (%s) from %s in one round trip in %s; %d round trips saved so far",
+		len(batch), strings.Join(chains, ", "), endpointLabel(b.url), duration, requests-trips)
+}
+
+// batchRejectionStatus 表示节点不接受批量请求的 HTTP 状态码：请求格式错误、路径或方法不支持、请求过大和未实现
+var batchRejectionStatus = map[int]bool{
+	http.StatusBadRequest:            true,
+	http.StatusNotFound:              true,
+	http.StatusMethodNotAllowed:      true,
+	http.StatusRequestEntityTooLarge: true,
+	http.StatusUnsupportedMediaType:  true,
+	http.StatusNotImplemented:        true,
+}
+
+// isBatchRejection 判断整个批量请求的错误是否表示节点不支持批量请求
+// 响应不是数组（节点把批量请求当作一个请求，返回了一个错误对象）、batchRejectionStatus 中的 HTTP 状态码，
+// 以及 JSON-RPC 的 Invalid Request（-32600）和 Method not found（-32601）视为不支持；
+// 429 和其他 5xx 是限流或节点暂时不可用，与其他 JSON-RPC 错误、网络错误和超时一样按普通 RPC 错误处理，之后仍合并发送
+func isBatchRejection(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return batchRejectionStatus[httpErr.StatusCode]
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode() == -32600 || rpcErr.ErrorCode() == -32601
+	}
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &typeErr)
+}
+
+// filterArg 将 FilterQuery 转换为 eth_getLogs 的参数，与 ethclient 的格式一致
+func filterArg(query ethereum.FilterQuery) map[string]interface{} {
+	arg := map[string]interface{}{
+		"address": query.Addresses,
+		"topics":  query.Topics,
+	}
+	if query.BlockHash != nil {
+		arg["blockHash"] = *query.BlockHash
+		return arg
+	}
+	arg["fromBlock"] = blockNumberArg(query.FromBlock, "0x0")
+	arg["toBlock"] = blockNumberArg(query.ToBlock, "latest")
+	return arg
+}
+
+// blockNumberArg 将区块号编码为十六进制，为 nil 时返回 fallback
+func blockNumberArg(number *big.Int, fallback string) string {
+	if number == nil {
+		return fallback
+	}
+	return hexutil.EncodeBig(number)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// emptyLogsRPC 对 eth_getLogs 返回空列表的模拟节点
+func emptyLogsRPC(t testing.TB) *mockRPC {
+	return newMockRPC(t, func(method string, params json.RawMessage) (interface{}, error) {
+		if method != "eth_getLogs" {
+			return nil, errors.New("unexpected method " + method)
+		}
+		return []types.Log{}, nil
+	})
+}
+
+// queryFrom 起始区块为 from 的 eth_getLogs 查询
+func queryFrom(from int64) ethereum.FilterQuery {
+	return ethereum.FilterQuery{FromBlock: big.NewInt(from), ToBlock: big.NewInt(from + 9)}
+}
+
+func TestLogBatcherBatchesConcurrentRequests(t *testing.T) {
+	node := emptyLogsRPC(t)
+	batcher := &logBatcher{url: node.URL}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := batcher.filterLogs(context.Background(), "chain", queryFrom(int64(i*100))); err != nil {
+				t.Errorf("filterLogs: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := node.Trips(); got != 1 {
+		t.Errorf("round trips = %d, want 1", got)
+	}
+	if got := len(node.Calls()); got != 3 {
+		t.Errorf("eth_getLogs calls = %d, want 3", got)
+	}
+}
+
+func TestLogBatcherDropsCancelledRequests(t *testing.T) {
+	node := emptyLogsRPC(t)
+	batcher := &logBatcher{url: node.URL}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	var cancelledErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, cancelledErr = batcher.filterLogs(cancelled, "cancelled", queryFrom(100))
+	}()
+	go func() {
+		defer wg.Done()
+		if _, err := batcher.filterLogs(context.Background(), "live", queryFrom(200)); err != nil {
+			t.Errorf("filterLogs: %v", err)
+		}
+	}()
+	// 在批次发送之前取消
+	time.Sleep(logBatchWindow / 5)
+	cancel()
+	wg.Wait()
+
+	if !errors.Is(cancelledErr, context.Canceled) {
+		t.Errorf("cancelled request returned %v, want context.Canceled", cancelledErr)
+	}
+	calls := node.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("eth_getLogs calls = %d, want 1", len(calls))
+	}
+	if !strings.Contains(string(calls[0].Params), `"fromBlock":"0xc8"`) {
+		t.Errorf("sent %s, want only the live request", calls[0].Params)
+	}
+}
+
+func TestLogBatcherSkipsBatchWhenAllCancelled(t *testing.T) {
+	node := emptyLogsRPC(t)
+	batcher := &logBatcher{url: node.URL}
+
+	ctx, cancel := context.WithTimeout(context.Background(), logBatchWindow/5)
+	defer cancel()
+	_, err := batcher.filterLogs(ctx, "cancelled", queryFrom(100))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("filterLogs returned %v, want context.DeadlineExceeded", err)
+	}
+	// 等待批次到期
+	time.Sleep(2 * logBatchWindow)
+
+	if got := node.Trips(); got != 0 {
+		t.Errorf("round trips = %d, want 0", got)
+	}
+}
+
+func TestLogBatcherFlushSkipsRequestCancelledWhilePending(t *testing.T) {
+	node := emptyLogsRPC(t)
+	batcher := &logBatcher{url: node.URL}
+
+	// 请求仍在批次中但调用方已取消，如 filterLogs 尚未来得及移除
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := &logRequest{ctx: ctx, chainName: "cancelled", query: queryFrom(100), done: make(chan struct{})}
+	batcher.pending = []*logRequest{req}
+	batcher.flush()
+
+	select {
+	case <-req.done:
+	default:
+		t.Fatal("cancelled request was not released")
+	}
+	if got := node.Trips(); got != 0 {
+		t.Errorf("round trips = %d, want 0", got)
+	}
+}
+
+// failingBatchRPC 前 failures 个 HTTP 请求用 status 和 body 回复，之后对每个 eth_getLogs 返回空列表
+func failingBatchRPC(t testing.TB, failures int, status int, body string) *httptest.Server {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		failing := requests <= failures
+		mu.Unlock()
+		if failing {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+			return
+		}
+		var calls []struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&calls); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		results := make([]map[string]interface{}, len(calls))
+		for i, call := range calls {
+			results[i] = map[string]interface{}{"jsonrpc": "2.0", "id": call.ID, "result": []types.Log{}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(results)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// filterLogsConcurrently 同时发送两条链的请求，使它们合并为一个批量请求，返回各自的错误
+func filterLogsConcurrently(batcher *logBatcher) []error {
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = batcher.filterLogs(context.Background(), "chain", queryFrom(int64(i*100)))
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestLogBatcherRejection(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		rejected bool
+	}{
+		{"method not allowed", http.StatusMethodNotAllowed, `method not allowed`, true},
+		{"single error object", http.StatusOK, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batch requests are not supported"}}`, true},
+		{"rate limited", http.StatusTooManyRequests, `too many requests`, false},
+		{"bad gateway", http.StatusBadGateway, `bad gateway`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := failingBatchRPC(t, 1, tt.status, tt.body)
+			batcher := &logBatcher{url: server.URL}
+			t.Cleanup(batcher.close)
+
+			for _, err := range filterLogsConcurrently(batcher) {
+				if err == nil {
+					t.Fatal("failed batch returned no error")
+				}
+				if got := errors.Is(err, errBatchRejected); got != tt.rejected {
+					t.Errorf("filterLogs returned %v, rejected = %v, want %v", err, got, tt.rejected)
+				}
+			}
+			// 没有被视为不支持批量请求时，下一批仍然合并发送
+			if !tt.rejected {
+				for _, err := range filterLogsConcurrently(batcher) {
+					if err != nil {
+						t.Errorf("next batch returned %v", err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLogBatcherRetriesBatchAfterRejectionExpires(t *testing.T) {
+	server := failingBatchRPC(t, 1, http.StatusMethodNotAllowed, `method not allowed`)
+	batcher := &logBatcher{url: server.URL}
+	t.Cleanup(batcher.close)
+
+	filterLogsConcurrently(batcher)
+	if _, err := batcher.filterLogs(context.Background(), "chain", queryFrom(0)); !errors.Is(err, errBatchRejected) {
+		t.Fatalf("filterLogs within the rejection window returned %v, want errBatchRejected", err)
+	}
+
+	// 模拟 logBatchRetryAfter 已经过去
+	batcher.mu.Lock()
+	batcher.rejectedUntil = time.Now().Add(-time.Second)
+	batcher.mu.Unlock()
+	for _, err := range filterLogsConcurrently(batcher) {
+		if err != nil {
+			t.Errorf("filterLogs after the rejection expired returned %v", err)
+		}
+	}
+}
+
+func TestCloseLogBatchers(t *testing.T) {
+	node := emptyLogsRPC(t)
+	batcher := sharedLogBatcher(node.URL)
+	t.Cleanup(closeLogBatchers)
+	if _, err := batcher.filterLogs(context.Background(), "chain", queryFrom(0)); err != nil {
+		t.Fatalf("filterLogs: %v", err)
+	}
+
+	closeLogBatchers()
+
+	batcher.mu.Lock()
+	client := batcher.client
+	batcher.mu.Unlock()
+	if client != nil {
+		t.Error("RPC client was not closed")
+	}
+	if sharedLogBatcher(node.URL) == batcher {
+		t.Error("closed logBatcher is still shared")
+	}
+}
+
+// logBatchChains 测量时合并的链数
+const logBatchChains = 4
+
+// benchmarkLatencies 测量时模拟的节点往返时间
+var benchmarkLatencies = []time.Duration{20 * time.Millisecond, 100 * time.Millisecond}
+
+// BenchmarkLogBatcher 比较 logBatchChains 条链的 eth_getLogs 合并为一个批量请求与依次单独发送的耗时
+// 合并发送需要额外等待 logBatchWindow，只有节点往返时间足够长时才更快
+func BenchmarkLogBatcher(b *testing.B) {
+	for _, latency := range benchmarkLatencies {
+		b.Run("batched/"+latency.String(), func(b *testing.B) {
+			node := emptyLogsRPC(b)
+			node.latency = latency
+			batcher := &logBatcher{url: node.URL}
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				var wg sync.WaitGroup
+				for i := 0; i < logBatchChains; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						if _, err := batcher.filterLogs(context.Background(), "chain", queryFrom(int64(i*100))); err != nil {
+							b.Error(err)
+						}
+					}(i)
+				}
+				wg.Wait()
+			}
+		})
+		b.Run("sequential/"+latency.String(), func(b *testing.B) {
+			node := emptyLogsRPC(b)
+			node.latency = latency
+			client, err := rpc.DialContext(context.Background(), node.URL)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer client.Close()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for i := 0; i < logBatchChains; i++ {
+					var logs []types.Log
+					if err := client.CallContext(context.Background(), &logs, "eth_getLogs", filterArg(queryFrom(int64(i*100)))); err != nil {
+						b.Error(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const minBlockStep = 10
+
+// blockStepper 根据 FilterLogs 的结果自适应调整每次查询的区块跨度
+// 查询结果过多或超时时减半，查询成功时逐步增长回最大值
+// maxRange 为 RPC 服务商允许的单次查询区块数上限，与自适应调整无关，始终限制跨度，为 0 时不限制
+type blockStepper struct {
+	chainName string
+	current   uint64
+	max       uint64
+	maxRange  uint64
+	catchUp   uint64 // 追赶模式下的跨度上限，为 0 时不在追赶模式
+}
+
+// newBlockStepper 根据链配置创建 blockStepper，未配置时使用默认的 blockStep
+func newBlockStepper(chainName string, chainConfig ChainConfig) *blockStepper {
+	base := chainConfig.BlockStep
+	if base == 0 {
+		base = blockStep
+	}
+	max := chainConfig.MaxBlockStep
+	if max < base {
+		max = base
+	}
+	return &blockStepper{chainName: chainName, current: base, max: max, maxRange: chainConfig.MaxLogRange}
+}
+
+// step 返回当前的区块跨度，查询区间为 [start, start+step]，包含 step+1 个区块
+// 配置了 maxRange 时跨度不超过 maxRange-1
+func (s *blockStepper) step() uint64 {
+	if s.maxRange > 0 && s.current >= s.maxRange {
+		return s.maxRange - 1
+	}
+	return s.current
+}
+
+// limit 返回当前的跨度上限，追赶模式下为追赶跨度
+func (s *blockStepper) limit() uint64 {
+	if s.catchUp > s.max {
+		return s.catchUp
+	}
+	return s.max
+}
+
+// normalStep 返回正常轮询时的跨度，不受追赶模式影响
+func (s *blockStepper) normalStep() uint64 {
+	step := s.current
+	if step > s.max {
+		step = s.max
+	}
+	if s.maxRange > 0 && step >= s.maxRange {
+		return s.maxRange - 1
+	}
+	return step
+}
+
+// setCatchUp 进入追赶模式时直接使用追赶跨度，仍受 maxRange 限制且出错时减半；catchUp 为 0 时退出并恢复到正常上限
+func (s *blockStepper) setCatchUp(catchUp uint64) {
+	s.catchUp = catchUp
+	if catchUp > s.current {
+		s.set(catchUp)
+	} else if catchUp == 0 && s.current > s.max {
+		s.set(s.max)
+	}
+}
+
+// onSuccess 查询成功后将跨度增长四分之一，不超过最大值
+func (s *blockStepper) onSuccess() {
+	max := s.limit()
+	if s.current >= max {
+		return
+	}
+	next := s.current + s.current/4 + 1
+	if next > max {
+		next = max
+	}
+	s.set(next)
+}
+
+// onError 查询失败时判断是否因区间过大导致，是则将跨度减半
+// 错误信息中带有服务商的区块数上限时，同时将 maxRange 降低到该上限
+func (s *blockStepper) onError(err error) {
+	if !isRangeTooLargeError(err) {
+		return
+	}
+	if limit, ok := providerRangeLimit(err); ok && (s.maxRange == 0 || limit < s.maxRange) {
+		logrus.Warnf("RPC provider for chain %s limits eth_getLogs to %d blocks, lowering maxLogRange from %d", s.chainName, limit, s.maxRange)
+		s.maxRange = limit
+		return
+	}
+	if s.current <= minBlockStep {
+		return
+	}
+	next := s.current / 2
+	if next < minBlockStep {
+		next = minBlockStep
+	}
+	s.set(next)
+}
+
+func (s *blockStepper) set(next uint64) {
+	logrus.Infof("Block step for chain %s changed from %d to %d", s.chainName, s.current, next)
+	s.current = next
+}
+
+// isRangeTooLargeError 判断 FilterLogs 的错误是否由查询区间过大（结果过多或超时）导致
+// 不同 RPC 服务商的错误信息不一致，这里按常见关键字匹配
+func isRangeTooLargeError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, keyword := range []string{
+		"more than",
+		"too many",
+		"limit exceeded",
+		"range is too large",
+		"too wide",
+		"block range",
+		"response size",
+		"timeout",
+		"timed out",
+		"deadline exceeded",
+	} {
+		if strings.Contains(msg, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// providerRangeLimitPatterns 常见 RPC 服务商在区间过大时返回的错误信息中区块数上限的位置
+var providerRangeLimitPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`up to a ([\d,]+)\s*(k?) block range`),                     // "... requests with up to a 2K block range ..."
+	regexp.MustCompile(`limited to a ([\d,]+)\s*(k?) (?:block )?range`),           // "eth_getLogs is limited to a 10,000 range"
+	regexp.MustCompile(`max(?:imum)?(?: block)? range[^\d]{0,10}([\d,]+)\s*(k?)`), // "exceed maximum block range: 5000"
+	regexp.MustCompile(`range too large, max(?:imum)?[^\d]{0,10}([\d,]+)\s*(k?)`), // "block range too large, max 1000"
+	regexp.MustCompile(`over ([\d,]+)\s*(k?) blocks`),                             // "ranges over 10000 blocks are not supported"
+}
+
+// providerRangeLimit 从错误信息中解析服务商允许的单次查询区块数上限
+func providerRangeLimit(err error) (uint64, bool) {
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range providerRangeLimitPatterns {
+		match := pattern.FindStringSubmatch(msg)
+		if match == nil {
+			continue
+		}
+		limit, parseErr := strconv.ParseUint(strings.ReplaceAll(match[1], ",", ""), 10, 64)
+		if parseErr != nil || limit == 0 {
+			continue
+		}
+		if match[2] == "k" {
+			limit *= 1000
+		}
+		if limit < minBlockStep {
+			limit = minBlockStep
+		}
+		return limit, true
+	}
+	return 0, false
+}
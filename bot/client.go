@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// defaultRequestTimeout 单次发送请求的默认超时时间
+const defaultRequestTimeout = 30 * time.Second
+
+// NewHTTPClient 创建机器人发送消息使用的 HTTP 客户端
+// proxyURL 不为空时所有请求经由该代理（支持 http、https 和 socks5），为空时沿用 HTTP_PROXY/HTTPS_PROXY 环境变量
+// timeout 为单次请求的超时时间，为 0 时使用默认值
+func NewHTTPClient(proxyURL string, timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != "" {
+		proxy, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %v", proxyURL, err)
+		}
+		if proxy.Scheme == "" || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q: scheme and host are required", proxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+var (
+	// sendContext 所有机器人发送请求使用的上下文，取消后进行中的请求和重试等待立即结束
+	sendContext     = context.Background()
+	sendContextLock sync.RWMutex
+)
+
+// SetContext 设置所有机器人发送请求使用的上下文，一般由程序的上下文派生
+// 取消后进行中的请求中止并返回错误，不再重试；未设置时使用 context.Background()
+func SetContext(ctx context.Context) {
+	sendContextLock.Lock()
+	defer sendContextLock.Unlock()
+
+	sendContext = ctx
+}
+
+// currentContext 返回 SetContext 设置的上下文
+func currentContext() context.Context {
+	sendContextLock.RLock()
+	defer sendContextLock.RUnlock()
+
+	return sendContext
+}
+
+// requestTimeout 单次请求的超时时间，client 设置了 Timeout 时使用它，否则使用默认值
+func requestTimeout(client *http.Client) time.Duration {
+	if client != nil && client.Timeout > 0 {
+		return client.Timeout
+	}
+	return defaultRequestTimeout
+}
+
+// httpClient 返回 client，为 nil 时使用 http.DefaultClient
+func httpClient(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return http.DefaultClient
+}
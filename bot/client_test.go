@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTransport 记录经过的请求并直接返回 200，不访问网络
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	rt.mu.Lock()
+	rt.requests = append(rt.requests, req)
+	rt.bodies = append(rt.bodies, string(body))
+	rt.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"ok":true}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestBotsUseInjectedClient(t *testing.T) {
+	transport := &recordingTransport{}
+	client := &http.Client{Transport: transport}
+
+	telegram := NewTelegramBot("test-token", []TelegramChat{{ChatID: 100}})
+	telegram.Client = client
+	if err := telegram.SendMessage("hello", "HTML"); err != nil {
+		t.Fatalf("Telegram SendMessage: %v", err)
+	}
+	lark := NewLarkBot("https://lark.example.com/hook", "")
+	lark.Client = client
+	if err := lark.SendCard("title", "red", "content"); err != nil {
+		t.Fatalf("Lark SendCard: %v", err)
+	}
+
+	if len(transport.requests) != 2 {
+		t.Fatalf("transport saw %d requests, want 2", len(transport.requests))
+	}
+	if got := transport.requests[0].URL.String(); got != "https://api.telegram.org/bottest-token/sendMessage" {
+		t.Errorf("Telegram request URL = %s", got)
+	}
+	if !strings.Contains(transport.bodies[0], `"text":"hello"`) {
+		t.Errorf("Telegram request body = %s", transport.bodies[0])
+	}
+	if got := transport.requests[1].URL.String(); got != "https://lark.example.com/hook" {
+		t.Errorf("Lark request URL = %s", got)
+	}
+	for _, req := range transport.requests {
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request %s %s Content-Type %q", req.Method, req.URL, req.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestNewHTTPClientSendsThroughProxy(t *testing.T) {
+	// 代理收到的请求行是完整的目标 URL
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(proxy.Close)
+
+	client, err := NewHTTPClient(proxy.URL, 0)
+	if err != nil {
+		t.Fatalf("NewHTTPClient: %v", err)
+	}
+	bot := NewLarkBot("http://lark.invalid/hook", "")
+	bot.Client = client
+	if err := bot.SendCard("title", "red", "content"); err != nil {
+		t.Fatalf("SendCard through proxy: %v", err)
+	}
+	select {
+	case got := <-proxied:
+		if got != "http://lark.invalid/hook" {
+			t.Errorf("proxy received %s, want the target URL", got)
+		}
+	default:
+		t.Fatal("request did not go through the proxy")
+	}
+}
+
+func TestNewHTTPClientTimeout(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{timeout: 0, want: defaultRequestTimeout},
+		{timeout: -time.Second, want: defaultRequestTimeout},
+		{timeout: 5 * time.Second, want: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		client, err := NewHTTPClient("", tt.timeout)
+		if err != nil {
+			t.Fatalf("NewHTTPClient(%v): %v", tt.timeout, err)
+		}
+		if client.Timeout != tt.want {
+			t.Errorf("NewHTTPClient(%v).Timeout = %v, want %v", tt.timeout, client.Timeout, tt.want)
+		}
+	}
+}
+
+func TestNewHTTPClientRejectsInvalidProxy(t *testing.T) {
+	for _, proxyURL := range []string{"proxy.example.com:8080", "://bad", "http://"} {
+		if _, err := NewHTTPClient(proxyURL, 0); err == nil {
+			t.Errorf("NewHTTPClient(%q) succeeded, want an error", proxyURL)
+		}
+	}
+	for _, proxyURL := range []string{"http://proxy.example.com:8080", "socks5://127.0.0.1:1080"} {
+		if _, err := NewHTTPClient(proxyURL, 0); err != nil {
+			t.Errorf("NewHTTPClient(%q): %v", proxyURL, err)
+		}
+	}
+}
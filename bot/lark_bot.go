@@ -1,29 +1,82 @@
 package bot
 
 import (
-	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
-	"net/http"
 	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
 	"github.com/sirupsen/logrus"
 )
 
 // LarkBot 是一个结构体，包含一个 WebhookURL 字段，用于存储飞书机器人的 Webhook URL。
+// Secret 为机器人的签名密钥，为空时不签名；MaxAttempts 为单条消息的最大发送次数。
+// Client 为发送请求使用的 HTTP 客户端，为 nil 时使用 http.DefaultClient。
 type LarkBot struct {
-	WebhookURL string
+	WebhookURL  string
+	Secret      string
+	MaxAttempts int
+	Client      *http.Client
 }
 
-// NewLarkBot 是一个构造函数，接受一个 webhookURL 参数，并返回一个 LarkBot 指针。
-func NewLarkBot(webhookURL string) *LarkBot {
+// NewLarkBot 是一个构造函数，接受 webhookURL 和可选的签名密钥 secret，并返回一个 LarkBot 指针。
+func NewLarkBot(webhookURL, secret string) *LarkBot {
 	return &LarkBot{
-		WebhookURL: webhookURL,
+		WebhookURL:  webhookURL,
+		Secret:      secret,
+		MaxAttempts: defaultMaxAttempts,
+	}
+}
+
+// sign 在配置了签名密钥时为请求体添加 timestamp 和 sign 字段
+func (bot *LarkBot) sign(data map[string]interface{}) error {
+	if bot.Secret == "" {
+		return nil
+	}
+	timestamp := time.Now().Unix()
+	sign, err := larkSign(bot.Secret, timestamp)
+	if err != nil {
+		return err
+	}
+	data["timestamp"] = strconv.FormatInt(timestamp, 10)
+	data["sign"] = sign
+	return nil
+}
+
+// larkSign 按飞书文档计算签名：以 timestamp + "\n" + secret 为密钥，对空字符串做 HmacSHA256 后 Base64 编码。
+func larkSign(secret string, timestamp int64) (string, error) {
+	stringToSign := strconv.FormatInt(timestamp, 10) + "\n" + secret
+	h := hmac.New(sha256.New, []byte(stringToSign))
+	_, err := h.Write([]byte{})
+	if err != nil {
+		return "", err
 	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
 }
 
 // SendMessage 方法用于向飞书机器人发送消息卡片。它接受 title 和内容参数，并返回一个错误类型的值。
 func (bot *LarkBot) SendMessage(title, time, from, to, txHashFrom, txHashTo string) error {
 	content := fmt.Sprintf("**Time:** %s\n\n**From:** %s\n**To:** %s\n\n**Tx hash (From):** %s\n**Tx hash (To):** %s\n",
 		time, from, to, txHashFrom, txHashTo)
+	return bot.SendCard(title, "", content)
+}
+
+// SendCard 发送一张标题为 title、正文为 lark_md 格式 content 的消息卡片。
+// template 为标题栏的颜色模板，如 red、orange，为空时使用飞书的默认颜色。
+func (bot *LarkBot) SendCard(title, template, content string) error {
+	header := map[string]interface{}{
+		"title": map[string]interface{}{
+			"content": title,
+			"tag":     "plain_text",
+		},
+	}
+	if template != "" {
+		header["template"] = template
+	}
 
 	data := map[string]interface{}{
 		"msg_type": "interactive",
@@ -37,31 +90,25 @@ func (bot *LarkBot) SendMessage(title, time, from, to, txHashFrom, txHashTo stri
 					},
 				},
 			},
-			"header": map[string]interface{}{
-				"title": map[string]interface{}{
-					"content": title,
-					"tag":     "plain_text",
-				},
-			},
+			"header": header,
 		},
 	}
 
-	body, err := json.Marshal(data)
+	err := bot.sign(data)
 	if err != nil {
-		logrus.Errorf("Failed to marshal JSON: %v", err)
+		logrus.Errorf("Failed to sign Lark message: %v", err)
 		return err
 	}
 
-	resp, err := http.Post(bot.WebhookURL, "application/json", bytes.NewBuffer(body))
+	body, err := json.Marshal(data)
 	if err != nil {
-		logrus.Errorf("Failed to send message: %v", err)
+		logrus.Errorf("Failed to marshal JSON: %v", err)
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-		logrus.Error(err)
+	err = postJSONWithRetry(bot.Client, bot.WebhookURL, body, bot.MaxAttempts)
+	if err != nil {
+		logrus.Errorf("Failed to send message: %v", err)
 		return err
 	}
 
@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestLarkSignKnownValue(t *testing.T) {
+	// 期望值由独立的 HMAC-SHA256 实现计算：密钥为 "1599360473\ntest-secret"，消息为空
+	const want = "wSds2BzzFIIGf/WrhUO+NI1q/9j+FRJd3JNHKAq0NZY="
+	got, err := larkSign("test-secret", 1599360473)
+	if err != nil {
+		t.Fatalf("larkSign: %v", err)
+	}
+	if got != want {
+		t.Errorf("larkSign = %s, want %s", got, want)
+	}
+}
+
+// receiveLarkCard 启动接收一张 Lark 消息卡片的服务，返回服务地址和收到的请求体
+func receiveLarkCard(t *testing.T) (string, <-chan map[string]interface{}) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var data map[string]interface{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			t.Errorf("request body is not JSON: %s", body)
+		}
+		received <- data
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, received
+}
+
+func TestLarkSendMessageSignsWithSecret(t *testing.T) {
+	url, received := receiveLarkCard(t)
+	if err := NewLarkBot(url, "test-secret").SendMessage("title", "time", "from", "to", "0xa", "0xb"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	data := <-received
+	timestamp, ok := data["timestamp"].(string)
+	if !ok {
+		t.Fatalf("timestamp missing or not a string: %v", data["timestamp"])
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp %q is not Unix seconds", timestamp)
+	}
+	mac := hmac.New(sha256.New, []byte(timestamp+"\ntest-secret"))
+	want := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if data["sign"] != want {
+		t.Errorf("sign = %v, want %s for timestamp %d", data["sign"], want, seconds)
+	}
+}
+
+func TestLarkSendMessageWithoutSecretIsUnsigned(t *testing.T) {
+	url, received := receiveLarkCard(t)
+	if err := NewLarkBot(url, "").SendMessage("title", "time", "from", "to", "0xa", "0xb"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	data := <-received
+	if _, ok := data["sign"]; ok {
+		t.Error("unsigned bot sent a sign field")
+	}
+	if _, ok := data["timestamp"]; ok {
+		t.Error("unsigned bot sent a timestamp field")
+	}
+}
@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// pagerDutyEventsURL PagerDuty Events API v2 的地址
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDuty 事件的 severity
+const (
+	PagerDutyCritical = "critical"
+	PagerDutyError    = "error"
+	PagerDutyWarning  = "warning"
+	PagerDutyInfo     = "info"
+)
+
+// PagerDutyBot 通过 Events API v2 触发和解决 PagerDuty 事件，同一 DedupKey 的事件归到同一个 incident。
+// URL 为空时使用 PagerDuty 的地址，Client 为 nil 时使用 http.DefaultClient。
+type PagerDutyBot struct {
+	RoutingKey  string
+	URL         string
+	MaxAttempts int
+	Client      *http.Client
+}
+
+// NewPagerDutyBot 是一个构造函数，接受服务集成的 routing key 并返回一个 PagerDutyBot 指针。
+func NewPagerDutyBot(routingKey string) *PagerDutyBot {
+	return &PagerDutyBot{
+		RoutingKey:  routingKey,
+		URL:         pagerDutyEventsURL,
+		MaxAttempts: defaultMaxAttempts,
+	}
+}
+
+// PagerDutyEvent 触发 incident 的内容，Severity 为 critical、error、warning 或 info
+type PagerDutyEvent struct {
+	DedupKey      string
+	Summary       string
+	Source        string
+	Severity      string
+	CustomDetails interface{}
+}
+
+// pagerDutyRequest Events API v2 的请求体，解决事件时只需要 routing_key、event_action 和 dedup_key
+type pagerDutyRequest struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string      `json:"summary"`
+	Source        string      `json:"source"`
+	Severity      string      `json:"severity"`
+	CustomDetails interface{} `json:"custom_details,omitempty"`
+}
+
+// TriggerBody 生成触发事件的请求体，summary 超过 PagerDuty 的 1024 字符上限时截断
+func (bot *PagerDutyBot) TriggerBody(event PagerDutyEvent) ([]byte, error) {
+	summary := event.Summary
+	if len(summary) > 1024 {
+		summary = summary[:1021] + "..."
+	}
+	return json.Marshal(pagerDutyRequest{
+		RoutingKey:  bot.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    event.DedupKey,
+		Payload: &pagerDutyPayload{
+			Summary:       summary,
+			Source:        event.Source,
+			Severity:      event.Severity,
+			CustomDetails: event.CustomDetails,
+		},
+	})
+}
+
+// ResolveBody 生成解决 dedupKey 对应 incident 的请求体，incident 不存在时 PagerDuty 直接忽略
+func (bot *PagerDutyBot) ResolveBody(dedupKey string) ([]byte, error) {
+	return json.Marshal(pagerDutyRequest{
+		RoutingKey:  bot.RoutingKey,
+		EventAction: "resolve",
+		DedupKey:    dedupKey,
+	})
+}
+
+// Post 将已生成的请求体发送到 Events API，也用于重新发送保存的失败事件
+func (bot *PagerDutyBot) Post(body []byte) error {
+	url := bot.URL
+	if url == "" {
+		url = pagerDutyEventsURL
+	}
+	err := postJSONWithRetry(bot.Client, url, body, bot.MaxAttempts)
+	if err != nil {
+		logrus.Errorf("Failed to send PagerDuty event: %v", err)
+		return err
+	}
+
+	logrus.Infof("PagerDuty event sent successfully")
+	return nil
+}
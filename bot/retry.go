@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMaxAttempts = 3
+	retryBaseDelay     = 1 * time.Second
+	retryMaxDelay      = 30 * time.Second
+
+	// maxErrorBodyBytes 错误信息中保留的响应体长度上限
+	maxErrorBodyBytes = 512
+)
+
+// retryableError 表示一次可以重试的发送失败，RetryAfter 为服务端要求的等待时间
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+// PermanentError 表示重新发送也不会成功的失败，如 token 无效、chat 不存在或 Webhook 已失效，需要修改配置
+// 401、403、404 和 410 状态码返回 PermanentError，Body 为截断后的响应体
+type PermanentError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("permanent failure, status code %d: %s", e.StatusCode, e.Body)
+}
+
+// IsPermanent 判断发送失败是否不应再重试
+// 向多个 chat 发送时，只有所有失败的 chat 都是永久失败才返回 true
+func IsPermanent(err error) bool {
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		for _, failed := range sendErr.Failed {
+			if !IsPermanent(failed.Err) {
+				return false
+			}
+		}
+		return len(sendErr.Failed) > 0
+	}
+	var permanentErr *PermanentError
+	return errors.As(err, &permanentErr)
+}
+
+// isPermanentStatus 判断状态码是否表示配置错误，重试不会成功
+func isPermanentStatus(code int) bool {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+// truncateBody 将响应体截断到 maxErrorBodyBytes，用于错误信息
+func truncateBody(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if len(text) > maxErrorBodyBytes {
+		return text[:maxErrorBodyBytes] + "...(truncated)"
+	}
+	return text
+}
+
+// telegramErrorResponse Telegram 接口返回的错误结构
+type telegramErrorResponse struct {
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// postJSON 通过 client 发送一次 JSON POST 请求，headers 为附加的请求头，client 为 nil 时使用 http.DefaultClient
+// 请求使用 ctx 派生的上下文，超过 requestTimeout 或 ctx 被取消时中止
+// 网络错误、429 和 5xx 状态码返回 retryableError，401、403、404 和 410 返回 PermanentError，其余非 2xx 状态码直接返回错误
+// 非 2xx 时错误信息中包含截断后的响应体，通常说明了失败的原因
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, headers map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout(client))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient(client).Do(req)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if isPermanentStatus(resp.StatusCode) {
+		return &PermanentError{StatusCode: resp.StatusCode, Body: truncateBody(respBody)}
+	}
+	err = fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, truncateBody(respBody))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// Slack 等服务通过 Retry-After 响应头返回等待秒数，Telegram 放在响应体的 parameters.retry_after 中
+		var tgErr telegramErrorResponse
+		var retryAfter time.Duration
+		if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		} else if json.Unmarshal(respBody, &tgErr) == nil && tgErr.Parameters.RetryAfter > 0 {
+			retryAfter = time.Duration(tgErr.Parameters.RetryAfter) * time.Second
+		}
+		return &retryableError{err: err, retryAfter: retryAfter}
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &retryableError{err: err}
+	}
+	return err
+}
+
+// postJSONWithRetry 发送 JSON POST 请求，失败时按指数退避加随机抖动重试，最多尝试 maxAttempts 次
+// 如果服务端返回了 Retry-After 或 retry_after，则至少等待该时长
+func postJSONWithRetry(client *http.Client, url string, body []byte, maxAttempts int) error {
+	return postWithRetry(client, url, body, nil, maxAttempts)
+}
+
+// postWithRetry 同 postJSONWithRetry，每个请求附加 headers 中的请求头
+// SetContext 设置的上下文被取消时不再重试，立即返回
+func postWithRetry(client *http.Client, url string, body []byte, headers map[string]string, maxAttempts int) error {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	ctx := currentContext()
+	delay := retryBaseDelay
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = postJSON(ctx, client, url, body, headers)
+		if err == nil {
+			return nil
+		}
+
+		retryErr, ok := err.(*retryableError)
+		if !ok || attempt == maxAttempts || ctx.Err() != nil {
+			break
+		}
+
+		wait := delay + time.Duration(rand.Int63n(int64(delay)))
+		if retryErr.retryAfter > wait {
+			wait = retryErr.retryAfter
+		}
+		logrus.Warnf("Send attempt %d/%d failed: %v. Retrying in %s...", attempt, maxAttempts, err, wait)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+	return err
+}
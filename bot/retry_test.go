@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statusServer 返回固定状态码和响应体的服务
+func statusServer(t *testing.T, status int, body string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestPostJSONClassifiesStatusCodes(t *testing.T) {
+	tests := []struct {
+		status        int
+		wantPermanent bool
+		wantRetryable bool
+	}{
+		{status: http.StatusUnauthorized, wantPermanent: true},
+		{status: http.StatusForbidden, wantPermanent: true},
+		{status: http.StatusNotFound, wantPermanent: true},
+		{status: http.StatusGone, wantPermanent: true},
+		{status: http.StatusTooManyRequests, wantRetryable: true},
+		{status: http.StatusBadGateway, wantRetryable: true},
+		{status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			url := statusServer(t, tt.status, `{"description":"chat not found"}`)
+			err := postJSON(context.Background(), nil, url, []byte(`{}`), nil)
+			if err == nil {
+				t.Fatal("postJSON succeeded")
+			}
+			// 错误信息中带有响应体，说明失败原因
+			if !strings.Contains(err.Error(), "chat not found") {
+				t.Errorf("error %q does not include the response body", err)
+			}
+			if IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("IsPermanent = %v, want %v", IsPermanent(err), tt.wantPermanent)
+			}
+			var retryErr *retryableError
+			if errors.As(err, &retryErr) != tt.wantRetryable {
+				t.Errorf("retryable = %v, want %v", !tt.wantRetryable, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestPostWithRetryStopsOnPermanentError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	if err := postWithRetry(nil, server.URL, []byte(`{}`), nil, 3); !IsPermanent(err) {
+		t.Fatalf("postWithRetry error = %v, want a permanent error", err)
+	}
+	if requests != 1 {
+		t.Errorf("sent %d requests, want 1", requests)
+	}
+}
+
+func TestPostWithRetryStopsWhenContextIsCancelled(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	SetContext(ctx)
+	t.Cleanup(func() { SetContext(context.Background()) })
+	cancel()
+
+	// 上下文已取消，第一次失败后不再等待重试
+	start := time.Now()
+	if err := postWithRetry(nil, server.URL, []byte(`{}`), nil, 3); err == nil {
+		t.Fatal("postWithRetry succeeded")
+	}
+	if elapsed := time.Since(start); elapsed >= retryBaseDelay {
+		t.Errorf("postWithRetry returned after %s, want before the first retry delay %s", elapsed, retryBaseDelay)
+	}
+	if requests > 1 {
+		t.Errorf("sent %d requests, want at most 1", requests)
+	}
+}
+
+func TestPostJSONAbortsWhenContextIsCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err := postJSON(ctx, nil, server.URL, []byte(`{}`), nil)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("postJSON error = %v, want one caused by %v", err, context.Canceled)
+	}
+}
+
+func TestTruncateBody(t *testing.T) {
+	long := strings.Repeat("x", maxErrorBodyBytes+10)
+	if got := truncateBody([]byte(long)); got != long[:maxErrorBodyBytes]+"...(truncated)" {
+		t.Errorf("truncateBody kept %d bytes, want %d", len(got), maxErrorBodyBytes)
+	}
+	if got := truncateBody([]byte("  short \n")); got != "short" {
+		t.Errorf("truncateBody = %q, want %q", got, "short")
+	}
+}
+
+func TestIsPermanentRequiresEveryChatToFailPermanently(t *testing.T) {
+	permanent := &PermanentError{StatusCode: http.StatusForbidden}
+	transient := errors.New("connection reset by peer")
+
+	if !IsPermanent(&SendError{Failed: []ChatError{{Chat: TelegramChat{ChatID: 1}, Err: permanent}}}) {
+		t.Error("IsPermanent = false when every chat failed permanently")
+	}
+	mixed := &SendError{Failed: []ChatError{
+		{Chat: TelegramChat{ChatID: 1}, Err: permanent},
+		{Chat: TelegramChat{ChatID: 2}, Err: transient},
+	}}
+	if IsPermanent(mixed) {
+		t.Error("IsPermanent = true while one chat failed transiently")
+	}
+}
@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SlackBot 通过 Incoming Webhook 向 Slack 发送消息，MaxAttempts 为单条消息的最大发送次数。
+// Client 为发送请求使用的 HTTP 客户端，为 nil 时使用 http.DefaultClient。
+type SlackBot struct {
+	WebhookURL  string
+	MaxAttempts int
+	Client      *http.Client
+}
+
+// NewSlackBot 是一个构造函数，接受 Slack Incoming Webhook 地址并返回一个 SlackBot 指针。
+func NewSlackBot(webhookURL string) *SlackBot {
+	return &SlackBot{
+		WebhookURL:  webhookURL,
+		MaxAttempts: defaultMaxAttempts,
+	}
+}
+
+// SlackField 消息中的一个字段，Value 使用 Slack mrkdwn 格式
+type SlackField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SendFields 使用 Block Kit 发送消息，fields 以 section 字段的形式展示。
+// color 不为空时消息内容放在该颜色的附件中，如 "#E01E5A"。
+func (bot *SlackBot) SendFields(title, time string, fields []SlackField, color string) error {
+	sectionFields := make([]map[string]interface{}, 0, len(fields))
+	for _, field := range fields {
+		sectionFields = append(sectionFields, slackField(field.Name, field.Value))
+	}
+
+	blocks := []map[string]interface{}{
+		{
+			"type": "header",
+			"text": map[string]interface{}{
+				"type": "plain_text",
+				"text": title,
+			},
+		},
+		{
+			"type":   "section",
+			"fields": sectionFields,
+		},
+		{
+			"type": "context",
+			"elements": []map[string]interface{}{
+				{
+					"type": "mrkdwn",
+					"text": fmt.Sprintf("*Time:* %s", time),
+				},
+			},
+		},
+	}
+
+	// text 用于通知预览，不支持 blocks 的客户端也会显示
+	data := map[string]interface{}{
+		"text": title,
+	}
+	if color != "" {
+		data["attachments"] = []map[string]interface{}{
+			{
+				"color":  color,
+				"blocks": blocks,
+			},
+		}
+	} else {
+		data["blocks"] = blocks
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		logrus.Errorf("Failed to marshal JSON: %v", err)
+		return err
+	}
+
+	err = postJSONWithRetry(bot.Client, bot.WebhookURL, body, bot.MaxAttempts)
+	if err != nil {
+		logrus.Errorf("Failed to send Slack message: %v", err)
+		return err
+	}
+
+	logrus.Infof("Slack message sent successfully: %s", title)
+	return nil
+}
+
+// slackField 构建 section 中的一个 mrkdwn 字段，值为空时显示 "-"
+func slackField(name, value string) map[string]interface{} {
+	if value == "" {
+		value = "-"
+	}
+	return map[string]interface{}{
+		"type": "mrkdwn",
+		"text": fmt.Sprintf("*%s*\n%s", name, value),
+	}
+}
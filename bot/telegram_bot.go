@@ -1,44 +1,146 @@
 package bot
 
 import (
-	"bytes"
 	"encoding/json"
-	"net/http"
 	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
 type TelegramBot struct {
-	Token   string
-	ChatIDs []int64
+	Token       string
+	ChatIDs     []TelegramChat
+	MaxAttempts int          // 单条消息的最大发送次数
+	Client      *http.Client // 发送请求使用的 HTTP 客户端，为 nil 时使用 http.DefaultClient
+}
+
+// TelegramChat 接收消息的 chat，ThreadID 不为 0 时发送到群组中的指定话题
+// 配置中既可以写成 {"chatID": -1001, "messageThreadID": 42}，也可以只写 chat ID 数字
+type TelegramChat struct {
+	ChatID   int64 `json:"chatID"`
+	ThreadID int64 `json:"messageThreadID,omitempty"`
+}
+
+// UnmarshalJSON 兼容旧配置中只写 chat ID 数字的格式
+func (c *TelegramChat) UnmarshalJSON(data []byte) error {
+	var chatID int64
+	if err := json.Unmarshal(data, &chatID); err == nil {
+		*c = TelegramChat{ChatID: chatID}
+		return nil
+	}
+
+	type plain TelegramChat
+	var chat plain
+	if err := json.Unmarshal(data, &chat); err != nil {
+		return fmt.Errorf("chat must be a chat ID or {\"chatID\", \"messageThreadID\"}: %v", err)
+	}
+	*c = TelegramChat(chat)
+	return nil
 }
 
-func NewTelegramBot(token string, chatIDs []int64) *TelegramBot {
+func (c TelegramChat) String() string {
+	if c.ThreadID != 0 {
+		return fmt.Sprintf("%d (thread %d)", c.ChatID, c.ThreadID)
+	}
+	return fmt.Sprintf("%d", c.ChatID)
+}
+
+// InlineButton Telegram 消息下方的链接按钮，点击后打开 URL
+type InlineButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// ChatError 单个 chat 的发送失败
+type ChatError struct {
+	Chat TelegramChat
+	Err  error
+}
+
+// SendError 向多个 chat ID 发送时的部分或全部失败，按 ChatIDs 中的顺序记录失败的 chat ID
+type SendError struct {
+	Failed []ChatError
+}
+
+func (e *SendError) Error() string {
+	parts := make([]string, 0, len(e.Failed))
+	for _, failed := range e.Failed {
+		parts = append(parts, fmt.Sprintf("chat ID %s: %v", failed.Chat, failed.Err))
+	}
+	return fmt.Sprintf("failed to send to %d chat(s): %s", len(e.Failed), strings.Join(parts, "; "))
+}
+
+// FailedChatIDs 返回发送失败的 chat
+func (e *SendError) FailedChatIDs() []TelegramChat {
+	chats := make([]TelegramChat, 0, len(e.Failed))
+	for _, failed := range e.Failed {
+		chats = append(chats, failed.Chat)
+	}
+	return chats
+}
+
+// RetryableChatIDs 返回发送失败且可以重试的 chat，用于只向这些 chat 重新发送
+// 永久失败的 chat（如 chat 不存在或 bot 被移出）不包含在内
+func (e *SendError) RetryableChatIDs() []TelegramChat {
+	chats := make([]TelegramChat, 0, len(e.Failed))
+	for _, failed := range e.Failed {
+		if !IsPermanent(failed.Err) {
+			chats = append(chats, failed.Chat)
+		}
+	}
+	return chats
+}
+
+func NewTelegramBot(token string, chatIDs []TelegramChat) *TelegramBot {
 	return &TelegramBot{
-		Token:   token,
-		ChatIDs: chatIDs,
+		Token:       token,
+		ChatIDs:     chatIDs,
+		MaxAttempts: defaultMaxAttempts,
 	}
 }
 
+// SendMessage 向所有配置的 chat ID 发送消息
 func (bot *TelegramBot) SendMessage(message, parseMode string) error {
-	for _, chatID := range bot.ChatIDs {
-		err := bot.sendToChatID(chatID, message, parseMode)
+	return bot.SendMessageTo(bot.ChatIDs, message, parseMode)
+}
+
+// SendMessageTo 向指定的 chat ID 发送消息，某个 chat 失败时继续发送其余 chat
+// 存在失败时返回 *SendError，其中列出失败的 chat ID
+func (bot *TelegramBot) SendMessageTo(chatIDs []TelegramChat, message, parseMode string) error {
+	return bot.SendMessageWithKeyboard(chatIDs, message, parseMode, nil)
+}
+
+// SendMessageWithKeyboard 与 SendMessageTo 相同，消息下方附带按行排列的链接按钮，keyboard 为空时不附带
+func (bot *TelegramBot) SendMessageWithKeyboard(chatIDs []TelegramChat, message, parseMode string, keyboard [][]InlineButton) error {
+	var sendErr SendError
+	for _, chat := range chatIDs {
+		err := bot.sendToChatID(chat, message, parseMode, keyboard)
 		if err != nil {
-			logrus.Errorf("Failed to send message to chat ID %d: %v", chatID, err)
-			return err
+			logrus.Errorf("Failed to send message to chat ID %s: %v", chat, err)
+			sendErr.Failed = append(sendErr.Failed, ChatError{Chat: chat, Err: err})
 		}
 	}
+	if len(sendErr.Failed) > 0 {
+		return &sendErr
+	}
 	return nil
 }
 
-func (bot *TelegramBot) sendToChatID(chatID int64, message, parseMode string) error {
+func (bot *TelegramBot) sendToChatID(chat TelegramChat, message, parseMode string, keyboard [][]InlineButton) error {
 	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", bot.Token)
 	data := map[string]interface{}{
-		"chat_id":    chatID,
+		"chat_id":    chat.ChatID,
 		"text":       message,
 		"parse_mode": parseMode,
 	}
+	if chat.ThreadID != 0 {
+		data["message_thread_id"] = chat.ThreadID
+	}
+	if len(keyboard) > 0 {
+		data["reply_markup"] = map[string]interface{}{"inline_keyboard": keyboard}
+	}
 
 	body, err := json.Marshal(data)
 	if err != nil {
@@ -46,19 +148,12 @@ func (bot *TelegramBot) sendToChatID(chatID int64, message, parseMode string) er
 		return err
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(body))
+	err = postJSONWithRetry(bot.Client, url, body, bot.MaxAttempts)
 	if err != nil {
 		logrus.Errorf("Failed to send message: %v", err)
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-		logrus.Error(err)
-		return err
-	}
 
-	logrus.Infof("Message sent successfully to chat ID %d", chatID)
+	logrus.Infof("Message sent successfully to chat ID %s", chat)
 	return nil
 }
@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WebhookBot 向任意地址 POST JSON 消息，用于接入自建的告警系统
+// Headers 为每个请求附加的请求头（如鉴权 token），Template 不为 nil 时使用模板渲染请求体
+// Client 为发送请求使用的 HTTP 客户端，为 nil 时使用 http.DefaultClient
+type WebhookBot struct {
+	URL         string
+	Headers     map[string]string
+	Template    *template.Template
+	MaxAttempts int
+	Client      *http.Client
+}
+
+// NewWebhookBot 是一个构造函数，接受 Webhook 地址、请求头和请求体模板并返回一个 WebhookBot 指针。
+// tmpl 为空时直接以 JSON 发送数据，模板无法解析时返回错误
+func NewWebhookBot(url string, headers map[string]string, tmpl string) (*WebhookBot, error) {
+	parsed, err := ParseWebhookTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookBot{
+		URL:         url,
+		Headers:     headers,
+		Template:    parsed,
+		MaxAttempts: defaultMaxAttempts,
+	}, nil
+}
+
+// ParseWebhookTemplate 解析 Go text/template 格式的请求体模板，tmpl 为空时返回 nil
+// 模板中可以使用 json 函数输出 JSON 编码的值，如 {"text": {{json .Title}}}
+func ParseWebhookTemplate(tmpl string) (*template.Template, error) {
+	if tmpl == "" {
+		return nil, nil
+	}
+	parsed, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %v", err)
+	}
+	return parsed, nil
+}
+
+// Render 生成请求体：配置了模板时用 data 渲染模板，渲染结果必须是合法的 JSON；否则直接将 data 序列化为 JSON
+func (bot *WebhookBot) Render(data interface{}) ([]byte, error) {
+	if bot.Template == nil {
+		return json.Marshal(data)
+	}
+	var buf bytes.Buffer
+	err := bot.Template.Execute(&buf, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render webhook template: %v", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("webhook template did not produce valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+// Send 将 data 渲染后 POST 到 Webhook 地址
+func (bot *WebhookBot) Send(data interface{}) error {
+	body, err := bot.Render(data)
+	if err != nil {
+		logrus.Errorf("Failed to build webhook body: %v", err)
+		return err
+	}
+	return bot.Post(body)
+}
+
+// Post 将已渲染的请求体 POST 到 Webhook 地址，用于重新发送保存的失败告警
+func (bot *WebhookBot) Post(body []byte) error {
+	err := postWithRetry(bot.Client, bot.URL, body, bot.Headers, bot.MaxAttempts)
+	if err != nil {
+		logrus.Errorf("Failed to send webhook message: %v", err)
+		return err
+	}
+
+	logrus.Infof("Webhook message sent successfully")
+	return nil
+}
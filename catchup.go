@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// catchUpExitRanges 距离确认高度不超过多少个正常跨度时退出追赶模式
+const catchUpExitRanges = 3
+
+// catchUpMode 轮询模式下落后较多时的追赶模式：查询之间不等待，使用更大的区块跨度，追到确认高度附近后恢复正常轮询
+type catchUpMode struct {
+	chainName string
+	threshold uint64 // 落后超过该区块数时进入追赶模式，为 0 时不启用
+	step      uint64 // 追赶模式下的区块跨度上限
+	active    bool
+}
+
+// newCatchUpMode 根据链配置创建追赶模式，未配置 catchUpBlockStep 时使用正常跨度上限的 4 倍
+func newCatchUpMode(chainName string, chainConfig ChainConfig, stepper *blockStepper) *catchUpMode {
+	step := chainConfig.CatchUpBlockStep
+	if step == 0 {
+		step = stepper.max * 4
+	}
+	return &catchUpMode{chainName: chainName, threshold: chainConfig.CatchUpThreshold, step: step}
+}
+
+// update 根据下一个待处理区块落后确认高度的区块数进入或退出追赶模式，并相应调整 stepper 的跨度上限
+// 落后超过 threshold 时进入，落后不超过 catchUpExitRanges 个正常跨度时退出
+func (m *catchUpMode) update(behind uint64, stepper *blockStepper) {
+	if m.threshold == 0 {
+		return
+	}
+	switch {
+	case !m.active && behind > m.threshold:
+		m.active = true
+		logrus.Infof("Chain %s is %d blocks behind, entering catch-up mode (block step up to %d, no wait between ranges)", m.chainName, behind, m.step)
+		stepper.setCatchUp(m.step)
+	case m.active && behind <= catchUpExitRanges*stepper.normalStep():
+		m.active = false
+		logrus.Infof("Chain %s is %d blocks behind, leaving catch-up mode", m.chainName, behind)
+		stepper.setCatchUp(0)
+	default:
+		return
+	}
+	markCatchingUp(m.chainName, m.active)
+}
+
+var (
+	catchingUp     = make(map[string]bool)
+	catchingUpLock sync.Mutex
+)
+
+// markCatchingUp 记录链是否处于追赶模式，用于 /metrics
+func markCatchingUp(chainName string, active bool) {
+	catchingUpLock.Lock()
+	defer catchingUpLock.Unlock()
+	catchingUp[chainName] = active
+}
+
+// writeCatchUpMetrics 输出各链是否处于追赶模式，只包含进入过追赶模式的链
+func writeCatchUpMetrics(w io.Writer) {
+	catchingUpLock.Lock()
+	defer catchingUpLock.Unlock()
+	if len(catchingUp) == 0 {
+		return
+	}
+
+	chainNames := make([]string, 0, len(catchingUp))
+	for chainName := range catchingUp {
+		chainNames = append(chainNames, chainName)
+	}
+	sort.Strings(chainNames)
+
+	fmt.Fprintln(w, "# HELP bridge_chain_catching_up Whether the chain listener is in catch-up mode (1) or polling normally (0).")
+	fmt.Fprintln(w, "# TYPE bridge_chain_catching_up gauge")
+	for _, chainName := range chainNames {
+		value := 0
+		if catchingUp[chainName] {
+			value = 1
+		}
+		fmt.Fprintf(w, "bridge_chain_catching_up{chain=%q} %d\n", chainName, value)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+	"meson-monitor/reqid"
+)
+
+// runCommand 执行命令行子命令
+func runCommand(config *Config, db database.Store, name string, args []string) error {
+	switch name {
+	case "backfill":
+		return runBackfill(config, db, args)
+	case "verify":
+		return runVerify(args)
+	case "export":
+		return runExport(args)
+	default:
+		return fmt.Errorf("unknown command: %s", name)
+	}
+}
+
+// dialAny 按顺序尝试连接 RPC 节点，返回第一个连接成功的客户端
+func dialAny(chainName string, urls []string) (*rpcClient, error) {
+	var lastErr error
+	for _, url := range urls {
+		client, err := dialRPC(chainName, url)
+		if err == nil {
+			return client, nil
+		}
+		logrus.Warnf("Failed to connect to RPC URL %s: %v", url, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("failed to connect to any RPC endpoint: %v", lastErr)
+}
+
+// runBackfill 重新处理指定链上的一段历史区块，不改动该链的区块进度
+// 用法：backfill --chain=bsc --from=X --to=Y
+func runBackfill(config *Config, db database.Store, args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	chainName := flags.String("chain", "", "chain name as configured in chains")
+	fromBlock := flags.Uint64("from", 0, "first block to process (inclusive)")
+	toBlock := flags.Uint64("to", 0, "last block to process (inclusive)")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	chainConfig, ok := config.Chains[*chainName]
+	if !ok {
+		return fmt.Errorf("--chain must be one of the configured chains, got %q", *chainName)
+	}
+	if *toBlock < *fromBlock {
+		return fmt.Errorf("--to (%d) must not be less than --from (%d)", *toBlock, *fromBlock)
+	}
+
+	client, err := dialAny(*chainName, chainConfig.rpcURLs())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	parsedABI, err := chainConfig.loadABI()
+	if err != nil {
+		return err
+	}
+	contractAddresses := chainConfig.filterAddresses()
+
+	// 补处理的事件同样写入审计日志，命令很快退出，文件留给监听进程上传
+	auditConfig := config.Main.AuditLog
+	auditConfig.S3 = S3Config{}
+	stopAuditLog, err := startAuditLog(auditConfig)
+	if err != nil {
+		return err
+	}
+	defer stopAuditLog()
+
+	ctx := context.Background()
+	stepper := newBlockStepper(*chainName, chainConfig)
+	total := 0
+	for start := *fromBlock; start <= *toBlock; {
+		end := start + stepper.step()
+		if end > *toBlock {
+			end = *toBlock
+		}
+
+		count, err := processRange(ctx, client, db, alertNotifier(), *chainName, chainConfig, parsedABI, contractAddresses, start, end)
+		if err != nil {
+			// 区间过大时缩小跨度后重试同一区间
+			step := stepper.step()
+			stepper.onError(err)
+			if stepper.step() < step {
+				continue
+			}
+			return fmt.Errorf("failed to process blocks %d-%d: %v", start, end, err)
+		}
+		stepper.onSuccess()
+
+		total += count
+		logrus.Infof("Backfilled chain %s blocks %d-%d: %d logs", *chainName, start, end, count)
+		start = end + 1
+	}
+
+	fmt.Printf("Backfilled chain %s blocks %d-%d: %d logs processed\n", *chainName, *fromBlock, *toBlock, total)
+	return nil
+}
+
+// runVerify 解析一个 reqID 并与数据库中的记录对照，打印两边的情况
+// 用法：verify --reqid=0x...，两边不一致或只有单边记录时返回错误
+func runVerify(args []string) error {
+	err := verifyReqID(args)
+	if err != nil {
+		fmt.Printf("Status:       FAILED: %v\n", err)
+	}
+	return err
+}
+
+func verifyReqID(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	reqIDFlag := flags.String("reqid", "", "reqID to verify, 0x-prefixed 32-byte hex")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	b, err := hexutil.Decode(*reqIDFlag)
+	if err != nil || len(b) != common.HashLength {
+		return fmt.Errorf("--reqid must be a 0x-prefixed 32-byte hex string, got %q", *reqIDFlag)
+	}
+	reqID := common.BytesToHash(b)
+
+	// reqID 中的金额为零时仍然打印解析结果；不知道 reqID 属于哪条链，按当前 Meson 的布局解析
+	info, decodeErr := reqid.Decode(reqID)
+	fmt.Printf("ReqID:        %s\n", reqID.Hex())
+	fmt.Printf("Token index:  %d\n", info.TokenIndex)
+	fmt.Printf("Amount:       %s (raw, %d decimals)\n", formatWithCommas(new(big.Int).SetUint64(info.Amount)), reqid.Meson.AmountDecimals)
+	fmt.Printf("Created time: %d (%s)\n", info.CreatedTime, formatDisplayTime(time.Unix(int64(info.CreatedTime), 0)))
+	if decodeErr != nil {
+		fmt.Printf("Warning:      %v\n", decodeErr)
+	}
+	fmt.Println()
+
+	meson, err := database.FindMesonByReqID(reqID.Hex())
+	if err != nil {
+		return fmt.Errorf("failed to query reqID: %v", err)
+	}
+	if meson == nil {
+		return fmt.Errorf("reqID %s is not recorded in the database", reqID.Hex())
+	}
+
+	// meson 表只保存配对的两边，多出的一边和发出事件的合约只记录在 meson_legs 中
+	legs, err := database.FindMesonLegs(reqID.Hex())
+	if err != nil {
+		return fmt.Errorf("failed to query legs: %v", err)
+	}
+
+	printVerifyLeg("A", meson.ChainA, meson.ActionA, meson.AmountA, tokenDecimals(meson.ChainA, meson.TokenIndex), meson.TxHashA, meson.AddressA, legContract(legs, meson.ChainA, meson.TxHashA), meson.BlockA)
+	if meson.ChainB == "" {
+		fmt.Println("Leg B:        missing")
+		if meson.TimedOut {
+			fmt.Println("Status:       timed out waiting for the counterpart leg")
+		}
+		return fmt.Errorf("reqID %s is incomplete: only one leg is recorded", reqID.Hex())
+	}
+	printVerifyLeg("B", meson.ChainB, meson.ActionB, meson.AmountB, tokenDecimals(meson.ChainB, meson.TokenIndex), meson.TxHashB, meson.AddressB, legContract(legs, meson.ChainB, meson.TxHashB), meson.BlockB)
+
+	extra := 0
+	for _, leg := range legs {
+		if (leg.Chain == meson.ChainA && leg.TxHash == meson.TxHashA) || (leg.Chain == meson.ChainB && leg.TxHash == meson.TxHashB) {
+			continue
+		}
+		printVerifyLeg("+", leg.Chain, leg.Action, leg.Amount, tokenDecimals(leg.Chain, leg.TokenIndex), leg.TxHash, leg.Address, leg.Contract, leg.Block)
+		extra++
+	}
+	fmt.Println()
+
+	if meson.Reorged {
+		fmt.Println("Note:         a recorded transaction was reorged")
+	}
+	if !meson_event(meson.ActionA, meson.ActionB) {
+		return fmt.Errorf("reqID %s has an invalid action pair: %s and %s", reqID.Hex(), displayAction(meson.ActionA), displayAction(meson.ActionB))
+	}
+	if !tokenIndexMatches(*meson) {
+		return fmt.Errorf("reqID %s has mismatched token indexes: %d on %s, %d on %s", reqID.Hex(), meson.TokenIndex, meson.ChainA, *meson.TokenIndexB, meson.ChainB)
+	}
+	if !toleranceFor(meson.ChainA, meson.ChainB).allows(meson.AmountA, meson.AmountB) {
+		return fmt.Errorf("reqID %s amounts do not match: delta %s", reqID.Hex(), formatDelta(meson.AmountA, meson.AmountB, tokenDecimals(meson.ChainA, meson.TokenIndex)))
+	}
+	if extra > 0 {
+		return fmt.Errorf("reqID %s has %d extra leg(s) besides the matched pair", reqID.Hex(), extra)
+	}
+	fmt.Println("Status:       matched")
+	return nil
+}
+
+// printVerifyLeg 打印 verify 命令中的一边记录
+func printVerifyLeg(label, chain, action string, amount *big.Int, decimals uint8, txHash, address, contract string, block uint64) {
+	fmt.Printf("Leg %s:        %s %s [%s]\n", label, chain, displayAction(action), formatTokenAmount(amountOrZero(amount), decimals))
+	fmt.Printf("  Tx hash:    %s (block %d)\n", txHash, block)
+	if address != "" {
+		fmt.Printf("  Address:    %s\n", address)
+	}
+	if contract != "" {
+		fmt.Printf("  Contract:   %s\n", contract)
+	}
+}
+
+// legContract 返回 meson_legs 中链和交易哈希对应的一边的合约地址，没有记录时返回空字符串
+func legContract(legs []database.MesonLeg, chain, txHash string) string {
+	for _, leg := range legs {
+		if leg.Chain == chain && leg.TxHash == txHash {
+			return leg.Contract
+		}
+	}
+	return ""
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"meson-monitor/bot"
+	"meson-monitor/database"
+)
+
+// Validate 检查配置中的必填字段和格式，返回的错误中包含出错字段的名称
+func (config *Config) Validate() error {
+	if config.Main.PostgresURI == "" {
+		return fmt.Errorf("main.postgresURI is required")
+	}
+	switch config.Main.DBType {
+	case "", database.TypePostgres, database.TypeSQLite:
+	default:
+		return fmt.Errorf("main.dbType must be %q or %q, got %q", database.TypePostgres, database.TypeSQLite, config.Main.DBType)
+	}
+	if config.Main.CheckIntervalSeconds < 0 {
+		return fmt.Errorf("main.checkIntervalSeconds must be at least 1, got %d", config.Main.CheckIntervalSeconds)
+	}
+	if config.Main.CheckIntervalSeconds == 0 && config.Main.CheckTime <= 0 {
+		return fmt.Errorf("main.checkIntervalSeconds must be at least 1")
+	}
+	if config.Main.StartupConcurrency < 0 {
+		return fmt.Errorf("main.startupConcurrency must not be negative, got %d", config.Main.StartupConcurrency)
+	}
+	if config.Main.StartupStaggerMillis < 0 {
+		return fmt.Errorf("main.startupStaggerMillis must not be negative, got %d", config.Main.StartupStaggerMillis)
+	}
+	if config.Main.StartupJitterMillis < 0 {
+		return fmt.Errorf("main.startupJitterMillis must not be negative, got %d", config.Main.StartupJitterMillis)
+	}
+	if config.Main.StartupGraceSeconds < 0 {
+		return fmt.Errorf("main.startupGraceSeconds must not be negative, got %d", config.Main.StartupGraceSeconds)
+	}
+	switch config.Main.ProgressBackend {
+	case "", progressBackendFile, progressBackendDB:
+	default:
+		return fmt.Errorf("main.progressBackend must be %q or %q, got %q", progressBackendFile, progressBackendDB, config.Main.ProgressBackend)
+	}
+	switch config.Main.ZeroAmountAction {
+	case "", zeroAmountSkip, zeroAmountProcess, zeroAmountAlert:
+	default:
+		return fmt.Errorf("main.zeroAmountAction must be %q, %q or %q, got %q", zeroAmountSkip, zeroAmountProcess, zeroAmountAlert, config.Main.ZeroAmountAction)
+	}
+	switch config.Main.MinAmountAction {
+	case "", minAmountRecord, minAmountSkip:
+	default:
+		return fmt.Errorf("main.minAmountAction must be %q or %q, got %q", minAmountRecord, minAmountSkip, config.Main.MinAmountAction)
+	}
+	if config.Main.WalletAddress != "" && !common.IsHexAddress(config.Main.WalletAddress) {
+		return fmt.Errorf("main.walletAddress is not a valid address: %s", config.Main.WalletAddress)
+	}
+	switch config.Main.ParseMode {
+	case "", parseModeHTML, parseModeMarkdownV2:
+	default:
+		return fmt.Errorf("main.parseMode must be %q or %q, got %q", parseModeHTML, parseModeMarkdownV2, config.Main.ParseMode)
+	}
+	if config.Main.SummaryTime != "" {
+		if _, err := time.Parse(summaryTimeLayout, config.Main.SummaryTime); err != nil {
+			return fmt.Errorf("main.summaryTime must be HH:MM in UTC, got %q", config.Main.SummaryTime)
+		}
+	}
+	if config.Main.StallAlertMinutes < 0 {
+		return fmt.Errorf("main.stallAlertMinutes must not be negative, got %d", config.Main.StallAlertMinutes)
+	}
+	if config.Main.CheckBatchSize < 0 {
+		return fmt.Errorf("main.checkBatchSize must not be negative, got %d", config.Main.CheckBatchSize)
+	}
+	if config.Main.AlertsPerMinute < 0 {
+		return fmt.Errorf("main.alertsPerMinute must not be negative, got %d", config.Main.AlertsPerMinute)
+	}
+	if config.Main.ProxyURL != "" {
+		if _, err := bot.NewHTTPClient(config.Main.ProxyURL, 0); err != nil {
+			return fmt.Errorf("main.proxyURL: %v", err)
+		}
+	}
+	if config.Main.NotifyTimeoutSeconds < 0 {
+		return fmt.Errorf("main.notifyTimeoutSeconds must not be negative, got %d", config.Main.NotifyTimeoutSeconds)
+	}
+	if _, err := bot.ParseWebhookTemplate(config.Main.WebhookTemplate); err != nil {
+		return fmt.Errorf("main.webhookTemplate: %v", err)
+	}
+	if _, err := loadMessageTemplates(config.Main.MessageTemplates, config.Main.ParseMode); err != nil {
+		return fmt.Errorf("main.messageTemplates.%v", err)
+	}
+	if config.Main.BotToken != "" && len(config.Main.ChatIDs) == 0 {
+		return fmt.Errorf("main.chatIDs must not be empty when main.botToken is set")
+	}
+
+	if len(config.Chains) == 0 {
+		return fmt.Errorf("chains must contain at least one chain")
+	}
+
+	// 按名称排序，保证多处配置错误时每次报告同一个
+	for _, chainName := range config.chainNames() {
+		err := config.Chains[chainName].validate()
+		if err != nil {
+			return fmt.Errorf("chains.%s.%v", chainName, err)
+		}
+	}
+
+	_, err := loadAmountTolerances(config)
+	if err != nil {
+		return err
+	}
+	_, err = loadWatchedRoutes(config)
+	if err != nil {
+		return err
+	}
+	_, err = loadAlertRoutes(config)
+	if err != nil {
+		return err
+	}
+	_, err = loadMinAmounts(config)
+	if err != nil {
+		return err
+	}
+	err = config.Main.ErrorLogAlerts.validate()
+	if err != nil {
+		return fmt.Errorf("main.errorLogAlerts.%v", err)
+	}
+	err = config.Main.HTTPServer.validate()
+	if err != nil {
+		return fmt.Errorf("main.httpServer.%v", err)
+	}
+	err = config.Main.AuditLog.validate()
+	if err != nil {
+		return fmt.Errorf("main.auditLog.%v", err)
+	}
+	err = config.Main.Retention.validate()
+	if err != nil {
+		return fmt.Errorf("main.retention.%v", err)
+	}
+	return nil
+}
+
+// chainNames 返回按名称排序的链名称
+func (config *Config) chainNames() []string {
+	chainNames := make([]string, 0, len(config.Chains))
+	for chainName := range config.Chains {
+		chainNames = append(chainNames, chainName)
+	}
+	sort.Strings(chainNames)
+	return chainNames
+}
+
+// checkInterval 返回检查未匹配 Meson 的间隔
+// 优先使用以秒为单位的 checkIntervalSeconds，未配置时兼容旧的 check_time（毫秒）
+func (config *Config) checkInterval() time.Duration {
+	if config.Main.CheckIntervalSeconds > 0 {
+		return time.Duration(config.Main.CheckIntervalSeconds) * time.Second
+	}
+	return time.Duration(config.Main.CheckTime) * time.Millisecond
+}
+
+// validate 检查单条链的配置，返回的错误以字段名开头
+func (c ChainConfig) validate() error {
+	urls := c.rpcURLs()
+	if len(urls) == 0 {
+		return fmt.Errorf("rpcUrl or rpcUrls is required")
+	}
+	for i, url := range urls {
+		if url == "" {
+			return fmt.Errorf("rpcUrls[%d] must not be empty", i)
+		}
+	}
+	if !common.IsHexAddress(c.MesonContract) {
+		return fmt.Errorf("mesonContract is not a valid address: %q", c.MesonContract)
+	}
+	if c.FilterAddress != "" && !common.IsHexAddress(c.FilterAddress) {
+		return fmt.Errorf("filterAddress is not a valid address: %q", c.FilterAddress)
+	}
+	if c.FilterAddress != "" && len(c.FilterAddresses) > 0 {
+		return fmt.Errorf("filterAddress and filterAddresses must not both be set")
+	}
+	seenAddresses := make(map[common.Address]bool)
+	for i, address := range c.FilterAddresses {
+		if !common.IsHexAddress(address) {
+			return fmt.Errorf("filterAddresses[%d] is not a valid address: %q", i, address)
+		}
+		if seenAddresses[common.HexToAddress(address)] {
+			return fmt.Errorf("filterAddresses[%d] is a duplicate: %q", i, address)
+		}
+		seenAddresses[common.HexToAddress(address)] = true
+	}
+	if c.TokenContract != "" && !common.IsHexAddress(c.TokenContract) {
+		return fmt.Errorf("tokenContract is not a valid address: %q", c.TokenContract)
+	}
+	switch c.StartFrom {
+	case "", startFromConfig, startFromLatest:
+	default:
+		return fmt.Errorf("startFrom must be %q or %q, got %q", startFromConfig, startFromLatest, c.StartFrom)
+	}
+	if _, err := listenMode(c); err != nil {
+		return fmt.Errorf("mode: %v", err)
+	}
+	parsedABI, err := c.loadABI()
+	if err != nil {
+		return fmt.Errorf("abi: %v", err)
+	}
+	if err := checkEventABI(c, parsedABI); err != nil {
+		return fmt.Errorf("abi: %v", err)
+	}
+	if c.ReqIDLayout != nil {
+		if err := c.ReqIDLayout.Validate(); err != nil {
+			return fmt.Errorf("reqIDLayout.%v", err)
+		}
+	}
+	if c.PollIntervalSeconds < 0 {
+		return fmt.Errorf("pollIntervalSeconds must not be negative, got %d", c.PollIntervalSeconds)
+	}
+	if c.IdleIntervalSeconds < 0 {
+		return fmt.Errorf("idleIntervalSeconds must not be negative, got %d", c.IdleIntervalSeconds)
+	}
+	if c.HeadCacheSeconds < 0 {
+		return fmt.Errorf("headCacheSeconds must not be negative, got %d", c.HeadCacheSeconds)
+	}
+	if c.Finality != nil {
+		err := c.Finality.validate()
+		if err != nil {
+			return fmt.Errorf("finality.%v", err)
+		}
+	}
+	if c.ExplorerTxURL != "" {
+		if err := validateExplorerTxURL(c.ExplorerTxURL); err != nil {
+			return fmt.Errorf("explorerTxUrl %v", err)
+		}
+	}
+	for i, address := range c.RecipientAllowlist {
+		if !common.IsHexAddress(address) {
+			return fmt.Errorf("recipientAllowlist[%d] is not a valid address: %q", i, address)
+		}
+	}
+	tokens := c.tokens()
+	for index := range c.TokenDecimals {
+		if _, ok := tokens[index]; !ok {
+			return fmt.Errorf("tokenDecimals has index %d which is not in mesonIndexes", index)
+		}
+	}
+	return nil
+}
+
+// 环境变量与配置字段的对应关系，环境变量优先于配置文件：
+//
+//	BRIDGE_WALLET_ADDRESS              main.walletAddress
+//	BRIDGE_PRIVATE_KEY                 main.privateKey
+//	BRIDGE_CHECK_TIME                  main.check_time（已废弃）
+//	BRIDGE_CHECK_INTERVAL_SECONDS      main.checkIntervalSeconds
+//	BRIDGE_BOT_TOKEN                   main.botToken
+//	BRIDGE_CHAT_IDS                    main.chatIDs，逗号分隔，如 "-1001,-1002"，chat ID:话题 ID 发送到指定话题，如 "-1001:42"
+//	BRIDGE_LARK_BOT                    main.lark_bot
+//	BRIDGE_LARK_SECRET                 main.lark_secret
+//	BRIDGE_SLACK_BOT                   main.slack_bot
+//	BRIDGE_WEBHOOK_URL                 main.webhookURL
+//	BRIDGE_PAGERDUTY_ROUTING_KEY       main.pagerDutyRoutingKey
+//	BRIDGE_PROXY_URL                   main.proxyURL
+//	BRIDGE_POSTGRES_URI                main.postgresURI
+//	BRIDGE_DB_TYPE                     main.dbType
+//	BRIDGE_PROGRESS_BACKEND            main.progressBackend
+//	BRIDGE_LAST_BLOCK_DIR              main.lastBlockDir
+//	BRIDGE_API_LISTEN                  main.apiListen
+//	BRIDGE_ADMIN_TOKEN                 main.adminToken
+//	BRIDGE_SUMMARY_TIME                main.summaryTime
+//	BRIDGE_AUDIT_S3_ACCESS_KEY_ID      main.auditLog.s3.accessKeyID
+//	BRIDGE_AUDIT_S3_SECRET_ACCESS_KEY  main.auditLog.s3.secretAccessKey
+//	BRIDGE_CHAINS                      chains，整个链配置的 JSON，会替换配置文件中的 chains
+const envPrefix = "BRIDGE_"
+
+// applyEnv 使用环境变量覆盖配置，未设置或为空的环境变量不会覆盖
+func applyEnv(config *Config) error {
+	stringFields := map[string]*string{
+		"WALLET_ADDRESS":             &config.Main.WalletAddress,
+		"PRIVATE_KEY":                &config.Main.PrivateKey,
+		"BOT_TOKEN":                  &config.Main.BotToken,
+		"LARK_BOT":                   &config.Main.LarkBotURL,
+		"LARK_SECRET":                &config.Main.LarkSecret,
+		"SLACK_BOT":                  &config.Main.SlackBotURL,
+		"WEBHOOK_URL":                &config.Main.WebhookURL,
+		"PAGERDUTY_ROUTING_KEY":      &config.Main.PagerDutyRoutingKey,
+		"PROXY_URL":                  &config.Main.ProxyURL,
+		"POSTGRES_URI":               &config.Main.PostgresURI,
+		"DB_TYPE":                    &config.Main.DBType,
+		"PROGRESS_BACKEND":           &config.Main.ProgressBackend,
+		"LAST_BLOCK_DIR":             &config.Main.LastBlockDir,
+		"AUDIT_S3_ACCESS_KEY_ID":     &config.Main.AuditLog.S3.AccessKeyID,
+		"AUDIT_S3_SECRET_ACCESS_KEY": &config.Main.AuditLog.S3.SecretAccessKey,
+		"API_LISTEN":                 &config.Main.APIListen,
+		"ADMIN_TOKEN":                &config.Main.AdminToken,
+		"SUMMARY_TIME":               &config.Main.SummaryTime,
+	}
+	for name, field := range stringFields {
+		if value, ok := lookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	if value, ok := lookupEnv("CHECK_TIME"); ok {
+		checkTime, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%sCHECK_TIME must be an integer: %v", envPrefix, err)
+		}
+		config.Main.CheckTime = checkTime
+	}
+
+	if value, ok := lookupEnv("CHECK_INTERVAL_SECONDS"); ok {
+		checkInterval, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%sCHECK_INTERVAL_SECONDS must be an integer: %v", envPrefix, err)
+		}
+		config.Main.CheckIntervalSeconds = checkInterval
+	}
+
+	if value, ok := lookupEnv("CHAT_IDS"); ok {
+		var chatIDs []bot.TelegramChat
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			chatPart, threadPart, hasThread := strings.Cut(part, ":")
+			chatID, err := strconv.ParseInt(chatPart, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%sCHAT_IDS contains invalid chat ID %q: %v", envPrefix, part, err)
+			}
+			chat := bot.TelegramChat{ChatID: chatID}
+			if hasThread {
+				chat.ThreadID, err = strconv.ParseInt(threadPart, 10, 64)
+				if err != nil {
+					return fmt.Errorf("%sCHAT_IDS contains invalid message thread ID %q: %v", envPrefix, part, err)
+				}
+			}
+			chatIDs = append(chatIDs, chat)
+		}
+		config.Main.ChatIDs = chatIDs
+	}
+
+	if value, ok := lookupEnv("CHAINS"); ok {
+		var chains map[string]ChainConfig
+		err := json.Unmarshal([]byte(value), &chains)
+		if err != nil {
+			return fmt.Errorf("%sCHAINS is not valid JSON: %v", envPrefix, err)
+		}
+		config.Chains = chains
+	}
+
+	return nil
+}
+
+// lookupEnv 读取带 BRIDGE_ 前缀的环境变量，为空时视为未设置
+func lookupEnv(name string) (string, bool) {
+	value := os.Getenv(envPrefix + name)
+	return value, value != ""
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"meson-monitor/bot"
+)
+
+// validTestConfig 能通过 Validate 的最小配置
+func validTestConfig() *Config {
+	config := &Config{}
+	config.Main.PostgresURI = "postgres://localhost/meson"
+	config.Main.CheckIntervalSeconds = 60
+	chain := testChainConfig()
+	chain.RpcUrl = "https://rpc.example.com"
+	config.Chains = map[string]ChainConfig{"bsc": chain, "eth": chain}
+	return config
+}
+
+func TestApplyEnvStringFields(t *testing.T) {
+	tests := []struct {
+		env   string
+		field func(*Config) *string
+	}{
+		{"WALLET_ADDRESS", func(c *Config) *string { return &c.Main.WalletAddress }},
+		{"PRIVATE_KEY", func(c *Config) *string { return &c.Main.PrivateKey }},
+		{"BOT_TOKEN", func(c *Config) *string { return &c.Main.BotToken }},
+		{"LARK_BOT", func(c *Config) *string { return &c.Main.LarkBotURL }},
+		{"LARK_SECRET", func(c *Config) *string { return &c.Main.LarkSecret }},
+		{"POSTGRES_URI", func(c *Config) *string { return &c.Main.PostgresURI }},
+		{"PROGRESS_BACKEND", func(c *Config) *string { return &c.Main.ProgressBackend }},
+		{"API_LISTEN", func(c *Config) *string { return &c.Main.APIListen }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			// 环境变量优先于配置文件
+			config := &Config{}
+			*tt.field(config) = "from-file"
+			t.Setenv(envPrefix+tt.env, "from-env")
+			if err := applyEnv(config); err != nil {
+				t.Fatalf("applyEnv: %v", err)
+			}
+			if got := *tt.field(config); got != "from-env" {
+				t.Errorf("got %q, want the environment value", got)
+			}
+
+			// 为空的环境变量视为未设置，保留配置文件中的值
+			config = &Config{}
+			*tt.field(config) = "from-file"
+			t.Setenv(envPrefix+tt.env, "")
+			if err := applyEnv(config); err != nil {
+				t.Fatalf("applyEnv: %v", err)
+			}
+			if got := *tt.field(config); got != "from-file" {
+				t.Errorf("got %q, want the config file value", got)
+			}
+		})
+	}
+}
+
+func TestApplyEnvParsedFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		value   string
+		check   func(*Config) bool
+		wantErr string
+	}{
+		{
+			name:  "check time",
+			env:   "CHECK_TIME",
+			value: "5000",
+			check: func(c *Config) bool { return c.Main.CheckTime == 5000 },
+		},
+		{
+			name:    "invalid check time",
+			env:     "CHECK_TIME",
+			value:   "5s",
+			wantErr: "BRIDGE_CHECK_TIME",
+		},
+		{
+			name:  "check interval",
+			env:   "CHECK_INTERVAL_SECONDS",
+			value: "30",
+			check: func(c *Config) bool { return c.Main.CheckIntervalSeconds == 30 },
+		},
+		{
+			name:    "invalid check interval",
+			env:     "CHECK_INTERVAL_SECONDS",
+			value:   "thirty",
+			wantErr: "BRIDGE_CHECK_INTERVAL_SECONDS",
+		},
+		{
+			name:  "chat IDs with a topic",
+			env:   "CHAT_IDS",
+			value: "-1001, -1002:42,",
+			check: func(c *Config) bool {
+				return reflect.DeepEqual(c.Main.ChatIDs, []bot.TelegramChat{{ChatID: -1001}, {ChatID: -1002, ThreadID: 42}})
+			},
+		},
+		{
+			name:    "invalid chat ID",
+			env:     "CHAT_IDS",
+			value:   "-1001,abc",
+			wantErr: "invalid chat ID",
+		},
+		{
+			name:    "invalid topic ID",
+			env:     "CHAT_IDS",
+			value:   "-1001:abc",
+			wantErr: "invalid message thread ID",
+		},
+		{
+			name:  "chains replace the config file",
+			env:   "CHAINS",
+			value: `{"polygon": {"rpcUrl": "https://polygon.example.com"}}`,
+			check: func(c *Config) bool {
+				_, hasFileChain := c.Chains["bsc"]
+				return !hasFileChain && c.Chains["polygon"].RpcUrl == "https://polygon.example.com"
+			},
+		},
+		{
+			name:    "invalid chains JSON",
+			env:     "CHAINS",
+			value:   `{"polygon":`,
+			wantErr: "BRIDGE_CHAINS",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validTestConfig()
+			config.Main.CheckTime = 1000
+			config.Main.ChatIDs = []bot.TelegramChat{{ChatID: -1}}
+			t.Setenv(envPrefix+tt.env, tt.value)
+			err := applyEnv(config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyEnv error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEnv: %v", err)
+			}
+			if !tt.check(config) {
+				t.Errorf("%s=%q not applied: %+v", envPrefix+tt.env, tt.value, config.Main)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"main": {"postgresURI": "postgres://file/meson", "botToken": "file-token", "checkIntervalSeconds": 60}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BRIDGE_BOT_TOKEN", "env-token")
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if config.Main.BotToken != "env-token" {
+		t.Errorf("botToken = %q, want the environment value", config.Main.BotToken)
+	}
+	if config.Main.PostgresURI != "postgres://file/meson" {
+		t.Errorf("postgresURI = %q, want the config file value", config.Main.PostgresURI)
+	}
+	if config.Main.CheckIntervalSeconds != 60 {
+		t.Errorf("checkIntervalSeconds = %d, want 60", config.Main.CheckIntervalSeconds)
+	}
+}
+
+func TestLoadConfigWithoutFileUsesEnv(t *testing.T) {
+	t.Setenv("BRIDGE_POSTGRES_URI", "postgres://env/meson")
+
+	config, err := loadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if config.Main.PostgresURI != "postgres://env/meson" {
+		t.Errorf("postgresURI = %q, want the environment value", config.Main.PostgresURI)
+	}
+}
+
+func TestValidateAcceptsValidConfig(t *testing.T) {
+	if err := validTestConfig().Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr string
+	}{
+		{"missing postgresURI", func(c *Config) { c.Main.PostgresURI = "" }, "main.postgresURI"},
+		{"negative check interval", func(c *Config) { c.Main.CheckIntervalSeconds = -1 }, "main.checkIntervalSeconds"},
+		{"no check interval", func(c *Config) { c.Main.CheckIntervalSeconds = 0 }, "main.checkIntervalSeconds"},
+		{"unknown progress backend", func(c *Config) { c.Main.ProgressBackend = "redis" }, "main.progressBackend"},
+		{"invalid wallet address", func(c *Config) { c.Main.WalletAddress = "0x123" }, "main.walletAddress"},
+		{"unknown parse mode", func(c *Config) { c.Main.ParseMode = "Markdown" }, "main.parseMode"},
+		{"bot token without chats", func(c *Config) { c.Main.BotToken = "token" }, "main.chatIDs"},
+		{"no chains", func(c *Config) { c.Chains = nil }, "chains must contain"},
+		{"invalid chain", func(c *Config) { updateChain(c, "eth", func(chain *ChainConfig) { chain.RpcUrl = "" }) }, "chains.eth.rpcUrl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validTestConfig()
+			tt.mutate(config)
+			err := config.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAcceptsDeprecatedCheckTime(t *testing.T) {
+	config := validTestConfig()
+	config.Main.CheckIntervalSeconds = 0
+	config.Main.CheckTime = 5000
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestValidateChainErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*ChainConfig)
+		wantErr string
+	}{
+		{"no RPC URL", func(c *ChainConfig) { c.RpcUrl = "" }, "rpcUrl"},
+		{"invalid meson contract", func(c *ChainConfig) { c.MesonContract = "0x123" }, "mesonContract"},
+		{"invalid token contract", func(c *ChainConfig) { c.TokenContract = "0x123" }, "tokenContract"},
+		{"subscribe over HTTP", func(c *ChainConfig) { c.Mode = modeSubscribe }, "mode:"},
+		{"decimals for unknown index", func(c *ChainConfig) { c.TokenDecimals = map[uint8]uint8{9: 18} }, "tokenDecimals has index 9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validTestConfig()
+			updateChain(config, "bsc", tt.mutate)
+			err := config.Validate()
+			if err == nil || !strings.Contains(err.Error(), "chains.bsc."+tt.wantErr) {
+				t.Errorf("Validate error = %v, want it to mention %q", err, "chains.bsc."+tt.wantErr)
+			}
+		})
+	}
+}
+
+// updateChain 修改配置中的一条链
+func updateChain(config *Config, chainName string, mutate func(*ChainConfig)) {
+	chain := config.Chains[chainName]
+	mutate(&chain)
+	config.Chains[chainName] = chain
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// ConfirmationsConfig 事件需要的确认区块数，可以写成一个数字，也可以按事件类型分别配置：
+// {"default": 12, "mint": 6, "burn": 64}，未配置的类型使用 default，未配置 default 时使用 defaultConfirmations
+type ConfirmationsConfig struct {
+	Default *uint64 `json:"default"`
+	Mint    *uint64 `json:"mint"`
+	Burn    *uint64 `json:"burn"`
+}
+
+// UnmarshalJSON 同时支持数字和对象两种写法，数字等同于只配置 default
+func (c *ConfirmationsConfig) UnmarshalJSON(data []byte) error {
+	var confirmations uint64
+	if err := json.Unmarshal(data, &confirmations); err == nil {
+		*c = ConfirmationsConfig{Default: &confirmations}
+		return nil
+	}
+
+	type plain ConfirmationsConfig
+	var config plain
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("confirmations must be a number or {\"default\", \"mint\", \"burn\"}: %v", err)
+	}
+	*c = ConfirmationsConfig(config)
+	return nil
+}
+
+// confirmations 返回链配置的默认确认区块数
+func (c ChainConfig) confirmations() uint64 {
+	if c.Confirmations == nil || c.Confirmations.Default == nil {
+		return defaultConfirmations
+	}
+	return *c.Confirmations.Default
+}
+
+// eventConfirmations 返回 eventName 事件需要的确认区块数，未单独配置的类型使用默认值
+func (c ChainConfig) eventConfirmations(eventName string) uint64 {
+	if c.Confirmations != nil {
+		switch {
+		case eventName == actionMint && c.Confirmations.Mint != nil:
+			return *c.Confirmations.Mint
+		case eventName == actionBurn && c.Confirmations.Burn != nil:
+			return *c.Confirmations.Burn
+		}
+	}
+	return c.confirmations()
+}
+
+// minConfirmations 两种事件中较少的确认区块数，轮询时按它确定查询的区间
+func (c ChainConfig) minConfirmations() uint64 {
+	return min(c.eventConfirmations(actionMint), c.eventConfirmations(actionBurn))
+}
+
+// maxConfirmations 两种事件中较多的确认区块数，此高度以下的所有事件都已获得足够确认
+func (c ChainConfig) maxConfirmations() uint64 {
+	return max(c.eventConfirmations(actionMint), c.eventConfirmations(actionBurn))
+}
+
+// confirmedHeight 返回在 latestBlock 下所有事件都已获得足够确认的最高区块号
+func (c ChainConfig) confirmedHeight(latestBlock uint64) uint64 {
+	return heightBelow(latestBlock, c.maxConfirmations())
+}
+
+// scanHeight 返回轮询时可以查询到的最高区块号，至少一种事件在此高度已获得足够确认
+// 其中确认数不够的事件由 holdUnconfirmedLogs 留到之后处理
+func (c ChainConfig) scanHeight(latestBlock uint64) uint64 {
+	return heightBelow(latestBlock, c.minConfirmations())
+}
+
+// heightBelow 返回 latestBlock 之下 confirmations 个区块的高度，不足时为 0
+func heightBelow(latestBlock, confirmations uint64) uint64 {
+	if latestBlock < confirmations {
+		return 0
+	}
+	return latestBlock - confirmations
+}
+
+// holdUnconfirmedLogs 按事件类型检查日志在 latestBlock 下是否已获得足够确认
+// 存在确认数不够的日志时，只返回其中最小区块号之前的日志，下一个待处理区块为该区块号，之后重新查询；
+// 否则返回全部日志，下一个待处理区块为 nextBlock。不是 Meson 事件的日志不影响结果
+func holdUnconfirmedLogs(chainName string, chainConfig ChainConfig, parsedABI abi.ABI, logs []types.Log, latestBlock, nextBlock uint64) ([]types.Log, uint64) {
+	heldBlock := nextBlock
+	for _, vLog := range logs {
+		event, ok := parseMesonEvent(chainConfig, parsedABI, vLog)
+		if !ok || vLog.BlockNumber >= heldBlock {
+			continue
+		}
+		if vLog.BlockNumber > heightBelow(latestBlock, chainConfig.eventConfirmations(event.Action)) {
+			heldBlock = vLog.BlockNumber
+		}
+	}
+	if heldBlock == nextBlock {
+		return logs, nextBlock
+	}
+
+	logrus.Infof("Events on chain %s from block %d need more confirmations, processing up to block %d for now", chainName, heldBlock, heldBlock-1)
+	var ready []types.Log
+	for _, vLog := range logs {
+		if vLog.BlockNumber < heldBlock {
+			ready = append(ready, vLog)
+		}
+	}
+	return ready, heldBlock
+}
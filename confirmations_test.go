@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestConfirmationsConfigUnmarshal(t *testing.T) {
+	tests := []struct {
+		name               string
+		json               string
+		wantMint, wantBurn uint64
+	}{
+		{name: "unset", json: `{}`, wantMint: defaultConfirmations, wantBurn: defaultConfirmations},
+		{name: "number", json: `{"confirmations": 12}`, wantMint: 12, wantBurn: 12},
+		{name: "per event", json: `{"confirmations": {"default": 12, "mint": 6, "burn": 64}}`, wantMint: 6, wantBurn: 64},
+		// 未配置的类型使用 default
+		{name: "burn only", json: `{"confirmations": {"default": 12, "burn": 64}}`, wantMint: 12, wantBurn: 64},
+		{name: "no default", json: `{"confirmations": {"mint": 3}}`, wantMint: 3, wantBurn: defaultConfirmations},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config ChainConfig
+			if err := json.Unmarshal([]byte(tt.json), &config); err != nil {
+				t.Fatal(err)
+			}
+			if got := config.eventConfirmations(actionMint); got != tt.wantMint {
+				t.Errorf("mint confirmations = %d, want %d", got, tt.wantMint)
+			}
+			if got := config.eventConfirmations(actionBurn); got != tt.wantBurn {
+				t.Errorf("burn confirmations = %d, want %d", got, tt.wantBurn)
+			}
+		})
+	}
+
+	var config ChainConfig
+	if err := json.Unmarshal([]byte(`{"confirmations": "12"}`), &config); err == nil {
+		t.Error("Unmarshal accepted a string")
+	}
+}
+
+func TestHoldUnconfirmedLogsPerEvent(t *testing.T) {
+	parsedABI := testABI(t)
+	mint, burn := uint64(2), uint64(10)
+	chainConfig := testChainConfig()
+	chainConfig.Confirmations = &ConfirmationsConfig{Mint: &mint, Burn: &burn}
+	reqID := testReqID(testTokenIndex, 1000000, 1700000000)
+
+	// 最新区块 100：mint 确认到 98，burn 确认到 90，轮询查询到 98
+	if got := chainConfig.scanHeight(100); got != 98 {
+		t.Errorf("scanHeight = %d, want 98", got)
+	}
+	if got := chainConfig.confirmedHeight(100); got != 90 {
+		t.Errorf("confirmedHeight = %d, want 90", got)
+	}
+
+	logs := []types.Log{
+		mesonLog(parsedABI, "bsc", actionBurn, reqID, 89, 0),
+		mesonLog(parsedABI, "bsc", actionMint, reqID, 92, 0),
+		mesonLog(parsedABI, "bsc", actionBurn, reqID, 95, 0),
+		mesonLog(parsedABI, "bsc", actionMint, reqID, 97, 0),
+	}
+	ready, next := holdUnconfirmedLogs("bsc", chainConfig, parsedABI, logs, 100, 99)
+	// 区块 95 的 burn 确认数不够，它和之后的日志留到下次处理
+	if next != 95 {
+		t.Errorf("next block = %d, want 95", next)
+	}
+	if len(ready) != 2 || ready[0].BlockNumber != 89 || ready[1].BlockNumber != 92 {
+		t.Errorf("ready logs = %v, want the logs in blocks 89 and 92", ready)
+	}
+
+	// 全部确认时原样返回
+	ready, next = holdUnconfirmedLogs("bsc", chainConfig, parsedABI, logs, 110, 99)
+	if next != 99 || len(ready) != len(logs) {
+		t.Errorf("holdUnconfirmedLogs returned %d logs and next block %d, want %d logs and 99", len(ready), next, len(logs))
+	}
+}
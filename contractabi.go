@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	actionMint = "TokenMintExecuted"
+	actionBurn = "TokenBurnExecuted"
+)
+
+// mesonEvent 从日志中解析出的 Meson 事件
+type mesonEvent struct {
+	Name    string // ABI 中的事件名称
+	Action  string // 对应的动作，actionMint 或 actionBurn
+	ReqID   common.Hash
+	Address common.Address
+}
+
+// loadABI 解析链配置使用的合约 ABI
+// 优先读取 abiFile，其次使用内联的 abi，都未配置时使用内置的 contractABI
+func (c ChainConfig) loadABI() (abi.ABI, error) {
+	abiJSON := contractABI
+	if c.ABIFile != "" {
+		data, err := os.ReadFile(c.ABIFile)
+		if err != nil {
+			return abi.ABI{}, fmt.Errorf("failed to read ABI file %s: %v", c.ABIFile, err)
+		}
+		abiJSON = string(data)
+	} else if c.ABI != "" {
+		abiJSON = c.ABI
+	}
+
+	parsedABI, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return abi.ABI{}, fmt.Errorf("failed to parse contract ABI: %v", err)
+	}
+	return parsedABI, nil
+}
+
+// eventAction 返回 ABI 事件对应的动作
+// eventActions 中配置的映射优先，未配置时事件名本身为 TokenMintExecuted 或 TokenBurnExecuted 才会处理
+func (c ChainConfig) eventAction(eventName string) (string, bool) {
+	if action, ok := c.EventActions[eventName]; ok {
+		return action, true
+	}
+	if eventName == actionMint || eventName == actionBurn {
+		return eventName, true
+	}
+	return "", false
+}
+
+// checkEventABI 检查 ABI 中需要处理的事件是否都能解析出 reqId
+// mint 和 burn 两种动作都要有对应的事件（事件名本身或通过 eventActions 映射），否则该链只能作为跨链的一边，
+// 缺少的动作永远收不到，出错时列出需要的动作和 ABI 中已有的事件
+func checkEventABI(chainConfig ChainConfig, parsedABI abi.ABI) error {
+	for eventName, action := range chainConfig.EventActions {
+		if action != actionMint && action != actionBurn {
+			return fmt.Errorf("eventActions.%s must be %q or %q, got %q", eventName, actionMint, actionBurn, action)
+		}
+		if _, ok := parsedABI.Events[eventName]; !ok {
+			return fmt.Errorf("eventActions.%s is not an event in the ABI (events in ABI: %s)", eventName, abiEventNames(parsedABI))
+		}
+	}
+
+	found := make(map[string]bool)
+	for _, event := range parsedABI.Events {
+		action, ok := chainConfig.eventAction(event.Name)
+		if !ok {
+			continue
+		}
+		if _, _, err := eventTopicPositions(event); err != nil {
+			return fmt.Errorf("event %s: %v", event.Name, err)
+		}
+		found[action] = true
+	}
+
+	var missing []string
+	for _, action := range []string{actionMint, actionBurn} {
+		if !found[action] {
+			missing = append(missing, action)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("ABI has no event for %s; required: %s and %s (by name or through eventActions); events in ABI: %s",
+			strings.Join(missing, " or "), actionMint, actionBurn, abiEventNames(parsedABI))
+	}
+	return nil
+}
+
+// abiEventNames 返回 ABI 中按名称排序的事件列表，用于错误信息
+func abiEventNames(parsedABI abi.ABI) string {
+	if len(parsedABI.Events) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(parsedABI.Events))
+	for name := range parsedABI.Events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// eventTopicPositions 返回 reqId 和地址参数在日志 topics 中的位置
+// reqId 为第一个 indexed 的 bytes32 参数，地址为第一个 indexed 的 address 参数，事件中没有地址参数时返回 0
+func eventTopicPositions(event abi.Event) (int, int, error) {
+	reqIDTopic, addressTopic := 0, 0
+	topic := 0
+	for _, input := range event.Inputs {
+		if !input.Indexed {
+			continue
+		}
+		topic++
+		switch {
+		case reqIDTopic == 0 && input.Type.T == abi.FixedBytesTy && input.Type.Size == 32:
+			reqIDTopic = topic
+		case addressTopic == 0 && input.Type.T == abi.AddressTy:
+			addressTopic = topic
+		}
+	}
+	if reqIDTopic == 0 {
+		return 0, 0, fmt.Errorf("no indexed bytes32 reqId parameter")
+	}
+	return reqIDTopic, addressTopic, nil
+}
+
+// parseMesonEvent 根据 ABI 解析日志，日志不是需要处理的事件时第二个返回值为 false
+func parseMesonEvent(chainConfig ChainConfig, parsedABI abi.ABI, vLog types.Log) (mesonEvent, bool) {
+	if len(vLog.Topics) == 0 {
+		return mesonEvent{}, false
+	}
+	event, err := parsedABI.EventByID(vLog.Topics[0])
+	if err != nil {
+		return mesonEvent{}, false
+	}
+	action, ok := chainConfig.eventAction(event.Name)
+	if !ok {
+		return mesonEvent{}, false
+	}
+	reqIDTopic, addressTopic, err := eventTopicPositions(*event)
+	if err != nil || reqIDTopic >= len(vLog.Topics) || addressTopic >= len(vLog.Topics) {
+		return mesonEvent{}, false
+	}
+
+	parsed := mesonEvent{
+		Name:   event.Name,
+		Action: action,
+		ReqID:  vLog.Topics[reqIDTopic],
+	}
+	if addressTopic > 0 {
+		// indexed address 在 topic 中左侧补零到 32 字节，地址为后 20 字节
+		parsed.Address = common.BytesToAddress(vLog.Topics[addressTopic].Bytes()[common.HashLength-common.AddressLength:])
+	}
+	return parsed, true
+}
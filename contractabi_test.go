@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestParseMesonEventSkipsLogsWithTooFewTopics(t *testing.T) {
+	parsedABI := testABI(t)
+	reqID := common.HexToHash("0x0100000000000f424001")
+	full := mesonLog(parsedABI, "bsc", actionMint, reqID, 100, 0)
+
+	tests := []struct {
+		name   string
+		topics []common.Hash
+		want   bool
+	}{
+		{name: "no topics", topics: nil},
+		{name: "event signature only", topics: full.Topics[:1]},
+		{name: "missing address topic", topics: full.Topics[:2]},
+		{name: "unknown event", topics: []common.Hash{common.HexToHash("0x01"), reqID, full.Topics[2]}},
+		{name: "complete", topics: full.Topics, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vLog := full
+			vLog.Topics = tt.topics
+			event, ok := parseMesonEvent(testChainConfig(), parsedABI, vLog)
+			if ok != tt.want {
+				t.Fatalf("parseMesonEvent ok = %v, want %v", ok, tt.want)
+			}
+			if ok && (event.ReqID != reqID || event.Action != actionMint || event.Address != testAddress) {
+				t.Errorf("parsed %+v", event)
+			}
+		})
+	}
+}
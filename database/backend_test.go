@@ -0,0 +1,323 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testPostgresEnv 设置后同一组测试也在该 PostgreSQL 数据库上运行，测试数据使用唯一的 reqID 和链名，不会清空已有数据
+const testPostgresEnv = "BRIDGE_TEST_POSTGRES_URI"
+
+// openTestStore 打开并初始化数据库，测试结束时关闭
+func openTestStore(t *testing.T, dbType, uri string) Store {
+	s, err := Open(dbType, uri, PoolConfig{})
+	if err != nil {
+		t.Fatalf("open %s: %v", dbType, err)
+	}
+	t.Cleanup(s.Close)
+	if err := s.InitDatabase(); err != nil {
+		t.Fatalf("init %s: %v", dbType, err)
+	}
+	return s
+}
+
+// forEachBackend 在 SQLite 内存数据库和（配置了 testPostgresEnv 时）PostgreSQL 上运行同一个测试
+// prefix 在每次运行中唯一，用于生成 reqID 和链名
+func forEachBackend(t *testing.T, test func(t *testing.T, s Store, prefix string)) {
+	prefix := fmt.Sprintf("t%d-", time.Now().UnixNano())
+	t.Run(TypeSQLite, func(t *testing.T) {
+		test(t, openTestStore(t, TypeSQLite, "sqlite://:memory:"), prefix)
+	})
+	t.Run(TypePostgres, func(t *testing.T) {
+		uri := os.Getenv(testPostgresEnv)
+		if uri == "" {
+			t.Skipf("%s not set", testPostgresEnv)
+		}
+		test(t, openTestStore(t, TypePostgres, uri), prefix)
+	})
+}
+
+// testMeson 只记录了一边的 Meson
+func testMeson(reqID string) Meson {
+	// 金额超出 int64，检查两种后端都能原样保存
+	amount, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+	return Meson{
+		ReqID:      reqID,
+		ChainA:     "bsc",
+		Timestamp:  1700000000,
+		AmountA:    amount,
+		ActionA:    "TokenBurnExecuted",
+		TxHashA:    reqID + "-a",
+		TokenIndex: 1,
+		BlockA:     100,
+		LogIndexA:  2,
+		AddressA:   "0x01",
+	}
+}
+
+func TestStoreInsertFindUpdate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s Store, prefix string) {
+		reqID := prefix + "meson"
+		meson := testMeson(reqID)
+
+		inserted, err := s.InsertMeson(meson)
+		if err != nil || !inserted {
+			t.Fatalf("InsertMeson = %v, %v; want true", inserted, err)
+		}
+		// 相同 reqID 再次插入时 ON CONFLICT DO NOTHING，不覆盖已有记录
+		duplicate := testMeson(reqID)
+		duplicate.ChainA = "eth"
+		inserted, err = s.InsertMeson(duplicate)
+		if err != nil || inserted {
+			t.Fatalf("second InsertMeson = %v, %v; want false", inserted, err)
+		}
+
+		found, err := s.FindMesonByReqID(reqID)
+		if err != nil || found == nil {
+			t.Fatalf("FindMesonByReqID = %v, %v", found, err)
+		}
+		if found.ChainA != "bsc" || found.AmountA.Cmp(meson.AmountA) != 0 || found.BlockA != 100 || found.LogIndexA != 2 ||
+			found.AddressA != "0x01" || found.IsCheck || found.CompletedAt != nil {
+			t.Errorf("found %+v, want %+v", *found, meson)
+		}
+
+		found.ChainB = "eth"
+		found.AmountB = meson.AmountA
+		found.ActionB = "TokenMintExecuted"
+		found.TxHashB = reqID + "-b"
+		found.BlockB = 200
+		found.LogIndexB = 3
+		found.AddressB = "0x02"
+		found.IsCheck = true
+		if err := s.UpdateMeson(found); err != nil {
+			t.Fatalf("UpdateMeson: %v", err)
+		}
+
+		updated, err := s.FindMesonByReqID(reqID)
+		if err != nil || updated == nil {
+			t.Fatalf("FindMesonByReqID = %v, %v", updated, err)
+		}
+		if updated.ChainB != "eth" || updated.AmountB.Cmp(meson.AmountA) != 0 || updated.BlockB != 200 || updated.LogIndexB != 3 ||
+			updated.AddressB != "0x02" || !updated.IsCheck || updated.CompletedAt == nil {
+			t.Errorf("updated %+v", *updated)
+		}
+		byTx, err := s.FindMesonByTxHash(reqID + "-b")
+		if err != nil || byTx == nil || byTx.ReqID != reqID {
+			t.Errorf("FindMesonByTxHash = %v, %v", byTx, err)
+		}
+	})
+}
+
+func TestStoreFindMissingMeson(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s Store, prefix string) {
+		meson, err := s.FindMesonByReqID(prefix + "missing")
+		if err != nil || meson != nil {
+			t.Errorf("FindMesonByReqID = %v, %v; want nil, nil", meson, err)
+		}
+	})
+}
+
+func TestStoreTxRollbackAndCommit(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s Store, prefix string) {
+		chain := prefix + "chain"
+		rolledBack, committed := prefix+"rolled-back", prefix+"committed"
+
+		tx, err := s.BeginTx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.InsertMeson(testMeson(rolledBack)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.SaveChainProgress(chain, 100); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err = s.BeginTx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.InsertMeson(testMeson(committed)); err != nil {
+			t.Fatal(err)
+		}
+		// 事务中能读到自己的写入
+		if meson, err := tx.FindMesonByReqID(committed); err != nil || meson == nil {
+			t.Fatalf("FindMesonByReqID in tx = %v, %v", meson, err)
+		}
+		if err := tx.SaveChainProgress(chain, 200); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if meson, err := s.FindMesonByReqID(rolledBack); err != nil || meson != nil {
+			t.Errorf("rolled back Meson = %v, %v; want nil", meson, err)
+		}
+		if meson, err := s.FindMesonByReqID(committed); err != nil || meson == nil {
+			t.Errorf("committed Meson = %v, %v", meson, err)
+		}
+		block, ok, err := s.GetChainProgress(chain)
+		if err != nil || !ok || block != 200 {
+			t.Errorf("GetChainProgress = %d, %v, %v; want 200", block, ok, err)
+		}
+	})
+}
+
+func TestSQLiteMemoryDatabaseIsSharedAcrossCalls(t *testing.T) {
+	s := openTestStore(t, TypeSQLite, "sqlite://:memory:")
+
+	// 事务占用连接时的其他查询等待事务结束，而不是打开一个看不到表的新内存数据库
+	tx, err := s.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.InsertMeson(testMeson("shared")); err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		meson, err := s.FindMesonByReqID("shared")
+		if err == nil && meson == nil {
+			err = fmt.Errorf("committed Meson not found")
+		}
+		result <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("query on the memory database: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("query did not finish after the transaction committed")
+	}
+}
+
+func TestStoreCountPendingMesons(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s Store, prefix string) {
+		// PostgreSQL 上可能已有其他数据，只检查数量的变化
+		before, err := s.CountPendingMesons()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"pending-1", "pending-2", "complete"} {
+			if _, err := s.InsertMeson(testMeson(prefix + name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		complete, err := s.FindMesonByReqID(prefix + "complete")
+		if err != nil || complete == nil {
+			t.Fatalf("FindMesonByReqID = %v, %v", complete, err)
+		}
+		complete.ChainB = "eth"
+		complete.AmountB = complete.AmountA
+		complete.ActionB = "TokenMintExecuted"
+		complete.TxHashB = prefix + "complete-b"
+		complete.IsCheck = true
+		if err := s.UpdateMeson(complete); err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := s.CountPendingMesons()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after-before != 2 {
+			t.Errorf("CountPendingMesons grew by %d, want 2", after-before)
+		}
+	})
+}
+
+func TestStoreInsertMesonLeg(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s Store, prefix string) {
+		reqID := prefix + "legs"
+		amount, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+		leg := MesonLeg{ReqID: reqID, Chain: "bsc", Action: "TokenBurnExecuted", Amount: amount, TokenIndex: 1, TxHash: reqID + "-a", Block: 100, LogIndex: 2, Address: "0x01"}
+
+		tx, err := s.BeginTx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		inserted, err := tx.InsertMesonLeg(leg)
+		if err != nil || !inserted {
+			t.Fatalf("InsertMesonLeg = %v, %v; want true", inserted, err)
+		}
+		// 同一条日志再次记录时不插入
+		inserted, err = tx.InsertMesonLeg(leg)
+		if err != nil || inserted {
+			t.Fatalf("second InsertMesonLeg = %v, %v; want false", inserted, err)
+		}
+		// 同一 reqID 在其他链上的事件和同一条链上的另一条日志各记录一行
+		other := leg
+		other.Chain, other.Action, other.TxHash, other.Block = "eth", "TokenMintExecuted", reqID+"-b", 200
+		extra := leg
+		extra.LogIndex = 3
+		for _, l := range []MesonLeg{other, extra} {
+			if inserted, err := tx.InsertMesonLeg(l); err != nil || !inserted {
+				t.Fatalf("InsertMesonLeg(%s log %d) = %v, %v; want true", l.Chain, l.LogIndex, inserted, err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		legs, err := s.FindMesonLegs(reqID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(legs) != 3 {
+			t.Fatalf("FindMesonLegs returned %d legs, want 3", len(legs))
+		}
+		for _, got := range legs {
+			if got.ReqID != reqID || got.Amount.Cmp(amount) != 0 || got.TokenIndex != 1 || got.SeenAt.IsZero() {
+				t.Errorf("leg %+v", got)
+			}
+		}
+	})
+}
+
+func TestUseSwapsPackageLevelStore(t *testing.T) {
+	first := openTestStore(t, TypeSQLite, "sqlite://"+filepath.Join(t.TempDir(), "first.db"))
+	second := openTestStore(t, TypeSQLite, "sqlite://"+filepath.Join(t.TempDir(), "second.db"))
+	previous := Use(first)
+	t.Cleanup(func() { Use(previous) })
+
+	// 包级函数写入当前的 Store，Open 返回的其他 Store 不受影响
+	if _, err := InsertMeson(testMeson("use")); err != nil {
+		t.Fatal(err)
+	}
+	if replaced := Use(second); replaced != first {
+		t.Errorf("Use returned %v, want the first store", replaced)
+	}
+	if Current() != second {
+		t.Error("Current does not return the store passed to Use")
+	}
+	if meson, err := FindMesonByReqID("use"); err != nil || meson != nil {
+		t.Errorf("FindMesonByReqID on the second store = %v, %v, want nil", meson, err)
+	}
+	if meson, err := first.FindMesonByReqID("use"); err != nil || meson == nil {
+		t.Errorf("FindMesonByReqID on the first store = %v, %v, want the inserted Meson", meson, err)
+	}
+}
@@ -2,131 +2,346 @@ package database
 
 import (
 	"context"
-	"sync"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/sirupsen/logrus"
 )
 
 type Meson struct {
-	ReqID     string
-	ChainA    string
-	ChainB    string
-	Timestamp int64
-	AmountA   float64
-	AmountB   float64
-	ActionA   string
-	ActionB   string
-	TxHashA   string
-	TxHashB   string
-	IsCheck   bool
-}
-
-var (
-	connInstance *pgx.Conn
-	connOnce     sync.Once
-	connLock     sync.Mutex
-)
+	ReqID     string `json:"reqId"`
+	ChainA    string `json:"chainA"`
+	ChainB    string `json:"chainB"`
+	Timestamp int64  `json:"timestamp"`
+	AmountA   *big.Int `json:"amountA"` // 金额，代币最小单位
+	AmountB   *big.Int `json:"amountB"` // 金额，代币最小单位
+	ActionA   string `json:"actionA"`
+	ActionB   string `json:"actionB"`
+	TxHashA   string `json:"txHashA"`
+	TxHashB   string `json:"txHashB"`
+	IsCheck   bool   `json:"isCheck"`
+	Reorged   bool   `json:"reorged"`
+	// TokenIndex reqID 中解析出的 token index
+	TokenIndex int `json:"tokenIndex"`
+	// LastAlertedAt 最近一次发送告警的时间，未告警过为 nil
+	LastAlertedAt *time.Time `json:"lastAlertedAt,omitempty"`
+	// TimedOut 只有单边记录且超过等待时间未收到另一边
+	TimedOut bool `json:"timedOut"`
+	// CompletedAt 两边金额一致、跨链完成的时间，未完成为 nil
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// 两边事件所在的区块号和日志序号，加列之前记录的数据为 0
+	BlockA    uint64 `json:"blockA"`
+	LogIndexA uint   `json:"logIndexA"`
+	BlockB    uint64 `json:"blockB"`
+	LogIndexB uint   `json:"logIndexB"`
+	// 两边事件中的地址，burn 为 proposer，mint 为 recipient，加列之前记录的数据为空
+	AddressA string `json:"addressA"`
+	AddressB string `json:"addressB"`
+	// AmountDelta 两边都记录后 amountB - amountA 的差额，只有单边记录时为 nil
+	AmountDelta *big.Int `json:"amountDelta,omitempty"`
+	// TokenIndexB B 边事件解析出的 token index，TokenIndex 为 A 边的；只有单边记录时为 nil
+	TokenIndexB *int `json:"tokenIndexB,omitempty"`
+	// 两边事件所在区块的哈希，用于检查区块是否被回滚，加列之前记录的数据为空
+	BlockHashA string `json:"blockHashA"`
+	BlockHashB string `json:"blockHashB"`
+}
+
+// MesonLeg 一个 reqID 在某条链上的一次事件，meson_legs 表中的一行
+// 每条日志都记录一行，与 meson 表中配对后的记录不同，同一个 reqID 多出的一边也会保留
+type MesonLeg struct {
+	ReqID      string   `json:"reqId"`
+	Chain      string   `json:"chain"`
+	Action     string   `json:"action"`
+	Amount     *big.Int `json:"amount"` // 金额，代币最小单位
+	TokenIndex int      `json:"tokenIndex"`
+	TxHash     string   `json:"txHash"`
+	// Block 和 LogIndex 为事件所在的区块号和日志序号，从加列之前的旧记录迁移的为 0
+	Block    uint64    `json:"block"`
+	LogIndex uint      `json:"logIndex"`
+	Address  string    `json:"address"`
+	// Contract 发出事件的合约地址，一条链上监听多个合约时用于区分，迁移的旧记录为空
+	Contract string    `json:"contract"`
+	SeenAt   time.Time `json:"seenAt"` // 记录的时间，迁移的旧记录为近似值
+	// BlockHash 事件所在区块的哈希，加列之前记录的为空
+	BlockHash string `json:"blockHash"`
+}
 
-// Connect 初始化一个 PostgreSQL 客户端实例
-func Connect(postgresURI string) error {
-	connLock.Lock()
-	defer connLock.Unlock()
+// mesonLegColumns meson_legs 表查询时的列顺序，与 scanMesonLeg 保持一致
+const mesonLegColumns = `reqid, chain, action, amount::TEXT, token_index, tx_hash, block, log_index, COALESCE(address, ''), COALESCE(contract, ''), seen_at, COALESCE(block_hash, '')`
 
-	if connInstance == nil {
-		conn, err := pgx.Connect(context.Background(), postgresURI)
-		if err != nil {
-			return err
+// scanMesonLeg 将一行查询结果解析为 MesonLeg
+func scanMesonLeg(row pgx.Row) (*MesonLeg, error) {
+	var leg MesonLeg
+	var amount *string
+	var block int64
+	var logIndex int64
+	err := row.Scan(&leg.ReqID, &leg.Chain, &leg.Action, &amount, &leg.TokenIndex, &leg.TxHash, &block, &logIndex, &leg.Address, &leg.Contract, &leg.SeenAt, &leg.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	leg.Amount, err = parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+	leg.Block = uint64(block)
+	leg.LogIndex = uint(logIndex)
+	return &leg, nil
+}
+
+// mesonColumns meson 表查询时的列顺序，与 scanMeson 保持一致
+// 金额列为 NUMERIC，以文本形式读取后解析为 *big.Int
+const mesonColumns = `reqid, chain_a, chain_b, timestamp, amount_a::TEXT, amount_b::TEXT, action_a, action_b, tx_hash_a, tx_hash_b, is_check, reorged, token_index, last_alerted_at, timed_out, completed_at,
+	COALESCE(block_a, 0), COALESCE(log_index_a, 0), COALESCE(block_b, 0), COALESCE(log_index_b, 0), COALESCE(address_a, ''), COALESCE(address_b, ''), amount_delta::TEXT, token_index_b,
+	COALESCE(block_hash_a, ''), COALESCE(block_hash_b, '')`
+
+// mesonArchiveColumns 归档时从 meson 复制到 meson_archive 的列，两个后端共用
+// 按列名复制，两张表中列的顺序不需要一致；meson 表新增列时需要同时加到这里
+const mesonArchiveColumns = `reqid, chain_a, chain_b, timestamp, amount_a, amount_b, action_a, action_b, tx_hash_a, tx_hash_b, is_check, reorged, token_index, last_alerted_at, timed_out, completed_at,
+	block_a, log_index_a, block_b, log_index_b, address_a, address_b, amount_delta, token_index_b, block_hash_a, block_hash_b`
+
+// scanMeson 将一行查询结果解析为 Meson
+func scanMeson(row pgx.Row) (*Meson, error) {
+	var meson Meson
+	var amountA, amountB, amountDelta *string
+	err := row.Scan(&meson.ReqID, &meson.ChainA, &meson.ChainB, &meson.Timestamp, &amountA, &amountB, &meson.ActionA, &meson.ActionB, &meson.TxHashA, &meson.TxHashB, &meson.IsCheck, &meson.Reorged, &meson.TokenIndex, &meson.LastAlertedAt, &meson.TimedOut, &meson.CompletedAt,
+		&meson.BlockA, &meson.LogIndexA, &meson.BlockB, &meson.LogIndexB, &meson.AddressA, &meson.AddressB, &amountDelta, &meson.TokenIndexB,
+		&meson.BlockHashA, &meson.BlockHashB)
+	if err != nil {
+		return nil, err
+	}
+	if meson.AmountA, err = parseAmount(amountA); err != nil {
+		return nil, err
+	}
+	if meson.AmountB, err = parseAmount(amountB); err != nil {
+		return nil, err
+	}
+	if amountDelta != nil {
+		if meson.AmountDelta, err = parseAmount(amountDelta); err != nil {
+			return nil, err
 		}
-		logrus.Println("Connected to PostgreSQL!")
-		connInstance = conn
 	}
+	return &meson, nil
+}
 
-	return nil
+// parseAmount 解析 NUMERIC 金额的文本形式，NULL 视为 0
+func parseAmount(value *string) (*big.Int, error) {
+	if value == nil {
+		return new(big.Int), nil
+	}
+	amount, ok := new(big.Int).SetString(*value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount: %s", *value)
+	}
+	return amount, nil
 }
 
-// Disconnect 关闭 PostgreSQL 客户端连接
-func Disconnect() error {
-	connLock.Lock()
-	defer connLock.Unlock()
+// formatAmount 将金额转换为写入 NUMERIC 列的文本，nil 视为 0
+func formatAmount(amount *big.Int) string {
+	if amount == nil {
+		return "0"
+	}
+	return amount.String()
+}
 
-	if connInstance != nil {
-		err := connInstance.Close(context.Background())
-		if err != nil {
-			return err
-		}
-		connInstance = nil
-		logrus.Println("Disconnected from PostgreSQL.")
+// formatOptionalAmount 将可为空的金额转为写入数据库的文本，nil 写入 NULL
+func formatOptionalAmount(amount *big.Int) *string {
+	if amount == nil {
+		return nil
 	}
-	return nil
+	value := amount.String()
+	return &value
+}
+
+// PoolConfig 连接池配置，零值字段使用 pgxpool 的默认值，SQLite 后端忽略这些配置
+type PoolConfig struct {
+	MaxConns       int32         // 连接池最大连接数
+	MinConns       int32         // 连接池保持的最小连接数
+	ConnectTimeout time.Duration // 建立单个连接的超时时间
+	MaxConnIdle    time.Duration // 空闲连接的最长保留时间
+}
+
+// querier 是 *pgxpool.Pool 和 pgx.Tx 共有的查询方法，使同一查询既可以直接执行也可以在事务中执行
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// postgresStore 基于 PostgreSQL 的 Store 实现，每个实例有自己的连接池
+type postgresStore struct {
+	pool *pgxpool.Pool
 }
 
-// InitDatabase 初始化数据库
-func InitDatabase() error {
-	conn := connInstance
-
-	createTableQuery := `
-	CREATE TABLE IF NOT EXISTS meson (
-		reqid TEXT PRIMARY KEY,
-		chain_a TEXT,
-		chain_b TEXT,
-		timestamp BIGINT,
-		amount_a FLOAT8,
-		amount_b FLOAT8,
-		action_a TEXT,
-		action_b TEXT,
-		tx_hash_a TEXT,
-		tx_hash_b TEXT,
-		is_check BOOLEAN
-	);`
-	_, err := conn.Exec(context.Background(), createTableQuery)
+// connectPostgres 初始化一个 PostgreSQL 连接池
+// 连接断开后由连接池自动重建，查询时从池中获取连接
+func connectPostgres(postgresURI string, poolConfig PoolConfig) (*postgresStore, error) {
+	config, err := pgxpool.ParseConfig(postgresURI)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	logrus.Println("Table 'meson' is ready.")
-	return nil
+	if poolConfig.MaxConns > 0 {
+		config.MaxConns = poolConfig.MaxConns
+	}
+	if poolConfig.MinConns > 0 {
+		config.MinConns = poolConfig.MinConns
+	}
+	if poolConfig.ConnectTimeout > 0 {
+		config.ConnConfig.ConnectTimeout = poolConfig.ConnectTimeout
+	}
+	if poolConfig.MaxConnIdle > 0 {
+		config.MaxConnIdleTime = poolConfig.MaxConnIdle
+	}
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Printf("Connected to PostgreSQL! (max conns: %d)", config.MaxConns)
+	return &postgresStore{pool: pool}, nil
+}
+
+// Close 关闭 PostgreSQL 连接池
+func (s *postgresStore) Close() {
+	s.pool.Close()
+	logrus.Println("Disconnected from PostgreSQL.")
+}
+
+// BeginTx 开启一个 PostgreSQL 事务
+func (s *postgresStore) BeginTx() (Tx, error) {
+	tx, err := s.pool.Begin(context.Background())
+	if err != nil {
+		logrus.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	return postgresTx{tx: tx}, nil
+}
+
+// InitDatabase 初始化数据库，按顺序执行 migrations 中尚未执行的表结构变更
+// 新增列或表时在 migrations 末尾追加新的迁移，已部署的数据库启动时会自动升级
+func (s *postgresStore) InitDatabase() error {
+	return migrate(s.pool)
 }
 
 // FindMesonByReqID 根据 reqID 查询 Meson 文档
-func FindMesonByReqID(reqID string) (*Meson, error) {
-	conn := connInstance
+func (s *postgresStore) FindMesonByReqID(reqID string) (*Meson, error) {
+	return findMesonByReqID(s.pool, reqID, false)
+}
+
+// findMesonByReqID 根据 reqID 查询 Meson 文档，forUpdate 为 true 时锁定该行直到事务结束
+func findMesonByReqID(conn querier, reqID string, forUpdate bool) (*Meson, error) {
 
-	query := `SELECT reqid, chain_a, chain_b, timestamp, amount_a, amount_b, action_a, action_b, tx_hash_a, tx_hash_b, is_check FROM meson WHERE reqid = $1`
+	query := `SELECT ` + mesonColumns + ` FROM meson WHERE reqid = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
 	row := conn.QueryRow(context.Background(), query, reqID)
 
-	var meson Meson
-	err := row.Scan(&meson.ReqID, &meson.ChainA, &meson.ChainB, &meson.Timestamp, &meson.AmountA, &meson.AmountB, &meson.ActionA, &meson.ActionB, &meson.TxHashA, &meson.TxHashB, &meson.IsCheck)
+	meson, err := scanMeson(row)
 	if err != nil {
-		if err == pgx.ErrNoRows {
+		if isNoRows(err) {
 			return nil, nil
 		}
 		return nil, err
 	}
 
-	return &meson, nil
+	return meson, nil
+}
+
+// FindMesonByTxHash 根据任意一边的交易哈希查询 Meson 文档，没有匹配的记录时返回 nil
+// 同一行两边的交易哈希相同时只返回这一行；多行匹配时返回时间最新的一行
+func (s *postgresStore) FindMesonByTxHash(txHash string) (*Meson, error) {
+	conn := s.pool
+
+	query := `SELECT ` + mesonColumns + ` FROM meson WHERE tx_hash_a = $1 OR tx_hash_b = $1 ORDER BY timestamp DESC LIMIT 1`
+	row := conn.QueryRow(context.Background(), query, txHash)
+
+	meson, err := scanMeson(row)
+	if err != nil {
+		if isNoRows(err) {
+			return nil, nil
+		}
+		logrus.Errorf("Failed to find Meson by tx hash: %v", err)
+		return nil, err
+	}
+
+	return meson, nil
 }
 
 // InsertMeson 插入 Meson 文档到 meson 集合
-func InsertMeson(meson Meson) error {
-	conn := connInstance
+// 相同 reqID 的记录已存在时不插入，返回 false
+func (s *postgresStore) InsertMeson(meson Meson) (bool, error) {
+	return insertMeson(s.pool, meson)
+}
+
+func insertMeson(conn querier, meson Meson) (bool, error) {
 
-	query := `INSERT INTO meson (reqid, chain_a, chain_b, timestamp, amount_a, amount_b, action_a, action_b, tx_hash_a, tx_hash_b, is_check) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
-	_, err := conn.Exec(context.Background(), query, meson.ReqID, meson.ChainA, meson.ChainB, meson.Timestamp, meson.AmountA, meson.AmountB, meson.ActionA, meson.ActionB, meson.TxHashA, meson.TxHashB, meson.IsCheck)
+	query := `INSERT INTO meson (reqid, chain_a, chain_b, timestamp, amount_a, amount_b, action_a, action_b, tx_hash_a, tx_hash_b, is_check, token_index, block_a, log_index_a, address_a, block_hash_a) VALUES ($1, $2, $3, $4, $5::NUMERIC, $6::NUMERIC, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, ''))
+		ON CONFLICT (reqid) DO NOTHING`
+	tag, err := conn.Exec(context.Background(), query, meson.ReqID, meson.ChainA, meson.ChainB, meson.Timestamp, formatAmount(meson.AmountA), formatAmount(meson.AmountB), meson.ActionA, meson.ActionB, meson.TxHashA, meson.TxHashB, meson.IsCheck, meson.TokenIndex, int64(meson.BlockA), int64(meson.LogIndexA), meson.AddressA, meson.BlockHashA)
 	if err != nil {
 		logrus.Errorf("Failed to insert Meson: %v", err)
-		return err
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		logrus.Infof("Meson with ID %v already exists, not inserted", meson.ReqID)
+		return false, nil
 	}
 
 	logrus.Infof("Inserted Meson with ID: %v", meson.ReqID)
-	return nil
+	return true, nil
+}
+
+// insertMesonLeg 记录一边事件，(reqID, 链, 交易哈希, 日志序号) 相同的记录已存在时不插入，返回 false
+func insertMesonLeg(conn querier, leg MesonLeg) (bool, error) {
+	query := `INSERT INTO meson_legs (reqid, chain, action, amount, token_index, tx_hash, block, log_index, address, contract, block_hash) VALUES ($1, $2, $3, $4::NUMERIC, $5, $6, $7, $8, $9, NULLIF($10, ''), NULLIF($11, ''))
+		ON CONFLICT (reqid, chain, tx_hash, log_index) DO NOTHING`
+	tag, err := conn.Exec(context.Background(), query, leg.ReqID, leg.Chain, leg.Action, formatAmount(leg.Amount), leg.TokenIndex, leg.TxHash, int64(leg.Block), int64(leg.LogIndex), leg.Address, leg.Contract, leg.BlockHash)
+	if err != nil {
+		logrus.Errorf("Failed to insert Meson leg: %v", err)
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// FindMesonLegs 查询 reqID 在各条链上记录的所有事件，按记录时间排序
+func (s *postgresStore) FindMesonLegs(reqID string) ([]MesonLeg, error) {
+	conn := s.pool
+
+	query := `SELECT ` + mesonLegColumns + ` FROM meson_legs WHERE reqid = $1 ORDER BY seen_at, chain, block, log_index`
+	rows, err := conn.Query(context.Background(), query, reqID)
+	if err != nil {
+		logrus.Errorf("Failed to find Meson legs: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var legs []MesonLeg
+	for rows.Next() {
+		leg, err := scanMesonLeg(rows)
+		if err != nil {
+			logrus.Errorf("Failed to decode Meson leg: %v", err)
+			return nil, err
+		}
+		legs = append(legs, *leg)
+	}
+	return legs, rows.Err()
 }
 
 // UpdateMeson 更新 Meson 文档
-func UpdateMeson(meson *Meson) error {
-	conn := connInstance
+func (s *postgresStore) UpdateMeson(meson *Meson) error {
+	return updateMeson(s.pool, meson)
+}
+
+func updateMeson(conn querier, meson *Meson) error {
 
-	query := `UPDATE meson SET chain_b = $1, amount_b = $2, action_b = $3, tx_hash_b = $4, is_check = $5 WHERE reqid = $6`
-	_, err := conn.Exec(context.Background(), query, meson.ChainB, meson.AmountB, meson.ActionB, meson.TxHashB, meson.IsCheck, meson.ReqID)
+	query := `UPDATE meson SET chain_b = $1, amount_b = $2::NUMERIC, action_b = $3, tx_hash_b = $4, is_check = $5, timed_out = false,
+		completed_at = CASE WHEN $5 THEN NOW() ELSE NULL END, block_b = $6, log_index_b = $7, address_b = $8, amount_delta = $9::NUMERIC, token_index_b = $10, block_hash_b = NULLIF($11, '') WHERE reqid = $12`
+	_, err := conn.Exec(context.Background(), query, meson.ChainB, formatAmount(meson.AmountB), meson.ActionB, meson.TxHashB, meson.IsCheck, int64(meson.BlockB), int64(meson.LogIndexB), meson.AddressB, formatOptionalAmount(meson.AmountDelta), meson.TokenIndexB, meson.BlockHashB, meson.ReqID)
 	if err != nil {
 		logrus.Errorf("Failed to update Meson: %v", err)
 		return err
@@ -136,27 +351,361 @@ func UpdateMeson(meson *Meson) error {
 	return nil
 }
 
-// FindUncheckedMesons 查询 is_check 为 false 的 Meson 文档
-func FindUncheckedMesons() ([]Meson, error) {
-	conn := connInstance
+// FindUncheckedMesons 查询创建时间晚于 since、排在 after 之后且 is_check 为 false 的 Meson 文档，最多 limit 条
+func (s *postgresStore) FindUncheckedMesons(since int64, after MesonCursor, limit int) ([]Meson, error) {
+	conn := s.pool
 
-	query := `SELECT reqid, chain_a, chain_b, timestamp, amount_a, amount_b, action_a, action_b, tx_hash_a, tx_hash_b, is_check FROM meson WHERE is_check = false`
-	rows, err := conn.Query(context.Background(), query)
+	query := `SELECT ` + mesonColumns + ` FROM meson WHERE is_check = false AND timestamp > $1 AND (timestamp, reqid) > ($2, $3)
+	ORDER BY timestamp, reqid LIMIT $4`
+	rows, err := conn.Query(context.Background(), query, since, after.Timestamp, after.ReqID, limit)
 	if err != nil {
 		logrus.Errorf("Failed to find unchecked Mesons: %v", err)
 		return nil, err
 	}
+
+	return collectMesons(rows)
+}
+
+// ArchiveMesons 将创建时间早于 before 的 Meson 文档移到 meson_archive 表，返回移动的数量
+// 插入和删除在同一条语句中完成，不会出现只复制未删除的情况
+func (s *postgresStore) ArchiveMesons(before int64) (int64, error) {
+	conn := s.pool
+
+	query := `WITH moved AS (DELETE FROM meson WHERE timestamp < $1 RETURNING *)
+	INSERT INTO meson_archive (` + mesonArchiveColumns + `, archived_at) SELECT ` + mesonArchiveColumns + `, NOW() FROM moved`
+	tag, err := conn.Exec(context.Background(), query, before)
+	if err != nil {
+		logrus.Errorf("Failed to archive Mesons: %v", err)
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// collectMesons 读取多行查询结果并关闭 rows
+func collectMesons(rows pgx.Rows) ([]Meson, error) {
 	defer rows.Close()
 
 	var results []Meson
 	for rows.Next() {
-		var meson Meson
-		err := rows.Scan(&meson.ReqID, &meson.ChainA, &meson.ChainB, &meson.Timestamp, &meson.AmountA, &meson.AmountB, &meson.ActionA, &meson.ActionB, &meson.TxHashA, &meson.TxHashB, &meson.IsCheck)
+		meson, err := scanMeson(rows)
+		if err != nil {
+			logrus.Errorf("Failed to decode Meson: %v", err)
+			return nil, err
+		}
+		results = append(results, *meson)
+	}
+
+	if rows.Err() != nil {
+		logrus.Errorf("Rows error: %v", rows.Err())
+		return nil, rows.Err()
+	}
+
+	return results, nil
+}
+
+// MesonFilter Meson 文档的查询条件，零值字段表示不过滤
+type MesonFilter struct {
+	Checked *bool  // 按 is_check 过滤
+	Chain   string // 任一侧链名称匹配
+	From    int64  // 创建时间下限（含），Unix 秒
+	To      int64  // 创建时间上限（含），Unix 秒
+	Limit   int
+	Offset  int
+}
+
+// MesonCursor 分批读取 Meson 文档时上一批最后一条的位置，按 (Timestamp, ReqID) 排序，零值表示从头开始
+type MesonCursor struct {
+	Timestamp int64
+	ReqID     string
+}
+
+// where 根据过滤条件构建 WHERE 子句和参数
+func (f MesonFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.Checked != nil {
+		args = append(args, *f.Checked)
+		conditions = append(conditions, fmt.Sprintf("is_check = $%d", len(args)))
+	}
+	if f.Chain != "" {
+		args = append(args, f.Chain)
+		conditions = append(conditions, fmt.Sprintf("(chain_a = $%d OR chain_b = $%d)", len(args), len(args)))
+	}
+	if f.From > 0 {
+		args = append(args, f.From)
+		conditions = append(conditions, fmt.Sprintf("timestamp >= $%d", len(args)))
+	}
+	if f.To > 0 {
+		args = append(args, f.To)
+		conditions = append(conditions, fmt.Sprintf("timestamp <= $%d", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// FindMesons 按过滤条件分页查询 Meson 文档，按创建时间倒序
+func (s *postgresStore) FindMesons(filter MesonFilter) ([]Meson, error) {
+	conn := s.pool
+
+	where, args := filter.where()
+	query := `SELECT ` + mesonColumns + ` FROM meson` + where + ` ORDER BY timestamp DESC, reqid`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := conn.Query(context.Background(), query, args...)
+	if err != nil {
+		logrus.Errorf("Failed to find Mesons: %v", err)
+		return nil, err
+	}
+
+	return collectMesons(rows)
+}
+
+// IterateMesons 按过滤条件逐行读取 Meson 文档交给 fn，按创建时间正序，忽略分页参数
+// pgx 在 rows.Next 时才从连接中读取下一行，结果不会一次性载入内存；fn 返回错误时停止读取并返回该错误
+func (s *postgresStore) IterateMesons(filter MesonFilter, fn func(Meson) error) error {
+	conn := s.pool
+
+	where, args := filter.where()
+	query := `SELECT ` + mesonColumns + ` FROM meson` + where + ` ORDER BY timestamp, reqid`
+	rows, err := conn.Query(context.Background(), query, args...)
+	if err != nil {
+		logrus.Errorf("Failed to iterate Mesons: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		meson, err := scanMeson(rows)
 		if err != nil {
 			logrus.Errorf("Failed to decode Meson: %v", err)
+			return err
+		}
+		err = fn(*meson)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountMesons 统计满足过滤条件的 Meson 文档数量，忽略分页参数
+func (s *postgresStore) CountMesons(filter MesonFilter) (int64, error) {
+	conn := s.pool
+
+	where, args := filter.where()
+	var count int64
+	err := conn.QueryRow(context.Background(), `SELECT COUNT(*) FROM meson`+where, args...).Scan(&count)
+	if err != nil {
+		logrus.Errorf("Failed to count Mesons: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// FindMesonsByChainAndTime 查询指定链上创建时间在 [from, to] 区间内的 Meson 文档
+func FindMesonsByChainAndTime(chainName string, from, to int64, limit, offset int) ([]Meson, error) {
+	return FindMesons(MesonFilter{Chain: chainName, From: from, To: to, Limit: limit, Offset: offset})
+}
+
+// FindRecentMesonsByChain 查询指定链上创建时间不早于 since 且未被标记回滚的 Meson 文档
+func (s *postgresStore) FindRecentMesonsByChain(chainName string, since int64) ([]Meson, error) {
+	conn := s.pool
+
+	query := `SELECT ` + mesonColumns + ` FROM meson WHERE (chain_a = $1 OR chain_b = $1) AND timestamp >= $2 AND reorged = false`
+	rows, err := conn.Query(context.Background(), query, chainName, since)
+	if err != nil {
+		logrus.Errorf("Failed to find recent Mesons: %v", err)
+		return nil, err
+	}
+
+	return collectMesons(rows)
+}
+
+// MarkMesonReorged 将 Meson 文档标记为交易已被回滚
+func (s *postgresStore) MarkMesonReorged(reqID string) error {
+	conn := s.pool
+
+	query := `UPDATE meson SET reorged = true WHERE reqid = $1`
+	_, err := conn.Exec(context.Background(), query, reqID)
+	if err != nil {
+		logrus.Errorf("Failed to mark Meson as reorged: %v", err)
+		return err
+	}
+
+	logrus.Infof("Marked Meson %v as reorged", reqID)
+	return nil
+}
+
+// MoveMesonLeg 记录一边事件所在的新区块，交易在回滚后被重新打包到其他区块时使用
+// 同时更新 meson 表中对应的一边和 meson_legs 中的记录
+func (s *postgresStore) MoveMesonLeg(reqID, chainName, txHash string, block uint64, logIndex uint, blockHash string) error {
+	ctx := context.Background()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		logrus.Errorf("Failed to begin transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE meson SET
+		block_a = CASE WHEN chain_a = $2 AND tx_hash_a = $3 THEN $4 ELSE block_a END,
+		log_index_a = CASE WHEN chain_a = $2 AND tx_hash_a = $3 THEN $5 ELSE log_index_a END,
+		block_hash_a = CASE WHEN chain_a = $2 AND tx_hash_a = $3 THEN $6 ELSE block_hash_a END,
+		block_b = CASE WHEN chain_b = $2 AND tx_hash_b = $3 THEN $4 ELSE block_b END,
+		log_index_b = CASE WHEN chain_b = $2 AND tx_hash_b = $3 THEN $5 ELSE log_index_b END,
+		block_hash_b = CASE WHEN chain_b = $2 AND tx_hash_b = $3 THEN $6 ELSE block_hash_b END
+		WHERE reqid = $1`, reqID, chainName, txHash, int64(block), int64(logIndex), blockHash)
+	if err != nil {
+		logrus.Errorf("Failed to move Meson leg: %v", err)
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE meson_legs SET block = $4, log_index = $5, block_hash = $6 WHERE reqid = $1 AND chain = $2 AND tx_hash = $3`,
+		reqID, chainName, txHash, int64(block), int64(logIndex), blockHash)
+	if err != nil {
+		logrus.Errorf("Failed to move Meson leg: %v", err)
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetChainProgress 查询指定链上次处理到的区块号
+// 第二个返回值表示是否存在记录
+func (s *postgresStore) GetChainProgress(chainName string) (uint64, bool, error) {
+	conn := s.pool
+
+	query := `SELECT last_block FROM chain_progress WHERE chain_name = $1`
+	row := conn.QueryRow(context.Background(), query, chainName)
+
+	var lastBlock int64
+	err := row.Scan(&lastBlock)
+	if err != nil {
+		if isNoRows(err) {
+			return 0, false, nil
+		}
+		logrus.Errorf("Failed to query chain progress: %v", err)
+		return 0, false, err
+	}
+
+	return uint64(lastBlock), true, nil
+}
+
+// SaveChainProgress 保存指定链处理到的区块号
+func (s *postgresStore) SaveChainProgress(chainName string, block uint64) error {
+	return saveChainProgress(s.pool, chainName, block)
+}
+
+func saveChainProgress(conn querier, chainName string, block uint64) error {
+
+	query := `INSERT INTO chain_progress (chain_name, last_block, updated_at) VALUES ($1, $2, NOW())
+	ON CONFLICT (chain_name) DO UPDATE SET last_block = EXCLUDED.last_block, updated_at = EXCLUDED.updated_at`
+	_, err := conn.Exec(context.Background(), query, chainName, int64(block))
+	if err != nil {
+		logrus.Errorf("Failed to save chain progress: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// FindTimedOutPendingMesons 查询创建时间早于 before 且仍只有单边记录的 Meson 文档
+func (s *postgresStore) FindTimedOutPendingMesons(before int64) ([]Meson, error) {
+	conn := s.pool
+
+	query := `SELECT ` + mesonColumns + ` FROM meson WHERE COALESCE(chain_b, '') = '' AND is_check = false AND timestamp < $1`
+	rows, err := conn.Query(context.Background(), query, before)
+	if err != nil {
+		logrus.Errorf("Failed to find timed out pending Mesons: %v", err)
+		return nil, err
+	}
+
+	return collectMesons(rows)
+}
+
+// MarkMesonTimedOut 将单边 Meson 文档标记为超时
+func (s *postgresStore) MarkMesonTimedOut(reqID string) error {
+	conn := s.pool
+
+	query := `UPDATE meson SET timed_out = true WHERE reqid = $1`
+	_, err := conn.Exec(context.Background(), query, reqID)
+	if err != nil {
+		logrus.Errorf("Failed to mark Meson as timed out: %v", err)
+		return err
+	}
+
+	logrus.Infof("Marked Meson %v as timed out", reqID)
+	return nil
+}
+
+// MarkMesonAlerted 记录 Meson 文档最近一次发送告警的时间
+func (s *postgresStore) MarkMesonAlerted(reqID string, alertedAt time.Time) error {
+	conn := s.pool
+
+	query := `UPDATE meson SET last_alerted_at = $1 WHERE reqid = $2`
+	_, err := conn.Exec(context.Background(), query, alertedAt, reqID)
+	if err != nil {
+		logrus.Errorf("Failed to mark Meson as alerted: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FailedAlert 发送失败、等待重试的告警
+type FailedAlert struct {
+	ID        int64
+	Channel   string // 告警渠道，如 telegram、lark
+	Payload   string // 重新发送所需的消息内容（JSON）
+	Error     string
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// InsertFailedAlert 保存一条发送失败的告警
+func (s *postgresStore) InsertFailedAlert(channel, payload, errMsg string) error {
+	conn := s.pool
+
+	query := `INSERT INTO failed_alerts (channel, payload, error) VALUES ($1, $2, $3)`
+	_, err := conn.Exec(context.Background(), query, channel, payload, errMsg)
+	if err != nil {
+		logrus.Errorf("Failed to insert failed alert: %v", err)
+		return err
+	}
+
+	logrus.Infof("Saved undelivered %s alert for later retry", channel)
+	return nil
+}
+
+// FindFailedAlerts 查询所有发送失败的告警，按创建时间排序
+func (s *postgresStore) FindFailedAlerts() ([]FailedAlert, error) {
+	conn := s.pool
+
+	query := `SELECT id, channel, payload, error, attempts, created_at FROM failed_alerts ORDER BY id`
+	rows, err := conn.Query(context.Background(), query)
+	if err != nil {
+		logrus.Errorf("Failed to find failed alerts: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []FailedAlert
+	for rows.Next() {
+		var alert FailedAlert
+		err := rows.Scan(&alert.ID, &alert.Channel, &alert.Payload, &alert.Error, &alert.Attempts, &alert.CreatedAt)
+		if err != nil {
+			logrus.Errorf("Failed to decode failed alert: %v", err)
 			return nil, err
 		}
-		results = append(results, meson)
+		results = append(results, alert)
 	}
 
 	if rows.Err() != nil {
@@ -166,3 +715,137 @@ func FindUncheckedMesons() ([]Meson, error) {
 
 	return results, nil
 }
+
+// DeleteFailedAlert 删除已经重新发送成功的告警
+func (s *postgresStore) DeleteFailedAlert(id int64) error {
+	conn := s.pool
+
+	_, err := conn.Exec(context.Background(), `DELETE FROM failed_alerts WHERE id = $1`, id)
+	if err != nil {
+		logrus.Errorf("Failed to delete failed alert: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateFailedAlertAttempt 记录一次失败的重新发送，payload 为下次需要重新发送的内容
+func (s *postgresStore) UpdateFailedAlertAttempt(id int64, payload, errMsg string) error {
+	conn := s.pool
+
+	_, err := conn.Exec(context.Background(), `UPDATE failed_alerts SET attempts = attempts + 1, payload = $1, error = $2 WHERE id = $3`, payload, errMsg, id)
+	if err != nil {
+		logrus.Errorf("Failed to update failed alert: %v", err)
+		return err
+	}
+	return nil
+}
+
+// CountCompletedMesons 统计完成时间在 [from, to) 内的跨链数量，Unix 秒，为 0 时表示不限制
+func (s *postgresStore) CountCompletedMesons(from, to int64) (int64, error) {
+	conn := s.pool
+
+	conditions := []string{"completed_at IS NOT NULL"}
+	var args []interface{}
+	if from > 0 {
+		args = append(args, from)
+		conditions = append(conditions, fmt.Sprintf("completed_at >= to_timestamp($%d)", len(args)))
+	}
+	if to > 0 {
+		args = append(args, to)
+		conditions = append(conditions, fmt.Sprintf("completed_at < to_timestamp($%d)", len(args)))
+	}
+
+	var count int64
+	query := `SELECT COUNT(*) FROM meson WHERE ` + strings.Join(conditions, " AND ")
+	err := conn.QueryRow(context.Background(), query, args...).Scan(&count)
+	if err != nil {
+		logrus.Errorf("Failed to count completed Mesons: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// CountPendingMesons 统计 chain_b 为空的 Meson 数量
+func (s *postgresStore) CountPendingMesons() (int64, error) {
+	conn := s.pool
+
+	var count int64
+	query := `SELECT COUNT(*) FROM meson WHERE COALESCE(chain_b, '') = ''`
+	err := conn.QueryRow(context.Background(), query).Scan(&count)
+	if err != nil {
+		logrus.Errorf("Failed to count pending Mesons: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// MesonSummary 一段时间内创建的 Meson 按状态统计的数量
+type MesonSummary struct {
+	Chain      string // 链名称，汇总所有链时为空
+	Total      int64
+	Completed  int64 // 两边金额一致
+	Pending    int64 // 只有单边记录
+	Mismatched int64 // 两边都有记录但未通过校验
+}
+
+// summaryColumns 按状态统计数量的列，与 MesonSummary 的字段顺序一致
+const summaryColumns = `COUNT(*),
+	COUNT(*) FILTER (WHERE is_check = true),
+	COUNT(*) FILTER (WHERE COALESCE(chain_b, '') = '' AND is_check = false),
+	COUNT(*) FILTER (WHERE COALESCE(chain_b, '') <> '' AND is_check = false)`
+
+// SummarizeMesons 统计创建时间在 [from, to) 内的 Meson，返回所有链的汇总和按链的统计
+// 按链统计时一条跨链记录会同时计入两侧的链
+func (s *postgresStore) SummarizeMesons(from, to int64) (MesonSummary, []MesonSummary, error) {
+	conn := s.pool
+
+	var total MesonSummary
+	query := `SELECT ` + summaryColumns + ` FROM meson WHERE timestamp >= $1 AND timestamp < $2`
+	err := conn.QueryRow(context.Background(), query, from, to).Scan(&total.Total, &total.Completed, &total.Pending, &total.Mismatched)
+	if err != nil {
+		logrus.Errorf("Failed to summarize Mesons: %v", err)
+		return total, nil, err
+	}
+
+	query = `SELECT chain, ` + summaryColumns + ` FROM (
+		SELECT chain_a AS chain, chain_b, is_check FROM meson WHERE timestamp >= $1 AND timestamp < $2
+		UNION ALL
+		SELECT chain_b AS chain, chain_b, is_check FROM meson WHERE timestamp >= $1 AND timestamp < $2 AND COALESCE(chain_b, '') <> ''
+	) legs GROUP BY chain ORDER BY chain`
+	rows, err := conn.Query(context.Background(), query, from, to)
+	if err != nil {
+		logrus.Errorf("Failed to summarize Mesons by chain: %v", err)
+		return total, nil, err
+	}
+	defer rows.Close()
+
+	var byChain []MesonSummary
+	for rows.Next() {
+		var summary MesonSummary
+		err := rows.Scan(&summary.Chain, &summary.Total, &summary.Completed, &summary.Pending, &summary.Mismatched)
+		if err != nil {
+			logrus.Errorf("Failed to decode Meson summary: %v", err)
+			return total, nil, err
+		}
+		byChain = append(byChain, summary)
+	}
+	if rows.Err() != nil {
+		logrus.Errorf("Rows error: %v", rows.Err())
+		return total, nil, rows.Err()
+	}
+
+	return total, byChain, nil
+}
+
+// ClaimDailySummary 记录某天的每日汇总已发送，返回 false 表示当天已经发送过
+// 先记录再发送，进程重启后不会重复发送
+func (s *postgresStore) ClaimDailySummary(date time.Time) (bool, error) {
+	conn := s.pool
+
+	tag, err := conn.Exec(context.Background(), `INSERT INTO daily_summaries (summary_date) VALUES ($1) ON CONFLICT (summary_date) DO NOTHING`, date.UTC().Format("2006-01-02"))
+	if err != nil {
+		logrus.Errorf("Failed to claim daily summary: %v", err)
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// migrationLockID 执行迁移时使用的 advisory lock，避免多个实例同时迁移
+const migrationLockID = 7242031
+
+// migration 一次表结构变更，version 按顺序递增，已发布的迁移不能修改，只能追加新的迁移
+// statements 需要能在旧部署上重复执行，第一次引入版本表时已有的列和表会被跳过
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// migrations 按版本顺序排列的所有迁移
+var migrations = []migration{
+	{1, "create meson table", []string{`
+	CREATE TABLE IF NOT EXISTS meson (
+		reqid TEXT PRIMARY KEY,
+		chain_a TEXT,
+		chain_b TEXT,
+		timestamp BIGINT,
+		amount_a NUMERIC(78, 0),
+		amount_b NUMERIC(78, 0),
+		action_a TEXT,
+		action_b TEXT,
+		tx_hash_a TEXT,
+		tx_hash_b TEXT,
+		is_check BOOLEAN
+	);`}},
+	{2, "add meson reorged", []string{
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS reorged BOOLEAN NOT NULL DEFAULT false`,
+	}},
+	{3, "add meson token_index", []string{
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS token_index INTEGER NOT NULL DEFAULT 0`,
+	}},
+	{4, "add meson alert state", []string{
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS last_alerted_at TIMESTAMPTZ`,
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS timed_out BOOLEAN NOT NULL DEFAULT false`,
+	}},
+	// 金额列由 FLOAT8 改为以最小单位保存的 BIGINT，避免浮点比较误差
+	{5, "store amounts as integers", []string{`
+	DO $$
+	BEGIN
+		IF (SELECT data_type FROM information_schema.columns WHERE table_name = 'meson' AND column_name = 'amount_a') = 'double precision' THEN
+			ALTER TABLE meson
+				ALTER COLUMN amount_a TYPE BIGINT USING ROUND(amount_a)::BIGINT,
+				ALTER COLUMN amount_b TYPE BIGINT USING ROUND(amount_b)::BIGINT;
+		END IF;
+	END $$;`}},
+	{6, "create chain_progress table", []string{`
+	CREATE TABLE IF NOT EXISTS chain_progress (
+		chain_name TEXT PRIMARY KEY,
+		last_block BIGINT,
+		updated_at TIMESTAMPTZ
+	);`}},
+	{7, "create failed_alerts table", []string{`
+	CREATE TABLE IF NOT EXISTS failed_alerts (
+		id BIGSERIAL PRIMARY KEY,
+		channel TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		error TEXT,
+		attempts INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`}},
+	{8, "add meson completed_at", []string{
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ`,
+		// 加列之前已完成的记录没有完成时间，用创建时间近似
+		`UPDATE meson SET completed_at = to_timestamp(timestamp) WHERE is_check = true AND completed_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS meson_completed_at_idx ON meson (completed_at)`,
+	}},
+	// 金额列由 BIGINT 改为 NUMERIC，18 位小数的代币金额可能超出 BIGINT 范围
+	{9, "store amounts as numeric", []string{`
+	DO $$
+	BEGIN
+		IF (SELECT data_type FROM information_schema.columns WHERE table_name = 'meson' AND column_name = 'amount_a') = 'bigint' THEN
+			ALTER TABLE meson
+				ALTER COLUMN amount_a TYPE NUMERIC(78, 0),
+				ALTER COLUMN amount_b TYPE NUMERIC(78, 0);
+		END IF;
+	END $$;`}},
+	{10, "create daily_summaries table", []string{`
+	CREATE TABLE IF NOT EXISTS daily_summaries (
+		summary_date DATE PRIMARY KEY,
+		sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`}},
+	{11, "add meson block and log index", []string{
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS block_a BIGINT`,
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS log_index_a INTEGER`,
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS block_b BIGINT`,
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS log_index_b INTEGER`,
+	}},
+	{12, "index meson tx hashes", []string{
+		`CREATE INDEX IF NOT EXISTS meson_tx_hash_a_idx ON meson (tx_hash_a)`,
+		`CREATE INDEX IF NOT EXISTS meson_tx_hash_b_idx ON meson (tx_hash_b)`,
+	}},
+	{13, "add meson addresses", []string{
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS address_a TEXT`,
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS address_b TEXT`,
+	}},
+	{14, "add meson amount_delta", []string{
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS amount_delta NUMERIC(78, 0)`,
+		`UPDATE meson SET amount_delta = amount_b - amount_a WHERE chain_b IS NOT NULL AND chain_b <> '' AND amount_delta IS NULL`,
+	}},
+	// 已完成的记录两边解析自同一个 reqID，B 边的 token index 与 A 边相同
+	{15, "add meson token_index_b", []string{
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS token_index_b INTEGER`,
+		`UPDATE meson SET token_index_b = token_index WHERE chain_b IS NOT NULL AND chain_b <> '' AND token_index_b IS NULL`,
+	}},
+	// 每条事件一行，同一个 reqID 在两条链上各有一行，多出的一边也能记录；meson 表保留为配对后的结果
+	// 已有记录的两边迁移过来，记录时间按创建时间和完成时间近似
+	{16, "create meson_legs table", []string{`
+	CREATE TABLE IF NOT EXISTS meson_legs (
+		reqid TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		action TEXT NOT NULL,
+		amount NUMERIC(78, 0),
+		token_index INTEGER NOT NULL DEFAULT 0,
+		tx_hash TEXT NOT NULL,
+		block BIGINT NOT NULL DEFAULT 0,
+		log_index INTEGER NOT NULL DEFAULT 0,
+		address TEXT,
+		seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (reqid, chain, tx_hash, log_index)
+	)`,
+		`INSERT INTO meson_legs (reqid, chain, action, amount, token_index, tx_hash, block, log_index, address, seen_at)
+		SELECT reqid, chain_a, COALESCE(action_a, ''), amount_a, token_index, COALESCE(tx_hash_a, ''), COALESCE(block_a, 0), COALESCE(log_index_a, 0), address_a, to_timestamp(timestamp)
+		FROM meson WHERE COALESCE(chain_a, '') <> ''
+		ON CONFLICT DO NOTHING`,
+		`INSERT INTO meson_legs (reqid, chain, action, amount, token_index, tx_hash, block, log_index, address, seen_at)
+		SELECT reqid, chain_b, COALESCE(action_b, ''), amount_b, COALESCE(token_index_b, token_index), COALESCE(tx_hash_b, ''), COALESCE(block_b, 0), COALESCE(log_index_b, 0), address_b, COALESCE(completed_at, to_timestamp(timestamp))
+		FROM meson WHERE COALESCE(chain_b, '') <> ''
+		ON CONFLICT DO NOTHING`,
+	}},
+	// 一条链上可以监听多个合约，记录每条事件由哪个合约发出；旧记录无法确定，保留为空
+	{17, "add meson_legs contract", []string{
+		`ALTER TABLE meson_legs ADD COLUMN IF NOT EXISTS contract TEXT`,
+	}},
+	// 超过保留时间的记录移到 meson_archive，列与 meson 相同并多一个 archived_at；meson 表新增列时需要同时加到 meson_archive 和 mesonArchiveColumns
+	{18, "create meson_archive table", []string{
+		`CREATE INDEX IF NOT EXISTS meson_is_check_timestamp_idx ON meson (is_check, timestamp)`,
+		`CREATE TABLE IF NOT EXISTS meson_archive (LIKE meson INCLUDING DEFAULTS)`,
+		`ALTER TABLE meson_archive ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+		`CREATE INDEX IF NOT EXISTS meson_archive_reqid_idx ON meson_archive (reqid)`,
+	}},
+	// 未完成的记录按 (timestamp, reqid) 分批读取，部分索引只包含 is_check = false 的行
+	{19, "index unchecked mesons", []string{
+		`CREATE INDEX IF NOT EXISTS meson_unchecked_idx ON meson (timestamp, reqid) WHERE is_check = false`,
+	}},
+	// 记录事件所在区块的哈希，回滚检查时与链上同一高度的区块比较；旧记录没有，仍按交易回执检查
+	{20, "add block hashes", []string{
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS block_hash_a TEXT`,
+		`ALTER TABLE meson ADD COLUMN IF NOT EXISTS block_hash_b TEXT`,
+		`ALTER TABLE meson_archive ADD COLUMN IF NOT EXISTS block_hash_a TEXT`,
+		`ALTER TABLE meson_archive ADD COLUMN IF NOT EXISTS block_hash_b TEXT`,
+		`ALTER TABLE meson_legs ADD COLUMN IF NOT EXISTS block_hash TEXT`,
+	}},
+}
+
+// migrate 按版本顺序执行尚未执行的迁移，每个迁移在单独的事务中执行并记录到 schema_migrations 表
+func migrate(conn *pgxpool.Pool) error {
+	_, err := conn.Exec(context.Background(), `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		ok, err := applyMigration(conn, m)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+		}
+		if ok {
+			logrus.Infof("Applied migration %d: %s", m.version, m.name)
+			applied++
+		}
+	}
+
+	logrus.Infof("Database schema is at version %d (%d migration(s) applied)", migrations[len(migrations)-1].version, applied)
+	return nil
+}
+
+// applyMigration 执行一个迁移，已执行过时返回 false
+// 事务中持有 advisory lock，其他实例会等待当前迁移提交后再检查版本
+func applyMigration(conn *pgxpool.Pool, m migration) (bool, error) {
+	ctx := context.Background()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID)
+	if err != nil {
+		return false, err
+	}
+
+	var version int
+	err = tx.QueryRow(ctx, `SELECT version FROM schema_migrations WHERE version = $1`, m.version).Scan(&version)
+	if err == nil {
+		return false, nil
+	}
+	if !isNoRows(err) {
+		return false, err
+	}
+
+	for _, statement := range m.statements {
+		_, err = tx.Exec(ctx, statement)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
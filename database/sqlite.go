@@ -0,0 +1,830 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTimeLayout SQLite 中时间列的文本格式（UTC），与 CURRENT_TIMESTAMP 一致，可以直接按文本比较
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// sqliteMesonColumns SQLite 中 meson 表查询时的列顺序，与 scanMeson 保持一致
+// 金额列以十进制文本保存，不需要类型转换
+const sqliteMesonColumns = `reqid, chain_a, chain_b, timestamp, amount_a, amount_b, action_a, action_b, tx_hash_a, tx_hash_b, is_check, reorged, token_index, last_alerted_at, timed_out, completed_at,
+	COALESCE(block_a, 0), COALESCE(log_index_a, 0), COALESCE(block_b, 0), COALESCE(log_index_b, 0), COALESCE(address_a, ''), COALESCE(address_b, ''), amount_delta, token_index_b,
+	COALESCE(block_hash_a, ''), COALESCE(block_hash_b, '')`
+
+// sqliteMigrations SQLite 后端按版本顺序排列的迁移，新增列或表时与 migrations 一起追加
+// SQLite 的数值类型会把超出 int64 的整数转成浮点数，金额列使用 TEXT 保存
+var sqliteMigrations = []migration{
+	{1, "create tables", []string{`
+	CREATE TABLE IF NOT EXISTS meson (
+		reqid TEXT PRIMARY KEY,
+		chain_a TEXT,
+		chain_b TEXT,
+		timestamp INTEGER,
+		amount_a TEXT,
+		amount_b TEXT,
+		action_a TEXT,
+		action_b TEXT,
+		tx_hash_a TEXT,
+		tx_hash_b TEXT,
+		is_check BOOLEAN,
+		reorged BOOLEAN NOT NULL DEFAULT false,
+		token_index INTEGER NOT NULL DEFAULT 0,
+		last_alerted_at DATETIME,
+		timed_out BOOLEAN NOT NULL DEFAULT false,
+		completed_at DATETIME,
+		block_a INTEGER,
+		log_index_a INTEGER,
+		block_b INTEGER,
+		log_index_b INTEGER
+	)`,
+		`CREATE INDEX IF NOT EXISTS meson_completed_at_idx ON meson (completed_at)`,
+		`CREATE INDEX IF NOT EXISTS meson_tx_hash_a_idx ON meson (tx_hash_a)`,
+		`CREATE INDEX IF NOT EXISTS meson_tx_hash_b_idx ON meson (tx_hash_b)`, `
+	CREATE TABLE IF NOT EXISTS chain_progress (
+		chain_name TEXT PRIMARY KEY,
+		last_block INTEGER,
+		updated_at DATETIME
+	)`, `
+	CREATE TABLE IF NOT EXISTS failed_alerts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		channel TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		error TEXT,
+		attempts INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`, `
+	CREATE TABLE IF NOT EXISTS daily_summaries (
+		summary_date TEXT PRIMARY KEY,
+		sent_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`}},
+	{2, "add meson addresses", []string{
+		`ALTER TABLE meson ADD COLUMN address_a TEXT`,
+		`ALTER TABLE meson ADD COLUMN address_b TEXT`,
+	}},
+	// 金额以 TEXT 保存，无法在 SQL 中精确相减，已有记录的差额保持为空
+	{3, "add meson amount_delta", []string{
+		`ALTER TABLE meson ADD COLUMN amount_delta TEXT`,
+	}},
+	// 已完成的记录两边解析自同一个 reqID，B 边的 token index 与 A 边相同
+	{4, "add meson token_index_b", []string{
+		`ALTER TABLE meson ADD COLUMN token_index_b INTEGER`,
+		`UPDATE meson SET token_index_b = token_index WHERE chain_b IS NOT NULL AND chain_b <> ''`,
+	}},
+	{5, "create meson_legs table", []string{`
+	CREATE TABLE IF NOT EXISTS meson_legs (
+		reqid TEXT NOT NULL,
+		chain TEXT NOT NULL,
+		action TEXT NOT NULL,
+		amount TEXT,
+		token_index INTEGER NOT NULL DEFAULT 0,
+		tx_hash TEXT NOT NULL,
+		block INTEGER NOT NULL DEFAULT 0,
+		log_index INTEGER NOT NULL DEFAULT 0,
+		address TEXT,
+		seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (reqid, chain, tx_hash, log_index)
+	)`,
+		`INSERT INTO meson_legs (reqid, chain, action, amount, token_index, tx_hash, block, log_index, address, seen_at)
+		SELECT reqid, chain_a, COALESCE(action_a, ''), amount_a, token_index, COALESCE(tx_hash_a, ''), COALESCE(block_a, 0), COALESCE(log_index_a, 0), address_a, datetime(timestamp, 'unixepoch')
+		FROM meson WHERE COALESCE(chain_a, '') <> ''
+		ON CONFLICT DO NOTHING`,
+		`INSERT INTO meson_legs (reqid, chain, action, amount, token_index, tx_hash, block, log_index, address, seen_at)
+		SELECT reqid, chain_b, COALESCE(action_b, ''), amount_b, COALESCE(token_index_b, token_index), COALESCE(tx_hash_b, ''), COALESCE(block_b, 0), COALESCE(log_index_b, 0), address_b, COALESCE(completed_at, datetime(timestamp, 'unixepoch'))
+		FROM meson WHERE COALESCE(chain_b, '') <> ''
+		ON CONFLICT DO NOTHING`,
+	}},
+	{6, "add meson_legs contract", []string{
+		`ALTER TABLE meson_legs ADD COLUMN contract TEXT`,
+	}},
+	// 列与 meson 相同并多一个 archived_at，meson 表新增列时需要同时加到 meson_archive 和 mesonArchiveColumns
+	{7, "create meson_archive table", []string{
+		`CREATE INDEX IF NOT EXISTS meson_is_check_timestamp_idx ON meson (is_check, timestamp)`,
+		`CREATE TABLE IF NOT EXISTS meson_archive AS SELECT * FROM meson WHERE 0`,
+		`ALTER TABLE meson_archive ADD COLUMN archived_at DATETIME`,
+		`CREATE INDEX IF NOT EXISTS meson_archive_reqid_idx ON meson_archive (reqid)`,
+	}},
+	{8, "index unchecked mesons", []string{
+		`CREATE INDEX IF NOT EXISTS meson_unchecked_idx ON meson (timestamp, reqid) WHERE is_check = false`,
+	}},
+	{9, "add block hashes", []string{
+		`ALTER TABLE meson ADD COLUMN block_hash_a TEXT`,
+		`ALTER TABLE meson ADD COLUMN block_hash_b TEXT`,
+		`ALTER TABLE meson_archive ADD COLUMN block_hash_a TEXT`,
+		`ALTER TABLE meson_archive ADD COLUMN block_hash_b TEXT`,
+		`ALTER TABLE meson_legs ADD COLUMN block_hash TEXT`,
+	}},
+}
+
+// sqliteMesonLegColumns SQLite 中 meson_legs 表查询时的列顺序，与 scanMesonLeg 保持一致
+const sqliteMesonLegColumns = `reqid, chain, action, amount, token_index, tx_hash, block, log_index, COALESCE(address, ''), COALESCE(contract, ''), seen_at, COALESCE(block_hash, '')`
+
+// sqlQuerier 是 *sql.DB 和 *sql.Tx 共有的查询方法
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqliteStore 基于 SQLite 的 Store 实现，适用于不想部署 PostgreSQL 的单机小规模监控
+// 写入由 SQLite 串行执行，并发写入时等待 busy_timeout
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// connectSQLite 打开 SQLite 数据库文件，uri 形如 sqlite:///var/lib/monitor.db 或 file:monitor.db，sqlite://:memory: 为内存数据库
+func connectSQLite(uri string) (*sqliteStore, error) {
+	path := strings.TrimPrefix(uri, "sqlite://")
+	if path == "" {
+		return nil, fmt.Errorf("sqlite database path is empty")
+	}
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	// 事务以 BEGIN IMMEDIATE 开始，开始时就取得写锁，各链的事务依次执行；
+	// 默认的 DEFERRED 事务先查询再写入时，另一个事务已提交的写入会使本事务的写入直接失败
+	dsn := path + separator + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// 内存数据库的每个连接各自是一个独立的空数据库，只保留一个连接，所有读写才会使用同一个数据库
+	if isMemoryPath(path) {
+		db.SetMaxOpenConns(1)
+	}
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	logrus.Printf("Connected to SQLite database %s", path)
+	return &sqliteStore{db: db}, nil
+}
+
+// isMemoryPath 判断 SQLite 地址是否为内存数据库，如 :memory: 或 file:monitor?mode=memory
+func isMemoryPath(path string) bool {
+	return strings.Contains(path, ":memory:") || strings.Contains(path, "mode=memory")
+}
+
+// placeholderPattern PostgreSQL 风格的 $N 占位符
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+// rebind 将 $N 占位符转换为 SQLite 的 ?N，使 MesonFilter 等共用的条件可以在 SQLite 中执行
+func rebind(query string) string {
+	return placeholderPattern.ReplaceAllString(query, "?$1")
+}
+
+// sqliteTime 将时间转换为 SQLite 时间列的文本
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// sqliteTimeScanner 读取 SQLite 时间列，dest 为 *time.Time 或 **time.Time，后者在 NULL 时置为 nil
+type sqliteTimeScanner struct {
+	dest interface{}
+}
+
+func (s sqliteTimeScanner) Scan(value interface{}) error {
+	var t *time.Time
+	switch v := value.(type) {
+	case nil:
+	case time.Time:
+		utc := v.UTC()
+		t = &utc
+	case string:
+		parsed, err := time.ParseInLocation(sqliteTimeLayout, v, time.UTC)
+		if err != nil {
+			return err
+		}
+		t = &parsed
+	default:
+		return fmt.Errorf("unsupported time value %T", value)
+	}
+
+	switch dest := s.dest.(type) {
+	case **time.Time:
+		*dest = t
+	case *time.Time:
+		if t == nil {
+			return fmt.Errorf("unexpected NULL time")
+		}
+		*dest = *t
+	}
+	return nil
+}
+
+// sqliteRow 将扫描到时间字段的目标替换为 sqliteTimeScanner
+type sqliteRow struct {
+	row interface {
+		Scan(dest ...interface{}) error
+	}
+}
+
+func (r sqliteRow) Scan(dest ...interface{}) error {
+	for i, d := range dest {
+		switch d.(type) {
+		case *time.Time, **time.Time:
+			dest[i] = sqliteTimeScanner{dest: d}
+		}
+	}
+	return r.row.Scan(dest...)
+}
+
+func sqliteFindMesonByReqID(conn sqlQuerier, reqID string) (*Meson, error) {
+	query := `SELECT ` + sqliteMesonColumns + ` FROM meson WHERE reqid = ?1`
+	meson, err := scanMeson(sqliteRow{conn.QueryRowContext(context.Background(), query, reqID)})
+	if err != nil {
+		if isNoRows(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return meson, nil
+}
+
+func sqliteInsertMeson(conn sqlQuerier, meson Meson) (bool, error) {
+	query := `INSERT INTO meson (reqid, chain_a, chain_b, timestamp, amount_a, amount_b, action_a, action_b, tx_hash_a, tx_hash_b, is_check, token_index, block_a, log_index_a, address_a, block_hash_a) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14, ?15, NULLIF(?16, ''))
+		ON CONFLICT (reqid) DO NOTHING`
+	result, err := conn.ExecContext(context.Background(), query, meson.ReqID, meson.ChainA, meson.ChainB, meson.Timestamp, formatAmount(meson.AmountA), formatAmount(meson.AmountB), meson.ActionA, meson.ActionB, meson.TxHashA, meson.TxHashB, meson.IsCheck, meson.TokenIndex, int64(meson.BlockA), int64(meson.LogIndexA), meson.AddressA, meson.BlockHashA)
+	if err != nil {
+		logrus.Errorf("Failed to insert Meson: %v", err)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		logrus.Infof("Meson with ID %v already exists, not inserted", meson.ReqID)
+		return false, nil
+	}
+
+	logrus.Infof("Inserted Meson with ID: %v", meson.ReqID)
+	return true, nil
+}
+
+func sqliteUpdateMeson(conn sqlQuerier, meson *Meson) error {
+	query := `UPDATE meson SET chain_b = ?1, amount_b = ?2, action_b = ?3, tx_hash_b = ?4, is_check = ?5, timed_out = false,
+		completed_at = CASE WHEN ?5 THEN CURRENT_TIMESTAMP ELSE NULL END, block_b = ?6, log_index_b = ?7, address_b = ?8, amount_delta = ?9, token_index_b = ?10, block_hash_b = NULLIF(?11, '') WHERE reqid = ?12`
+	_, err := conn.ExecContext(context.Background(), query, meson.ChainB, formatAmount(meson.AmountB), meson.ActionB, meson.TxHashB, meson.IsCheck, int64(meson.BlockB), int64(meson.LogIndexB), meson.AddressB, formatOptionalAmount(meson.AmountDelta), meson.TokenIndexB, meson.BlockHashB, meson.ReqID)
+	if err != nil {
+		logrus.Errorf("Failed to update Meson: %v", err)
+		return err
+	}
+
+	logrus.Infof("Updated Meson with ID: %v", meson.ReqID)
+	return nil
+}
+
+func sqliteInsertMesonLeg(conn sqlQuerier, leg MesonLeg) (bool, error) {
+	query := `INSERT INTO meson_legs (reqid, chain, action, amount, token_index, tx_hash, block, log_index, address, contract, block_hash) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, NULLIF(?10, ''), NULLIF(?11, ''))
+		ON CONFLICT (reqid, chain, tx_hash, log_index) DO NOTHING`
+	result, err := conn.ExecContext(context.Background(), query, leg.ReqID, leg.Chain, leg.Action, formatAmount(leg.Amount), leg.TokenIndex, leg.TxHash, int64(leg.Block), int64(leg.LogIndex), leg.Address, leg.Contract, leg.BlockHash)
+	if err != nil {
+		logrus.Errorf("Failed to insert Meson leg: %v", err)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *sqliteStore) FindMesonLegs(reqID string) ([]MesonLeg, error) {
+	query := `SELECT ` + sqliteMesonLegColumns + ` FROM meson_legs WHERE reqid = ?1 ORDER BY seen_at, chain, block, log_index`
+	rows, err := s.db.QueryContext(context.Background(), query, reqID)
+	if err != nil {
+		logrus.Errorf("Failed to find Meson legs: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var legs []MesonLeg
+	for rows.Next() {
+		leg, err := scanMesonLeg(sqliteRow{rows})
+		if err != nil {
+			logrus.Errorf("Failed to decode Meson leg: %v", err)
+			return nil, err
+		}
+		legs = append(legs, *leg)
+	}
+	return legs, rows.Err()
+}
+
+func sqliteSaveChainProgress(conn sqlQuerier, chainName string, block uint64) error {
+	query := `INSERT INTO chain_progress (chain_name, last_block, updated_at) VALUES (?1, ?2, CURRENT_TIMESTAMP)
+	ON CONFLICT (chain_name) DO UPDATE SET last_block = excluded.last_block, updated_at = excluded.updated_at`
+	_, err := conn.ExecContext(context.Background(), query, chainName, int64(block))
+	if err != nil {
+		logrus.Errorf("Failed to save chain progress: %v", err)
+		return err
+	}
+	return nil
+}
+
+// queryMesons 执行查询并读取多行 Meson
+func (s *sqliteStore) queryMesons(query string, args ...interface{}) ([]Meson, error) {
+	rows, err := s.db.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []Meson
+	for rows.Next() {
+		meson, err := scanMeson(sqliteRow{rows})
+		if err != nil {
+			logrus.Errorf("Failed to decode Meson: %v", err)
+			return nil, err
+		}
+		results = append(results, *meson)
+	}
+	if rows.Err() != nil {
+		logrus.Errorf("Rows error: %v", rows.Err())
+		return nil, rows.Err()
+	}
+	return results, nil
+}
+
+// InitDatabase 按顺序执行 sqliteMigrations 中尚未执行的迁移
+func (s *sqliteStore) InitDatabase() error {
+	ctx := context.Background()
+	_, err := s.db.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	applied := 0
+	for _, m := range sqliteMigrations {
+		ok, err := s.applyMigration(m)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+		}
+		if ok {
+			logrus.Infof("Applied migration %d: %s", m.version, m.name)
+			applied++
+		}
+	}
+
+	logrus.Infof("Database schema is at version %d (%d migration(s) applied)", sqliteMigrations[len(sqliteMigrations)-1].version, applied)
+	return nil
+}
+
+// applyMigration 在事务中执行一个迁移，已执行过时返回 false
+func (s *sqliteStore) applyMigration(m migration) (bool, error) {
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var version int
+	err = tx.QueryRowContext(ctx, `SELECT version FROM schema_migrations WHERE version = ?1`, m.version).Scan(&version)
+	if err == nil {
+		return false, nil
+	}
+	if !isNoRows(err) {
+		return false, err
+	}
+
+	for _, statement := range m.statements {
+		_, err = tx.ExecContext(ctx, statement)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?1, ?2)`, m.version, m.name)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Close 关闭 SQLite 数据库
+func (s *sqliteStore) Close() {
+	s.db.Close()
+	logrus.Println("Disconnected from SQLite.")
+}
+
+// BeginTx 开启一个 SQLite 事务
+func (s *sqliteStore) BeginTx() (Tx, error) {
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		logrus.Errorf("Failed to begin transaction: %v", err)
+		return nil, err
+	}
+	return sqliteTx{tx: tx}, nil
+}
+
+func (s *sqliteStore) FindMesonByReqID(reqID string) (*Meson, error) {
+	return sqliteFindMesonByReqID(s.db, reqID)
+}
+
+func (s *sqliteStore) FindMesonByTxHash(txHash string) (*Meson, error) {
+	query := `SELECT ` + sqliteMesonColumns + ` FROM meson WHERE tx_hash_a = ?1 OR tx_hash_b = ?1 ORDER BY timestamp DESC LIMIT 1`
+	meson, err := scanMeson(sqliteRow{s.db.QueryRowContext(context.Background(), query, txHash)})
+	if err != nil {
+		if isNoRows(err) {
+			return nil, nil
+		}
+		logrus.Errorf("Failed to find Meson by tx hash: %v", err)
+		return nil, err
+	}
+	return meson, nil
+}
+
+func (s *sqliteStore) InsertMeson(meson Meson) (bool, error) {
+	return sqliteInsertMeson(s.db, meson)
+}
+
+func (s *sqliteStore) UpdateMeson(meson *Meson) error {
+	return sqliteUpdateMeson(s.db, meson)
+}
+
+func (s *sqliteStore) FindUncheckedMesons(since int64, after MesonCursor, limit int) ([]Meson, error) {
+	query := `SELECT ` + sqliteMesonColumns + ` FROM meson WHERE is_check = false AND timestamp > ?1 AND (timestamp, reqid) > (?2, ?3)
+	ORDER BY timestamp, reqid LIMIT ?4`
+	results, err := s.queryMesons(query, since, after.Timestamp, after.ReqID, limit)
+	if err != nil {
+		logrus.Errorf("Failed to find unchecked Mesons: %v", err)
+	}
+	return results, err
+}
+
+func (s *sqliteStore) ArchiveMesons(before int64) (int64, error) {
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logrus.Errorf("Failed to begin transaction: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO meson_archive (` + mesonArchiveColumns + `, archived_at) SELECT ` + mesonArchiveColumns + `, CURRENT_TIMESTAMP FROM meson WHERE timestamp < ?1`
+	result, err := tx.ExecContext(ctx, query, before)
+	if err != nil {
+		logrus.Errorf("Failed to archive Mesons: %v", err)
+		return 0, err
+	}
+	archived, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM meson WHERE timestamp < ?1`, before)
+	if err != nil {
+		logrus.Errorf("Failed to delete archived Mesons: %v", err)
+		return 0, err
+	}
+	return archived, tx.Commit()
+}
+
+func (s *sqliteStore) FindMesons(filter MesonFilter) ([]Meson, error) {
+	where, args := filter.where()
+	query := `SELECT ` + sqliteMesonColumns + ` FROM meson` + where + ` ORDER BY timestamp DESC, reqid`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		if filter.Limit <= 0 {
+			// SQLite 的 OFFSET 必须跟在 LIMIT 之后
+			query += " LIMIT -1"
+		}
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	results, err := s.queryMesons(rebind(query), args...)
+	if err != nil {
+		logrus.Errorf("Failed to find Mesons: %v", err)
+	}
+	return results, err
+}
+
+func (s *sqliteStore) IterateMesons(filter MesonFilter, fn func(Meson) error) error {
+	where, args := filter.where()
+	query := `SELECT ` + sqliteMesonColumns + ` FROM meson` + where + ` ORDER BY timestamp, reqid`
+	rows, err := s.db.QueryContext(context.Background(), rebind(query), args...)
+	if err != nil {
+		logrus.Errorf("Failed to iterate Mesons: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		meson, err := scanMeson(sqliteRow{rows})
+		if err != nil {
+			logrus.Errorf("Failed to decode Meson: %v", err)
+			return err
+		}
+		err = fn(*meson)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteStore) CountMesons(filter MesonFilter) (int64, error) {
+	where, args := filter.where()
+	var count int64
+	err := s.db.QueryRowContext(context.Background(), rebind(`SELECT COUNT(*) FROM meson`+where), args...).Scan(&count)
+	if err != nil {
+		logrus.Errorf("Failed to count Mesons: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *sqliteStore) FindRecentMesonsByChain(chainName string, since int64) ([]Meson, error) {
+	query := `SELECT ` + sqliteMesonColumns + ` FROM meson WHERE (chain_a = ?1 OR chain_b = ?1) AND timestamp >= ?2 AND reorged = false`
+	results, err := s.queryMesons(query, chainName, since)
+	if err != nil {
+		logrus.Errorf("Failed to find recent Mesons: %v", err)
+	}
+	return results, err
+}
+
+func (s *sqliteStore) MarkMesonReorged(reqID string) error {
+	_, err := s.db.ExecContext(context.Background(), `UPDATE meson SET reorged = true WHERE reqid = ?1`, reqID)
+	if err != nil {
+		logrus.Errorf("Failed to mark Meson as reorged: %v", err)
+		return err
+	}
+
+	logrus.Infof("Marked Meson %v as reorged", reqID)
+	return nil
+}
+
+func (s *sqliteStore) MoveMesonLeg(reqID, chainName, txHash string, block uint64, logIndex uint, blockHash string) error {
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		logrus.Errorf("Failed to begin transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE meson SET
+		block_a = CASE WHEN chain_a = ?2 AND tx_hash_a = ?3 THEN ?4 ELSE block_a END,
+		log_index_a = CASE WHEN chain_a = ?2 AND tx_hash_a = ?3 THEN ?5 ELSE log_index_a END,
+		block_hash_a = CASE WHEN chain_a = ?2 AND tx_hash_a = ?3 THEN ?6 ELSE block_hash_a END,
+		block_b = CASE WHEN chain_b = ?2 AND tx_hash_b = ?3 THEN ?4 ELSE block_b END,
+		log_index_b = CASE WHEN chain_b = ?2 AND tx_hash_b = ?3 THEN ?5 ELSE log_index_b END,
+		block_hash_b = CASE WHEN chain_b = ?2 AND tx_hash_b = ?3 THEN ?6 ELSE block_hash_b END
+		WHERE reqid = ?1`, reqID, chainName, txHash, int64(block), int64(logIndex), blockHash)
+	if err != nil {
+		logrus.Errorf("Failed to move Meson leg: %v", err)
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE meson_legs SET block = ?4, log_index = ?5, block_hash = ?6 WHERE reqid = ?1 AND chain = ?2 AND tx_hash = ?3`,
+		reqID, chainName, txHash, int64(block), int64(logIndex), blockHash)
+	if err != nil {
+		logrus.Errorf("Failed to move Meson leg: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) FindTimedOutPendingMesons(before int64) ([]Meson, error) {
+	query := `SELECT ` + sqliteMesonColumns + ` FROM meson WHERE COALESCE(chain_b, '') = '' AND is_check = false AND timestamp < ?1`
+	results, err := s.queryMesons(query, before)
+	if err != nil {
+		logrus.Errorf("Failed to find timed out pending Mesons: %v", err)
+	}
+	return results, err
+}
+
+func (s *sqliteStore) MarkMesonTimedOut(reqID string) error {
+	_, err := s.db.ExecContext(context.Background(), `UPDATE meson SET timed_out = true WHERE reqid = ?1`, reqID)
+	if err != nil {
+		logrus.Errorf("Failed to mark Meson as timed out: %v", err)
+		return err
+	}
+
+	logrus.Infof("Marked Meson %v as timed out", reqID)
+	return nil
+}
+
+func (s *sqliteStore) MarkMesonAlerted(reqID string, alertedAt time.Time) error {
+	_, err := s.db.ExecContext(context.Background(), `UPDATE meson SET last_alerted_at = ?1 WHERE reqid = ?2`, sqliteTime(alertedAt), reqID)
+	if err != nil {
+		logrus.Errorf("Failed to mark Meson as alerted: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *sqliteStore) CountCompletedMesons(from, to int64) (int64, error) {
+	conditions := []string{"completed_at IS NOT NULL"}
+	var args []interface{}
+	if from > 0 {
+		args = append(args, sqliteTime(time.Unix(from, 0)))
+		conditions = append(conditions, fmt.Sprintf("completed_at >= ?%d", len(args)))
+	}
+	if to > 0 {
+		args = append(args, sqliteTime(time.Unix(to, 0)))
+		conditions = append(conditions, fmt.Sprintf("completed_at < ?%d", len(args)))
+	}
+
+	var count int64
+	query := `SELECT COUNT(*) FROM meson WHERE ` + strings.Join(conditions, " AND ")
+	err := s.db.QueryRowContext(context.Background(), query, args...).Scan(&count)
+	if err != nil {
+		logrus.Errorf("Failed to count completed Mesons: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *sqliteStore) CountPendingMesons() (int64, error) {
+	var count int64
+	query := `SELECT COUNT(*) FROM meson WHERE COALESCE(chain_b, '') = ''`
+	err := s.db.QueryRowContext(context.Background(), query).Scan(&count)
+	if err != nil {
+		logrus.Errorf("Failed to count pending Mesons: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *sqliteStore) SummarizeMesons(from, to int64) (MesonSummary, []MesonSummary, error) {
+	ctx := context.Background()
+
+	var total MesonSummary
+	query := `SELECT ` + summaryColumns + ` FROM meson WHERE timestamp >= ?1 AND timestamp < ?2`
+	err := s.db.QueryRowContext(ctx, query, from, to).Scan(&total.Total, &total.Completed, &total.Pending, &total.Mismatched)
+	if err != nil {
+		logrus.Errorf("Failed to summarize Mesons: %v", err)
+		return total, nil, err
+	}
+
+	query = `SELECT chain, ` + summaryColumns + ` FROM (
+		SELECT chain_a AS chain, chain_b, is_check FROM meson WHERE timestamp >= ?1 AND timestamp < ?2
+		UNION ALL
+		SELECT chain_b AS chain, chain_b, is_check FROM meson WHERE timestamp >= ?1 AND timestamp < ?2 AND COALESCE(chain_b, '') <> ''
+	) legs GROUP BY chain ORDER BY chain`
+	rows, err := s.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		logrus.Errorf("Failed to summarize Mesons by chain: %v", err)
+		return total, nil, err
+	}
+	defer rows.Close()
+
+	var byChain []MesonSummary
+	for rows.Next() {
+		var summary MesonSummary
+		err := rows.Scan(&summary.Chain, &summary.Total, &summary.Completed, &summary.Pending, &summary.Mismatched)
+		if err != nil {
+			logrus.Errorf("Failed to decode Meson summary: %v", err)
+			return total, nil, err
+		}
+		byChain = append(byChain, summary)
+	}
+	if rows.Err() != nil {
+		logrus.Errorf("Rows error: %v", rows.Err())
+		return total, nil, rows.Err()
+	}
+
+	return total, byChain, nil
+}
+
+func (s *sqliteStore) GetChainProgress(chainName string) (uint64, bool, error) {
+	var lastBlock int64
+	err := s.db.QueryRowContext(context.Background(), `SELECT last_block FROM chain_progress WHERE chain_name = ?1`, chainName).Scan(&lastBlock)
+	if err != nil {
+		if isNoRows(err) {
+			return 0, false, nil
+		}
+		logrus.Errorf("Failed to query chain progress: %v", err)
+		return 0, false, err
+	}
+	return uint64(lastBlock), true, nil
+}
+
+func (s *sqliteStore) SaveChainProgress(chainName string, block uint64) error {
+	return sqliteSaveChainProgress(s.db, chainName, block)
+}
+
+func (s *sqliteStore) InsertFailedAlert(channel, payload, errMsg string) error {
+	_, err := s.db.ExecContext(context.Background(), `INSERT INTO failed_alerts (channel, payload, error) VALUES (?1, ?2, ?3)`, channel, payload, errMsg)
+	if err != nil {
+		logrus.Errorf("Failed to insert failed alert: %v", err)
+		return err
+	}
+
+	logrus.Infof("Saved undelivered %s alert for later retry", channel)
+	return nil
+}
+
+func (s *sqliteStore) FindFailedAlerts() ([]FailedAlert, error) {
+	rows, err := s.db.QueryContext(context.Background(), `SELECT id, channel, payload, COALESCE(error, ''), attempts, created_at FROM failed_alerts ORDER BY id`)
+	if err != nil {
+		logrus.Errorf("Failed to find failed alerts: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []FailedAlert
+	for rows.Next() {
+		var alert FailedAlert
+		err := sqliteRow{rows}.Scan(&alert.ID, &alert.Channel, &alert.Payload, &alert.Error, &alert.Attempts, &alert.CreatedAt)
+		if err != nil {
+			logrus.Errorf("Failed to decode failed alert: %v", err)
+			return nil, err
+		}
+		results = append(results, alert)
+	}
+	if rows.Err() != nil {
+		logrus.Errorf("Rows error: %v", rows.Err())
+		return nil, rows.Err()
+	}
+	return results, nil
+}
+
+func (s *sqliteStore) DeleteFailedAlert(id int64) error {
+	_, err := s.db.ExecContext(context.Background(), `DELETE FROM failed_alerts WHERE id = ?1`, id)
+	if err != nil {
+		logrus.Errorf("Failed to delete failed alert: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *sqliteStore) UpdateFailedAlertAttempt(id int64, payload, errMsg string) error {
+	_, err := s.db.ExecContext(context.Background(), `UPDATE failed_alerts SET attempts = attempts + 1, payload = ?1, error = ?2 WHERE id = ?3`, payload, errMsg, id)
+	if err != nil {
+		logrus.Errorf("Failed to update failed alert: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *sqliteStore) ClaimDailySummary(date time.Time) (bool, error) {
+	result, err := s.db.ExecContext(context.Background(), `INSERT INTO daily_summaries (summary_date) VALUES (?1) ON CONFLICT (summary_date) DO NOTHING`, date.UTC().Format("2006-01-02"))
+	if err != nil {
+		logrus.Errorf("Failed to claim daily summary: %v", err)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// sqliteTx SQLite 后端的事务
+type sqliteTx struct {
+	tx *sql.Tx
+}
+
+func (t sqliteTx) FindMesonByReqID(reqID string) (*Meson, error) {
+	return sqliteFindMesonByReqID(t.tx, reqID)
+}
+
+func (t sqliteTx) InsertMeson(meson Meson) (bool, error) {
+	return sqliteInsertMeson(t.tx, meson)
+}
+
+func (t sqliteTx) UpdateMeson(meson *Meson) error {
+	return sqliteUpdateMeson(t.tx, meson)
+}
+
+func (t sqliteTx) InsertMesonLeg(leg MesonLeg) (bool, error) {
+	return sqliteInsertMesonLeg(t.tx, leg)
+}
+
+func (t sqliteTx) SaveChainProgress(chainName string, block uint64) error {
+	return sqliteSaveChainProgress(t.tx, chainName, block)
+}
+
+func (t sqliteTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t sqliteTx) Rollback() error {
+	err := t.tx.Rollback()
+	if err == sql.ErrTxDone {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,284 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// 支持的数据库类型
+const (
+	TypePostgres = "postgres"
+	TypeSQLite   = "sqlite"
+)
+
+// isNoRows 判断查询错误是否只是没有匹配的记录，同时识别两种后端的错误，错误被包装过时也能识别
+// 其他错误（连接中断、超时等）需要返回给调用方，不能当作记录不存在
+func isNoRows(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows)
+}
+
+// Store 数据库后端需要实现的操作，PostgreSQL 和 SQLite 各有一个实现
+// 包级函数转发到 Connect 或 Use 设置的 Store，调用方不需要关心使用的是哪种数据库
+type Store interface {
+	InitDatabase() error
+	Close()
+	BeginTx() (Tx, error)
+
+	FindMesonByReqID(reqID string) (*Meson, error)
+	FindMesonByTxHash(txHash string) (*Meson, error)
+	InsertMeson(meson Meson) (bool, error)
+	UpdateMeson(meson *Meson) error
+	FindMesonLegs(reqID string) ([]MesonLeg, error)
+	FindUncheckedMesons(since int64, after MesonCursor, limit int) ([]Meson, error)
+	ArchiveMesons(before int64) (int64, error)
+	FindMesons(filter MesonFilter) ([]Meson, error)
+	IterateMesons(filter MesonFilter, fn func(Meson) error) error
+	CountMesons(filter MesonFilter) (int64, error)
+	FindRecentMesonsByChain(chainName string, since int64) ([]Meson, error)
+	MarkMesonReorged(reqID string) error
+	MoveMesonLeg(reqID, chainName, txHash string, block uint64, logIndex uint, blockHash string) error
+	FindTimedOutPendingMesons(before int64) ([]Meson, error)
+	MarkMesonTimedOut(reqID string) error
+	MarkMesonAlerted(reqID string, alertedAt time.Time) error
+	CountCompletedMesons(from, to int64) (int64, error)
+	CountPendingMesons() (int64, error)
+	SummarizeMesons(from, to int64) (MesonSummary, []MesonSummary, error)
+
+	GetChainProgress(chainName string) (uint64, bool, error)
+	SaveChainProgress(chainName string, block uint64) error
+
+	InsertFailedAlert(channel, payload, errMsg string) error
+	FindFailedAlerts() ([]FailedAlert, error)
+	DeleteFailedAlert(id int64) error
+	UpdateFailedAlertAttempt(id int64, payload, errMsg string) error
+
+	ClaimDailySummary(date time.Time) (bool, error)
+}
+
+var (
+	// store 包级函数使用的 Store，读写都需要持有 storeLock
+	store     Store
+	storeLock sync.RWMutex
+)
+
+// DetectType 根据连接地址推断数据库类型，sqlite:// 或 file: 开头的地址使用 SQLite，其余使用 PostgreSQL
+func DetectType(uri string) string {
+	if strings.HasPrefix(uri, "sqlite://") || strings.HasPrefix(uri, "file:") {
+		return TypeSQLite
+	}
+	return TypePostgres
+}
+
+// Open 连接数据库并返回一个独立的 Store，dbType 为空时根据 uri 推断
+// 返回的 Store 不影响包级函数使用的连接，由调用方负责 Close
+func Open(dbType, uri string, poolConfig PoolConfig) (Store, error) {
+	if dbType == "" {
+		dbType = DetectType(uri)
+	}
+
+	switch dbType {
+	case TypePostgres:
+		return connectPostgres(uri, poolConfig)
+	case TypeSQLite:
+		return connectSQLite(uri)
+	default:
+		return nil, fmt.Errorf("unknown database type: %s", dbType)
+	}
+}
+
+// Connect 连接数据库，作为包级函数使用的 Store，dbType 为空时根据 uri 推断
+// 已连接时不重复连接
+func Connect(dbType, uri string, poolConfig PoolConfig) error {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	if store != nil {
+		return nil
+	}
+	s, err := Open(dbType, uri, poolConfig)
+	if err != nil {
+		return err
+	}
+	store = s
+	return nil
+}
+
+// Use 将 s 作为包级函数使用的 Store，替换并返回之前的 Store（不关闭），用于测试中的模拟实现或其他后端
+func Use(s Store) Store {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	previous := store
+	store = s
+	return previous
+}
+
+// Current 返回包级函数当前使用的 Store，未连接时为 nil
+func Current() Store {
+	return current()
+}
+
+// current 在读锁下读取包级函数使用的 Store，与 Connect、Use 和 Disconnect 的替换不会产生数据竞争
+func current() Store {
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+
+	return store
+}
+
+// Disconnect 关闭数据库连接
+func Disconnect() error {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	if store != nil {
+		store.Close()
+		store = nil
+	}
+	return nil
+}
+
+// InitDatabase 初始化数据库，按顺序执行尚未执行的表结构变更
+func InitDatabase() error {
+	return current().InitDatabase()
+}
+
+// FindMesonByReqID 根据 reqID 查询 Meson 文档
+func FindMesonByReqID(reqID string) (*Meson, error) {
+	return current().FindMesonByReqID(reqID)
+}
+
+// FindMesonByTxHash 根据任意一边的交易哈希查询 Meson 文档，没有匹配的记录时返回 nil
+func FindMesonByTxHash(txHash string) (*Meson, error) {
+	return current().FindMesonByTxHash(txHash)
+}
+
+// InsertMeson 插入 Meson 文档，相同 reqID 的记录已存在时不插入，返回 false
+func InsertMeson(meson Meson) (bool, error) {
+	return current().InsertMeson(meson)
+}
+
+// UpdateMeson 更新 Meson 文档
+func UpdateMeson(meson *Meson) error {
+	return current().UpdateMeson(meson)
+}
+
+// FindMesonLegs 查询 reqID 在各条链上记录的所有事件，按记录时间排序
+func FindMesonLegs(reqID string) ([]MesonLeg, error) {
+	return current().FindMesonLegs(reqID)
+}
+
+// FindUncheckedMesons 按 (timestamp, reqid) 顺序查询排在 after 之后、is_check 为 false 的 Meson 文档，最多 limit 条
+// 只返回创建时间晚于 since（Unix 秒）的记录，since 为 0 时不限制；返回的数量小于 limit 时表示已经读完
+func FindUncheckedMesons(since int64, after MesonCursor, limit int) ([]Meson, error) {
+	return current().FindUncheckedMesons(since, after, limit)
+}
+
+// ArchiveMesons 将创建时间早于 before（Unix 秒）的 Meson 文档移到 meson_archive 表，返回移动的数量
+// 已完成和仍未完成的记录都会移动，归档后不再参与检查和查询
+func ArchiveMesons(before int64) (int64, error) {
+	return current().ArchiveMesons(before)
+}
+
+// FindMesons 按过滤条件分页查询 Meson 文档，按创建时间倒序
+func FindMesons(filter MesonFilter) ([]Meson, error) {
+	return current().FindMesons(filter)
+}
+
+// IterateMesons 按过滤条件逐行读取 Meson 文档交给 fn，按创建时间正序，不会一次性载入内存
+// 忽略分页参数；fn 返回错误时停止读取并返回该错误
+func IterateMesons(filter MesonFilter, fn func(Meson) error) error {
+	return current().IterateMesons(filter, fn)
+}
+
+// CountMesons 统计满足过滤条件的 Meson 文档数量，忽略分页参数
+func CountMesons(filter MesonFilter) (int64, error) {
+	return current().CountMesons(filter)
+}
+
+// FindRecentMesonsByChain 查询指定链上创建时间不早于 since 且未被标记回滚的 Meson 文档
+func FindRecentMesonsByChain(chainName string, since int64) ([]Meson, error) {
+	return current().FindRecentMesonsByChain(chainName, since)
+}
+
+// MarkMesonReorged 将 Meson 文档标记为交易已被回滚
+func MarkMesonReorged(reqID string) error {
+	return current().MarkMesonReorged(reqID)
+}
+
+// MoveMesonLeg 记录 reqID 在 chainName 上交易 txHash 所在的新区块、日志序号和区块哈希
+// 交易在回滚后被重新打包到其他区块时使用，meson 表和 meson_legs 中的记录一起更新
+func MoveMesonLeg(reqID, chainName, txHash string, block uint64, logIndex uint, blockHash string) error {
+	return current().MoveMesonLeg(reqID, chainName, txHash, block, logIndex, blockHash)
+}
+
+// FindTimedOutPendingMesons 查询创建时间早于 before 且仍只有单边记录的 Meson 文档
+func FindTimedOutPendingMesons(before int64) ([]Meson, error) {
+	return current().FindTimedOutPendingMesons(before)
+}
+
+// MarkMesonTimedOut 将单边 Meson 文档标记为超时
+func MarkMesonTimedOut(reqID string) error {
+	return current().MarkMesonTimedOut(reqID)
+}
+
+// MarkMesonAlerted 记录 Meson 文档最近一次发送告警的时间
+func MarkMesonAlerted(reqID string, alertedAt time.Time) error {
+	return current().MarkMesonAlerted(reqID, alertedAt)
+}
+
+// CountCompletedMesons 统计完成时间在 [from, to) 内的跨链数量，Unix 秒，为 0 时表示不限制
+func CountCompletedMesons(from, to int64) (int64, error) {
+	return current().CountCompletedMesons(from, to)
+}
+
+// CountPendingMesons 统计只记录了一边、另一边尚未出现的跨链数量
+func CountPendingMesons() (int64, error) {
+	return current().CountPendingMesons()
+}
+
+// SummarizeMesons 统计创建时间在 [from, to) 内的 Meson，返回所有链的汇总和按链的统计
+func SummarizeMesons(from, to int64) (MesonSummary, []MesonSummary, error) {
+	return current().SummarizeMesons(from, to)
+}
+
+// GetChainProgress 查询指定链上次处理到的区块号，第二个返回值表示是否存在记录
+func GetChainProgress(chainName string) (uint64, bool, error) {
+	return current().GetChainProgress(chainName)
+}
+
+// SaveChainProgress 保存指定链处理到的区块号
+func SaveChainProgress(chainName string, block uint64) error {
+	return current().SaveChainProgress(chainName, block)
+}
+
+// InsertFailedAlert 保存一条发送失败的告警
+func InsertFailedAlert(channel, payload, errMsg string) error {
+	return current().InsertFailedAlert(channel, payload, errMsg)
+}
+
+// FindFailedAlerts 查询所有发送失败的告警，按创建时间排序
+func FindFailedAlerts() ([]FailedAlert, error) {
+	return current().FindFailedAlerts()
+}
+
+// DeleteFailedAlert 删除已经重新发送成功的告警
+func DeleteFailedAlert(id int64) error {
+	return current().DeleteFailedAlert(id)
+}
+
+// UpdateFailedAlertAttempt 记录一次失败的重新发送，payload 为下次需要重新发送的内容
+func UpdateFailedAlertAttempt(id int64, payload, errMsg string) error {
+	return current().UpdateFailedAlertAttempt(id, payload, errMsg)
+}
+
+// ClaimDailySummary 记录某天的每日汇总已发送，返回 false 表示当天已经发送过
+func ClaimDailySummary(date time.Time) (bool, error) {
+	return current().ClaimDailySummary(date)
+}
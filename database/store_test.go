@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestIsNoRows(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: pgx.ErrNoRows, want: true},
+		{err: sql.ErrNoRows, want: true},
+		{err: fmt.Errorf("scan meson: %w", sql.ErrNoRows), want: true},
+		{err: nil},
+		{err: errors.New("connection reset by peer")},
+		{err: fmt.Errorf("query: %w", sql.ErrConnDone)},
+	}
+	for _, tt := range tests {
+		if got := isNoRows(tt.err); got != tt.want {
+			t.Errorf("isNoRows(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// fakeStore 只用于替换包级 Store 的占位实现，调用未实现的方法会 panic
+type fakeStore struct {
+	Store
+	name string
+}
+
+func TestUseAndCurrentAreRaceFree(t *testing.T) {
+	previous := Use(nil)
+	defer Use(previous)
+
+	a, b := &fakeStore{name: "a"}, &fakeStore{name: "b"}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if i%2 == 0 {
+				Use(a)
+			} else {
+				Use(b)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if s := Current(); s != nil && s != Store(a) && s != Store(b) {
+				t.Errorf("Current returned unexpected store %v", s)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Tx 一个数据库事务，用于将一个区块区间内的所有写入和进度保存原子地提交
+// PostgreSQL 和 SQLite 各有一个实现，测试中可以替换为模拟实现
+type Tx interface {
+	// FindMesonByReqID 在事务中根据 reqID 查询 Meson 文档
+	FindMesonByReqID(reqID string) (*Meson, error)
+	// InsertMeson 在事务中插入 Meson 文档，相同 reqID 的记录已存在时返回 false
+	InsertMeson(meson Meson) (bool, error)
+	// UpdateMeson 在事务中更新 Meson 文档
+	UpdateMeson(meson *Meson) error
+	// InsertMesonLeg 在事务中记录一边事件，同一条日志已记录时返回 false
+	InsertMesonLeg(leg MesonLeg) (bool, error)
+	// SaveChainProgress 在事务中保存链的处理进度
+	SaveChainProgress(chainName string, block uint64) error
+	// Commit 提交事务，事务中有语句失败时返回错误
+	Commit() error
+	// Rollback 回滚事务，已提交的事务上调用不会产生影响
+	Rollback() error
+}
+
+// postgresTx PostgreSQL 后端的事务
+type postgresTx struct {
+	tx pgx.Tx
+}
+
+// FindMesonByReqID 查询并锁定记录：两条链的监听协程同时处理同一个 reqID 时，
+// 后查询的一方等待先查询的事务提交后读到更新后的记录，不会互相覆盖对方写入的一边
+func (t postgresTx) FindMesonByReqID(reqID string) (*Meson, error) {
+	return findMesonByReqID(t.tx, reqID, true)
+}
+
+func (t postgresTx) InsertMeson(meson Meson) (bool, error) {
+	return insertMeson(t.tx, meson)
+}
+
+func (t postgresTx) UpdateMeson(meson *Meson) error {
+	return updateMeson(t.tx, meson)
+}
+
+func (t postgresTx) InsertMesonLeg(leg MesonLeg) (bool, error) {
+	return insertMesonLeg(t.tx, leg)
+}
+
+func (t postgresTx) SaveChainProgress(chainName string, block uint64) error {
+	return saveChainProgress(t.tx, chainName, block)
+}
+
+func (t postgresTx) Commit() error {
+	return t.tx.Commit(context.Background())
+}
+
+func (t postgresTx) Rollback() error {
+	err := t.tx.Rollback(context.Background())
+	if err == pgx.ErrTxClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"meson-monitor/bot"
+)
+
+// chainExplorerTxURLs 各链区块浏览器的交易链接模板，未配置的链不在其中
+var chainExplorerTxURLs = map[string]string{}
+
+// loadExplorerTxURLs 从链配置中读取区块浏览器的交易链接模板
+func loadExplorerTxURLs(chains map[string]ChainConfig) map[string]string {
+	result := make(map[string]string, len(chains))
+	for chainName, chainConfig := range chains {
+		if chainConfig.ExplorerTxURL != "" {
+			result[chainName] = chainConfig.ExplorerTxURL
+		}
+	}
+	return result
+}
+
+// validateExplorerTxURL 检查交易链接模板，必须是 http(s) 地址且只包含一个 %s
+func validateExplorerTxURL(template string) error {
+	if !strings.HasPrefix(template, "https://") && !strings.HasPrefix(template, "http://") {
+		return fmt.Errorf("must be an http(s) URL, got %q", template)
+	}
+	if strings.Count(template, "%") != 1 || strings.Count(template, "%s") != 1 {
+		return fmt.Errorf("must contain exactly one %%s for the tx hash, got %q", template)
+	}
+	return nil
+}
+
+// explorerTxURL 返回交易在区块浏览器中的链接，链未配置 explorerTxUrl 或交易哈希为空时返回空字符串
+func explorerTxURL(chainName, txHash string) string {
+	template, ok := chainExplorerTxURLs[chainName]
+	if !ok || txHash == "" {
+		return ""
+	}
+	return fmt.Sprintf(template, txHash)
+}
+
+// telegramKeyboard 为告警中每条带交易哈希的记录生成一个打开区块浏览器的按钮，每行一个
+// 所有记录所在的链都未配置 explorerTxUrl 时返回 nil，消息不带键盘
+func telegramKeyboard(alert Alert) [][]bot.InlineButton {
+	var keyboard [][]bot.InlineButton
+	for _, leg := range alert.Legs {
+		url := explorerTxURL(leg.Chain, leg.TxHash)
+		if url == "" {
+			continue
+		}
+		text := fmt.Sprintf("View %s tx on %s", leg.Label, leg.Chain)
+		if leg.Label == "" {
+			text = fmt.Sprintf("View tx on %s", leg.Chain)
+		}
+		keyboard = append(keyboard, []bot.InlineButton{{Text: text, URL: url}})
+	}
+	return keyboard
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+)
+
+// exportColumns CSV 的表头，与 mesonCSVRecord 的字段顺序一致
+var exportColumns = []string{
+	"reqid", "chain_a", "chain_b", "timestamp", "token_index", "token_index_b",
+	"amount_a", "amount_b", "amount_delta", "action_a", "action_b",
+	"tx_hash_a", "tx_hash_b", "block_a", "log_index_a", "block_b", "log_index_b",
+	"address_a", "address_b", "is_check", "reorged", "timed_out", "completed_at", "last_alerted_at",
+}
+
+// runExport 将创建时间在 [from, to] 区间内的 Meson 记录导出为 CSV
+// 用法：export --from=<unix 秒> --to=<unix 秒> --out=crossings.csv，--out 为空或 "-" 时输出到标准输出
+// 逐行从数据库读取并写出，不会一次性载入内存；写入文件时先写临时文件，成功后再改名
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	from := flags.Int64("from", 0, "earliest created time to export, unix seconds (inclusive, 0 for no limit)")
+	to := flags.Int64("to", 0, "latest created time to export, unix seconds (inclusive, 0 for no limit)")
+	chainName := flags.String("chain", "", "only export crossings with a leg on this chain")
+	out := flags.String("out", "-", "output CSV file, - for stdout")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *from < 0 || *to < 0 {
+		return fmt.Errorf("--from and --to must not be negative")
+	}
+	if *to > 0 && *to < *from {
+		return fmt.Errorf("--to (%d) must not be less than --from (%d)", *to, *from)
+	}
+	filter := database.MesonFilter{Chain: *chainName, From: *from, To: *to}
+
+	if *out == "" || *out == "-" {
+		_, err = exportMesons(os.Stdout, filter)
+		return err
+	}
+
+	tmpName := *out + ".tmp"
+	file, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	count, err := exportMesons(file, filter)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	err = os.Rename(tmpName, *out)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Exported %d Mesons to %s", count, *out)
+	return nil
+}
+
+// exportMesons 写出表头和满足 filter 的所有 Meson 记录，返回写出的行数（不含表头）
+func exportMesons(w io.Writer, filter database.MesonFilter) (int, error) {
+	writer := csv.NewWriter(w)
+	err := writer.Write(exportColumns)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = database.IterateMesons(filter, func(meson database.Meson) error {
+		count++
+		return writer.Write(mesonCSVRecord(meson))
+	})
+	if err != nil {
+		return count, err
+	}
+	writer.Flush()
+	return count, writer.Error()
+}
+
+// mesonCSVRecord 将 Meson 转为一行 CSV，金额为最小单位的整数，时间为 UTC RFC3339，空值为空字符串
+func mesonCSVRecord(meson database.Meson) []string {
+	tokenIndexB := ""
+	if meson.TokenIndexB != nil {
+		tokenIndexB = strconv.Itoa(*meson.TokenIndexB)
+	}
+	return []string{
+		meson.ReqID,
+		meson.ChainA,
+		meson.ChainB,
+		strconv.FormatInt(meson.Timestamp, 10),
+		strconv.Itoa(meson.TokenIndex),
+		tokenIndexB,
+		csvAmount(meson.AmountA),
+		csvAmount(meson.AmountB),
+		csvAmount(meson.AmountDelta),
+		meson.ActionA,
+		meson.ActionB,
+		meson.TxHashA,
+		meson.TxHashB,
+		strconv.FormatUint(meson.BlockA, 10),
+		strconv.FormatUint(uint64(meson.LogIndexA), 10),
+		strconv.FormatUint(meson.BlockB, 10),
+		strconv.FormatUint(uint64(meson.LogIndexB), 10),
+		meson.AddressA,
+		meson.AddressB,
+		strconv.FormatBool(meson.IsCheck),
+		strconv.FormatBool(meson.Reorged),
+		strconv.FormatBool(meson.TimedOut),
+		csvTime(meson.CompletedAt),
+		csvTime(meson.LastAlertedAt),
+	}
+}
+
+// csvAmount 金额为 nil 时返回空字符串
+func csvAmount(amount *big.Int) string {
+	if amount == nil {
+		return ""
+	}
+	return amount.String()
+}
+
+// csvTime 时间为 nil 时返回空字符串
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
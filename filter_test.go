@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"meson-monitor/database"
+)
+
+// otherContract 发出同名事件但不是监听对象的合约
+var otherContract = common.HexToAddress("0x00000000000000000000000000000000000000c2")
+
+// assertNotRecorded 检查 reqID 没有写入 meson
+func assertNotRecorded(t *testing.T, reqID common.Hash) {
+	t.Helper()
+	meson, err := database.FindMesonByReqID(reqID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meson != nil {
+		t.Errorf("Meson %s was recorded: %+v", reqID.Hex(), *meson)
+	}
+}
+
+func TestFilterAddresses(t *testing.T) {
+	proxy := "0x00000000000000000000000000000000000000b1"
+	tests := []struct {
+		name   string
+		mutate func(c *ChainConfig)
+		want   []common.Address
+	}{
+		{name: "defaults to mesonContract", mutate: func(c *ChainConfig) {}, want: []common.Address{testContract}},
+		{name: "filterAddress", mutate: func(c *ChainConfig) { c.FilterAddress = proxy }, want: []common.Address{common.HexToAddress(proxy)}},
+		{name: "filterAddresses", mutate: func(c *ChainConfig) { c.FilterAddresses = []string{proxy, testContract.Hex()} },
+			want: []common.Address{common.HexToAddress(proxy), testContract}},
+		// tokenContract 仅作记录，不参与过滤
+		{name: "tokenContract ignored", mutate: func(c *ChainConfig) { c.TokenContract = otherContract.Hex() }, want: []common.Address{testContract}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testChainConfig()
+			tt.mutate(&config)
+			got := config.filterAddresses()
+			if len(got) != len(tt.want) {
+				t.Fatalf("filterAddresses = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("filterAddresses = %v, want %v", got, tt.want)
+				}
+				if !config.watchesAddress(tt.want[i]) {
+					t.Errorf("watchesAddress(%s) = false", tt.want[i].Hex())
+				}
+			}
+			if config.watchesAddress(otherContract) {
+				t.Errorf("watchesAddress(%s) = true for a contract that is not filtered", otherContract.Hex())
+			}
+		})
+	}
+}
+
+func TestProcessLogsDropsLogsFromOtherContracts(t *testing.T) {
+	db := useTestDatabase(t)
+	parsedABI := testABI(t)
+	recorder := &recordingNotifier{}
+	foreignReqID := testReqID(testTokenIndex, 1000000, 1700000000)
+	reqID := testReqID(testTokenIndex, 2000000, 1700000000)
+
+	// 节点忽略了地址过滤，返回了其他合约的同名事件
+	foreign := mesonLog(parsedABI, "bsc", actionBurn, foreignReqID, 100, 0)
+	foreign.Address = otherContract
+	valid := mesonLog(parsedABI, "bsc", actionBurn, reqID, 100, 1)
+
+	err := processLogsWithoutCursor(db, recorder, "bsc", testChainConfig(), parsedABI, []types.Log{foreign, valid})
+	if err != nil {
+		t.Fatalf("processLogsWithoutCursor: %v", err)
+	}
+
+	assertNotRecorded(t, foreignReqID)
+	findTestMeson(t, reqID.Hex())
+	if alerts := recorder.Alerts(); len(alerts) != 0 {
+		t.Errorf("sent %d alerts, want 0", len(alerts))
+	}
+}
+
+func TestProcessLogsUsesFilterAddressInsteadOfMesonContract(t *testing.T) {
+	db := useTestDatabase(t)
+	parsedABI := testABI(t)
+	chainConfig := testChainConfig()
+	chainConfig.FilterAddress = otherContract.Hex()
+	fromMeson := testReqID(testTokenIndex, 1000000, 1700000000)
+	fromFilter := testReqID(testTokenIndex, 2000000, 1700000000)
+
+	// 配置了 filterAddress 后只处理该地址发出的日志，mesonContract 发出的日志也被丢弃
+	mesonContractLog := mesonLog(parsedABI, "bsc", actionBurn, fromMeson, 100, 0)
+	filterLog := mesonLog(parsedABI, "bsc", actionBurn, fromFilter, 100, 1)
+	filterLog.Address = otherContract
+
+	err := processLogsWithoutCursor(db, &recordingNotifier{}, "bsc", chainConfig, parsedABI, []types.Log{mesonContractLog, filterLog})
+	if err != nil {
+		t.Fatalf("processLogsWithoutCursor: %v", err)
+	}
+	assertNotRecorded(t, fromMeson)
+	findTestMeson(t, fromFilter.Hex())
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+)
+
+const (
+	// 判断区块是否最终确定的方式
+	finalityBlocks    = "blocks"    // 距最新区块至少 blocks 个区块
+	finalityFinalized = "finalized" // 不晚于节点返回的 finalized 区块
+)
+
+// FinalityConfig 区块最终确定的判断方式，两边事件都最终确定后才判定跨链是否完成
+// 与 confirmations 不同，未最终确定的事件照常记录，只是推迟校验和告警
+type FinalityConfig struct {
+	// Mode "blocks" 按区块数判断，"finalized" 通过 eth_getBlockByNumber("finalized") 查询
+	Mode string `json:"mode"`
+	// Blocks mode 为 "blocks" 时需要的区块数
+	Blocks uint64 `json:"blocks"`
+}
+
+// validate 检查最终确定配置
+func (c FinalityConfig) validate() error {
+	switch c.Mode {
+	case finalityBlocks:
+		if c.Blocks == 0 {
+			return fmt.Errorf("blocks must be greater than 0 when mode is %q", finalityBlocks)
+		}
+	case finalityFinalized:
+	default:
+		return fmt.Errorf("mode must be %q or %q, got %q", finalityBlocks, finalityFinalized, c.Mode)
+	}
+	return nil
+}
+
+var (
+	// finalityChains 配置了最终确定检查的链，未配置的链事件记录后即视为最终确定
+	finalityChains = map[string]bool{}
+	// finalizedHeights 各链已最终确定的最高区块号，由监听协程更新
+	finalizedHeights     = map[string]uint64{}
+	finalizedHeightsLock sync.Mutex
+)
+
+// loadFinalityChains 返回配置了最终确定检查的链
+func loadFinalityChains(config *Config) map[string]bool {
+	chains := make(map[string]bool)
+	for chainName, chainConfig := range config.Chains {
+		if chainConfig.Finality != nil {
+			chains[chainName] = true
+		}
+	}
+	return chains
+}
+
+// updateFinalizedHeight 根据链配置更新已最终确定的区块号，未配置时不做任何事
+// latestBlock 为本次查询到的最新区块号；查询 finalized 区块失败时保留上一次的高度，等下次更新
+func updateFinalizedHeight(ctx context.Context, client *rpcClient, chainName string, chainConfig ChainConfig, latestBlock uint64) {
+	finality := chainConfig.Finality
+	if finality == nil {
+		return
+	}
+
+	var height uint64
+	switch finality.Mode {
+	case finalityBlocks:
+		if latestBlock < finality.Blocks {
+			return
+		}
+		height = latestBlock - finality.Blocks
+	case finalityFinalized:
+		header, err := client.HeaderByNumber(ctx, big.NewInt(int64(rpc.FinalizedBlockNumber)))
+		if err != nil {
+			logrus.Warnf("Failed to get finalized block of chain %s: %v", chainName, err)
+			return
+		}
+		height = header.Number.Uint64()
+	default:
+		return
+	}
+
+	finalizedHeightsLock.Lock()
+	defer finalizedHeightsLock.Unlock()
+	// 切换节点后新节点的 finalized 区块可能略低，只前进不后退
+	if height > finalizedHeights[chainName] {
+		finalizedHeights[chainName] = height
+		logrus.Debugf("Chain %s finalized up to block %d", chainName, height)
+	}
+}
+
+// legFinal 判断链上 blockNumber 中的事件是否已最终确定
+// 未配置最终确定检查的链，以及加列之前没有记录区块号的旧数据，都视为已最终确定
+func legFinal(chainName string, blockNumber uint64) bool {
+	if !finalityChains[chainName] || blockNumber == 0 {
+		return true
+	}
+	finalizedHeightsLock.Lock()
+	defer finalizedHeightsLock.Unlock()
+	height, ok := finalizedHeights[chainName]
+	return ok && blockNumber <= height
+}
+
+// mesonFinal 判断 Meson 两边的事件是否都已最终确定
+func mesonFinal(meson database.Meson) bool {
+	return legFinal(meson.ChainA, meson.BlockA) && legFinal(meson.ChainB, meson.BlockB)
+}
+
+// crossingMatches 判断两边都已记录的 Meson 是否一致：一个 burn 一个 mint，token index 相同，金额在容差范围内
+func crossingMatches(meson database.Meson) bool {
+	return meson_event(meson.ActionA, meson.ActionB) &&
+		tokenIndexMatches(meson) &&
+		toleranceFor(meson.ChainA, meson.ChainB).allows(meson.AmountA, meson.AmountB)
+}
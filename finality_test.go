@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// useFinality 设置配置了最终确定检查的链并清空已最终确定的高度，测试结束时恢复
+func useFinality(t *testing.T, chains ...string) {
+	t.Helper()
+	savedChains := finalityChains
+	finalizedHeightsLock.Lock()
+	savedHeights := finalizedHeights
+	finalizedHeights = map[string]uint64{}
+	finalizedHeightsLock.Unlock()
+	t.Cleanup(func() {
+		finalityChains = savedChains
+		finalizedHeightsLock.Lock()
+		finalizedHeights = savedHeights
+		finalizedHeightsLock.Unlock()
+	})
+
+	finalityChains = map[string]bool{}
+	for _, chainName := range chains {
+		finalityChains[chainName] = true
+	}
+}
+
+// setFinalizedHeight 直接设置链已最终确定的高度
+func setFinalizedHeight(chainName string, height uint64) {
+	finalizedHeightsLock.Lock()
+	finalizedHeights[chainName] = height
+	finalizedHeightsLock.Unlock()
+}
+
+func TestUpdateFinalizedHeightInBlocksMode(t *testing.T) {
+	useFinality(t, "eth")
+	chainConfig := testChainConfig()
+	chainConfig.Finality = &FinalityConfig{Mode: finalityBlocks, Blocks: 10}
+
+	// 按区块数判断时不查询节点
+	updateFinalizedHeight(context.Background(), nil, "eth", chainConfig, 5)
+	if legFinal("eth", 1) {
+		t.Error("leg final before the chain is 10 blocks long")
+	}
+	updateFinalizedHeight(context.Background(), nil, "eth", chainConfig, 210)
+	if !legFinal("eth", 200) || legFinal("eth", 201) {
+		t.Errorf("legFinal at head 210 with 10 blocks: block 200 %v, block 201 %v; want true, false", legFinal("eth", 200), legFinal("eth", 201))
+	}
+	// 切换到落后的节点时高度不后退
+	updateFinalizedHeight(context.Background(), nil, "eth", chainConfig, 150)
+	if !legFinal("eth", 200) {
+		t.Error("finalized height moved backwards")
+	}
+	// 未配置最终确定检查的链记录后即视为最终确定
+	if !legFinal("bsc", 1000000) {
+		t.Error("leg on a chain without finality not final")
+	}
+}
+
+func TestFinalityDefersValidationUntilBothLegsAreFinal(t *testing.T) {
+	tests := []struct {
+		name       string
+		mintAmount int64
+		wantAlert  bool
+	}{
+		{name: "matching pair completes", mintAmount: 1000000},
+		{name: "mismatch alerts", mintAmount: 900000, wantAlert: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDatabase(t)
+			recorder := useTestNotifier(t)
+			setAlertCooldown(t, 0)
+			useFinality(t, "eth")
+			reqID := "finality"
+
+			handleTestEvent(t, db, "bsc", actionBurn, reqID, 1000000, reqID+"-burn", 100)
+			if err := handleTestEvent(t, db, "eth", actionMint, reqID, tt.mintAmount, reqID+"-mint", 200); err != nil {
+				t.Fatalf("mint leg: %v", err)
+			}
+			runDatabaseCheck(db, 0)
+			if alerts := recorder.Alerts(); len(alerts) != 0 {
+				t.Fatalf("sent %v before the mint leg is final", recorder.Kinds())
+			}
+			if meson := findTestMeson(t, reqID); meson.IsCheck || meson.ChainB != "eth" {
+				t.Fatalf("isCheck = %v, chainB = %q; want an unchecked pair with both legs", meson.IsCheck, meson.ChainB)
+			}
+
+			setFinalizedHeight("eth", 200)
+			runDatabaseCheck(db, 0)
+
+			meson := findTestMeson(t, reqID)
+			if tt.wantAlert {
+				if kinds := recorder.Kinds(); len(kinds) != 1 || kinds[0] != AlertAmountMismatch || meson.IsCheck {
+					t.Errorf("alerts = %v, isCheck = %v; want one %s", kinds, meson.IsCheck, AlertAmountMismatch)
+				}
+				return
+			}
+			if alerts := recorder.Alerts(); len(alerts) != 0 || !meson.IsCheck || meson.CompletedAt == nil {
+				t.Errorf("alerts = %v, isCheck = %v; want a completed pair without alerts", recorder.Kinds(), meson.IsCheck)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFormatTokenAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		decimals uint8
+		want     string
+	}{
+		{name: "fraction kept", amount: "1234560000", decimals: 6, want: "1,234.56"},
+		{name: "trailing zeros trimmed", amount: "1234500000", decimals: 6, want: "1,234.5"},
+		{name: "whole amount", amount: "1000000000000", decimals: 6, want: "1,000,000"},
+		{name: "below one unit", amount: "560000", decimals: 6, want: "0.56"},
+		{name: "smallest unit", amount: "1", decimals: 6, want: "0.000001"},
+		{name: "leading fraction zeros", amount: "1000001", decimals: 6, want: "1.000001"},
+		{name: "zero", amount: "0", decimals: 6, want: "0"},
+		{name: "negative", amount: "-1234560000", decimals: 6, want: "-1,234.56"},
+		{name: "negative below one unit", amount: "-10", decimals: 2, want: "-0.1"},
+		{name: "no decimals", amount: "1234567", decimals: 0, want: "1,234,567"},
+		{name: "large amount", amount: "123456789012345678901234567890", decimals: 6, want: "123,456,789,012,345,678,901,234.56789"},
+		{name: "large amount 18 decimals", amount: "987654321987654321987654321000000000000000000", decimals: 18, want: "987,654,321,987,654,321,987,654,321"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, ok := new(big.Int).SetString(tt.amount, 10)
+			if !ok {
+				t.Fatalf("invalid amount %s", tt.amount)
+			}
+			if got := formatTokenAmount(amount, tt.decimals); got != tt.want {
+				t.Errorf("formatTokenAmount(%s, %d) = %s, want %s", tt.amount, tt.decimals, got, tt.want)
+			}
+		})
+	}
+	if got := formatTokenAmount(nil, 6); got != "0" {
+		t.Errorf("formatTokenAmount(nil) = %s, want 0", got)
+	}
+}
+
+func TestFormatWithCommas(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   string
+	}{
+		{amount: "0", want: "0"},
+		{amount: "999", want: "999"},
+		{amount: "1000", want: "1,000"},
+		{amount: "123456", want: "123,456"},
+		{amount: "1234567", want: "1,234,567"},
+		{amount: "-1234567", want: "-1,234,567"},
+		{amount: "18446744073709551616", want: "18,446,744,073,709,551,616"},
+	}
+	for _, tt := range tests {
+		amount, _ := new(big.Int).SetString(tt.amount, 10)
+		if got := formatWithCommas(amount); got != tt.want {
+			t.Errorf("formatWithCommas(%s) = %s, want %s", tt.amount, got, tt.want)
+		}
+	}
+	if got := formatWithCommas(nil); got != "0" {
+		t.Errorf("formatWithCommas(nil) = %s, want 0", got)
+	}
+}
+
+func TestTokenDecimalsFromChainConfig(t *testing.T) {
+	saved := chainTokenDecimals
+	t.Cleanup(func() { chainTokenDecimals = saved })
+
+	chainTokenDecimals = loadTokenDecimals(map[string]ChainConfig{
+		"bsc": {MesonIndex: 1, TokenDecimal: 18},
+		"eth": {MesonIndexes: []uint8{1, 2}, TokenDecimal: 6, TokenDecimals: map[uint8]uint8{2: 18}},
+	})
+	tests := []struct {
+		chain      string
+		tokenIndex int
+		want       uint8
+	}{
+		{chain: "bsc", tokenIndex: 1, want: 18},
+		{chain: "eth", tokenIndex: 1, want: 6},
+		{chain: "eth", tokenIndex: 2, want: 18},
+		// 未配置的链或 token index 按最小单位展示
+		{chain: "eth", tokenIndex: 3, want: 0},
+		{chain: "tron", tokenIndex: 1, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tokenDecimals(tt.chain, tt.tokenIndex); got != tt.want {
+			t.Errorf("tokenDecimals(%s, %d) = %d, want %d", tt.chain, tt.tokenIndex, got, tt.want)
+		}
+	}
+
+	leg := AlertLeg{Amount: big.NewInt(1234560000), Decimals: tokenDecimals("eth", 1)}
+	if got := leg.AmountText(); got != "1,234.56" {
+		t.Errorf("AmountText = %s, want 1,234.56", got)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// headCache 缓存一条链的最新区块号，落后较多时连续处理多个区间不必每次都查询区块头
+// 只在监听协程内使用，不需要加锁；ttl 为 0 时不缓存
+type headCache struct {
+	ttl       time.Duration
+	block     uint64
+	fetchedAt time.Time
+}
+
+// newHeadCache 根据链配置创建最新区块号缓存
+func newHeadCache(chainConfig ChainConfig) *headCache {
+	return &headCache{ttl: time.Duration(chainConfig.HeadCacheSeconds) * time.Second}
+}
+
+// latest 返回最新区块号，缓存未过期时不查询节点，第二个返回值表示是否来自缓存
+// ctx 为监听协程的上下文，取消时不再等待节点响应
+func (c *headCache) latest(ctx context.Context, client *rpcClient) (uint64, bool, error) {
+	if c.ttl > 0 && !c.fetchedAt.IsZero() && time.Since(c.fetchedAt) < c.ttl {
+		return c.block, true, nil
+	}
+	block, err := getLatestBlockNumber(ctx, client)
+	if err != nil {
+		return 0, false, err
+	}
+	c.block = block
+	c.fetchedAt = time.Now()
+	return block, false, nil
+}
+
+// invalidate 清除缓存，下次 latest 查询节点
+func (c *headCache) invalidate() {
+	c.fetchedAt = time.Time{}
+}
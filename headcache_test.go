@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// headerFetches 节点收到的最新区块头查询次数
+func headerFetches(node *chainNode) int {
+	fetches := 0
+	for _, call := range node.Calls() {
+		if call.Method == "eth_getBlockByNumber" {
+			fetches++
+		}
+	}
+	return fetches
+}
+
+func TestHeadCacheReusesBlockWithinTTL(t *testing.T) {
+	node := newChainNode(t, "bsc", 1000)
+	client, err := dialRPC("bsc", node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	chainConfig := testChainConfig()
+	chainConfig.HeadCacheSeconds = 3600
+	head := newHeadCache(chainConfig)
+
+	for i, wantCached := range []bool{false, true, true} {
+		block, cached, err := head.latest(context.Background(), client)
+		if err != nil {
+			t.Fatalf("latest #%d: %v", i, err)
+		}
+		if block != 1000 || cached != wantCached {
+			t.Errorf("latest #%d = %d, cached %v; want 1000, cached %v", i, block, cached, wantCached)
+		}
+	}
+	if got := headerFetches(node); got != 1 {
+		t.Errorf("fetched %d headers within the TTL, want 1", got)
+	}
+
+	// 清除缓存后重新查询节点
+	head.invalidate()
+	if _, cached, err := head.latest(context.Background(), client); err != nil || cached {
+		t.Errorf("latest after invalidate: cached %v, err %v; want a fresh fetch", cached, err)
+	}
+	if got := headerFetches(node); got != 2 {
+		t.Errorf("fetched %d headers, want 2", got)
+	}
+}
+
+func TestHeadCacheDisabledByDefault(t *testing.T) {
+	node := newChainNode(t, "bsc", 1000)
+	client, err := dialRPC("bsc", node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	head := newHeadCache(testChainConfig())
+	for i := 0; i < 3; i++ {
+		if _, cached, err := head.latest(context.Background(), client); err != nil || cached {
+			t.Fatalf("latest #%d: cached %v, err %v; want a fresh fetch", i, cached, err)
+		}
+	}
+	if got := headerFetches(node); got != 3 {
+		t.Errorf("fetched %d headers, want 3", got)
+	}
+}
+
+func TestHeadCacheStopsWaitingWhenCancelled(t *testing.T) {
+	node := newChainNode(t, "bsc", 1000)
+	node.latency = 500 * time.Millisecond
+	client, err := dialRPC("bsc", node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err = newHeadCache(testChainConfig()).latest(ctx, client)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("latest returned %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed >= node.latency/2 {
+		t.Errorf("latest returned after %s, want it to stop waiting once ctx is done", elapsed)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// 各超时的默认值，ReadTimeout 同时用作 ReadHeaderTimeout
+	defaultHTTPReadTimeout  = 10 * time.Second
+	defaultHTTPWriteTimeout = 30 * time.Second
+	defaultHTTPIdleTimeout  = 120 * time.Second
+
+	// apiShutdownTimeout 停止时等待进行中的请求完成的最长时间
+	apiShutdownTimeout = 10 * time.Second
+)
+
+// HTTPServerConfig 对外提供的 HTTP 服务的超时配置，避免慢速或不关闭的连接一直占用服务
+// 各字段为 0 时使用默认值：读取 10 秒、写入 30 秒、空闲 120 秒
+type HTTPServerConfig struct {
+	// ReadTimeoutSeconds 读取整个请求（包括请求头和请求体）的超时时间（秒）
+	ReadTimeoutSeconds int `json:"readTimeoutSeconds"`
+	// WriteTimeoutSeconds 从读完请求头到写完响应的超时时间（秒），需要大于最慢的查询接口的耗时
+	WriteTimeoutSeconds int `json:"writeTimeoutSeconds"`
+	// IdleTimeoutSeconds keep-alive 连接等待下一个请求的超时时间（秒）
+	IdleTimeoutSeconds int `json:"idleTimeoutSeconds"`
+}
+
+// validate 检查超时配置
+func (c HTTPServerConfig) validate() error {
+	if c.ReadTimeoutSeconds < 0 {
+		return fmt.Errorf("readTimeoutSeconds must not be negative, got %d", c.ReadTimeoutSeconds)
+	}
+	if c.WriteTimeoutSeconds < 0 {
+		return fmt.Errorf("writeTimeoutSeconds must not be negative, got %d", c.WriteTimeoutSeconds)
+	}
+	if c.IdleTimeoutSeconds < 0 {
+		return fmt.Errorf("idleTimeoutSeconds must not be negative, got %d", c.IdleTimeoutSeconds)
+	}
+	return nil
+}
+
+// secondsOr 将秒数换算为 time.Duration，为 0 时返回默认值
+func secondsOr(seconds int, fallback time.Duration) time.Duration {
+	if seconds == 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// newHTTPServer 创建按配置设置了超时的 HTTP 服务，所有对外监听的服务都通过它创建
+func newHTTPServer(addr string, handler http.Handler, config HTTPServerConfig) *http.Server {
+	readTimeout := secondsOr(config.ReadTimeoutSeconds, defaultHTTPReadTimeout)
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readTimeout,
+		WriteTimeout:      secondsOr(config.WriteTimeoutSeconds, defaultHTTPWriteTimeout),
+		IdleTimeout:       secondsOr(config.IdleTimeoutSeconds, defaultHTTPIdleTimeout),
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"meson-monitor/database"
+)
+
+// chainNode 模拟一条链的 JSON-RPC 节点：最新区块为 latest，eth_getLogs 按区块区间和合约地址返回 logs 中的日志
+type chainNode struct {
+	*mockRPC
+	chainName string
+	latest    uint64
+	logs      []types.Log
+}
+
+// newChainNode 启动模拟节点，日志的区块哈希改为节点返回的对应区块头的哈希
+func newChainNode(t *testing.T, chainName string, latest uint64, logs ...types.Log) *chainNode {
+	node := &chainNode{chainName: chainName, latest: latest}
+	for _, vLog := range logs {
+		vLog.BlockHash = node.header(vLog.BlockNumber).Hash()
+		node.logs = append(node.logs, vLog)
+	}
+	node.mockRPC = newMockRPC(t, node.handle)
+	return node
+}
+
+// header 区块 number 的区块头，不同链的同一高度哈希不同
+func (n *chainNode) header(number uint64) *types.Header {
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(number),
+		Difficulty: new(big.Int),
+		Time:       1700000000 + number,
+		Extra:      []byte(n.chainName),
+	}
+}
+
+func (n *chainNode) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "eth_blockNumber":
+		return hexutil.Uint64(n.latest), nil
+	case "eth_getBlockByNumber":
+		var args []interface{}
+		if err := json.Unmarshal(params, &args); err != nil || len(args) == 0 {
+			return nil, fmt.Errorf("invalid eth_getBlockByNumber params %s", params)
+		}
+		tag, _ := args[0].(string)
+		if tag == "latest" {
+			return n.header(n.latest), nil
+		}
+		number, err := hexutil.DecodeUint64(tag)
+		if err != nil || number > n.latest {
+			return nil, fmt.Errorf("unknown block %q", tag)
+		}
+		return n.header(number), nil
+	case "eth_getLogs":
+		var filters []struct {
+			FromBlock hexutil.Uint64   `json:"fromBlock"`
+			ToBlock   hexutil.Uint64   `json:"toBlock"`
+			Address   []common.Address `json:"address"`
+		}
+		if err := json.Unmarshal(params, &filters); err != nil || len(filters) != 1 {
+			return nil, fmt.Errorf("invalid eth_getLogs params %s", params)
+		}
+		filter := filters[0]
+		if uint64(filter.ToBlock) > n.latest {
+			return nil, fmt.Errorf("toBlock %d is past the latest block %d", filter.ToBlock, n.latest)
+		}
+		logs := []types.Log{}
+		for _, vLog := range n.logs {
+			if vLog.BlockNumber < uint64(filter.FromBlock) || vLog.BlockNumber > uint64(filter.ToBlock) {
+				continue
+			}
+			for _, address := range filter.Address {
+				if vLog.Address == address {
+					logs = append(logs, vLog)
+					break
+				}
+			}
+		}
+		return logs, nil
+	}
+	return nil, errors.New("unexpected method " + method)
+}
+
+// useProgressBackend 设置区块进度的存储方式，测试结束时恢复
+func useProgressBackend(t *testing.T, backend string) {
+	previous := progressBackend
+	progressBackend = backend
+	t.Cleanup(func() {
+		progressBackend = previous
+	})
+}
+
+func TestConnectAndListenRecordsMesonsFromMockNodes(t *testing.T) {
+	db := useTestDatabase(t)
+	useProgressBackend(t, progressBackendDB)
+	parsedABI := testABI(t)
+	paired := testReqID(testTokenIndex, 1000000, 1700000000)
+	invalid := testReqID(testTokenIndex, 2000000, 1700000000)
+	// 最新区块为 1000，默认需要 12 个确认，区块 995 的日志还不会处理
+	unconfirmed := testReqID(testTokenIndex, 3000000, 1700000000)
+
+	nodes := map[string]*chainNode{
+		"bsc": newChainNode(t, "bsc", 1000,
+			mesonLog(parsedABI, "bsc", actionBurn, paired, 50, 0),
+			mesonLog(parsedABI, "bsc", actionBurn, invalid, 70, 0),
+			mesonLog(parsedABI, "bsc", actionBurn, unconfirmed, 995, 0),
+		),
+		"eth": newChainNode(t, "eth", 1000,
+			mesonLog(parsedABI, "eth", actionMint, paired, 60, 1),
+			mesonLog(parsedABI, "eth", actionBurn, invalid, 80, 1),
+		),
+	}
+	recorder := &recordingNotifier{}
+	deps := listenDeps{dial: dialRPC, notifier: recorder, store: db}
+
+	// 处理完第一个区间后监听循环会等待新的区块，这里只等到两条链的日志都已记录
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for chainName, node := range nodes {
+		chainConfig := testChainConfig()
+		chainConfig.RpcUrl = node.URL
+		go connectAndListen(ctx, chainName, chainConfig, newRPCEndpoints(chainName, chainConfig.rpcURLs()), deps)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if progressReached("bsc", 989) && progressReached("eth", 989) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	alerts := recorder.Alerts()
+	if len(alerts) != 1 || alerts[0].Kind != AlertInvalidActionPair || alerts[0].ReqID != invalid.Hex() {
+		t.Fatalf("alerts = %+v, want one %s for %s", alerts, AlertInvalidActionPair, invalid.Hex())
+	}
+
+	meson := findTestMeson(t, paired.Hex())
+	if meson.ChainA == meson.ChainB || (meson.ChainA != "bsc" && meson.ChainA != "eth") || (meson.ChainB != "bsc" && meson.ChainB != "eth") ||
+		!meson.IsCheck || meson.CompletedAt == nil {
+		t.Errorf("paired Meson = %+v, want a completed bsc/eth pair", *meson)
+	}
+	if meson := findTestMeson(t, invalid.Hex()); meson.ChainB == "" {
+		t.Errorf("second leg of the invalid pair not recorded: %+v", *meson)
+	}
+	if meson, err := database.FindMesonByReqID(unconfirmed.Hex()); err != nil || meson != nil {
+		t.Errorf("unconfirmed Meson = %v, %v; want not recorded", meson, err)
+	}
+
+	// 两条链的查询都只到确认高度 988
+	for chainName, node := range nodes {
+		queries := 0
+		for _, call := range node.Calls() {
+			if call.Method != "eth_getLogs" {
+				continue
+			}
+			queries++
+			if !strings.Contains(string(call.Params), `"toBlock":"0x3dc"`) {
+				t.Errorf("%s eth_getLogs %s, want the range to end at the confirmed block 988", chainName, call.Params)
+			}
+		}
+		if queries == 0 {
+			t.Errorf("%s node received no eth_getLogs calls", chainName)
+		}
+	}
+}
+
+// progressReached 判断链的区块进度是否已保存为 block
+func progressReached(chainName string, block uint64) bool {
+	saved, ok, err := database.GetChainProgress(chainName)
+	return err == nil && ok && saved == block
+}
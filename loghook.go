@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultErrorLogInterval 同一类错误日志两次告警的默认最小间隔
+const defaultErrorLogInterval = 15 * time.Minute
+
+// ErrorLogAlertsConfig 将 error 及以上级别的日志作为告警发送，使运维人员看到监控程序自身的故障（RPC、数据库等）
+type ErrorLogAlertsConfig struct {
+	// Enabled 是否启用
+	Enabled bool `json:"enabled"`
+	// IntervalMinutes 同一类错误两次告警的最小间隔（分钟），期间的同类错误只计数，为 0 时使用默认值 15
+	IntervalMinutes int `json:"intervalMinutes"`
+}
+
+// validate 检查错误日志告警配置
+func (c ErrorLogAlertsConfig) validate() error {
+	if c.IntervalMinutes < 0 {
+		return fmt.Errorf("intervalMinutes must not be negative, got %d", c.IntervalMinutes)
+	}
+	return nil
+}
+
+// errorLogIgnoredPrefixes 发送告警本身失败时的日志，转为告警只会再次发送失败，不处理
+var errorLogIgnoredPrefixes = []string{
+	"Failed to send ",
+	"Failed to deliver ",
+	"Failed to redeliver ",
+	"Failed to persist undelivered ",
+}
+
+var (
+	errorLogHexPattern    = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+	errorLogURLPattern    = regexp.MustCompile(`[a-z]+://[^\s"]*[^\s":,.]`)
+	errorLogNumberPattern = regexp.MustCompile(`\d+`)
+)
+
+// errorLogCategory 去掉日志中的地址、哈希、URL 和数字后作为错误类别，同一位置因不同区块或交易反复出错时归为一类
+// 带有 ChainName 字段的日志按链分开
+func errorLogCategory(entry *logrus.Entry) string {
+	category := errorLogURLPattern.ReplaceAllString(entry.Message, "<url>")
+	category = errorLogHexPattern.ReplaceAllString(category, "<hex>")
+	category = errorLogNumberPattern.ReplaceAllString(category, "<n>")
+	if len(category) > 200 {
+		category = category[:200]
+	}
+	if chain, ok := entry.Data["ChainName"]; ok {
+		category = fmt.Sprintf("[%v] %s", chain, category)
+	}
+	return category
+}
+
+// errorLogState 一类错误最近一次告警的时间和之后被抑制的次数
+type errorLogState struct {
+	lastAlerted time.Time
+	suppressed  int
+}
+
+// errorLogHook 将 error 及以上级别的日志转为 AlertInternalError 告警
+// 同一类错误在 interval 内只告警一次，下次告警时附上期间被抑制的次数
+type errorLogHook struct {
+	interval time.Duration
+	notifier Notifier
+
+	mu         sync.Mutex
+	categories map[string]*errorLogState
+}
+
+func (h *errorLogHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+// Fire 只决定是否告警并将告警交给 notifier，notifier 为告警队列，不阻塞写日志
+func (h *errorLogHook) Fire(entry *logrus.Entry) error {
+	for _, prefix := range errorLogIgnoredPrefixes {
+		if strings.HasPrefix(entry.Message, prefix) {
+			return nil
+		}
+	}
+
+	category := errorLogCategory(entry)
+	h.mu.Lock()
+	state, ok := h.categories[category]
+	if !ok {
+		state = &errorLogState{}
+		h.categories[category] = state
+	}
+	if !state.lastAlerted.IsZero() && entry.Time.Sub(state.lastAlerted) < h.interval {
+		state.suppressed++
+		h.mu.Unlock()
+		return nil
+	}
+	suppressed := state.suppressed
+	state.lastAlerted = entry.Time
+	state.suppressed = 0
+	h.mu.Unlock()
+
+	note := fmt.Sprintf("%s: %s", strings.ToUpper(entry.Level.String()), entry.Message)
+	if suppressed > 0 {
+		note += fmt.Sprintf(" (%d similar error(s) suppressed in the last %s)", suppressed, h.interval)
+	}
+	sendAlertTo(h.notifier, Alert{
+		Kind:      AlertInternalError,
+		Timestamp: entry.Time.Unix(),
+		Note:      note,
+	})
+	return nil
+}
+
+// startErrorLogAlerts 根据配置为 logrus 添加错误日志告警 hook，需要在告警队列启动之后调用
+// 返回的函数移除该 hook，需要在停止告警队列之前调用
+func startErrorLogAlerts(config ErrorLogAlertsConfig) func() {
+	if !config.Enabled {
+		return func() {}
+	}
+	interval := defaultErrorLogInterval
+	if config.IntervalMinutes > 0 {
+		interval = time.Duration(config.IntervalMinutes) * time.Minute
+	}
+	hook := &errorLogHook{
+		interval:   interval,
+		notifier:   alertNotifier(),
+		categories: make(map[string]*errorLogState),
+	}
+	logrus.AddHook(hook)
+	logrus.Infof("Forwarding error logs as alerts, at most once per %s for each kind of error", interval)
+
+	return func() {
+		removeLogHook(hook)
+	}
+}
+
+// removeLogHook 从 logrus 的标准 logger 中移除 hook，其他 hook 保留
+func removeLogHook(hook logrus.Hook) {
+	logger := logrus.StandardLogger()
+	kept := make(logrus.LevelHooks)
+	for level, hooks := range logger.ReplaceHooks(make(logrus.LevelHooks)) {
+		for _, h := range hooks {
+			if h != hook {
+				kept[level] = append(kept[level], h)
+			}
+		}
+	}
+	logger.ReplaceHooks(kept)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// errorEntry 在 at 时刻记录的一条 error 日志
+func errorEntry(message string, at time.Time, fields logrus.Fields) *logrus.Entry {
+	return &logrus.Entry{Message: message, Level: logrus.ErrorLevel, Time: at, Data: fields}
+}
+
+func TestErrorLogCategory(t *testing.T) {
+	// 只有区块号、哈希和 URL 不同的错误归为同一类
+	a := errorEntry("Failed to get logs for blocks 100-200 from https://rpc-a.example.com/key1: tx 0xabc", time.Now(), nil)
+	b := errorEntry("Failed to get logs for blocks 300-400 from https://rpc-b.example.com/key2: tx 0xdef", time.Now(), nil)
+	if errorLogCategory(a) != errorLogCategory(b) {
+		t.Errorf("categories differ:\n%s\n%s", errorLogCategory(a), errorLogCategory(b))
+	}
+	if want := "Failed to get logs for blocks <n>-<n> from <url>: tx <hex>"; errorLogCategory(a) != want {
+		t.Errorf("category = %q, want %q", errorLogCategory(a), want)
+	}
+
+	// 不同链的同一种错误分开
+	bsc := errorEntry("RPC timeout", time.Now(), logrus.Fields{"ChainName": "bsc"})
+	eth := errorEntry("RPC timeout", time.Now(), logrus.Fields{"ChainName": "eth"})
+	if errorLogCategory(bsc) == errorLogCategory(eth) {
+		t.Errorf("chains share category %q", errorLogCategory(bsc))
+	}
+}
+
+func TestErrorLogHookRateLimitsEachCategory(t *testing.T) {
+	recorder := &recordingNotifier{}
+	hook := &errorLogHook{interval: time.Minute, notifier: recorder, categories: make(map[string]*errorLogState)}
+	start := time.Now()
+
+	hook.Fire(errorEntry("Failed to commit block 100", start, nil))
+	hook.Fire(errorEntry("Failed to commit block 101", start.Add(10*time.Second), nil))
+	hook.Fire(errorEntry("Failed to commit block 102", start.Add(20*time.Second), nil))
+	// 另一类错误不受影响
+	hook.Fire(errorEntry("Database unreachable", start.Add(30*time.Second), nil))
+	// 间隔过后再次告警，附上被抑制的次数
+	hook.Fire(errorEntry("Failed to commit block 103", start.Add(time.Minute), nil))
+
+	alerts := recorder.Alerts()
+	if len(alerts) != 3 {
+		t.Fatalf("sent %d alerts, want 3: %+v", len(alerts), alerts)
+	}
+	for _, alert := range alerts {
+		if alert.Kind != AlertInternalError {
+			t.Errorf("alert kind = %s, want %s", alert.Kind, AlertInternalError)
+		}
+	}
+	if alerts[0].Note != "ERROR: Failed to commit block 100" {
+		t.Errorf("first note = %q", alerts[0].Note)
+	}
+	if want := "ERROR: Failed to commit block 103 (2 similar error(s) suppressed in the last 1m0s)"; alerts[2].Note != want {
+		t.Errorf("note after the interval = %q, want %q", alerts[2].Note, want)
+	}
+}
+
+func TestErrorLogHookIgnoresSendFailures(t *testing.T) {
+	recorder := &recordingNotifier{}
+	hook := &errorLogHook{interval: time.Minute, notifier: recorder, categories: make(map[string]*errorLogState)}
+	for _, prefix := range errorLogIgnoredPrefixes {
+		hook.Fire(errorEntry(prefix+"alert: connection refused", time.Now(), nil))
+	}
+	if alerts := recorder.Alerts(); len(alerts) != 0 {
+		t.Errorf("forwarded %d send failures, want 0: %v", len(alerts), alerts)
+	}
+}
@@ -3,24 +3,27 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
-	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/sirupsen/logrus"
 
 	"meson-monitor/bot"
 	"meson-monitor/database"
+	"meson-monitor/reqid"
 
 )
 
@@ -28,52 +31,344 @@ type Config struct {
 	Main struct {
 		WalletAddress string   `json:"walletAddress"`
 		PrivateKey    string   `json:"privateKey"`
-		CheckTime     int      `json:"check_time"`
+		CheckTime     int      `json:"check_time"` // 已废弃：检查间隔（毫秒），请使用 checkIntervalSeconds
+		// CheckIntervalSeconds 检查未匹配 Meson 的间隔（秒），配置后忽略 check_time
+		CheckIntervalSeconds int `json:"checkIntervalSeconds"`
 		BotToken      string   `json:"botToken"`
-		ChatIDs       []int64  `json:"chatIDs"`
+		// ChatIDs 每项可以是 chat ID 数字，或 {"chatID": ..., "messageThreadID": ...} 发送到指定话题
+		ChatIDs       []bot.TelegramChat `json:"chatIDs"`
+		ParseMode     string   `json:"parseMode"` // Telegram 消息格式："HTML"（默认）或 "MarkdownV2"
+		// DisplayTimezone 消息中显示时间使用的 IANA 时区，如 "Asia/Shanghai"，为空或无效时使用 UTC
+		DisplayTimezone string `json:"displayTimezone"`
 		LarkBotURL    string   `json:"lark_bot"`
-		PostgresURI   string   `json:"postgresURI"`
+		LarkSecret    string   `json:"lark_secret"` // 飞书机器人签名密钥，未开启签名校验时留空
+		SlackBotURL   string   `json:"slack_bot"`   // Slack Incoming Webhook 地址，为空时不发送 Slack 消息
+		// WebhookURL 通用 Webhook 地址，告警以 JSON POST 到该地址，为空时不发送
+		WebhookURL string `json:"webhookURL"`
+		// WebhookHeaders 每个 Webhook 请求附加的请求头，如 {"Authorization": "Bearer ..."}
+		WebhookHeaders map[string]string `json:"webhookHeaders"`
+		// WebhookTemplate 请求体的 Go text/template 模板，为空时发送默认的告警 JSON
+		WebhookTemplate string `json:"webhookTemplate"`
+		// PagerDutyRoutingKey PagerDuty Events API v2 的 routing key，金额不一致和缺少一边的告警会触发 incident，为空时不发送
+		PagerDutyRoutingKey string `json:"pagerDutyRoutingKey"`
+		// MessageTemplates Telegram 和 Lark 告警正文的模板，为空时使用内置的默认格式
+		MessageTemplates MessageTemplatesConfig `json:"messageTemplates"`
+		PostgresURI   string   `json:"postgresURI"` // 数据库连接地址，sqlite:// 或 file: 开头时使用 SQLite
+		// DBType 数据库类型："postgres" 或 "sqlite"，为空时根据 postgresURI 推断
+		DBType string `json:"dbType"`
+		// PostgreSQL 连接池配置，为 0 时使用默认值
+		PostgresMaxConns       int32 `json:"postgresMaxConns"`
+		PostgresMinConns       int32 `json:"postgresMinConns"`
+		PostgresConnectTimeout int   `json:"postgresConnectTimeout"` // 秒
+		PostgresMaxConnIdle    int   `json:"postgresMaxConnIdle"`    // 秒
+		// NotifyMaxAttempts 每条告警的最大发送次数，为 0 时使用默认值
+		NotifyMaxAttempts int `json:"notifyMaxAttempts"`
+		// NotifyTimeoutSeconds 发送告警时单次请求的超时时间（秒），为 0 时使用默认值
+		NotifyTimeoutSeconds int `json:"notifyTimeoutSeconds"`
+		// ProxyURL 发送告警使用的代理，如 "http://proxy.example.com:3128"，为空时沿用 HTTP_PROXY/HTTPS_PROXY 环境变量
+		ProxyURL string `json:"proxyURL"`
+		// AlertCooldownMinutes 同一 reqID 重复告警的冷却时间（分钟），为 0 时每个检查周期都告警
+		AlertCooldownMinutes int `json:"alertCooldownMinutes"`
+		// PendingTimeoutMinutes 单边 Meson 等待另一边的超时时间（分钟），为 0 时不检查
+		PendingTimeoutMinutes int `json:"pendingTimeoutMinutes"`
+		// APIListen 查询接口的监听地址，如 ":8080"，为空时不启动
+		APIListen string `json:"apiListen"`
+		// AdminToken 管理接口（暂停/恢复链监听）的 Bearer token，为空时不启用管理接口
+		AdminToken string `json:"adminToken"`
+		// ErrorLogAlerts 将监控程序自身的 error 日志作为告警发送，按错误类别限流
+		ErrorLogAlerts ErrorLogAlertsConfig `json:"errorLogAlerts"`
+		// HTTPServer 查询接口等 HTTP 服务的读取、写入和空闲超时
+		HTTPServer HTTPServerConfig `json:"httpServer"`
+		// ProgressBackend 指定区块进度的存储方式："file"（默认）或 "db"
+		ProgressBackend string `json:"progressBackend"`
+		// LastBlockDir progressBackend 为 "file" 时保存区块进度的目录，不存在时启动时自动创建，为空时使用 last_block
+		LastBlockDir string `json:"lastBlockDir"`
+		// StallAlertMinutes 某条链超过该时间（分钟）没有推进区块进度时发送停滞告警，为 0 时不检查
+		StallAlertMinutes int `json:"stallAlertMinutes"`
+		// StartupConcurrency 启动时同时首次连接 RPC 节点的链数量上限，为 0 时不限制
+		StartupConcurrency int `json:"startupConcurrency"`
+		// StartupStaggerMillis 相邻两条链启动监听之间的间隔（毫秒），为 0 时同时启动
+		StartupStaggerMillis int `json:"startupStaggerMillis"`
+		// StartupGraceSeconds 链启动后在该时间（秒）内仍未连接成功时发送告警，为 0 时使用默认值 120
+		StartupGraceSeconds int `json:"startupGraceSeconds"`
+		// StartupJitterMillis 每条链启动监听前以及轮询模式每次等待时附加的随机延迟上限（毫秒），为 0 时不加随机延迟
+		StartupJitterMillis int `json:"startupJitterMillis"`
+		// ZeroAmountAction reqID 中金额为零的事件的处理方式："skip"（默认）、"process" 或 "alert"
+		ZeroAmountAction string `json:"zeroAmountAction"`
+		// AlertsPerMinute 所有渠道合计每分钟最多发送的告警数，超出的告警合并为一条汇总，为 0 时不限流
+		AlertsPerMinute int `json:"alertsPerMinute"`
+		// AlertQueueSize 待发送告警队列的容量，队列满时丢弃最旧的告警，为 0 时使用默认值
+		AlertQueueSize int `json:"alertQueueSize"`
+		// SummaryTime 每日汇总的发送时间（UTC），格式 "09:00"，为空时不发送
+		SummaryTime string `json:"summaryTime"`
+		// AmountTolerances 各链对之间允许的金额差，未配置的链对要求两边金额严格相等
+		AmountTolerances []AmountTolerance `json:"amountTolerances"`
+		// MinAmount 以代币单位表示的最小金额，如 "100"，低于该金额的跨链不告警，为空时不限制；链上的 minAmount 优先
+		// 按每条链的代币小数位数换算后比较，各链的最小金额应当一致，否则一边被跳过的跨链可能在另一边触发缺失告警
+		MinAmount string `json:"minAmount"`
+		// MinAmountAction 低于最小金额的跨链的处理方式："record"（默认）正常记录但不告警，"skip" 不记录
+		MinAmountAction string `json:"minAmountAction"`
+		// WatchedRoutes 需要校验和告警的跨链方向，为空时所有方向都校验；不在其中的方向仍然记录，只是不告警
+		WatchedRoutes []WatchedRoute `json:"watchedRoutes"`
+		// AlertRoutes 按链将告警发送到单独的 Telegram chat、Lark 或 Slack 机器人，没有路由的链发送到上面的默认渠道
+		AlertRoutes []AlertRoute `json:"alertRoutes"`
+		// AuditLog 将每个解析出的事件追加写入审计日志，dir 为空时不启用
+		AuditLog AuditLogConfig `json:"auditLog"`
+		// CheckBatchSize 定期检查时每批读取的未完成记录数量，为 0 时使用默认值 500
+		CheckBatchSize int `json:"checkBatchSize"`
+		// Retention 超过保留时间的记录定期移到 meson_archive 表，maxAgeDays 为 0 时不归档
+		Retention RetentionConfig `json:"retention"`
 	} `json:"main"`
-	Chains map[string]struct {
-		RpcUrl        string `json:"rpcUrl"`
-		MesonContract string `json:"mesonContract"`
-		MesonIndex    uint8  `json:"mesonIndex"`
-		TokenDecimal  uint8  `json:"tokendecimal"`
-		StartBlock    uint64 `json:"startBlock"`
-		TokenContract string `json:"tokenContract"`
-	} `json:"chains"`
+	Chains map[string]ChainConfig `json:"chains"`
+}
+
+// ChainConfig 单条链的监听配置
+type ChainConfig struct {
+	RpcUrl        string `json:"rpcUrl"`
+	// RpcUrls 多个备用 RPC 节点，按顺序轮换；只配置 rpcUrl 时视为只有一个节点
+	RpcUrls       []string `json:"rpcUrls"`
+	// MesonContract 跨链桥合约地址，filterAddress 为空时只处理该合约发出的日志
+	MesonContract string `json:"mesonContract"`
+	// FilterAddress 查询和订阅日志时过滤的合约地址，即发出 TokenMintExecuted/TokenBurnExecuted 事件的合约
+	// 事件由代理合约等其他地址发出时配置，为空时使用 mesonContract
+	FilterAddress string `json:"filterAddress"`
+	// FilterAddresses 同一条链上有多个发出事件的合约时（如旧合约和升级后的合约）配置，与 filterAddress 二选一
+	// 所有合约共用一个监听协程和区块进度，记录的每条事件都带有发出它的合约地址
+	FilterAddresses []string `json:"filterAddresses"`
+	MesonIndex      uint8    `json:"mesonIndex"`
+	TokenDecimal  uint8  `json:"tokendecimal"`
+	StartBlock    uint64 `json:"startBlock"`
+	// StartFrom 没有保存的区块进度时的起始位置："config"（默认）使用 startBlock，"latest" 从当前已确认高度开始
+	StartFrom string `json:"startFrom"`
+	// TokenContract 代币合约地址，仅作记录，不用于过滤日志
+	TokenContract string `json:"tokenContract"`
+	// Mode 监听方式："poll" 轮询 FilterLogs，"subscribe" 通过 WebSocket 订阅日志
+	// 为空时根据 rpcUrl 自动选择：ws:// 或 wss:// 使用订阅，其余使用轮询
+	Mode string `json:"mode"`
+	// MesonIndexes 同一合约上需要监听的多个 token index，未配置时使用 MesonIndex
+	MesonIndexes []uint8 `json:"mesonIndexes"`
+	// TokenDecimals 各 token index 对应的代币小数位数，未配置的 index 使用 TokenDecimal
+	TokenDecimals map[uint8]uint8 `json:"tokenDecimals"`
+	// BlockStep 每次 FilterLogs 查询的初始区块跨度，为 0 时使用默认值
+	BlockStep uint64 `json:"blockStep"`
+	// MaxBlockStep 自适应调整时区块跨度的上限，小于 BlockStep 时取 BlockStep
+	MaxBlockStep uint64 `json:"maxBlockStep"`
+	// MaxLogRange RPC 服务商允许的单次 eth_getLogs 查询区块数上限，为 0 时不限制
+	// 服务商返回的错误中带有更小的上限时自动降低
+	MaxLogRange uint64 `json:"maxLogRange"`
+	// Confirmations 事件需要的确认区块数，可以按 mint 和 burn 分别配置，未配置时默认为 defaultConfirmations
+	Confirmations *ConfirmationsConfig `json:"confirmations"`
+	// MinAmount 该链的最小金额（代币单位），覆盖 main.minAmount
+	MinAmount string `json:"minAmount"`
+	// PollIntervalSeconds 轮询模式下处理完一个区间后到查询下一个区间之间的等待时间（秒），为 0 时使用默认值 5
+	PollIntervalSeconds int `json:"pollIntervalSeconds"`
+	// IdleIntervalSeconds 轮询模式下已追上确认高度时的等待时间（秒），为 0 时使用默认值 600
+	IdleIntervalSeconds int `json:"idleIntervalSeconds"`
+	// CatchUpThreshold 轮询模式下落后确认高度超过该区块数时进入追赶模式：查询之间不等待，使用 catchUpBlockStep 的跨度，
+	// 追到确认高度附近几个跨度以内后恢复正常轮询；为 0 时不启用
+	CatchUpThreshold uint64 `json:"catchUpThreshold"`
+	// CatchUpBlockStep 追赶模式下的区块跨度上限，为 0 时使用 maxBlockStep 的 4 倍
+	CatchUpBlockStep uint64 `json:"catchUpBlockStep"`
+	// HeadCacheSeconds 轮询模式下最新区块号的缓存时间（秒），追赶历史区块时减少区块头查询，为 0 时每次都查询
+	HeadCacheSeconds int `json:"headCacheSeconds"`
+	// ABIFile 合约 ABI 文件路径，ABI 为内联的 ABI JSON，都未配置时使用内置的 contractABI
+	ABIFile string `json:"abiFile"`
+	ABI     string `json:"abi"`
+	// EventActions ABI 中事件名称到 TokenMintExecuted/TokenBurnExecuted 的映射，用于事件改名的合约
+	EventActions map[string]string `json:"eventActions"`
+	// Finality 两边事件最终确定后才判定跨链是否完成，未配置时事件获得 confirmations 个确认后即判定
+	Finality *FinalityConfig `json:"finality"`
+	// ReqIDLayout reqID 中金额、token index 和创建时间的位置，用于其他版本的 Meson 或其他跨链桥，未配置时使用当前 Meson 的布局
+	ReqIDLayout *reqid.Layout `json:"reqIDLayout"`
+	// ExplorerTxURL 区块浏览器的交易链接模板，%s 替换为交易哈希，如 "https://bscscan.com/tx/%s"
+	// 配置后 Telegram 告警附带打开该链交易的按钮，为空时不附带
+	ExplorerTxURL string `json:"explorerTxUrl"`
+	// BatchRequests 轮询模式下与同一 RPC 节点上同样开启该选项的其他链合并 eth_getLogs 请求，节点需要支持 JSON-RPC 批量请求
+	// 节点拒绝批量请求时自动改为单独发送
+	BatchRequests bool `json:"batchRequests"`
+	// RecipientAllowlist 该链上 mint 允许的接收地址，接收地址不在其中时发送高优先级告警，为空时不检查
+	RecipientAllowlist []string `json:"recipientAllowlist"`
+}
+
+// rpcURLs 返回链配置的全部 RPC 节点，兼容只配置了单个 rpcUrl 的旧配置
+func (c ChainConfig) rpcURLs() []string {
+	if len(c.RpcUrls) > 0 {
+		return c.RpcUrls
+	}
+	if c.RpcUrl == "" {
+		return nil
+	}
+	return []string{c.RpcUrl}
+}
+
+// filterAddresses 返回过滤日志使用的合约地址
+// 优先使用 filterAddresses，其次是 filterAddress，都未配置时使用 mesonContract
+func (c ChainConfig) filterAddresses() []common.Address {
+	if len(c.FilterAddresses) > 0 {
+		addresses := make([]common.Address, len(c.FilterAddresses))
+		for i, address := range c.FilterAddresses {
+			addresses[i] = common.HexToAddress(address)
+		}
+		return addresses
+	}
+	if c.FilterAddress != "" {
+		return []common.Address{common.HexToAddress(c.FilterAddress)}
+	}
+	return []common.Address{common.HexToAddress(c.MesonContract)}
+}
+
+// watchesAddress 判断 address 是否为该链过滤日志的合约之一
+func (c ChainConfig) watchesAddress(address common.Address) bool {
+	for _, expected := range c.filterAddresses() {
+		if address == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// addressesHex 将合约地址列表格式化为逗号分隔的字符串，用于日志
+func addressesHex(addresses []common.Address) string {
+	hexes := make([]string, len(addresses))
+	for i, address := range addresses {
+		hexes[i] = address.Hex()
+	}
+	return strings.Join(hexes, ", ")
+}
+
+// reqIDLayout 返回解析 reqID 使用的布局，未配置时使用 reqid.Meson
+func (c ChainConfig) reqIDLayout() reqid.Layout {
+	if c.ReqIDLayout != nil {
+		return *c.ReqIDLayout
+	}
+	return reqid.Meson
+}
+
+// tokens 返回需要监听的 token index 及其对应的代币小数位数
+// 兼容旧配置中单个的 mesonIndex/tokendecimal 字段
+func (c ChainConfig) tokens() map[uint8]uint8 {
+	indexes := c.MesonIndexes
+	if len(indexes) == 0 {
+		indexes = []uint8{c.MesonIndex}
+	}
+
+	tokens := make(map[uint8]uint8, len(indexes))
+	for _, index := range indexes {
+		decimal, ok := c.TokenDecimals[index]
+		if !ok {
+			decimal = c.TokenDecimal
+		}
+		tokens[index] = decimal
+	}
+	return tokens
+}
+
+// chainTokenDecimals 各链各 token index 的代币小数位数，用于在告警中按代币单位展示金额
+var chainTokenDecimals = map[string]map[uint8]uint8{}
+
+// loadTokenDecimals 从链配置中读取各链各 token index 的代币小数位数
+func loadTokenDecimals(chains map[string]ChainConfig) map[string]map[uint8]uint8 {
+	result := make(map[string]map[uint8]uint8, len(chains))
+	for chainName, chainConfig := range chains {
+		result[chainName] = chainConfig.tokens()
+	}
+	return result
+}
+
+// tokenDecimals 返回链上 token index 对应的代币小数位数，未配置时返回 0，即按最小单位展示
+func tokenDecimals(chainName string, tokenIndex int) uint8 {
+	return chainTokenDecimals[chainName][uint8(tokenIndex)]
+}
+
+
+// pollInterval 返回轮询模式下处理完一个区间后的等待时间
+func (c ChainConfig) pollInterval() time.Duration {
+	if c.PollIntervalSeconds == 0 {
+		return defaultPollInterval
+	}
+	return time.Duration(c.PollIntervalSeconds) * time.Second
+}
+
+// idleInterval 返回轮询模式下已追上确认高度时的等待时间
+func (c ChainConfig) idleInterval() time.Duration {
+	if c.IdleIntervalSeconds == 0 {
+		return defaultIdleInterval
+	}
+	return time.Duration(c.IdleIntervalSeconds) * time.Second
 }
 
 var (
 	telegramBot *bot.TelegramBot // 全局 TelegramBot 实例
 	larkBot     *bot.LarkBot     // 全局 LarkBot 实例
+	slackBot    *bot.SlackBot    // 全局 SlackBot 实例，未配置时为 nil
+	webhookBot  *bot.WebhookBot  // 全局 WebhookBot 实例，未配置时为 nil
+	pagerDutyBot *bot.PagerDutyBot // 全局 PagerDutyBot 实例，未配置时为 nil
+	progressBackend = progressBackendFile // 区块进度存储方式
+	lastBlockDir = defaultLastBlockDir    // 文件方式保存区块进度的目录
+	zeroAmountAction = zeroAmountSkip     // reqID 中金额为零的事件的处理方式
+	checkBatchSize = defaultCheckBatchSize // 定期检查时每批读取的未完成记录数量
 	contractABI = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"reqId","type":"bytes32"},{"indexed":true,"name":"recipient","type":"address"}],"name":"TokenMintExecuted","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"reqId","type":"bytes32"},{"indexed":true,"name":"proposer","type":"address"}],"name":"TokenBurnExecuted","type":"event"}]`
 )
 
 const (
-	lastBlockDir = "last_block"
-	blockStep    = 5000
+	modePoll      = "poll"
+	modeSubscribe = "subscribe"
+
+	rpcRetryMinBackoff = 30 * time.Second
+	rpcRetryMaxBackoff = 5 * time.Minute
+
+	defaultLastBlockDir = "last_block"
+	blockStep           = 5000
+
+	defaultConfirmations = 12
+
+	defaultPollInterval = 5 * time.Second
+	defaultIdleInterval = 600 * time.Second
+
+	defaultCheckBatchSize = 500
+
+	progressBackendFile = "file"
+	progressBackendDB   = "db"
+
+	startFromConfig = "config"
+	startFromLatest = "latest"
+
+	// reqID 中金额为零的事件的处理方式
+	zeroAmountSkip    = "skip"    // 跳过，记录一条警告日志
+	zeroAmountProcess = "process" // 按金额 0 正常记录
+	zeroAmountAlert   = "alert"   // 不记录，发送告警
 )
 
 // loadConfig 读取并解析配置文件
 // 该函数接受一个文件名字符串参数，并返回一个指向 Config 结构体的指针和一个错误值
+// 解析后的配置会再用环境变量覆盖，配置文件不存在时完全由环境变量提供，见 applyEnv
 func loadConfig(filename string) (*Config, error) {
+	var config Config // 创建一个 Config 结构体实例来存储解析结果
+
 	// 打开指定的配置文件
 	file, err := os.Open(filename)
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		// 如果打开文件失败，返回 nil 和错误信息
 		return nil, err
 	}
-	defer file.Close() // 确保在函数结束时关闭文件
+	if err == nil {
+		defer file.Close() // 确保在函数结束时关闭文件
 
-	var config Config // 创建一个 Config 结构体实例来存储解析结果
+		// 创建一个 JSON 解码器，读取文件内容
+		decoder := json.NewDecoder(file)
+		// 将文件内容解码到 Config 结构体实例中
+		err = decoder.Decode(&config)
+		if err != nil {
+			// 如果解码失败，返回 nil 和错误信息
+			return nil, err
+		}
+	} else {
+		logrus.Warnf("Config file %s not found, using environment variables only", filename)
+	}
 
-	// 创建一个 JSON 解码器，读取文件内容
-	decoder := json.NewDecoder(file)
-	// 将文件内容解码到 Config 结构体实例中
-	err = decoder.Decode(&config)
+	// 使用环境变量覆盖配置文件中的值
+	err = applyEnv(&config)
 	if err != nil {
-		// 如果解码失败，返回 nil 和错误信息
 		return nil, err
 	}
 
@@ -83,13 +378,42 @@ func loadConfig(filename string) (*Config, error) {
 
 // meson_event 验证 Meson 事件
 func meson_event(actionA, actionB string) bool {
-	return (actionA == "TokenBurnExecuted" && actionB == "TokenMintExecuted") ||
-		(actionA == "TokenMintExecuted" && actionB == "TokenBurnExecuted")
+	return (actionA == actionBurn && actionB == actionMint) ||
+		(actionA == actionMint && actionB == actionBurn)
+}
+
+// 格式化金额为千分位，nil 视为 0
+func formatWithCommas(number *big.Int) string {
+	if number == nil {
+		return "0"
+	}
+	if number.Sign() < 0 {
+		return "-" + addCommas(new(big.Int).Neg(number).String())
+	}
+	return addCommas(number.String())
 }
 
-// 格式化数字为千分位
-func formatWithCommas(number float64) string {
-	return addCommas(strconv.FormatInt(int64(number), 10))
+// formatTokenAmount 将最小单位的金额按代币小数位数格式化，整数部分加千分位，小数部分去掉末尾的 0
+// 如 1234560000 按 6 位小数格式化为 "1,234.56"，nil 视为 0
+func formatTokenAmount(amount *big.Int, decimals uint8) string {
+	if amount == nil || decimals == 0 {
+		return formatWithCommas(amount)
+	}
+
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(new(big.Int).Abs(amount), unit, new(big.Int))
+
+	result := sign + addCommas(whole.String())
+	if frac.Sign() == 0 {
+		return result
+	}
+	fracStr := frac.String()
+	fracStr = strings.Repeat("0", int(decimals)-len(fracStr)) + fracStr
+	return result + "." + strings.TrimRight(fracStr, "0")
 }
 
 // 添加逗号作为千分位分隔符
@@ -105,68 +429,149 @@ func addCommas(numStr string) string {
 	return numStr[:3] + "," + addCommas(numStr[3:])
 }
 
-// 构建消息的函数
-func constructMessage(timestamp int64, chainA, actionA string, amountA float64, txHashA string, chainB, actionB string, amountB float64, txHashB string) {
-	var fromChain, toChain, fromAction, toAction string
-	var fromAmount, toAmount float64
-	var fromTxHash, toTxHash string
+// constructMessage 构建并发送 Meson 两侧记录不一致的告警
+func constructMessage(meson database.Meson) {
+	sendAlert(FromMeson(meson))
+}
 
-	if actionA == "TokenBurnExecuted" {
-		fromChain, fromAction, fromAmount, fromTxHash = chainA, "Burn", amountA, txHashA
-		toChain, toAction, toAmount, toTxHash = chainB, "Mint", amountB, txHashB
-	} else {
-		fromChain, fromAction, fromAmount, fromTxHash = chainB, "Burn", amountB, txHashB
-		toChain, toAction, toAmount, toTxHash = chainA, "Mint", amountA, txHashA
+// constructTimeoutMessage 构建并发送跨链只有单边记录、另一边超时未出现的告警
+func constructTimeoutMessage(meson database.Meson) {
+	waiting := time.Since(time.Unix(meson.Timestamp, 0)).Truncate(time.Minute)
+	sendAlert(Alert{
+		Kind:      AlertTimeout,
+		ReqID:     meson.ReqID,
+		Timestamp: meson.Timestamp,
+		Legs: []AlertLeg{
+			{Label: "Recorded", Chain: meson.ChainA, Action: displayAction(meson.ActionA), Amount: meson.AmountA, Decimals: tokenDecimals(meson.ChainA, meson.TokenIndex), TxHash: meson.TxHashA, Address: meson.AddressA},
+		},
+		Note: fmt.Sprintf("Missing: counterpart leg after %s", waiting),
+	})
+}
+
+// duplicateLegAlert 构建相同 reqID 出现多余一边的告警
+// 包括同一条链上重复出现，以及两边都已记录后又在其他链上出现
+func duplicateLegAlert(meson database.Meson, chainName, eventName string, amount *big.Int, txHash, address string) Alert {
+	legs := []AlertLeg{
+		{Label: "Recorded", Chain: meson.ChainA, Action: displayAction(meson.ActionA), Amount: meson.AmountA, Decimals: tokenDecimals(meson.ChainA, meson.TokenIndex), TxHash: meson.TxHashA, Address: meson.AddressA},
+	}
+	if meson.ChainB != "" {
+		legs[0].Label = "Recorded A"
+		legs = append(legs, AlertLeg{Label: "Recorded B", Chain: meson.ChainB, Action: displayAction(meson.ActionB), Amount: meson.AmountB, Decimals: tokenDecimals(meson.ChainB, meson.TokenIndex), TxHash: meson.TxHashB, Address: meson.AddressB})
 	}
+	legs = append(legs, AlertLeg{Label: "Duplicate", Chain: chainName, Action: displayAction(eventName), Amount: amount, Decimals: tokenDecimals(chainName, meson.TokenIndex), TxHash: txHash, Address: address})
 
-	telegramMessage := fmt.Sprintf(
-		"<b>*****❗️❗️Bridge data anomaly❗️❗️*****</b>\n<b>Time:</b> %s\n\n<b>From:</b> %s <b>%s</b> [%s]\n<b>To:</b> %s <b>%s</b> [%s]\n\n<b>Tx hash (From):</b> %s\n<b>Tx hash (To):</b> %s\n",
-		time.Unix(timestamp, 0).UTC().Format(time.RFC3339),
-		fromChain, fromAction, formatWithCommas(fromAmount),
-		toChain, toAction, formatWithCommas(toAmount),
-		fromTxHash,
-		toTxHash,
-	)
+	return Alert{
+		Kind:      AlertDuplicateLeg,
+		ReqID:     meson.ReqID,
+		Timestamp: meson.Timestamp,
+		Legs:      legs,
+	}
+}
 
-	larkTitle := "*****❗️❗️Bridge data anomaly❗️❗️*****"
-	larkTime := time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
-	larkFrom := fmt.Sprintf("%s **%s** [%s]", fromChain, fromAction, formatWithCommas(fromAmount))
-	larkTo := fmt.Sprintf("%s **%s** [%s]", toChain, toAction, formatWithCommas(toAmount))
-	larkTxHashFrom := fromTxHash
-	larkTxHashTo := toTxHash
+// constructReorgMessage 构建并发送交易被回滚的告警
+func constructReorgMessage(meson database.Meson, chainName, txHash string) {
+	alert := FromMeson(meson)
+	alert.Kind = AlertReorg
+	alert.Note = reorgNote(meson, chainName, txHash)
+	sendAlert(alert)
+}
 
-	// 发送消息到 Telegram
-	telegramErr := telegramBot.SendMessage(telegramMessage, "HTML")
-	if telegramErr != nil {
-		logrus.Errorf("Failed to send Telegram message: %v", telegramErr)
-	}
+// sendAlert 发送告警到所有已配置的渠道，失败的渠道已各自保存等待重新发送
+// 告警队列已启动时只入队，不等待发送完成
+func sendAlert(alert Alert) {
+	sendAlertTo(alertNotifier(), alert)
+}
 
-	// 发送消息到 Lark
-	larkErr := larkBot.SendMessage(larkTitle, larkTime, larkFrom, larkTo, larkTxHashFrom, larkTxHashTo)
-	if larkErr != nil {
-		logrus.Errorf("Failed to send Lark message: %v", larkErr)
+// sendAlertTo 通过指定的 Notifier 发送告警，失败时只记录日志
+func sendAlertTo(notifier Notifier, alert Alert) {
+	err := notifier.Notify(alert)
+	if err != nil {
+		logrus.Errorf("Failed to deliver %s alert: %v", alert.Kind, err)
 	}
 }
 
+// storeError meson_handle 读写数据库失败，事件本身没有问题，数据库恢复后可以重新处理
+type storeError struct {
+	err error
+}
+
+func (e *storeError) Error() string {
+	return e.err.Error()
+}
 
+func (e *storeError) Unwrap() error {
+	return e.err
+}
 
-func meson_handle(reqID, chainName, eventName string, createdTime int64, amount float64, txHash string) error {
+// store 为读写 Meson 记录的存储，notifier 用于发送处理中发现的异常
+// address 为事件中的 proposer（burn）或 recipient（mint）地址
+// contract 为发出事件的合约地址，blockNumber 和 logIndex 为事件日志所在的区块号和日志序号，blockHash 为所在区块的哈希
+// 同一条日志重复处理时直接跳过，保证重叠区间或重启后重新处理不会重复记录和告警
+// 每条事件先记录到 meson_legs，再与已有的一边配对校验；同一条日志在 meson_legs 中已存在时不再处理
+func meson_handle(store Store, notifier Notifier, reqID, chainName, eventName string, tokenIndex uint8, createdTime int64, amount *big.Int, txHash, address, contract string, blockNumber uint64, logIndex uint, blockHash string) error {
+	inserted, err := store.InsertMesonLeg(database.MesonLeg{
+		ReqID:      reqID,
+		Chain:      chainName,
+		Action:     eventName,
+		Amount:     amount,
+		TokenIndex: int(tokenIndex),
+		TxHash:     txHash,
+		Block:      blockNumber,
+		LogIndex:   logIndex,
+		Address:    address,
+		Contract:   contract,
+		BlockHash:  blockHash,
+	})
+	if err != nil {
+		logrus.Errorf("Failed to record leg of ReqID %s: %v", reqID, err)
+		return &storeError{fmt.Errorf("failed to record leg: %v", err)}
+	}
+	if !inserted {
+		logrus.Infof("Event for ReqID %s in tx %s (block %d, log %d) already recorded, skipping", reqID, txHash, blockNumber, logIndex)
+		return nil
+	}
+	checkRecipient(notifier, reqID, chainName, eventName, tokenIndex, createdTime, amount, txHash, address)
+	return meson_handle_once(store, notifier, reqID, chainName, eventName, tokenIndex, createdTime, amount, txHash, address, blockNumber, logIndex, blockHash, false)
+}
+
+// meson_handle_once 执行一次 meson_handle，retried 表示是否为插入冲突后的重试
+func meson_handle_once(store Store, notifier Notifier, reqID, chainName, eventName string, tokenIndex uint8, createdTime int64, amount *big.Int, txHash, address string, blockNumber uint64, logIndex uint, blockHash string, retried bool) error {
 	// 查询数据库中是否已存在该 reqID 的文档
-	existingMeson, err := database.FindMesonByReqID(reqID)
+	// 记录不存在时返回 (nil, nil)，其他错误可能是暂时的，整个区间回滚后重新处理
+	existingMeson, err := store.FindMesonByReqID(reqID)
 	if err != nil{
 		// 如果查询过程中出现错误（且不是没有文档错误），记录错误并返回
 		logrus.Errorf("Failed to query Meson by ReqID: %v", err)
-		return fmt.Errorf("failed to query Meson by ReqID: %v", err)
+		return &storeError{fmt.Errorf("failed to query Meson by ReqID: %v", err)}
 	}
 
 	if existingMeson != nil {
+		// 同一条日志再次出现（如重启后或区间重叠时重新处理），已记录过，直接跳过
+		// 大多数情况在 meson_legs 中已经识别，这里处理从没有区块号的旧记录迁移过来的一边
+		if isRecordedLog(existingMeson, chainName, txHash, blockNumber, logIndex) {
+			logrus.Infof("Event for ReqID %s in tx %s (block %d, log %d) already recorded, skipping", reqID, txHash, blockNumber, logIndex)
+			return nil
+		}
+
+		// 同一条链上出现相同 reqID 的另一笔交易，不是跨链的另一边，告警且不覆盖已有记录
+		if existingMeson.ChainA == chainName {
+			sendAlertTo(notifier, duplicateLegAlert(*existingMeson, chainName, eventName, amount, txHash, address))
+
+			logrus.Errorf("Duplicate leg on same chain %s for ReqID: %s", chainName, reqID)
+			return fmt.Errorf("error: duplicate leg on same chain %s", chainName)
+		}
+
 		if existingMeson.ChainB != "" {
-			// 构建错误消息
-			constructMessage (
-				existingMeson.Timestamp,
-				existingMeson.ChainA, existingMeson.ActionA, existingMeson.AmountA, existingMeson.TxHashA,
-				existingMeson.ChainB, existingMeson.ActionB, existingMeson.AmountB, existingMeson.TxHashB,
-			)
+			if !routeWatched(*existingMeson) {
+				logrus.Infof("Extra leg on chain %s for ReqID %s on an unwatched route, skipping", chainName, reqID)
+				return nil
+			}
+			if crossingBelowMinAmount(*existingMeson) {
+				logrus.Infof("Extra leg on chain %s for ReqID %s below minAmount, skipping", chainName, reqID)
+				return nil
+			}
+			// 两边都已记录，又在其他链上出现
+			sendAlertTo(notifier, duplicateLegAlert(*existingMeson, chainName, eventName, amount, txHash, address))
 
 			// 发送错误消息
 			//sendNotification("Error", message)
@@ -179,23 +584,48 @@ func meson_handle(reqID, chainName, eventName string, createdTime int64, amount
 			existingMeson.AmountB = amount
 			existingMeson.ActionB = eventName
 			existingMeson.TxHashB = txHash
-			existingMeson.IsCheck = existingMeson.AmountA == existingMeson.AmountB
-			err := database.UpdateMeson(existingMeson)
+			existingMeson.AddressB = address
+			existingMeson.BlockB = blockNumber
+			existingMeson.LogIndexB = logIndex
+			existingMeson.BlockHashB = blockHash
+			indexB := int(tokenIndex)
+			existingMeson.TokenIndexB = &indexB
+			// 金额以最小单位的整数保存，差额在该链对的容差范围内视为一致；两侧 token index 不一致时不算完成
+			// 两边事件未最终确定时先不算完成，由 checkUncheckedMesons 在最终确定后重新判断
+			final := mesonFinal(*existingMeson)
+			existingMeson.IsCheck = final &&
+				toleranceFor(existingMeson.ChainA, existingMeson.ChainB).allows(existingMeson.AmountA, existingMeson.AmountB) &&
+				tokenIndexMatches(*existingMeson)
+			existingMeson.AmountDelta = signedDelta(existingMeson.AmountA, existingMeson.AmountB)
+			err := store.UpdateMeson(existingMeson)
 			if err != nil {
 				// 如果更新文档失败，记录错误并返回
 				logrus.Errorf("Failed to update Meson: %v", err)
-				return fmt.Errorf("failed to update Meson: %v", err)
+				return &storeError{fmt.Errorf("failed to update Meson: %v", err)}
 			}
 			logrus.Info("Updated Meson document with ChainB information.")
 
+			// 不在白名单中的方向只记录，不校验也不告警
+			if !routeWatched(*existingMeson) {
+				from, to := bridgeDirection(*existingMeson)
+				logrus.Infof("Route %s -> %s is not watched, skipping validation for ReqID: %s", from, to, reqID)
+				return nil
+			}
+			// 低于最小金额的跨链只记录，不校验也不告警
+			if crossingBelowMinAmount(*existingMeson) {
+				logrus.Infof("Amount below minAmount, skipping validation for ReqID: %s", reqID)
+				return nil
+			}
+			// 未最终确定的跨链保持未完成，不告警
+			if !final {
+				logrus.Infof("Legs of ReqID %s are not final yet, deferring validation", reqID)
+				return nil
+			}
+
 			// 验证动作，必须是一个 burn，另一个是 mint
 			if !meson_event(existingMeson.ActionA, existingMeson.ActionB) {
 				// 构建错误消息
-				constructMessage(
-					existingMeson.Timestamp,
-					existingMeson.ChainA, existingMeson.ActionA, existingMeson.AmountA, existingMeson.TxHashA,
-					existingMeson.ChainB, existingMeson.ActionB, existingMeson.AmountB, existingMeson.TxHashB,
-				)
+				sendAlertTo(notifier, FromMeson(*existingMeson))
 
 				// 发送错误消息
 				//sendNotification("Error", message)
@@ -204,13 +634,17 @@ func meson_handle(reqID, chainName, eventName string, createdTime int64, amount
 				return fmt.Errorf("error: meson event validation failed: actionA and actionB must be one TokenBurnExecuted and one TokenMintExecuted")
 			}
 
+			// 验证 token index，两侧必须是同一种代币，不一致说明 reqID 被篡改或解析有误
+			if !tokenIndexMatches(*existingMeson) {
+				sendAlertTo(notifier, FromMeson(*existingMeson))
+
+				logrus.Errorf("Token index mismatch for ReqID %s: %d on %s, %d on %s", reqID, existingMeson.TokenIndex, existingMeson.ChainA, tokenIndex, chainName)
+				return fmt.Errorf("error: token index mismatch: %d on %s, %d on %s", existingMeson.TokenIndex, existingMeson.ChainA, tokenIndex, chainName)
+			}
+
 			// 验证数额，必须两个数额是一样的
 			if !existingMeson.IsCheck {
-				constructMessage(
-					existingMeson.Timestamp,
-					existingMeson.ChainA, existingMeson.ActionA, existingMeson.AmountA, existingMeson.TxHashA,
-					existingMeson.ChainB, existingMeson.ActionB, existingMeson.AmountB, existingMeson.TxHashB,
-				)
+				sendAlertTo(notifier, FromMeson(*existingMeson))
 
 				// 发送错误消息
 				//sendNotification("Error", message)
@@ -219,28 +653,44 @@ func meson_handle(reqID, chainName, eventName string, createdTime int64, amount
 				return fmt.Errorf("error: Amounts do not match.")
 			}
 
+			notifySettled(notifier, *existingMeson, time.Now())
+
 			// 成功消息通过日志打印，不发送通知
 			logrus.Infof(
-				"Cross-chain success!\nReqID: %s\nChainA: %s\nChainB: %s\nTimestamp: %d\nAmountA: %f\nAmountB: %f\nActionA: %s\nActionB: %s\nTxHashA: %s\nTxHashB: %s\nIsCheck: %t\n",
+				"Cross-chain success!\nReqID: %s\nChainA: %s\nChainB: %s\nTimestamp: %d\nAmountA: %d\nAmountB: %d\nActionA: %s\nActionB: %s\nTxHashA: %s\nTxHashB: %s\nIsCheck: %t\n",
 				existingMeson.ReqID, existingMeson.ChainA, existingMeson.ChainB, existingMeson.Timestamp, existingMeson.AmountA, existingMeson.AmountB, existingMeson.ActionA, existingMeson.ActionB, existingMeson.TxHashA, existingMeson.TxHashB, existingMeson.IsCheck,
 			)
 		}
 	} else {
 		// 如果文档不存在，插入新文档
 		meson := database.Meson{
-			ReqID:     reqID,
-			ChainA:    chainName,
-			Timestamp: createdTime,
-			AmountA:   amount,
-			ActionA:   eventName,
-			TxHashA:   txHash,
-			IsCheck:   false,
-		}
-		err = database.InsertMeson(meson)
+			ReqID:      reqID,
+			TokenIndex: int(tokenIndex),
+			ChainA:     chainName,
+			Timestamp:  createdTime,
+			AmountA:    amount,
+			ActionA:    eventName,
+			TxHashA:    txHash,
+			AddressA:   address,
+			BlockA:     blockNumber,
+			LogIndexA:  logIndex,
+			BlockHashA: blockHash,
+			IsCheck:    false,
+		}
+		inserted, err := store.InsertMeson(meson)
 		if err != nil {
 			// 如果插入文档失败，记录错误并返回
 			logrus.Errorf("Failed to insert Meson: %v", err)
-			return fmt.Errorf("failed to insert Meson: %v", err)
+			return &storeError{fmt.Errorf("failed to insert Meson: %v", err)}
+		}
+		if !inserted {
+			// 查询之后另一条链的监听协程已插入了相同 reqID，按已存在的记录重新处理
+			// 重试后仍查不到说明读到的数据不一致，按数据库错误处理，稍后重新处理而不是丢弃事件
+			if retried {
+				logrus.Errorf("Insert of ReqID %s conflicts but the existing row cannot be found", reqID)
+				return &storeError{fmt.Errorf("failed to insert Meson: reqID %s conflicts but cannot be found", reqID)}
+			}
+			return meson_handle_once(store, notifier, reqID, chainName, eventName, tokenIndex, createdTime, amount, txHash, address, blockNumber, logIndex, blockHash, true)
 		}
 		logrus.Info("Inserted new Meson document with ID: ", reqID)
 	}
@@ -248,24 +698,44 @@ func meson_handle(reqID, chainName, eventName string, createdTime int64, amount
 	return nil
 }
 
-// processEvent 处理事件的公共逻辑
-// 该函数接受链名称、事件名称、请求 ID、地址、Meson 索引和代币小数位数作为参数
-func processEvent(chainName, eventName string, reqID common.Hash, address common.Address, txHash common.Hash, mesonIndex uint8, tokenDecimal uint8) {
-	// 处理 ReqID，将其转换为 *big.Int 类型
-	reqIdBigInt := new(big.Int).SetBytes(reqID.Bytes())
+// isRecordedLog 判断事件日志是否已记录为 Meson 的某一侧
+// 记录了区块号时按 (区块号, 日志序号) 判断，加列之前的旧记录按交易哈希判断
+func isRecordedLog(meson *database.Meson, chainName, txHash string, blockNumber uint64, logIndex uint) bool {
+	sameLog := func(chain, recordedTxHash string, recordedBlock uint64, recordedLogIndex uint) bool {
+		if chain != chainName {
+			return false
+		}
+		if recordedBlock == 0 {
+			return recordedTxHash == txHash
+		}
+		return recordedBlock == blockNumber && recordedLogIndex == logIndex
+	}
+	return sameLog(meson.ChainA, meson.TxHashA, meson.BlockA, meson.LogIndexA) ||
+		(meson.ChainB != "" && sameLog(meson.ChainB, meson.TxHashB, meson.BlockB, meson.LogIndexB))
+}
 
-	// 检查 tokenIndex 是否匹配已知的 token index
-	if isMyToken(reqIdBigInt, mesonIndex) {
+// processEvent 处理事件的公共逻辑
+// 该函数接受链名称、事件名称、请求 ID、地址、事件所在的日志、监听的 token index 到代币小数位数的映射，以及该链的 reqID 布局作为参数
+// 产生的告警通过 notifier 发送；读写数据库失败时返回 *storeError，事务已不可用，调用方需回滚并重新处理整个区间
+func processEvent(tx database.Tx, notifier Notifier, chainName, eventName string, reqID common.Hash, address common.Address, vLog types.Log, tokens map[uint8]uint8, layout reqid.Layout) error {
+	txHash := vLog.TxHash
+	// 检查 tokenIndex 是否匹配已知的 token index，并取得对应的小数位数
+	mesonIndex := layout.DecodeTokenIndex(reqID)
+	if tokenDecimal, ok := tokens[mesonIndex]; ok {
 		// 获取 amount，从 ReqID 中提取金额
-		amount, err := getAmountFromReqID(reqIdBigInt, tokenDecimal)
-		if err != nil {
+		amount, err := layout.DecodeAmount(reqID, tokenDecimal)
+		if errors.Is(err, reqid.ErrZeroAmount) {
+			if !handleZeroAmount(notifier, chainName, eventName, reqID, address, vLog, layout) {
+				return nil
+			}
+		} else if err != nil {
 			// 如果提取金额失败，输出错误信息并返回
 			logrus.Errorf("Failed to get amount from ReqID: %v", err)
-			return
+			return nil
 		}
 
 		// 获取 createdTime，从 ReqID 中提取创建时间
-		createdTime := getCreatedTimeFromReqID(reqIdBigInt)
+		createdTime := layout.DecodeCreatedTime(reqID)
 		// 格式化创建时间为 RFC3339 格式
 		createdTimeFormatted := time.Unix(int64(createdTime), 0).UTC().Format(time.RFC3339)
 
@@ -277,32 +747,143 @@ func processEvent(chainName, eventName string, reqID common.Hash, address common
 		logrus.Infof("Amount: %d", amount)
 		logrus.Infof("Token Index matches the known token index %d", mesonIndex)
 		logrus.Infof("Transaction Hash: %s", txHash.Hex())
+		logrus.Infof("Address: %s", address.Hex())
+		logrus.Infof("Contract: %s", vLog.Address.Hex())
+		logrus.Infof("Block: %d, Log Index: %d", vLog.BlockNumber, vLog.Index)
+
+		// 写入审计日志，与 meson 表的处理结果无关
+		recordAuditEvent(auditEvent{
+			Chain:       chainName,
+			ReqID:       reqID.Hex(),
+			Event:       eventName,
+			TokenIndex:  mesonIndex,
+			Amount:      amount.String(),
+			TxHash:      txHash.Hex(),
+			Address:     address.Hex(),
+			Contract:    vLog.Address.Hex(),
+			Block:       vLog.BlockNumber,
+			LogIndex:    vLog.Index,
+			CreatedTime: int64(createdTime),
+			ProcessedAt: time.Now().UTC().Format(time.RFC3339),
+		})
+
+		if minAmountAction == minAmountSkip && belowMinAmount(chainName, int(mesonIndex), amount) {
+			logrus.Infof("Amount of ReqID %s on chain %s is below minAmount, skipping", reqID.Hex(), chainName)
+			return nil
+		}
 
 		// 保存或更新 Meson 文档
-		err = meson_handle(reqID.Hex(), chainName, eventName, int64(createdTime), float64(amount), txHash.Hex())
+		err = meson_handle(tx, notifier, reqID.Hex(), chainName, eventName, mesonIndex, int64(createdTime), amount, txHash.Hex(), address.Hex(), vLog.Address.Hex(), vLog.BlockNumber, vLog.Index, vLog.BlockHash.Hex())
 		if err != nil {
 			logrus.Errorf("Database operation failed: %v", err)
 		}
+		// 读写数据库失败时停止处理该区间，区间回滚后重新处理，区块进度不会推进
+		var storeErr *storeError
+		if errors.As(err, &storeErr) {
+			return err
+		}
 	}
+	return nil
 }
 
-// listenEvents 启动一个无限循环监听指定链上的事件
-// 该函数接受一个 WaitGroup 指针、链名称、RPC URL、合约地址、Meson 索引和代币小数位数作为参数
-func listenEvents(wg *sync.WaitGroup, chainName, rpcUrl, tokenContract string, mesonIndex uint8, tokenDecimal uint8, startBlock uint64) {
+// handleZeroAmount 按 zeroAmountAction 处理 reqID 中金额为零的事件，返回 true 表示继续按金额 0 记录
+func handleZeroAmount(notifier Notifier, chainName, eventName string, reqID common.Hash, address common.Address, vLog types.Log, layout reqid.Layout) bool {
+	switch zeroAmountAction {
+	case zeroAmountProcess:
+		logrus.Infof("Processing zero-amount event %s for ReqID %s on chain %s", eventName, reqID.Hex(), chainName)
+		return true
+	case zeroAmountAlert:
+		logrus.Warnf("Zero-amount event %s for ReqID %s on chain %s (tx %s), sending alert", eventName, reqID.Hex(), chainName, vLog.TxHash.Hex())
+		sendAlertTo(notifier, Alert{
+			Kind:      AlertZeroAmount,
+			ReqID:     reqID.Hex(),
+			Timestamp: int64(layout.DecodeCreatedTime(reqID)),
+			Legs: []AlertLeg{
+				{Label: "Event", Chain: chainName, Action: displayAction(eventName), Amount: new(big.Int), TxHash: vLog.TxHash.Hex(), Address: address.Hex()},
+			},
+			Note: "The amount encoded in the reqID is zero; the event was not recorded",
+		})
+		return false
+	default:
+		logrus.Warnf("Skipping zero-amount event %s for ReqID %s on chain %s (tx %s)", eventName, reqID.Hex(), chainName, vLog.TxHash.Hex())
+		return false
+	}
+}
+
+// listenEvents 循环监听指定链上的事件，直到 parent 被取消
+// 该函数接受一个上下文、WaitGroup 指针、链名称、链配置、启动限制、连接成功的期限和随机延迟上限作为参数
+// 首次连接前先等待 [0, jitter) 的随机时间，再从 gate 获取名额，首次连接尝试结束后释放；超过 grace 仍未连接成功时告警，但继续重试
+func listenEvents(parent context.Context, wg *sync.WaitGroup, db database.Store, chainName string, chainConfig ChainConfig, gate *startupGate, grace, jitter time.Duration) {
 	defer wg.Done() // 在函数结束时调用 Done 方法以通知 WaitGroup 当前协程已完成
 
-	for {
-		// 创建一个带取消功能的上下文
-		ctx, cancel := context.WithCancel(context.Background())
+	// 等待启动名额之前就注册，等待中的链也可以暂停，并在就绪检查中显示为未启动
+	control := registerChainControl(chainName)
+	watch := &startupWatch{chainName: chainName}
+	// 随机错开各链首次查询的时间，同时也错开了之后轮询的相位
+	if delay := randomJitter(jitter); delay > 0 {
+		logrus.Infof("Delaying start of chain %s by %s", chainName, delay)
+		sleepContext(parent, delay)
+	}
+	release := gate.acquire(parent)
+	startupTimer := time.AfterFunc(grace, func() { watch.check(grace) })
+	defer startupTimer.Stop()
+
+	deps := defaultListenDeps(db)
+	deps.jitter = jitter
+	deps.started = func() {
+		watch.markConnected()
+		release()
+	}
+
+	endpoints := newRPCEndpoints(chainName, chainConfig.rpcURLs())
+	backoff := rpcRetryMinBackoff
+	for parent.Err() == nil {
+		// 暂停期间不连接节点，恢复后从保存的区块进度继续
+		control.waitIfPaused(parent)
+		if parent.Err() != nil {
+			break
+		}
+
+		// 创建一个带取消功能的上下文，暂停或 parent 取消时停止当前一次监听
+		ctx, cancel := context.WithCancel(parent)
+		control.attach(cancel)
 
 		// 连接到以太坊客户端并监听事件
-		err := connectAndListen(ctx, chainName, rpcUrl, tokenContract, mesonIndex, tokenDecimal, startBlock)
+		err := connectAndListen(ctx, chainName, chainConfig, endpoints, deps)
+		release()
+		if parent.Err() != nil {
+			logrus.Infof("Listener for chain %s stopped: %v", chainName, err)
+			cancel()
+			break
+		}
+		if isChainPaused(chainName) {
+			logrus.Infof("Listener for chain %s stopped while paused: %v", chainName, err)
+			cancel()
+			continue
+		}
 		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"ChainName": chainName,
-				"Error":     err,
-			}).Error("Error in connectAndListen. Retrying in 30 seconds...\n")
-			time.Sleep(30 * time.Second)
+			watch.markFailed(err)
+			if endpoints.exhausted() {
+				// 所有节点都不可用，退避后重新尝试整个节点列表
+				logrus.WithFields(logrus.Fields{
+					"ChainName": chainName,
+					"Error":     err,
+				}).Errorf("All RPC endpoints failed. Retrying in %s...\n", backoff)
+				sleepContext(parent, backoff)
+				endpoints.reset()
+				backoff *= 2
+				if backoff > rpcRetryMaxBackoff {
+					backoff = rpcRetryMaxBackoff
+				}
+			} else {
+				logrus.WithFields(logrus.Fields{
+					"ChainName": chainName,
+					"Error":     err,
+				}).Error("Error in connectAndListen. Retrying with next RPC endpoint...\n")
+				sleepContext(parent, time.Second)
+			}
+		} else {
+			backoff = rpcRetryMinBackoff
 		}
 
 		// 确保在每次重试之前取消先前的上下文
@@ -310,9 +891,9 @@ func listenEvents(wg *sync.WaitGroup, chainName, rpcUrl, tokenContract string, m
 	}
 }
 
-// getLatestBlockNumber 获取当前链的最新区块号
-func getLatestBlockNumber(client *ethclient.Client) (uint64, error) {
-	header, err := client.HeaderByNumber(context.Background(), nil)
+// getLatestBlockNumber 获取当前链的最新区块号，ctx 取消时立即返回
+func getLatestBlockNumber(ctx context.Context, client *rpcClient) (uint64, error) {
+	header, err := client.HeaderByNumber(ctx, nil)
 	if err != nil {
 		logrus.Errorf("Failed to get latest block header: %v", err)
 		return 0, err
@@ -322,31 +903,76 @@ func getLatestBlockNumber(client *ethclient.Client) (uint64, error) {
 }
 
 
-func getLastBlockNumber(chainName string, client *ethclient.Client, contractAddress common.Address, startBlock uint64) (uint64, error) {
-	filename := filepath.Join("last_block", chainName+".txt")
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
+// getLastBlockNumber 获取指定链上次处理到的区块号
+// 根据 progressBackend 从文件或数据库中读取，不存在记录时由 initialBlockNumber 决定起始区块
+func getLastBlockNumber(ctx context.Context, db database.Store, chainName string, client *rpcClient, chainConfig ChainConfig) (uint64, error) {
+	var blockNumber uint64
+	var ok bool
+	var err error
+	if progressBackend == progressBackendDB {
+		blockNumber, ok, err = getLastBlockNumberFromDB(db, chainName)
+	} else {
+		blockNumber, ok, err = getLastBlockNumberFromFile(chainName)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return initialBlockNumber(ctx, chainName, client, chainConfig)
+	}
+	logrus.Infof("Last block number for chain %s: %d", chainName, blockNumber)
+	return blockNumber, nil
+}
+
+// initialBlockNumber 首次监听时的起始区块
+// startFrom 为 "latest" 时从当前已确认高度开始，跳过历史区块；否则使用配置中的 startBlock
+func initialBlockNumber(ctx context.Context, chainName string, client *rpcClient, chainConfig ChainConfig) (uint64, error) {
+	if chainConfig.StartFrom != startFromLatest {
 		logrus.Infof("Using startBlock from config for chain: %s", chainName)
-		return startBlock, nil // 从配置文件中的起始区块号开始
+		return chainConfig.StartBlock, nil // 从配置文件中的起始区块号开始
+	}
+
+	latestBlock, err := getLatestBlockNumber(ctx, client)
+	if err != nil {
+		return 0, err
+	}
+	blockNumber := chainConfig.confirmedHeight(latestBlock)
+	logrus.Infof("Starting chain %s from the latest confirmed block %d, skipping historical blocks", chainName, blockNumber)
+	return blockNumber, nil
+}
+
+// getLastBlockNumberFromDB 从数据库读取区块进度，第二个返回值表示是否存在记录
+func getLastBlockNumberFromDB(db database.Store, chainName string) (uint64, bool, error) {
+	blockNumber, ok, err := db.GetChainProgress(chainName)
+	if err != nil {
+		logrus.Errorf("Failed to read chain progress from database: %v", err)
+		return 0, false, err
+	}
+	return blockNumber, ok, nil
+}
+
+// getLastBlockNumberFromFile 从文件读取区块进度，第二个返回值表示是否存在记录
+func getLastBlockNumberFromFile(chainName string) (uint64, bool, error) {
+	filename := filepath.Join(lastBlockDir, chainName+".txt")
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return 0, false, nil
 	}
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		logrus.Errorf("Failed to read last block file: %v", err)
-		return 0, err
+		return 0, false, err
 	}
 	var blockNumber uint64
 	err = json.Unmarshal(data, &blockNumber)
 	if err != nil {
 		logrus.Errorf("Failed to unmarshal last block number: %v", err)
-		return 0, err
+		return 0, false, err
 	}
-	logrus.Infof("Last block number for chain %s: %d", chainName, blockNumber)
-	return blockNumber, nil
+	return blockNumber, true, nil
 }
 
-
-
-func saveLastBlockNumber(chainName string, blockNumber uint64) error {
-	filename := filepath.Join("last_block", chainName+".txt")
+func saveLastBlockNumberToFile(chainName string, blockNumber uint64) error {
+	filename := filepath.Join(lastBlockDir, chainName+".txt")
 	data, err := json.Marshal(blockNumber)
 	if err != nil {
 		logrus.Errorf("Failed to marshal block number: %v", err)
@@ -355,188 +981,463 @@ func saveLastBlockNumber(chainName string, blockNumber uint64) error {
 	err = ioutil.WriteFile(filename, data, 0644)
 	if err != nil {
 		logrus.Errorf("Failed to write last block number to file: %v", err)
+		return err
 	}
 	logrus.Infof("Saved last block number %d for chain %s to file: %s", blockNumber, chainName, filename)
-	return err
+	return nil
+}
+
+
+// listenDeps connectAndListen 使用的外部依赖
+// 替换 dial 和 notifier 后可以连接模拟的 JSON-RPC 服务并收集产生的告警；
+// Meson 记录和数据库中的区块进度写入 store，可以使用 SQLite 内存数据库代替 PostgreSQL
+type listenDeps struct {
+	dial     func(chainName, rpcUrl string) (*rpcClient, error)
+	notifier Notifier
+	store    database.Store
+	started  func()        // 节点第一次成功响应后调用（之后可能重复调用），可以为 nil
+	jitter   time.Duration // 轮询模式每次等待时附加的随机延迟上限，为 0 时不加
 }
 
+// defaultListenDeps 连接真实的 RPC 节点，告警通过告警队列发送，记录写入 db
+func defaultListenDeps(db database.Store) listenDeps {
+	return listenDeps{dial: dialRPC, notifier: alertNotifier(), store: db}
+}
 
 // connectAndListen 连接到以太坊客户端并监听指定合约的事件
-// 该函数接受上下文、链名称、RPC URL、合约地址、Meson 索引和代币小数位数作为参数
-// 返回一个错误值
-func connectAndListen(ctx context.Context, chainName, rpcUrl, tokenContract string, mesonIndex uint8, tokenDecimal uint8, startBlockConfig uint64) error {
+// 该函数接受上下文、链名称、链配置和外部依赖作为参数
+// 返回一个错误值，ctx 被取消时停止监听并返回 ctx.Err()
+// 当前 RPC 节点连接失败或连续查询出错时切换 endpoints 中的下一个节点并返回错误
+func connectAndListen(ctx context.Context, chainName string, chainConfig ChainConfig, endpoints *rpcEndpoints, deps listenDeps) error {
+	rpcUrl := endpoints.url()
 	logrus.Infof("Connecting to RPC URL: %s", rpcUrl)
-	client, err := ethclient.Dial(rpcUrl)
+	client, err := deps.dial(chainName, rpcUrl)
 	if err != nil {
+		endpoints.markFailed()
 		logrus.Errorf("Failed to connect to the Ethereum client: %v", err)
 		return fmt.Errorf("Failed to connect to the Ethereum client: %v", err)
 	}
 	defer client.Close()
+	if chainConfig.BatchRequests {
+		client.batcher = sharedLogBatcher(rpcUrl)
+	}
 
-	parsedABI, err := abi.JSON(strings.NewReader(contractABI))
+	parsedABI, err := chainConfig.loadABI()
 	if err != nil {
-		logrus.Errorf("Failed to parse contract ABI: %v", err)
-		return fmt.Errorf("Failed to parse contract ABI: %v", err)
+		logrus.Errorf("Failed to load contract ABI: %v", err)
+		return err
 	}
 
-	contractAddress := common.HexToAddress(tokenContract)
-	startBlock, err := getLastBlockNumber(chainName, client, contractAddress, startBlockConfig)
+	notifier, db := deps.notifier, deps.store
+	contractAddresses := chainConfig.filterAddresses()
+	logrus.Infof("Filtering logs of chain %s by contract(s) %s", chainName, addressesHex(contractAddresses))
+	startBlock, err := getLastBlockNumber(ctx, db, chainName, client, chainConfig)
 	if err != nil {
 		logrus.Errorf("Failed to get last block number: %v", err)
 		return fmt.Errorf("Failed to get last block number: %v", err)
 	}
+	markChainStarted(chainName, startBlock)
 
+	mode, err := listenMode(chainConfig)
+	if err != nil {
+		return err
+	}
+	if mode == modeSubscribe {
+		// WebSocket 连接在 dial 时已经建立
+		if deps.started != nil {
+			deps.started()
+		}
+		err = subscribeAndListen(ctx, client, db, notifier, chainName, chainConfig, parsedABI, contractAddresses, startBlock, newBlockStepper(chainName, chainConfig))
+		if err != nil {
+			endpoints.markFailed()
+		}
+		return err
+	}
+
+	stepper := newBlockStepper(chainName, chainConfig)
+	catchUp := newCatchUpMode(chainName, chainConfig, stepper)
+	head := newHeadCache(chainConfig)
+	pollInterval, idleInterval := chainConfig.pollInterval(), chainConfig.idleInterval()
+	logrus.Infof("Polling chain %s every %s between ranges and every %s once caught up", chainName, pollInterval, idleInterval)
+	var lastReorgCheck time.Time
+	rpcErrors := 0
 	for {
-		latestBlock, err := getLatestBlockNumber(client)
-		logrus.Infof("Chain name: %s, Latest block: %d", chainName, latestBlock)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if rpcErrors >= maxConsecutiveRPCErrors {
+			endpoints.markFailed()
+			return fmt.Errorf("RPC endpoint %s failed %d times in a row", rpcUrl, rpcErrors)
+		}
+
+		latestBlock, cached, err := head.latest(ctx, client)
 		if err != nil {
 			logrus.Errorf("Failed to get latest block number: %v", err)
-			time.Sleep(5 * time.Second)
+			rpcErrors++
+			sleepContext(ctx, 5*time.Second)
 			continue
 		}
-
-		// 确保最新区块号大于上次检查的区块号100以上
-		if latestBlock <= startBlock+100 {
-			logrus.Infof("Latest block (%d) is not greater than start block (%d) by at least 100. Waiting...", latestBlock, startBlock)
-			time.Sleep(600 * time.Second)
-			continue
+		if cached {
+			logrus.Infof("Chain name: %s, Latest block: %d (cached)", chainName, latestBlock)
+		} else {
+			logrus.Infof("Chain name: %s, Latest block: %d", chainName, latestBlock)
+			endpoints.markHealthy()
+			if deps.started != nil {
+				deps.started()
+			}
 		}
 
-		endBlock := startBlock + blockStep
-		if endBlock > latestBlock {
-			endBlock = latestBlock
+		if !cached {
+			updateFinalizedHeight(ctx, client, chainName, chainConfig, latestBlock)
+		}
+		if time.Since(lastReorgCheck) >= reorgCheckInterval {
+			verifyRecordedTxs(ctx, client, db, chainName)
+			lastReorgCheck = time.Now()
 		}
 
-		query := ethereum.FilterQuery{
-			FromBlock: big.NewInt(int64(startBlock)),
-			ToBlock:   big.NewInt(int64(endBlock)),
-			Addresses: []common.Address{contractAddress},
+		// 只处理已获得足够确认的区块，游标不能超过确认高度；mint 和 burn 的确认数不同时按较少的查询，确认数不够的事件留到之后处理
+		confirmedBlock := chainConfig.scanHeight(latestBlock)
+		if confirmedBlock > startBlock {
+			catchUp.update(confirmedBlock-startBlock, stepper)
 		}
 
-		logs, err := client.FilterLogs(ctx, query)
-		if err != nil {
-			logrus.Errorf("Failed to filter logs: %v", err)
-			time.Sleep(5 * time.Second)
+		// 确保确认高度大于上次检查的区块号100以上
+		if confirmedBlock <= startBlock+100 {
+			if cached {
+				// 缓存的高度可能已经落后，重新查询后再决定是否等待
+				head.invalidate()
+				continue
+			}
+			logrus.Infof("Confirmed block (%d) is not greater than start block (%d) by at least 100. Waiting...", confirmedBlock, startBlock)
+			sleepContext(ctx, idleInterval+randomJitter(deps.jitter))
 			continue
 		}
 
-		for _, vLog := range logs {
-			logrus.Infof("Transaction Hash: %s", vLog.TxHash.Hex())
+		endBlock := startBlock + stepper.step()
+		if endBlock > confirmedBlock {
+			endBlock = confirmedBlock
+		}
 
-			switch vLog.Topics[0].Hex() {
-			case parsedABI.Events["TokenMintExecuted"].ID.Hex():
-				event := struct {
-					ReqID     common.Hash
-					Recipient common.Address
-				}{
-					ReqID:     vLog.Topics[1],
-					Recipient: common.HexToAddress(vLog.Topics[2].Hex()),
-				}
-				processEvent(chainName, "TokenMintExecuted", event.ReqID, event.Recipient, vLog.TxHash, mesonIndex, tokenDecimal)
-
-			case parsedABI.Events["TokenBurnExecuted"].ID.Hex():
-				event := struct {
-					ReqID    common.Hash
-					Proposer common.Address
-				}{
-					ReqID:    vLog.Topics[1],
-					Proposer: common.HexToAddress(vLog.Topics[2].Hex()),
-				}
-				processEvent(chainName, "TokenBurnExecuted", event.ReqID, event.Proposer, vLog.TxHash, mesonIndex, tokenDecimal)
+		nextBlock, err := filterAndProcessLogs(ctx, client, db, notifier, chainName, chainConfig, parsedABI, contractAddresses, startBlock, endBlock, latestBlock)
+		if err != nil {
+			// 区间过大导致的错误只缩小跨度，不算节点故障
+			if isRPCError(err) && !isRangeTooLargeError(err) {
+				rpcErrors++
 			}
+			stepper.onError(err)
+			sleepContext(ctx, 5*time.Second)
+			continue
+		}
+		rpcErrors = 0
+		stepper.onSuccess()
+
+		startBlock = nextBlock
+		// 已追到缓存高度的一个跨度以内，下次查询最新的区块号
+		if startBlock+stepper.step() >= confirmedBlock {
+			head.invalidate()
+		}
+		// 追赶模式下不等待，直接查询下一个区间
+		if !catchUp.active {
+			sleepContext(ctx, pollInterval+randomJitter(deps.jitter)) // 延迟一段时间后继续查询，加上随机延迟避免各链重新对齐
 		}
+	}
+}
+
+// filterAndProcessLogs 查询 [fromBlock, toBlock] 区间内合约的日志并逐条处理，latestBlock 为链上的最新区块号
+// 处理结果与区块进度在同一事务中提交，返回下一个待处理区块：一般为 toBlock+1，
+// 区间内有按事件类型尚未获得足够确认的日志时为其所在区块，该区块及之后的日志下次重新查询
+func filterAndProcessLogs(ctx context.Context, client *rpcClient, db database.Store, notifier Notifier, chainName string, chainConfig ChainConfig, parsedABI abi.ABI, contractAddresses []common.Address, fromBlock, toBlock, latestBlock uint64) (uint64, error) {
+	logs, err := filterLogs(ctx, client, contractAddresses, fromBlock, toBlock)
+	if err != nil {
+		return fromBlock, err
+	}
+
+	logs, nextBlock := holdUnconfirmedLogs(chainName, chainConfig, parsedABI, logs, latestBlock, toBlock+1)
+	err = processLogs(db, notifier, chainName, chainConfig, parsedABI, logs, fromBlock, nextBlock)
+	if err != nil {
+		return fromBlock, err
+	}
+	return nextBlock, nil
+}
+
+// processRange 查询 [fromBlock, toBlock] 区间内合约的日志，在一个事务中解析并处理，不改动区块进度（用于回放历史区间）
+// 返回处理的日志数量
+func processRange(ctx context.Context, client *rpcClient, db database.Store, notifier Notifier, chainName string, chainConfig ChainConfig, parsedABI abi.ABI, contractAddresses []common.Address, fromBlock, toBlock uint64) (int, error) {
+	logs, err := filterLogs(ctx, client, contractAddresses, fromBlock, toBlock)
+	if err != nil {
+		return 0, err
+	}
+	return len(logs), processLogsWithoutCursor(db, notifier, chainName, chainConfig, parsedABI, logs)
+}
+
+// filterLogs 查询 [fromBlock, toBlock] 区间内合约的日志，失败时返回 rpcError
+func filterLogs(ctx context.Context, client *rpcClient, contractAddresses []common.Address, fromBlock, toBlock uint64) ([]types.Log, error) {
+	query := ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(fromBlock),
+		ToBlock:   new(big.Int).SetUint64(toBlock),
+		Addresses: contractAddresses,
+	}
+
+	logs, err := client.FilterLogs(ctx, query)
+	if err != nil {
+		logrus.Errorf("Failed to filter logs: %v", err)
+		return nil, &rpcError{err: err}
+	}
+	return logs, nil
+}
+
+// processLogsWithoutCursor 在一个数据库事务中处理一批日志，不改动区块进度
+// 产生的告警在事务提交成功后才发送
+func processLogsWithoutCursor(db database.Store, notifier Notifier, chainName string, chainConfig ChainConfig, parsedABI abi.ABI, logs []types.Log) error {
+	tx, err := db.BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pending := newAlertBuffer(notifier)
+	err = handleLogs(tx, pending, chainName, chainConfig, parsedABI, logs)
+	if err != nil {
+		logrus.Errorf("Failed to process block range for chain %s, rolling back: %v", chainName, err)
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logrus.Errorf("Failed to commit block range for chain %s: %v", chainName, err)
+		return err
+	}
+	pending.flush()
+	return nil
+}
+
+// processLogs 在一个数据库事务中处理一批日志，并将区块进度从 prevBlock 推进到 nextBlock
+// 只有进度保存成功后才提交事务，任一写入失败时整批回滚并返回错误，调用方会重新处理该区间
+// 产生的告警在事务提交成功后才发送，回滚的区间不会发出告警，重新处理时再产生
+func processLogs(db database.Store, notifier Notifier, chainName string, chainConfig ChainConfig, parsedABI abi.ABI, logs []types.Log, prevBlock, nextBlock uint64) error {
+	tx, err := db.BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pending := newAlertBuffer(notifier)
+	err = handleLogs(tx, pending, chainName, chainConfig, parsedABI, logs)
+	if err != nil {
+		logrus.Errorf("Failed to process block range for chain %s, rolling back: %v", chainName, err)
+		return err
+	}
 
-		startBlock = endBlock + 1
-		err = saveLastBlockNumber(chainName, startBlock)
+	if progressBackend == progressBackendDB {
+		err = tx.SaveChainProgress(chainName, nextBlock)
 		if err != nil {
 			logrus.Errorf("Failed to save last block number: %v", err)
+			reportProgressSaveFailure(chainName, nextBlock, err)
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			logrus.Errorf("Failed to commit block range for chain %s: %v", chainName, err)
+			return err
+		}
+		logrus.Infof("Saved last block number %d for chain %s to database", nextBlock, chainName)
+		markChainProgress(chainName, nextBlock)
+		pending.flush()
+		return nil
+	}
+
+	// 文件无法参与数据库事务：先写文件，提交失败时恢复为原来的进度
+	err = saveLastBlockNumberToFile(chainName, nextBlock)
+	if err != nil {
+		reportProgressSaveFailure(chainName, nextBlock, err)
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		logrus.Errorf("Failed to commit block range for chain %s: %v", chainName, err)
+		saveLastBlockNumberToFile(chainName, prevBlock)
+		return err
+	}
+	markChainProgress(chainName, nextBlock)
+	pending.flush()
+	return nil
+}
+
+// handleLogs 按顺序处理一批日志
+// 同一区间的日志共用一个数据库事务，事务上的读写只能串行执行，因此不做并发处理
+// 某条日志读写数据库失败时事务已不可用，停止处理并返回错误，由调用方回滚整个区间
+func handleLogs(tx database.Tx, notifier Notifier, chainName string, chainConfig ChainConfig, parsedABI abi.ABI, logs []types.Log) error {
+	for _, vLog := range logs {
+		err := handleLog(tx, notifier, chainName, chainConfig, parsedABI, vLog)
+		if err != nil {
+			return err
 		}
-		time.Sleep(5 * time.Second) // 延迟一段时间后继续查询
 	}
+	return nil
+}
+
+// handleLog 根据事件签名解析日志并分发到 processEvent，返回 processEvent 的数据库错误
+func handleLog(tx database.Tx, notifier Notifier, chainName string, chainConfig ChainConfig, parsedABI abi.ABI, vLog types.Log) error {
+	logrus.Infof("Transaction Hash: %s", vLog.TxHash.Hex())
+
+	// 查询时已按地址过滤，这里再检查一次，避免节点返回其他合约的同名事件被当作跨链记录
+	if !chainConfig.watchesAddress(vLog.Address) {
+		logrus.WithFields(logrus.Fields{
+			"ChainName": chainName,
+			"TxHash":    vLog.TxHash.Hex(),
+			"LogIndex":  vLog.Index,
+			"Address":   vLog.Address.Hex(),
+			"Expected":  addressesHex(chainConfig.filterAddresses()),
+		}).Warn("Skipping log emitted by an unexpected contract")
+		return nil
+	}
+
+	// 按 ABI 中存在的事件分发，不在 ABI 中或无法解析出 reqId 的日志直接跳过
+	// 避免非标准或被截断的日志越界导致监听协程崩溃
+	event, ok := parseMesonEvent(chainConfig, parsedABI, vLog)
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"ChainName": chainName,
+			"TxHash":    vLog.TxHash.Hex(),
+			"LogIndex":  vLog.Index,
+			"Topics":    len(vLog.Topics),
+		}).Debug("Skipping log that is not a known Meson event")
+		return nil
+	}
+
+	return processEvent(tx, notifier, chainName, event.Action, event.ReqID, event.Address, vLog, chainConfig.tokens(), chainConfig.reqIDLayout())
 }
 
 
 
 // checkDatabase 定期检查数据库中 is_check 为 false 的 Meson 文档
-// 该函数接受一个 WaitGroup 指针和一个检查间隔时间（毫秒）作为参数
-func checkDatabase(wg *sync.WaitGroup, checkTime int) {
+// 启动后立即检查一次，之后每隔 checkInterval 检查一次，done 被关闭时退出
+// 该函数接受一个 WaitGroup 指针、退出信号、检查的数据库、检查间隔和单边等待超时时间作为参数
+func checkDatabase(wg *sync.WaitGroup, done <-chan struct{}, db database.Store, checkInterval time.Duration, pendingTimeout time.Duration) {
 	defer wg.Done() // 在函数结束时，调用 Done 方法以通知 WaitGroup 当前协程已完成
 
-	// 创建一个新的 Ticker，每隔 checkTime 毫秒触发一次
-	ticker := time.NewTicker(time.Duration(checkTime) * time.Millisecond)
+	// 创建一个新的 Ticker，每隔 checkInterval 触发一次
+	ticker := time.NewTicker(checkInterval)
 	defer ticker.Stop() // 确保在函数结束时停止 Ticker
 
-	for range ticker.C {
+	for {
+		runDatabaseCheck(db, pendingTimeout)
+
+		select {
+		case <-done:
+			logrus.Info("Stopping database check")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDatabaseCheck 执行一次检查：重新发送失败的告警，对两边不一致的 Meson 告警，更新单边记录数量的指标
+// 只有单边记录的 Meson 超过 pendingTimeout 后单独发送缺失告警，为 0 时不检查
+func runDatabaseCheck(db database.Store, pendingTimeout time.Duration) {
+	// 重新发送之前发送失败的告警
+	retryFailedAlerts(db)
+
+	checkUncheckedMesons(db)
+	updatePendingMetric(db)
+
+	if pendingTimeout > 0 {
+		checkTimedOutMesons(db, pendingTimeout)
+	}
+}
+
+// checkUncheckedMesons 对两边都已记录但不一致的 Meson 发送告警
+// 未完成的记录按创建时间分批读取，每批最多 checkBatchSize 条，处理完一批再读取下一批，不会一次性载入内存
+func checkUncheckedMesons(db database.Store) {
+	now := time.Now()
+	since := uncheckedSince(now)
+	var after database.MesonCursor
+	for {
 		// 查询 is_check 为 false 的文档
-		results, err := database.FindUncheckedMesons()
+		results, err := db.FindUncheckedMesons(since, after, checkBatchSize)
 		if err != nil {
-			// 如果查询失败，输出错误信息并继续下一个周期
+			// 如果查询失败，输出错误信息，下个周期重试
 			logrus.Errorf("Failed to find unchecked Mesons: %v", err)
-			continue
+			return
 		}
 
-		if len(results) > 0 {
-			// 如果有未检查的 Meson 文档，输出信息
-			logrus.Info("Unchecked Mesons:")
-			for _, meson := range results {
-				// 构建消息字符串，包含 Meson 文档的详细信息
-				constructMessage(
-					meson.Timestamp,
-					meson.ChainA, meson.ActionA, meson.AmountA, meson.TxHashA,
-					meson.ChainB, meson.ActionB, meson.AmountB, meson.TxHashB,
-				)
-				//logrus.Info(message)
-
-				// 使用 sendNotification 函数统一发送消息
-				//sendNotification("Error", message)
-			}
+		for _, meson := range results {
+			checkUncheckedMeson(db, meson, now)
+		}
+		if len(results) < checkBatchSize {
+			return
 		}
+		last := results[len(results)-1]
+		after = database.MesonCursor{Timestamp: last.Timestamp, ReqID: last.ReqID}
 	}
 }
 
-// isMyToken 检查 tokenIndex 是否匹配已知的 token index
-// 该函数接受一个 *big.Int 类型的 reqId 和一个 uint8 类型的 myTokenIndex 作为参数
-// 返回一个布尔值，表示 tokenIndex 是否匹配 myTokenIndex
-func isMyToken(reqId *big.Int, myTokenIndex uint8) bool {
-	// 从 reqId 中提取 tokenIndex，方法是将 reqId 右移 192 位，然后取最低 8 位
-	tokenIndex := uint8(new(big.Int).Rsh(reqId, 192).Uint64() & 0xFF)
-	// 检查提取的 tokenIndex 是否等于 myTokenIndex
-	return tokenIndex == myTokenIndex
+// checkUncheckedMeson 检查一条未完成的 Meson：最终确定后两边一致的标记为完成，不一致的按冷却时间告警
+func checkUncheckedMeson(db database.Store, meson database.Meson, now time.Time) {
+	// 只有单边记录的 Meson 由超时检查单独处理
+	if meson.ChainB == "" {
+		return
+	}
+	if !routeWatched(meson) || crossingBelowMinAmount(meson) {
+		return
+	}
+	// 未最终确定的跨链继续等待，不告警
+	if !mesonFinal(meson) {
+		return
+	}
+	// 记录时未最终确定的跨链，最终确定后两边一致即标记为完成
+	if crossingMatches(meson) {
+		completeMeson(db, meson)
+		return
+	}
+
+	// 冷却期内已告警过的 reqID 不再重复发送
+	if !shouldAlert(meson, now) {
+		return
+	}
+
+	// 构建消息字符串，包含 Meson 文档的详细信息
+	constructMessage(meson)
+	markAlerted(db, meson.ReqID, now)
 }
 
-// getAmountFromReqID 从 reqId 中提取金额
-// 该函数接受一个 *big.Int 类型的 reqId 和一个 uint8 类型的 decimals 作为参数
-// 返回一个 uint64 类型的金额和一个错误值
-func getAmountFromReqID(reqId *big.Int, decimals uint8) (uint64, error) {
-	// 从 reqId 中提取金额，方法是将 reqId 右移 128 位，然后取最低 64 位
-	amount := new(big.Int).Rsh(reqId, 128).Uint64() & 0xFFFFFFFFFFFFFFFF
-	if amount == 0 {
-		// 如果金额为零，记录错误并返回
-		logrus.Errorf("amount must be greater than zero")
-		return 0, fmt.Errorf("amount must be greater than zero")
+// completeMeson 将最终确定且两边一致的 Meson 标记为完成，失败时下个周期重试
+func completeMeson(db database.Store, meson database.Meson) {
+	meson.IsCheck = true
+	err := db.UpdateMeson(&meson)
+	if err != nil {
+		logrus.Errorf("Failed to mark ReqID %s as checked: %v", meson.ReqID, err)
+		return
 	}
+	settleMeson(meson, time.Now())
+	logrus.Infof("Cross-chain success after finality for ReqID: %s", meson.ReqID)
+}
 
-	// 处理小数点位置
-	if decimals > 6 {
-		// 如果小数位数大于 6，乘以 10^(decimals-6)
-		multiplier := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals-6)), nil).Uint64()
-		amount *= multiplier
-	} else {
-		// 如果小数位数小于等于 6，除以 10^(6-decimals)
-		divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(6-decimals)), nil).Uint64()
-		amount /= divisor
+// checkTimedOutMesons 查找等待另一边超时的单边 Meson，标记为超时并发送缺失告警
+func checkTimedOutMesons(db database.Store, pendingTimeout time.Duration) {
+	now := time.Now()
+	results, err := db.FindTimedOutPendingMesons(now.Add(-pendingTimeout).Unix())
+	if err != nil {
+		logrus.Errorf("Failed to find timed out pending Mesons: %v", err)
+		return
 	}
 
-	return amount, nil
-}
+	for _, meson := range results {
+		if !meson.TimedOut {
+			// 标记失败时跳过告警，下次检查时重新标记后再告警
+			if err := db.MarkMesonTimedOut(meson.ReqID); err != nil {
+				logrus.Errorf("Failed to mark ReqID %s as timed out: %v", meson.ReqID, err)
+				continue
+			}
+		}
+		if crossingBelowMinAmount(meson) || !shouldAlert(meson, now) {
+			continue
+		}
 
-// getCreatedTimeFromReqID 从 reqId 中提取 createdTime
-// 该函数接受一个 *big.Int 类型的 reqId 作为参数
-// 返回一个 uint64 类型的 createdTime
-func getCreatedTimeFromReqID(reqId *big.Int) uint64 {
-	// 将 reqId 右移 208 位，提取前 40 位作为 createdTime
-	createdTime := new(big.Int).Rsh(reqId, 208).Uint64() & 0xFFFFFFFFFF
-	return createdTime
+		logrus.Errorf("Bridge leg missing for ReqID: %s", meson.ReqID)
+		constructTimeoutMessage(meson)
+		markAlerted(db, meson.ReqID, now)
+	}
 }
 
 // InitLogger 初始化日志记录器
@@ -559,6 +1460,161 @@ func InitLogger() {
 	logrus.SetLevel(logrus.InfoLevel)
 }
 
+// initServices 根据配置初始化数据库连接、告警机器人和全局设置
+// 返回的 Store 由调用方传给监听、检查等处理流程，同时作为 database 包级函数使用的 Store；返回的函数用于在程序退出前释放资源
+func initServices(config *Config) (database.Store, func(), error) {
+	// 初始化数据库连接
+	db, err := database.Open(config.Main.DBType, config.Main.PostgresURI, database.PoolConfig{
+		MaxConns:       config.Main.PostgresMaxConns,
+		MinConns:       config.Main.PostgresMinConns,
+		ConnectTimeout: time.Duration(config.Main.PostgresConnectTimeout) * time.Second,
+		MaxConnIdle:    time.Duration(config.Main.PostgresMaxConnIdle) * time.Second,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	// 查询接口、每日汇总等尚未传入 Store 的功能通过包级函数访问同一个连接
+	database.Use(db)
+	// 初始化数据库
+	err = db.InitDatabase()
+	if err != nil {
+		database.Disconnect()
+		return nil, nil, fmt.Errorf("failed to initialize database: %v", err)
+	}
+
+	// 设置区块进度的存储方式
+	switch config.Main.ProgressBackend {
+	case "", progressBackendFile:
+		progressBackend = progressBackendFile
+	case progressBackendDB:
+		progressBackend = progressBackendDB
+	default:
+		database.Disconnect()
+		return nil, nil, fmt.Errorf("unknown progressBackend: %s", config.Main.ProgressBackend)
+	}
+	if progressBackend == progressBackendFile {
+		if config.Main.LastBlockDir != "" {
+			lastBlockDir = config.Main.LastBlockDir
+		}
+		// 目录不存在时进度无法保存，重启后会重复处理同一区间，启动时就创建好
+		err = os.MkdirAll(lastBlockDir, 0755)
+		if err != nil {
+			database.Disconnect()
+			return nil, nil, fmt.Errorf("failed to create last block directory %s: %v", lastBlockDir, err)
+		}
+	}
+
+	err = initNotifiers(config)
+	if err != nil {
+		database.Disconnect()
+		return nil, nil, err
+	}
+
+	if config.Main.ZeroAmountAction != "" {
+		zeroAmountAction = config.Main.ZeroAmountAction
+	}
+	alertCooldown = time.Duration(config.Main.AlertCooldownMinutes) * time.Minute
+	retentionMaxAge = config.Main.Retention.maxAge()
+	if config.Main.CheckBatchSize > 0 {
+		checkBatchSize = config.Main.CheckBatchSize
+	}
+
+	amountTolerances, err = loadAmountTolerances(config)
+	if err != nil {
+		database.Disconnect()
+		return nil, nil, fmt.Errorf("invalid amount tolerances: %v", err)
+	}
+	watchedRoutes, err = loadWatchedRoutes(config)
+	if err != nil {
+		database.Disconnect()
+		return nil, nil, fmt.Errorf("invalid watched routes: %v", err)
+	}
+	minAmounts, err = loadMinAmounts(config)
+	if err != nil {
+		database.Disconnect()
+		return nil, nil, fmt.Errorf("invalid minimum amounts: %v", err)
+	}
+	if config.Main.MinAmountAction != "" {
+		minAmountAction = config.Main.MinAmountAction
+	}
+	finalityChains = loadFinalityChains(config)
+
+	return db, func() {
+		database.Disconnect()
+	}, nil
+}
+
+// initNotifiers 根据配置创建各告警渠道的机器人实例
+func initNotifiers(config *Config) error {
+	// 初始化 Telegram 和 Lark 机器人
+	// 使用配置文件中的参数创建 Telegram 和 Lark 机器人实例
+	notifiers = buildNotifiers(config)
+	telegramBot = bot.NewTelegramBot(config.Main.BotToken, config.Main.ChatIDs)
+	larkBot = bot.NewLarkBot(config.Main.LarkBotURL, config.Main.LarkSecret)
+	if config.Main.SlackBotURL != "" {
+		slackBot = bot.NewSlackBot(config.Main.SlackBotURL)
+	}
+	if config.Main.WebhookURL != "" {
+		var err error
+		webhookBot, err = bot.NewWebhookBot(config.Main.WebhookURL, config.Main.WebhookHeaders, config.Main.WebhookTemplate)
+		if err != nil {
+			return fmt.Errorf("failed to create webhook notifier: %v", err)
+		}
+	}
+	if config.Main.PagerDutyRoutingKey != "" {
+		pagerDutyBot = bot.NewPagerDutyBot(config.Main.PagerDutyRoutingKey)
+	}
+	client, err := bot.NewHTTPClient(config.Main.ProxyURL, time.Duration(config.Main.NotifyTimeoutSeconds)*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP client for notifiers: %v", err)
+	}
+	telegramBot.Client = client
+	larkBot.Client = client
+	if slackBot != nil {
+		slackBot.Client = client
+	}
+	if webhookBot != nil {
+		webhookBot.Client = client
+	}
+	if pagerDutyBot != nil {
+		pagerDutyBot.Client = client
+	}
+	alertRoutes, err = loadAlertRoutes(config)
+	if err != nil {
+		return err
+	}
+	chainAlertRoutes = routesByChain(alertRoutes)
+	for _, route := range alertRoutes {
+		route.configureBots(client, config.Main.NotifyMaxAttempts)
+	}
+	if config.Main.NotifyMaxAttempts > 0 {
+		telegramBot.MaxAttempts = config.Main.NotifyMaxAttempts
+		larkBot.MaxAttempts = config.Main.NotifyMaxAttempts
+		if slackBot != nil {
+			slackBot.MaxAttempts = config.Main.NotifyMaxAttempts
+		}
+		if webhookBot != nil {
+			webhookBot.MaxAttempts = config.Main.NotifyMaxAttempts
+		}
+		if pagerDutyBot != nil {
+			pagerDutyBot.MaxAttempts = config.Main.NotifyMaxAttempts
+		}
+	}
+
+	if config.Main.ParseMode != "" {
+		telegramParseMode = config.Main.ParseMode
+	}
+	alertTemplates, err = loadMessageTemplates(config.Main.MessageTemplates, telegramParseMode)
+	if err != nil {
+		return fmt.Errorf("failed to load message templates: %v", err)
+	}
+	displayLocation = loadDisplayLocation(config.Main.DisplayTimezone)
+	chainTokenDecimals = loadTokenDecimals(config.Chains)
+	chainExplorerTxURLs = loadExplorerTxURLs(config.Chains)
+	chainRecipientAllowlists = loadRecipientAllowlists(config.Chains)
+	return nil
+}
+
 func main() {
 
 	// 初始化日志记录器
@@ -572,40 +1628,52 @@ func main() {
 		logrus.Fatalf("Failed to load config file: %v", err)
 	}
 
-	// 初始化 PostgreSQL 数据库连接
-	err = database.Connect(config.Main.PostgresURI)
-	if err != nil {
-		logrus.Fatalf("Failed to connect to PostgreSQL: %v", err)
-	}
-	defer database.Disconnect()
-	// 初始化数据库
-	err = database.InitDatabase()
+	// 校验配置，出错时直接指出具体字段
+	err = config.Validate()
 	if err != nil {
-		logrus.Fatalf("Failed to initialize PostgreSQL: %v", err)
+		logrus.Fatalf("Invalid config: %v", err)
 	}
 
-	// 初始化 Telegram 和 Lark 机器人
-	// 使用配置文件中的参数创建 Telegram 和 Lark 机器人实例
-	telegramBot = bot.NewTelegramBot(config.Main.BotToken, config.Main.ChatIDs)
-	larkBot = bot.NewLarkBot(config.Main.LarkBotURL)
+	// --test-alert：发送一条示例告警检查各渠道配置后退出，不需要数据库
+	if len(os.Args) > 1 && os.Args[1] == "--test-alert" {
+		err = initNotifiers(config)
+		if err != nil {
+			logrus.Fatalf("Failed to create notifiers: %v", err)
+		}
+		err = runTestAlert(config)
+		if err != nil {
+			logrus.Fatalf("Test alert failed: %v", err)
+		}
+		return
+	}
 
-	// 使用 WaitGroup 来等待监听协程完成
-	var wg sync.WaitGroup
+	// 子命令：执行完后直接退出，不启动监听
+	if len(os.Args) > 1 {
+		db, cleanup, err := initServices(config)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		err = runCommand(config, db, os.Args[1], os.Args[2:])
+		cleanup()
+		if err != nil {
+			logrus.Fatalf("Command %s failed: %v", os.Args[1], err)
+		}
+		return
+	}
 
-	// 启动数据库检查协程
-	wg.Add(1) // 增加 WaitGroup 计数
-	// 启动一个新的协程执行 checkDatabase 函数
-	go checkDatabase(&wg, config.Main.CheckTime)
+	// 收到 SIGINT 或 SIGTERM 时取消 ctx，Run 停止监听后返回
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-signals
+		logrus.Infof("Received %s, shutting down", sig)
+		cancel()
+	}()
 
-	// 遍历所有链配置并启动监听协程
-	// 遍历配置文件中的所有链配置
-	for chainName, chainConfig := range config.Chains {
-		logrus.Infof("Starting listener for chain: %s", chainName)
-		wg.Add(1) // 增加 WaitGroup 计数
-		// 启动一个新的协程执行 listenEvents 函数
-		go listenEvents(&wg, chainName, chainConfig.RpcUrl, chainConfig.MesonContract, chainConfig.MesonIndex, chainConfig.TokenDecimal, chainConfig.StartBlock)
+	err = Run(ctx, config)
+	if err != nil {
+		logrus.Fatalf("Monitor stopped: %v", err)
 	}
-
-	// 等待所有协程完成（实际上不会，因为协程中有无限循环）
-	wg.Wait()
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+	"meson-monitor/reqid"
+)
+
+func TestMain(m *testing.M) {
+	// 处理逻辑会输出大量日志，测试中不输出
+	logrus.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// recordingNotifier 记录收到的告警，不发送
+type recordingNotifier struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (n *recordingNotifier) Name() string {
+	return "recording"
+}
+
+func (n *recordingNotifier) Notify(alert Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+// Alerts 已收到的告警
+func (n *recordingNotifier) Alerts() []Alert {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Alert(nil), n.alerts...)
+}
+
+// Kinds 已收到的告警类型，按收到的顺序
+func (n *recordingNotifier) Kinds() []AlertKind {
+	var kinds []AlertKind
+	for _, alert := range n.Alerts() {
+		kinds = append(kinds, alert.Kind)
+	}
+	return kinds
+}
+
+// count 任一条记录的交易哈希包含 text 的告警数量
+func (n *recordingNotifier) count(text string) int {
+	count := 0
+	for _, alert := range n.Alerts() {
+		for _, leg := range alert.Legs {
+			if strings.Contains(leg.TxHash, text) {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// useTestNotifier 将已配置的告警渠道替换为 recordingNotifier，测试结束时恢复
+func useTestNotifier(t testing.TB) *recordingNotifier {
+	recorder := &recordingNotifier{}
+	previous := notifiers
+	notifiers = []Notifier{recorder}
+	t.Cleanup(func() {
+		notifiers = previous
+	})
+	return recorder
+}
+
+// testSQLiteURI 测试临时目录中的 SQLite 数据库地址
+func testSQLiteURI(t testing.TB) string {
+	return "sqlite://" + filepath.Join(t.TempDir(), "monitor.db")
+}
+
+// useTestDatabase 在测试临时目录中创建 SQLite 数据库并初始化表，测试结束时关闭
+func useTestDatabase(t testing.TB) database.Store {
+	return useTestStore(t, database.TypeSQLite, testSQLiteURI(t))
+}
+
+// useTestStore 打开并初始化数据库，作为 database 包级函数使用的 Store，测试结束时关闭并恢复之前的 Store
+func useTestStore(t testing.TB, dbType, uri string) database.Store {
+	db, err := database.Open(dbType, uri, database.PoolConfig{})
+	if err != nil {
+		t.Fatalf("open %s: %v", dbType, err)
+	}
+	if err := db.InitDatabase(); err != nil {
+		db.Close()
+		t.Fatalf("init %s: %v", dbType, err)
+	}
+	previous := database.Use(db)
+	t.Cleanup(func() {
+		database.Use(previous)
+		db.Close()
+	})
+	return db
+}
+
+// testPostgresEnv 设置后 useTestPostgres 连接该 PostgreSQL 数据库，测试数据使用唯一的 reqID，不会清空已有数据
+const testPostgresEnv = "BRIDGE_TEST_POSTGRES_URI"
+
+// useTestPostgres 连接 testPostgresEnv 指定的 PostgreSQL 数据库并初始化表，未设置时跳过测试
+func useTestPostgres(t testing.TB) database.Store {
+	uri := os.Getenv(testPostgresEnv)
+	if uri == "" {
+		t.Skipf("%s not set", testPostgresEnv)
+	}
+	return useTestStore(t, database.TypePostgres, uri)
+}
+
+// testContract 测试链配置监听的合约地址
+var testContract = common.HexToAddress("0x25aB3Efd52e6470681CE037cD546Dc60726948D3")
+
+// testTokenIndex 测试链配置监听的 token index，代币为 6 位小数
+const testTokenIndex = 1
+
+// testChainConfig 使用内置 ABI、只监听 testContract 上 testTokenIndex 的链配置
+func testChainConfig() ChainConfig {
+	return ChainConfig{MesonContract: testContract.Hex(), MesonIndex: testTokenIndex, TokenDecimal: 6}
+}
+
+// testABI 解析内置的 contractABI
+func testABI(t testing.TB) abi.ABI {
+	parsedABI, err := abi.JSON(strings.NewReader(contractABI))
+	if err != nil {
+		t.Fatalf("parse contractABI: %v", err)
+	}
+	return parsedABI
+}
+
+// testReqID 按 reqid.Meson 布局编码 reqID，amount 为 6 位小数的原始金额
+func testReqID(tokenIndex uint8, amount, createdTime uint64) common.Hash {
+	value := new(big.Int).Lsh(new(big.Int).SetUint64(createdTime), reqid.Meson.CreatedTime.Offset)
+	value.Or(value, new(big.Int).Lsh(big.NewInt(int64(tokenIndex)), reqid.Meson.TokenIndex.Offset))
+	value.Or(value, new(big.Int).Lsh(new(big.Int).SetUint64(amount), reqid.Meson.Amount.Offset))
+	return common.BigToHash(value)
+}
+
+// testAddress 测试事件中的 proposer 或 recipient 地址
+var testAddress = common.HexToAddress("0x00000000000000000000000000000000000000a1")
+
+// mesonLog testContract 在 chainName 上发出的 action 事件日志，交易哈希和区块哈希由链名、区块号和日志序号生成
+func mesonLog(parsedABI abi.ABI, chainName, action string, reqID common.Hash, block uint64, logIndex uint) types.Log {
+	return types.Log{
+		Address:     testContract,
+		Topics:      []common.Hash{parsedABI.Events[action].ID, reqID, common.BytesToHash(testAddress.Bytes())},
+		BlockNumber: block,
+		Index:       logIndex,
+		TxHash:      crypto.Keccak256Hash([]byte(fmt.Sprintf("tx/%s/%d/%d", chainName, block, logIndex))),
+		BlockHash:   crypto.Keccak256Hash([]byte(fmt.Sprintf("block/%s/%d", chainName, block))),
+	}
+}
+
+func TestHandleLogSkipsLogsWithTooFewTopics(t *testing.T) {
+	parsedABI := testABI(t)
+	mintID := parsedABI.Events["TokenMintExecuted"].ID
+	burnID := parsedABI.Events["TokenBurnExecuted"].ID
+
+	tests := []struct {
+		name   string
+		topics []common.Hash
+	}{
+		{name: "no topics"},
+		{name: "mint signature only", topics: []common.Hash{mintID}},
+		{name: "burn signature only", topics: []common.Hash{burnID}},
+		{name: "missing address topic", topics: []common.Hash{mintID, common.HexToHash("0x01")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vLog := types.Log{Address: testContract, Topics: tt.topics, TxHash: common.HexToHash("0xabc")}
+			// 截断的日志在读取 reqId 和地址之前被跳过，越界会直接让测试 panic
+			handleLog(nil, &recordingNotifier{}, "bsc", ChainConfig{MesonContract: testContract.Hex()}, parsedABI, vLog)
+		})
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"meson-monitor/database"
+)
+
+// handleTestEvent 在一个事务中处理 chainName 上 block 区块中的一个事件并提交，返回 meson_handle 的结果
+func handleTestEvent(t *testing.T, db database.Store, chainName, eventName, reqID string, amount int64, txHash string, block uint64) error {
+	t.Helper()
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	handleErr := meson_handle(tx, alertFanout{}, reqID, chainName, eventName, testTokenIndex, 1700000000, big.NewInt(amount), txHash, testAddress.Hex(), testContract.Hex(), block, 0, "0xblock")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit %s event: %v", chainName, err)
+	}
+	return handleErr
+}
+
+// processTestLogs 在一个事务中处理 chainName 上的日志，告警发送到 notifier
+func processTestLogs(t *testing.T, db database.Store, notifier Notifier, chainName string, logs ...types.Log) {
+	t.Helper()
+	if err := processLogsWithoutCursor(db, notifier, chainName, testChainConfig(), testABI(t), logs); err != nil {
+		t.Fatalf("process %s logs: %v", chainName, err)
+	}
+}
+
+// findTestMeson 查询 reqID 对应的 Meson，不存在时测试失败
+func findTestMeson(t *testing.T, reqID string) *database.Meson {
+	t.Helper()
+	meson, err := database.FindMesonByReqID(reqID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meson == nil {
+		t.Fatalf("Meson %s not recorded", reqID)
+	}
+	return meson
+}
+
+func TestSameChainDuplicateLegAlertsWithoutOverwriting(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	reqID := "duplicate-leg"
+
+	if err := handleTestEvent(t, db, "bsc", "TokenBurnExecuted", reqID, 1000000, reqID+"-first", 100); err != nil {
+		t.Fatalf("first leg: %v", err)
+	}
+	if err := handleTestEvent(t, db, "bsc", "TokenBurnExecuted", reqID, 1000000, reqID+"-replay", 105); err == nil {
+		t.Error("duplicate leg accepted")
+	}
+
+	if got := recorder.count(reqID + "-replay"); got != 1 {
+		t.Fatalf("sent %d duplicate leg alerts, want 1", got)
+	}
+	meson := findTestMeson(t, reqID)
+	if meson.ChainB != "" || meson.IsCheck {
+		t.Errorf("duplicate leg completed the pair: chainB=%q isCheck=%v", meson.ChainB, meson.IsCheck)
+	}
+	if meson.TxHashA != reqID+"-first" || meson.BlockA != 100 {
+		t.Errorf("first leg overwritten: tx %s block %d", meson.TxHashA, meson.BlockA)
+	}
+}
+
+func TestCrossChainLegsCompleteThePair(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	reqID := "cross-chain"
+
+	if err := handleTestEvent(t, db, "bsc", "TokenBurnExecuted", reqID, 1000000, reqID+"-burn", 100); err != nil {
+		t.Fatalf("burn leg: %v", err)
+	}
+	if err := handleTestEvent(t, db, "eth", "TokenMintExecuted", reqID, 1000000, reqID+"-mint", 200); err != nil {
+		t.Fatalf("mint leg: %v", err)
+	}
+
+	if got := recorder.count(reqID); got != 0 {
+		t.Fatalf("sent %d alerts, want none", got)
+	}
+	meson := findTestMeson(t, reqID)
+	if meson.ChainA != "bsc" || meson.ChainB != "eth" || !meson.IsCheck {
+		t.Errorf("pair not completed: chainA=%q chainB=%q isCheck=%v", meson.ChainA, meson.ChainB, meson.IsCheck)
+	}
+	if meson.TxHashB != reqID+"-mint" {
+		t.Errorf("txHashB = %s, want %s", meson.TxHashB, reqID+"-mint")
+	}
+}
+
+func TestReplayedRangeDoesNotDuplicateAlerts(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	// 一对正常完成的跨链，以及两边都是 burn、处理时告警的跨链
+	paired := "replay-paired"
+	invalid := "replay-invalid"
+
+	// 第二次处理模拟保存区块进度之前重启后重新处理同一区间
+	for i := 0; i < 2; i++ {
+		handleTestEvent(t, db, "bsc", "TokenBurnExecuted", paired, 1000000, paired+"-burn", 100)
+		handleTestEvent(t, db, "bsc", "TokenBurnExecuted", invalid, 2000000, invalid+"-bsc", 101)
+		handleTestEvent(t, db, "eth", "TokenMintExecuted", paired, 1000000, paired+"-mint", 200)
+		handleTestEvent(t, db, "eth", "TokenBurnExecuted", invalid, 2000000, invalid+"-eth", 201)
+	}
+
+	if got := recorder.count(paired); got != 0 {
+		t.Errorf("sent %d alerts for the matching pair, want none", got)
+	}
+	if got := recorder.count(invalid); got != 1 {
+		t.Errorf("sent %d alerts for the invalid pair, want 1", got)
+	}
+	if meson := findTestMeson(t, paired); !meson.IsCheck {
+		t.Error("matching pair not completed after replay")
+	}
+	if meson := findTestMeson(t, invalid); meson.TxHashB != invalid+"-eth" {
+		t.Errorf("invalid pair txHashB = %s, want %s", meson.TxHashB, invalid+"-eth")
+	}
+	for _, reqID := range []string{paired, invalid} {
+		if legs, err := database.FindMesonLegs(reqID); err != nil || len(legs) != 2 {
+			t.Errorf("%s: recorded %d legs (%v), want 2", reqID, len(legs), err)
+		}
+	}
+}
+
+// memStore 保存在内存中的 Store，用于不依赖数据库地测试 meson_handle
+type memStore struct {
+	mesons map[string]database.Meson
+	legs   map[string]database.MesonLeg
+}
+
+func newMemStore() *memStore {
+	return &memStore{mesons: make(map[string]database.Meson), legs: make(map[string]database.MesonLeg)}
+}
+
+func (s *memStore) FindMesonByReqID(reqID string) (*database.Meson, error) {
+	meson, ok := s.mesons[reqID]
+	if !ok {
+		return nil, nil
+	}
+	return &meson, nil
+}
+
+func (s *memStore) InsertMeson(meson database.Meson) (bool, error) {
+	if _, ok := s.mesons[meson.ReqID]; ok {
+		return false, nil
+	}
+	s.mesons[meson.ReqID] = meson
+	return true, nil
+}
+
+// InsertMesonLeg 与数据库一致，按 reqID、链、交易哈希和日志序号去重
+func (s *memStore) InsertMesonLeg(leg database.MesonLeg) (bool, error) {
+	key := fmt.Sprintf("%s/%s/%s/%d", leg.ReqID, leg.Chain, leg.TxHash, leg.LogIndex)
+	if _, ok := s.legs[key]; ok {
+		return false, nil
+	}
+	s.legs[key] = leg
+	return true, nil
+}
+
+// UpdateMeson 与数据库一致，两边金额一致时记录完成时间
+func (s *memStore) UpdateMeson(meson *database.Meson) error {
+	updated := *meson
+	updated.CompletedAt = nil
+	if updated.IsCheck {
+		now := time.Now()
+		updated.CompletedAt = &now
+	}
+	s.mesons[meson.ReqID] = updated
+	return nil
+}
+
+// handleStep 状态机测试中依次处理的一条事件
+type handleStep struct {
+	chain    string
+	action   string
+	amount   int64
+	tx       string
+	block    uint64
+	logIndex uint
+}
+
+// burnStep 和 mintStep 为金额 1,000,000 的事件
+func burnStep(chain, tx string, block uint64, logIndex uint) handleStep {
+	return handleStep{chain: chain, action: actionBurn, amount: 1000000, tx: tx, block: block, logIndex: logIndex}
+}
+
+func mintStep(chain, tx string, block uint64, logIndex uint) handleStep {
+	return handleStep{chain: chain, action: actionMint, amount: 1000000, tx: tx, block: block, logIndex: logIndex}
+}
+
+func TestMesonHandleStateMachine(t *testing.T) {
+	reqID := "0x0100000000000f424001"
+	withAmount := func(step handleStep, amount int64) handleStep { step.amount = amount; return step }
+
+	tests := []struct {
+		name  string
+		steps []handleStep
+		// 期望的告警和最后一步是否返回错误
+		wantAlerts []AlertKind
+		wantErr    bool
+		// 期望的记录
+		wantChainB  string
+		wantIsCheck bool
+		wantTxHashA string
+	}{
+		{
+			name:        "first leg inserted",
+			steps:       []handleStep{burnStep("bsc", "0xa", 100, 0)},
+			wantTxHashA: "0xa",
+		},
+		{
+			name:       "matching second leg completes the pair",
+			steps:      []handleStep{burnStep("bsc", "0xa", 100, 0), mintStep("eth", "0xb", 200, 0)},
+			wantChainB: "eth", wantIsCheck: true, wantTxHashA: "0xa",
+		},
+		{
+			name:       "amount mismatch alerts",
+			steps:      []handleStep{burnStep("bsc", "0xa", 100, 0), withAmount(mintStep("eth", "0xb", 200, 0), 900000)},
+			wantAlerts: []AlertKind{AlertAmountMismatch}, wantErr: true,
+			wantChainB: "eth", wantTxHashA: "0xa",
+		},
+		{
+			// 两边金额一致，is_check 按金额计算为 true，但动作组合无效仍然告警
+			name:       "invalid action pair alerts",
+			steps:      []handleStep{burnStep("bsc", "0xa", 100, 0), burnStep("eth", "0xb", 200, 0)},
+			wantAlerts: []AlertKind{AlertInvalidActionPair}, wantErr: true,
+			wantChainB: "eth", wantIsCheck: true, wantTxHashA: "0xa",
+		},
+		{
+			// 重启或区间重叠时同一条日志再次处理
+			name:        "duplicate leg ignored",
+			steps:       []handleStep{burnStep("bsc", "0xa", 100, 0), burnStep("bsc", "0xa", 100, 0)},
+			wantTxHashA: "0xa",
+		},
+		{
+			name:       "same-chain leg in another tx alerts without overwriting",
+			steps:      []handleStep{burnStep("bsc", "0xa", 100, 0), burnStep("bsc", "0xc", 105, 3)},
+			wantAlerts: []AlertKind{AlertDuplicateLeg}, wantErr: true,
+			wantTxHashA: "0xa",
+		},
+		{
+			name:       "extra leg after completion alerts",
+			steps:      []handleStep{burnStep("bsc", "0xa", 100, 0), mintStep("eth", "0xb", 200, 0), mintStep("polygon", "0xc", 300, 0)},
+			wantAlerts: []AlertKind{AlertDuplicateLeg}, wantErr: true,
+			wantChainB: "eth", wantIsCheck: true, wantTxHashA: "0xa",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemStore()
+			recorder := &recordingNotifier{}
+
+			var err error
+			for i, step := range tt.steps {
+				err = meson_handle(store, recorder, reqID, step.chain, step.action, testTokenIndex, 1700000000, big.NewInt(step.amount),
+					step.tx, testAddress.Hex(), testContract.Hex(), step.block, step.logIndex, "0xblock")
+				if i < len(tt.steps)-1 && err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("last step error = %v, want error %v", err, tt.wantErr)
+			}
+
+			kinds := recorder.Kinds()
+			if len(kinds) != len(tt.wantAlerts) {
+				t.Fatalf("alerts = %v, want %v", kinds, tt.wantAlerts)
+			}
+			for i := range kinds {
+				if kinds[i] != tt.wantAlerts[i] {
+					t.Fatalf("alerts = %v, want %v", kinds, tt.wantAlerts)
+				}
+			}
+
+			meson, _ := store.FindMesonByReqID(reqID)
+			if meson == nil {
+				t.Fatal("Meson not recorded")
+			}
+			if meson.ChainA != "bsc" || meson.ChainB != tt.wantChainB || meson.IsCheck != tt.wantIsCheck || meson.TxHashA != tt.wantTxHashA {
+				t.Errorf("recorded chainA=%s chainB=%q isCheck=%v txHashA=%s, want bsc %q %v %s",
+					meson.ChainA, meson.ChainB, meson.IsCheck, meson.TxHashA, tt.wantChainB, tt.wantIsCheck, tt.wantTxHashA)
+			}
+			if tt.wantIsCheck && meson.CompletedAt == nil {
+				t.Error("completed pair has no completed_at")
+			}
+		})
+	}
+}
+
+func TestTokenIndexMismatchAlertsAndLeavesPairIncomplete(t *testing.T) {
+	db := useTestDatabase(t)
+	recorder := useTestNotifier(t)
+	reqID := "token-index"
+
+	if err := handleTestEvent(t, db, "bsc", actionBurn, reqID, 1000000, reqID+"-burn", 100); err != nil {
+		t.Fatalf("burn leg: %v", err)
+	}
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	// 金额一致，但 B 边的 token index 与 A 边不同
+	err = meson_handle(tx, alertFanout{}, reqID, "eth", actionMint, testTokenIndex+1, 1700000000, big.NewInt(1000000), reqID+"-mint", testAddress.Hex(), testContract.Hex(), 200, 0, "0xblock")
+	if err == nil {
+		t.Error("token index mismatch accepted")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if kinds := recorder.Kinds(); len(kinds) != 1 || kinds[0] != AlertTokenIndexMismatch {
+		t.Fatalf("alerts = %v, want one %s", kinds, AlertTokenIndexMismatch)
+	}
+	meson := findTestMeson(t, reqID)
+	if meson.IsCheck || meson.TokenIndexB == nil || *meson.TokenIndexB != int(testTokenIndex)+1 {
+		t.Errorf("isCheck = %v, tokenIndexB = %v; want an incomplete pair with leg B's index", meson.IsCheck, meson.TokenIndexB)
+	}
+	if kind := classifyMeson(*meson); kind != AlertTokenIndexMismatch {
+		t.Errorf("classifyMeson = %s, want %s", kind, AlertTokenIndexMismatch)
+	}
+}
+
+// raceLegs 在两个协程中同时用 handle 处理同一 reqID 的 bsc burn 和 eth mint，重复 rounds 次，每次使用不同的 reqID
+// 每一轮结束后检查该 reqID 只有一行，且两边都已记录并完成配对；createdTime 使不同次运行的 reqID 不同
+func raceLegs(t *testing.T, rounds int, createdTime uint64, handle func(chainName, action string, reqID common.Hash, vLog types.Log) error) {
+	t.Helper()
+	parsedABI := testABI(t)
+	for i := 0; i < rounds; i++ {
+		reqID := testReqID(testTokenIndex, uint64(1000000+i), createdTime)
+		legs := []struct {
+			chain, action string
+			block         uint64
+		}{{"bsc", actionBurn, 100}, {"eth", actionMint, 200}}
+
+		start := make(chan struct{})
+		errs := make(chan error, len(legs))
+		var wg sync.WaitGroup
+		for _, leg := range legs {
+			vLog := mesonLog(parsedABI, leg.chain, leg.action, reqID, leg.block, uint(i))
+			wg.Add(1)
+			go func(chainName, action string) {
+				defer wg.Done()
+				<-start
+				errs <- handle(chainName, action, reqID, vLog)
+			}(leg.chain, leg.action)
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("round %d: %v", i, err)
+			}
+		}
+
+		meson := findTestMeson(t, reqID.Hex())
+		chains := map[string]bool{meson.ChainA: true, meson.ChainB: true}
+		if !chains["bsc"] || !chains["eth"] || !meson.IsCheck || meson.CompletedAt == nil {
+			t.Fatalf("round %d: want one completed bsc/eth row, got %+v", i, *meson)
+		}
+	}
+}
+
+func TestConcurrentLegsOfOneReqIDCompleteOnePair(t *testing.T) {
+	// 两条链的监听协程几乎同时处理同一 reqID 的两边，重复多次以覆盖两边先后提交的不同顺序
+	const rounds = 20
+	backends := []struct {
+		name string
+		use  func(t testing.TB) database.Store
+	}{
+		{name: database.TypeSQLite, use: useTestDatabase},
+		// PostgreSQL 上两个事务都查不到记录后同时插入，后插入的一方 ON CONFLICT DO NOTHING，再用 SELECT ... FOR UPDATE 重新读取
+		{name: database.TypePostgres, use: useTestPostgres},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			t.Run("process logs", func(t *testing.T) {
+				db := backend.use(t)
+				recorder := &recordingNotifier{}
+				parsedABI := testABI(t)
+				createdTime := uint64(time.Now().UnixNano()) & (1<<40 - 1)
+				raceLegs(t, rounds, createdTime, func(chainName, action string, reqID common.Hash, vLog types.Log) error {
+					return processLogsWithoutCursor(db, recorder, chainName, testChainConfig(), parsedABI, []types.Log{vLog})
+				})
+				if alerts := recorder.Alerts(); len(alerts) != 0 {
+					t.Errorf("sent %d alerts, want 0: %v", len(alerts), recorder.Kinds())
+				}
+			})
+
+			// 直接调用 meson_handle_once，返回错误而不是像 processLogs 那样只记录日志
+			t.Run("handle in one transaction", func(t *testing.T) {
+				db := backend.use(t)
+				createdTime := uint64(time.Now().UnixNano()) & (1<<40 - 1)
+				raceLegs(t, rounds, createdTime, func(chainName, action string, reqID common.Hash, vLog types.Log) error {
+					tx, err := db.BeginTx()
+					if err != nil {
+						return err
+					}
+					defer tx.Rollback()
+					err = meson_handle_once(tx, &recordingNotifier{}, reqID.Hex(), chainName, action, testTokenIndex, 1700000000, big.NewInt(1000000),
+						vLog.TxHash.Hex(), testAddress.Hex(), vLog.BlockNumber, vLog.Index, "0xblock", false)
+					if err != nil {
+						return err
+					}
+					return tx.Commit()
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	// 运行镜像中没有安装 tzdata，内置时区数据以支持 displayTimezone
+	_ "time/tzdata"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	parseModeHTML       = "HTML"
+	parseModeMarkdownV2 = "MarkdownV2"
+)
+
+// telegramParseMode Telegram 消息使用的 parse_mode
+var telegramParseMode = parseModeHTML
+
+// displayLocation 消息中显示时间使用的时区，数据库中始终保存 UTC
+var displayLocation = time.UTC
+
+// loadDisplayLocation 按 IANA 时区名称（如 "Asia/Shanghai"）加载消息显示时区，为空或无效时使用 UTC
+func loadDisplayLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		logrus.Warnf("Invalid displayTimezone %q, using UTC: %v", name, err)
+		return time.UTC
+	}
+	return location
+}
+
+// formatDisplayTime 按 displayLocation 格式化消息中显示的时间
+func formatDisplayTime(t time.Time) string {
+	return t.In(displayLocation).Format(time.RFC3339)
+}
+
+// markdownV2Special Telegram MarkdownV2 中需要转义的字符
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// escapeMarkdownV2 按 Telegram MarkdownV2 规则转义文本中的特殊字符
+func escapeMarkdownV2(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(markdownV2Special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// formatTelegram 按当前 parse_mode 格式化 Telegram 消息
+// format 中用 <b>...</b> 标记粗体，参数中的内容会按 parse_mode 转义，避免交易哈希、地址等破坏消息格式
+func formatTelegram(format string, args ...interface{}) string {
+	escaped := make([]interface{}, len(args))
+
+	if telegramParseMode == parseModeMarkdownV2 {
+		for i, arg := range args {
+			escaped[i] = escapeMarkdownV2(fmt.Sprint(arg))
+		}
+		// 先转义模板中的字面文本，再把粗体标签换成 MarkdownV2 的 *
+		parts := strings.Split(format, "<b>")
+		for i, part := range parts {
+			segments := strings.Split(part, "</b>")
+			for j, segment := range segments {
+				segments[j] = escapeMarkdownV2(segment)
+			}
+			parts[i] = strings.Join(segments, "*")
+		}
+		return fmt.Sprintf(strings.Join(parts, "*"), escaped...)
+	}
+
+	for i, arg := range args {
+		escaped[i] = html.EscapeString(fmt.Sprint(arg))
+	}
+	return fmt.Sprintf(format, escaped...)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"meson-monitor/reqid"
+)
+
+// checkMarkdownV2 检查文本是否为只使用粗体的合法 MarkdownV2：特殊字符都已转义，未转义的只有成对的 *
+func checkMarkdownV2(t *testing.T, text string) {
+	t.Helper()
+	bold := 0
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\':
+			if i+1 == len(runes) {
+				t.Fatalf("trailing backslash in %q", text)
+			}
+			i++
+		case r == '*':
+			bold++
+		case strings.ContainsRune(markdownV2Special, r):
+			t.Fatalf("unescaped %q at %d in %q", r, i, text)
+		}
+	}
+	if bold%2 != 0 {
+		t.Fatalf("unbalanced bold markers in %q", text)
+	}
+}
+
+// setTelegramParseMode 设置 Telegram 的 parse_mode，测试结束时恢复
+func setTelegramParseMode(t *testing.T, parseMode string) {
+	previous := telegramParseMode
+	telegramParseMode = parseMode
+	t.Cleanup(func() {
+		telegramParseMode = previous
+	})
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"TQ_recipient_address", `TQ\_recipient\_address`},
+		{"1,000.5", `1,000\.5`},
+		{"(-0.1%)", `\(\-0\.1%\)`},
+		{`a\b`, `a\\b`},
+		{"_*[]()~`>#+-=|{}.!", "\\_\\*\\[\\]\\(\\)\\~\\`\\>\\#\\+\\-\\=\\|\\{\\}\\.\\!"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		got := escapeMarkdownV2(tt.in)
+		if got != tt.want {
+			t.Errorf("escapeMarkdownV2(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		checkMarkdownV2(t, got)
+	}
+}
+
+func TestFormatTelegramMarkdownV2EscapesArguments(t *testing.T) {
+	setTelegramParseMode(t, parseModeMarkdownV2)
+
+	got := formatTelegram("<b>Address:</b> %s (%s)", "TQ_recipient_address", "tron")
+	want := `*Address:* TQ\_recipient\_address \(tron\)`
+	if got != want {
+		t.Errorf("formatTelegram = %q, want %q", got, want)
+	}
+	checkMarkdownV2(t, got)
+}
+
+func TestFormatWithCommasEighteenDecimals(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount string
+		want   string
+	}{
+		{name: "one million tokens", amount: "1000000000000000000000000", want: "1,000,000,000,000,000,000,000,000"},
+		{name: "max reqID amount", amount: "18446744073709551615000000000000", want: "18,446,744,073,709,551,615,000,000,000,000"},
+		{name: "negative", amount: "-1234567", want: "-1,234,567"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, _ := new(big.Int).SetString(tt.amount, 10)
+			if got := formatWithCommas(amount); got != tt.want {
+				t.Errorf("formatWithCommas = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEighteenDecimalAmountFromReqIDDoesNotWrap(t *testing.T) {
+	// 原始金额 10^12 即 1,000,000 个代币，按 uint64 计算换算为 18 位小数时会回绕
+	reqID := common.BigToHash(new(big.Int).Lsh(big.NewInt(1000000000000), 128))
+	amount, err := reqid.DecodeAmount(reqID, 18)
+	if err != nil {
+		t.Fatalf("DecodeAmount: %v", err)
+	}
+	if got := formatWithCommas(amount); got != "1,000,000,000,000,000,000,000,000" {
+		t.Errorf("formatWithCommas = %s, want 1,000,000,000,000,000,000,000,000", got)
+	}
+}
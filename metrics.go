@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"meson-monitor/database"
+)
+
+// rpcLatencyBuckets RPC 请求耗时直方图的桶上限，单位秒
+var rpcLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// rpcMetricKey 按链、节点和方法区分的指标
+type rpcMetricKey struct {
+	chain    string
+	endpoint string
+	method   string
+}
+
+// settlementLatencyBuckets 跨链完成耗时直方图的桶上限，单位秒
+var settlementLatencyBuckets = []float64{30, 60, 120, 300, 600, 1800, 3600, 7200, 21600}
+
+// histogram 简单的累计直方图，counts[i] 为耗时不超过 buckets[i] 的观测数
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(seconds float64) {
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+var (
+	rpcLatency     = make(map[rpcMetricKey]*histogram)
+	rpcErrors      = make(map[rpcMetricKey]uint64)
+	rpcMetricsLock sync.Mutex
+)
+
+// observeRPC 记录一次 RPC 请求的耗时和结果
+func observeRPC(chain, endpoint, method string, duration time.Duration, err error) {
+	key := rpcMetricKey{chain: chain, endpoint: endpoint, method: method}
+
+	rpcMetricsLock.Lock()
+	defer rpcMetricsLock.Unlock()
+
+	h, ok := rpcLatency[key]
+	if !ok {
+		h = newHistogram(rpcLatencyBuckets)
+		rpcLatency[key] = h
+	}
+	h.observe(duration.Seconds())
+	if err != nil {
+		rpcErrors[key]++
+	}
+}
+
+// chainPair 跨链方向，from 为先记录的一边
+type chainPair struct {
+	from string
+	to   string
+}
+
+var (
+	settlementLatency     = make(map[chainPair]*histogram)
+	settlementLatencyLock sync.Mutex
+)
+
+// observeSettlement 记录一次跨链完成的耗时，即第二边被观测到的时间减去 reqID 中的创建时间
+// 节点时钟偏差可能导致耗时为负，按 0 记录
+func observeSettlement(chainA, chainB string, createdTime int64, completedAt time.Time) {
+	seconds := completedAt.Sub(time.Unix(createdTime, 0)).Seconds()
+	if seconds < 0 {
+		seconds = 0
+	}
+	key := chainPair{from: chainA, to: chainB}
+
+	settlementLatencyLock.Lock()
+	defer settlementLatencyLock.Unlock()
+
+	h, ok := settlementLatency[key]
+	if !ok {
+		h = newHistogram(settlementLatencyBuckets)
+		settlementLatency[key] = h
+	}
+	h.observe(seconds)
+}
+
+var (
+	alertCounts     = make(map[AlertKind]uint64)
+	alertCountsLock sync.Mutex
+)
+
+// observeAlert 记录一次按类型区分的告警
+func observeAlert(kind AlertKind) {
+	alertCountsLock.Lock()
+	defer alertCountsLock.Unlock()
+	alertCounts[kind]++
+}
+
+var (
+	// pendingMesons 只记录了一边的跨链数量，由 runDatabaseCheck 每个检查周期更新，未统计过时 pendingMesonsKnown 为 false
+	pendingMesons      int64
+	pendingMesonsKnown bool
+	pendingMesonsLock  sync.Mutex
+)
+
+// updatePendingMetric 查询只记录了一边的跨链数量，查询失败时保留上次的值
+func updatePendingMetric(db database.Store) {
+	count, err := db.CountPendingMesons()
+	if err != nil {
+		return
+	}
+	pendingMesonsLock.Lock()
+	defer pendingMesonsLock.Unlock()
+	pendingMesons = count
+	pendingMesonsKnown = true
+}
+
+// endpointLabel 只保留 RPC 地址的协议和主机，避免把路径或参数中的 API key 暴露在指标里
+func endpointLabel(rpcUrl string) string {
+	u, err := url.Parse(rpcUrl)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// handleMetrics 处理 GET /metrics，以 Prometheus 文本格式输出指标
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w)
+	writeAlertMetrics(w)
+	writeCompletedMetrics(w)
+	writePendingMetrics(w)
+	writeSettlementMetrics(w)
+	writeChainMetrics(w)
+	writeCatchUpMetrics(w)
+}
+
+// writeSettlementMetrics 输出按链对区分的跨链完成耗时直方图
+func writeSettlementMetrics(w io.Writer) {
+	settlementLatencyLock.Lock()
+	defer settlementLatencyLock.Unlock()
+
+	keys := make([]chainPair, 0, len(settlementLatency))
+	for key := range settlementLatency {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].from != keys[j].from {
+			return keys[i].from < keys[j].from
+		}
+		return keys[i].to < keys[j].to
+	})
+
+	fmt.Fprintln(w, "# HELP bridge_settlement_duration_seconds Time from reqID creation until the second leg was observed, by chain pair.")
+	fmt.Fprintln(w, "# TYPE bridge_settlement_duration_seconds histogram")
+	for _, key := range keys {
+		h := settlementLatency[key]
+		labels := fmt.Sprintf("from=%q,to=%q", key.from, key.to)
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "bridge_settlement_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "bridge_settlement_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "bridge_settlement_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(w, "bridge_settlement_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+}
+
+// writeAlertMetrics 输出按告警类型区分的告警次数
+func writeAlertMetrics(w io.Writer) {
+	alertCountsLock.Lock()
+	defer alertCountsLock.Unlock()
+
+	kinds := make([]AlertKind, 0, len(alertCounts))
+	for kind := range alertCounts {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	if queue := alerts.Load(); queue != nil {
+		fmt.Fprintln(w, "# HELP bridge_alerts_dropped_total Alerts dropped because the alert queue was full.")
+		fmt.Fprintln(w, "# TYPE bridge_alerts_dropped_total counter")
+		fmt.Fprintf(w, "bridge_alerts_dropped_total %d\n", queue.dropped.Load())
+		fmt.Fprintln(w, "# HELP bridge_alert_queue_length Alerts waiting to be sent.")
+		fmt.Fprintln(w, "# TYPE bridge_alert_queue_length gauge")
+		fmt.Fprintf(w, "bridge_alert_queue_length %d\n", len(queue.alerts))
+	}
+
+	if limiter := alertLimiter.Load(); limiter != nil {
+		fmt.Fprintln(w, "# HELP bridge_alerts_suppressed_total Alerts suppressed by the alert rate limit.")
+		fmt.Fprintln(w, "# TYPE bridge_alerts_suppressed_total counter")
+		fmt.Fprintf(w, "bridge_alerts_suppressed_total %d\n", limiter.suppressedTotal())
+	}
+
+	fmt.Fprintln(w, "# HELP bridge_alerts_total Alerts raised by kind.")
+	fmt.Fprintln(w, "# TYPE bridge_alerts_total counter")
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "bridge_alerts_total{kind=%q} %d\n", kind, alertCounts[kind])
+	}
+}
+
+// writeCompletedMetrics 输出数据库中记录的跨链完成数量，查询失败时跳过
+func writeCompletedMetrics(w io.Writer) {
+	total, err := database.CountCompletedMesons(0, 0)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	lastDay, err := database.CountCompletedMesons(now.Add(-24*time.Hour).Unix(), 0)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintln(w, "# HELP bridge_completed_crossings_total Crossings whose two legs matched.")
+	fmt.Fprintln(w, "# TYPE bridge_completed_crossings_total counter")
+	fmt.Fprintf(w, "bridge_completed_crossings_total %d\n", total)
+	fmt.Fprintln(w, "# HELP bridge_completed_crossings_24h Crossings completed in the last 24 hours.")
+	fmt.Fprintln(w, "# TYPE bridge_completed_crossings_24h gauge")
+	fmt.Fprintf(w, "bridge_completed_crossings_24h %d\n", lastDay)
+}
+
+// writePendingMetrics 输出只记录了一边的跨链数量，持续增长说明目标链的事件没有被监听到
+func writePendingMetrics(w io.Writer) {
+	pendingMesonsLock.Lock()
+	count, known := pendingMesons, pendingMesonsKnown
+	pendingMesonsLock.Unlock()
+	if !known {
+		return
+	}
+
+	fmt.Fprintln(w, "# HELP bridge_pending_crossings Crossings with one leg recorded and the other still pending.")
+	fmt.Fprintln(w, "# TYPE bridge_pending_crossings gauge")
+	fmt.Fprintf(w, "bridge_pending_crossings %d\n", count)
+}
+
+// writeMetrics 输出 RPC 耗时直方图和错误计数
+func writeMetrics(w io.Writer) {
+	rpcMetricsLock.Lock()
+	defer rpcMetricsLock.Unlock()
+
+	keys := make([]rpcMetricKey, 0, len(rpcLatency))
+	for key := range rpcLatency {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].chain != keys[j].chain {
+			return keys[i].chain < keys[j].chain
+		}
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	fmt.Fprintln(w, "# HELP bridge_rpc_request_duration_seconds RPC request latency by chain, endpoint and method.")
+	fmt.Fprintln(w, "# TYPE bridge_rpc_request_duration_seconds histogram")
+	for _, key := range keys {
+		h := rpcLatency[key]
+		labels := metricLabels(key)
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "bridge_rpc_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "bridge_rpc_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "bridge_rpc_request_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(w, "bridge_rpc_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP bridge_rpc_errors_total Failed RPC requests by chain, endpoint and method.")
+	fmt.Fprintln(w, "# TYPE bridge_rpc_errors_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "bridge_rpc_errors_total{%s} %d\n", metricLabels(key), rpcErrors[key])
+	}
+}
+
+func metricLabels(key rpcMetricKey) string {
+	return fmt.Sprintf("chain=%q,endpoint=%q,method=%q", key.chain, key.endpoint, key.method)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"meson-monitor/database"
+)
+
+// resetPendingMetric 清除单边记录数量的指标，测试结束时也清除
+func resetPendingMetric(t *testing.T) {
+	reset := func() {
+		pendingMesonsLock.Lock()
+		pendingMesons, pendingMesonsKnown = 0, false
+		pendingMesonsLock.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestPendingCrossingsGauge(t *testing.T) {
+	db := useTestDatabase(t)
+	useTestNotifier(t)
+	resetPendingMetric(t)
+
+	// 第一次检查之前不输出
+	var buf bytes.Buffer
+	writePendingMetrics(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("gauge written before the first check:\n%s", buf.String())
+	}
+
+	for _, reqID := range []string{"pending-1", "pending-2"} {
+		if _, err := database.InsertMeson(database.Meson{ReqID: reqID, ChainA: "bsc", ActionA: actionBurn, TxHashA: reqID + "-a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insertMismatchedMeson(t, "mismatched")
+	runDatabaseCheck(db, 0)
+
+	buf.Reset()
+	writePendingMetrics(&buf)
+	if !strings.Contains(buf.String(), "\nbridge_pending_crossings 2\n") {
+		t.Errorf("metrics =\n%s\nwant bridge_pending_crossings 2", buf.String())
+	}
+}
+
+// settlementCount 链对 from -> to 已记录的跨链完成次数
+func settlementCount(from, to string) uint64 {
+	settlementLatencyLock.Lock()
+	defer settlementLatencyLock.Unlock()
+	if h, ok := settlementLatency[chainPair{from: from, to: to}]; ok {
+		return h.count
+	}
+	return 0
+}
+
+func TestSettlementIsObservedOnlyAfterCommit(t *testing.T) {
+	db := useTestDatabase(t)
+	parsedABI := testABI(t)
+	reqID := testReqID(testTokenIndex, 1000000, 1700000000)
+	// 使用本测试专用的链名，不受其他测试记录的指标影响
+	from, to := "settle-a", "settle-b"
+
+	processTestLogs(t, db, &recordingNotifier{}, from, mesonLog(parsedABI, from, actionBurn, reqID, 100, 0))
+	mint := mesonLog(parsedABI, to, actionMint, reqID, 200, 0)
+
+	// 区间回滚时不记录完成耗时
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handleLogs(tx, newAlertBuffer(&recordingNotifier{}), to, testChainConfig(), parsedABI, []types.Log{mint}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	if got := settlementCount(from, to); got != 0 {
+		t.Fatalf("recorded %d settlements before the range was committed", got)
+	}
+
+	processTestLogs(t, db, &recordingNotifier{}, to, mint)
+	if got := settlementCount(from, to); got != 1 {
+		t.Errorf("recorded %d settlements after the commit, want 1", got)
+	}
+}
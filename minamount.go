@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+
+	"meson-monitor/database"
+)
+
+// 金额低于 minAmount 的跨链的处理方式
+const (
+	minAmountRecord = "record" // 正常记录，但不校验也不告警
+	minAmountSkip   = "skip"   // 不记录
+)
+
+var (
+	// minAmounts 各链的最小金额（代币单位），未配置的链不限制
+	minAmounts = map[string]*big.Rat{}
+	// minAmountAction 金额低于 minAmount 的跨链的处理方式
+	minAmountAction = minAmountRecord
+)
+
+// tokenAmountPattern 以代币单位书写的金额，如 "100" 或 "0.5"
+var tokenAmountPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// parseMinAmount 解析以代币单位书写的金额，用 big.Rat 保存，与任意小数位数的金额比较都没有舍入
+func parseMinAmount(value string) (*big.Rat, error) {
+	if !tokenAmountPattern.MatchString(value) {
+		return nil, fmt.Errorf("must be a decimal number in token units such as \"100\" or \"0.5\", got %q", value)
+	}
+	amount, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+// loadMinAmounts 读取各链的最小金额，链上配置的 minAmount 优先于 main.minAmount
+func loadMinAmounts(config *Config) (map[string]*big.Rat, error) {
+	var global *big.Rat
+	if config.Main.MinAmount != "" {
+		amount, err := parseMinAmount(config.Main.MinAmount)
+		if err != nil {
+			return nil, fmt.Errorf("main.minAmount %v", err)
+		}
+		global = amount
+	}
+
+	result := make(map[string]*big.Rat, len(config.Chains))
+	for _, chainName := range config.chainNames() {
+		chainConfig := config.Chains[chainName]
+		if chainConfig.MinAmount == "" {
+			if global != nil {
+				result[chainName] = global
+			}
+			continue
+		}
+		amount, err := parseMinAmount(chainConfig.MinAmount)
+		if err != nil {
+			return nil, fmt.Errorf("chains.%s.minAmount %v", chainName, err)
+		}
+		result[chainName] = amount
+	}
+	return result, nil
+}
+
+// belowMinAmount 判断一条链上的金额（最小单位）按代币小数位数换算后是否低于该链的最小金额，等于最小金额时不算低于
+func belowMinAmount(chainName string, tokenIndex int, amount *big.Int) bool {
+	threshold, ok := minAmounts[chainName]
+	if !ok || amount == nil {
+		return false
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(tokenDecimals(chainName, tokenIndex))), nil)
+	return new(big.Rat).SetFrac(amount, scale).Cmp(threshold) < 0
+}
+
+// crossingBelowMinAmount 判断 Meson 的每一条已记录的边是否都低于所在链的最小金额，这样的跨链不校验也不告警
+func crossingBelowMinAmount(meson database.Meson) bool {
+	if !belowMinAmount(meson.ChainA, meson.TokenIndex, meson.AmountA) {
+		return false
+	}
+	return meson.ChainB == "" || belowMinAmount(meson.ChainB, meson.TokenIndex, meson.AmountB)
+}
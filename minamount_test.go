@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"meson-monitor/database"
+)
+
+// useMinAmount 设置 bsc 和 eth 上的最小金额和处理方式，两条链的 testTokenIndex 都按 decimals 位小数换算，测试结束时恢复
+func useMinAmount(t *testing.T, minAmount string, action string, decimals uint8) {
+	t.Helper()
+	savedAmounts, savedAction, savedDecimals := minAmounts, minAmountAction, chainTokenDecimals
+	t.Cleanup(func() {
+		minAmounts, minAmountAction, chainTokenDecimals = savedAmounts, savedAction, savedDecimals
+	})
+
+	threshold, err := parseMinAmount(minAmount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minAmounts = map[string]*big.Rat{"bsc": threshold, "eth": threshold}
+	minAmountAction = action
+	chainTokenDecimals = map[string]map[uint8]uint8{
+		"bsc": {testTokenIndex: decimals},
+		"eth": {testTokenIndex: decimals},
+	}
+}
+
+func TestBelowMinAmountBoundary(t *testing.T) {
+	tests := []struct {
+		name      string
+		minAmount string
+		decimals  uint8
+		amount    string
+		want      bool
+	}{
+		{name: "exactly the threshold", minAmount: "100", decimals: 6, amount: "100000000", want: false},
+		{name: "one unit below", minAmount: "100", decimals: 6, amount: "99999999", want: true},
+		{name: "one unit above", minAmount: "100", decimals: 6, amount: "100000001", want: false},
+		{name: "fractional threshold exactly", minAmount: "100.5", decimals: 6, amount: "100500000", want: false},
+		{name: "fractional threshold one unit below", minAmount: "100.5", decimals: 6, amount: "100499999", want: true},
+		{name: "18 decimals exactly", minAmount: "100.5", decimals: 18, amount: "100500000000000000000", want: false},
+		{name: "18 decimals one unit below", minAmount: "100.5", decimals: 18, amount: "100499999999999999999", want: true},
+		{name: "threshold is the smallest unit", minAmount: "0.000001", decimals: 6, amount: "1", want: false},
+		{name: "zero below the smallest unit", minAmount: "0.000001", decimals: 6, amount: "0", want: true},
+		{name: "zero threshold", minAmount: "0", decimals: 6, amount: "0", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMinAmount(t, tt.minAmount, minAmountRecord, tt.decimals)
+			amount, _ := new(big.Int).SetString(tt.amount, 10)
+			if got := belowMinAmount("bsc", testTokenIndex, amount); got != tt.want {
+				t.Errorf("belowMinAmount(%s with %d decimals, minAmount %s) = %v, want %v", tt.amount, tt.decimals, tt.minAmount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBelowMinAmountWithoutThreshold(t *testing.T) {
+	useMinAmount(t, "100", minAmountRecord, 6)
+	if belowMinAmount("tron", testTokenIndex, big.NewInt(1)) {
+		t.Error("chain without minAmount treated as below it")
+	}
+	if belowMinAmount("bsc", testTokenIndex, nil) {
+		t.Error("nil amount treated as below minAmount")
+	}
+}
+
+func TestCrossingBelowMinAmount(t *testing.T) {
+	useMinAmount(t, "100", minAmountRecord, 6)
+	below, atThreshold := big.NewInt(99999999), big.NewInt(100000000)
+
+	tests := []struct {
+		name  string
+		meson database.Meson
+		want  bool
+	}{
+		{name: "one leg below", meson: database.Meson{ChainA: "bsc", AmountA: below, TokenIndex: testTokenIndex}, want: true},
+		{name: "one leg at threshold", meson: database.Meson{ChainA: "bsc", AmountA: atThreshold, TokenIndex: testTokenIndex}},
+		{name: "both legs below", meson: database.Meson{ChainA: "bsc", AmountA: below, ChainB: "eth", AmountB: below, TokenIndex: testTokenIndex}, want: true},
+		// 只有每一条已记录的边都低于最小金额时才不校验
+		{name: "other leg at threshold", meson: database.Meson{ChainA: "bsc", AmountA: below, ChainB: "eth", AmountB: atThreshold, TokenIndex: testTokenIndex}},
+	}
+	for _, tt := range tests {
+		if got := crossingBelowMinAmount(tt.meson); got != tt.want {
+			t.Errorf("%s: crossingBelowMinAmount = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadMinAmounts(t *testing.T) {
+	config := validTestConfig()
+	config.Main.MinAmount = "100"
+	updateChain(config, "eth", func(c *ChainConfig) { c.MinAmount = "0.5" })
+
+	amounts, err := loadMinAmounts(config)
+	if err != nil {
+		t.Fatalf("loadMinAmounts: %v", err)
+	}
+	if got := amounts["bsc"]; got == nil || got.Cmp(big.NewRat(100, 1)) != 0 {
+		t.Errorf("bsc minAmount = %v, want main.minAmount 100", got)
+	}
+	if got := amounts["eth"]; got == nil || got.Cmp(big.NewRat(1, 2)) != 0 {
+		t.Errorf("eth minAmount = %v, want the chain override 0.5", got)
+	}
+
+	for _, value := range []string{"-1", "1e3", "1,000", ".5", "abc"} {
+		config := validTestConfig()
+		config.Main.MinAmount = value
+		if _, err := loadMinAmounts(config); err == nil || !strings.Contains(err.Error(), "main.minAmount") {
+			t.Errorf("loadMinAmounts(%q) error = %v, want a main.minAmount error", value, err)
+		}
+	}
+}
+
+func TestProcessLogsAtMinAmountBoundary(t *testing.T) {
+	parsedABI := testABI(t)
+	// reqID 中的金额为 6 位小数，minAmount 100 即 100000000；burn/burn 是无效的动作组合，达到最小金额时告警
+	tests := []struct {
+		name       string
+		action     string
+		amount     uint64
+		wantAlert  bool
+		wantRecord bool
+	}{
+		{name: "record at threshold", action: minAmountRecord, amount: 100000000, wantAlert: true, wantRecord: true},
+		{name: "record below threshold", action: minAmountRecord, amount: 99999999, wantAlert: false, wantRecord: true},
+		{name: "skip at threshold", action: minAmountSkip, amount: 100000000, wantAlert: true, wantRecord: true},
+		{name: "skip below threshold", action: minAmountSkip, amount: 99999999, wantAlert: false, wantRecord: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMinAmount(t, "100", tt.action, 6)
+			db := useTestDatabase(t)
+			recorder := &recordingNotifier{}
+			reqID := testReqID(testTokenIndex, tt.amount, 1700000000)
+
+			processTestLogs(t, db, recorder, "bsc", mesonLog(parsedABI, "bsc", actionBurn, reqID, 100, 0))
+			processTestLogs(t, db, recorder, "eth", mesonLog(parsedABI, "eth", actionBurn, reqID, 200, 0))
+
+			kinds := recorder.Kinds()
+			if gotAlert := len(kinds) == 1 && kinds[0] == AlertInvalidActionPair; gotAlert != tt.wantAlert || (!tt.wantAlert && len(kinds) != 0) {
+				t.Errorf("alerts = %v, want alert %v", kinds, tt.wantAlert)
+			}
+			if !tt.wantRecord {
+				assertNotRecorded(t, reqID)
+				return
+			}
+			if meson := findTestMeson(t, reqID.Hex()); meson.ChainB != "eth" {
+				t.Errorf("second leg not recorded: %+v", *meson)
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/bot"
+	"meson-monitor/database"
+)
+
+// AlertKind 告警类型，决定告警的标题、emoji 和颜色
+type AlertKind string
+
+const (
+	AlertAmountMismatch      AlertKind = "amount_mismatch"      // 两侧金额不一致
+	AlertInvalidActionPair   AlertKind = "invalid_action_pair"  // 两侧动作不是一个 burn 一个 mint
+	AlertMissingLeg          AlertKind = "missing_leg"          // 记录缺少另一边
+	AlertTimeout             AlertKind = "timeout"              // 只有单边记录，另一边超时未出现
+	AlertDuplicateLeg        AlertKind = "duplicate_leg"        // 同一个 reqID 出现多余的一边
+	AlertReorg               AlertKind = "reorg"                // 已记录的交易被回滚
+	AlertSuppressed          AlertKind = "suppressed"           // 限流期间被抑制的告警汇总
+	AlertZeroAmount          AlertKind = "zero_amount"          // reqID 中的金额为零
+	AlertChainStalled        AlertKind = "chain_stalled"        // 链的监听长时间没有推进区块进度
+	AlertProgressNotSaved    AlertKind = "progress_not_saved"   // 区块进度保存失败，同一区间会被反复处理
+	AlertChainStartupFailed  AlertKind = "chain_startup_failed" // 链启动后超过期限仍未连接成功
+	AlertTokenIndexMismatch  AlertKind = "token_index_mismatch" // 两侧解析出的 token index 不一致
+	AlertInternalError       AlertKind = "internal_error"       // 监控程序自身记录了 error 级别的日志
+	AlertUnexpectedRecipient AlertKind = "unexpected_recipient" // mint 的接收地址不在链的白名单中
+)
+
+// alertStyle 告警类型的展示样式，LarkColor 为飞书卡片标题的模板颜色，SlackColor 为 Slack 附件左侧的颜色
+type alertStyle struct {
+	Title      string
+	Emoji      string
+	LarkColor  string
+	SlackColor string
+}
+
+// alertStyles 各告警类型的展示样式
+var alertStyles = map[AlertKind]alertStyle{
+	AlertAmountMismatch:      {Title: "Bridge amount mismatch", Emoji: "❗️", LarkColor: "red", SlackColor: "#E01E5A"},
+	AlertInvalidActionPair:   {Title: "Invalid bridge action pair", Emoji: "⛔️", LarkColor: "carmine", SlackColor: "#8B0000"},
+	AlertMissingLeg:          {Title: "Bridge leg missing", Emoji: "❓", LarkColor: "orange", SlackColor: "#FF8C00"},
+	AlertTimeout:             {Title: "Bridge leg timed out", Emoji: "⏰", LarkColor: "yellow", SlackColor: "#ECB22E"},
+	AlertDuplicateLeg:        {Title: "Duplicate bridge leg", Emoji: "⚠️", LarkColor: "violet", SlackColor: "#7B3FE4"},
+	AlertReorg:               {Title: "Bridge tx reorged", Emoji: "🔄", LarkColor: "purple", SlackColor: "#4A154B"},
+	AlertSuppressed:          {Title: "Alerts suppressed", Emoji: "🔕", LarkColor: "grey", SlackColor: "#868686"},
+	AlertZeroAmount:          {Title: "Zero-amount bridge event", Emoji: "0️⃣", LarkColor: "yellow", SlackColor: "#ECB22E"},
+	AlertChainStalled:        {Title: "Chain listener stalled", Emoji: "🐢", LarkColor: "orange", SlackColor: "#FF8C00"},
+	AlertProgressNotSaved:    {Title: "Block progress not saved", Emoji: "💾", LarkColor: "red", SlackColor: "#E01E5A"},
+	AlertChainStartupFailed:  {Title: "Chain listener failed to start", Emoji: "🔌", LarkColor: "red", SlackColor: "#E01E5A"},
+	AlertTokenIndexMismatch:  {Title: "Bridge token index mismatch", Emoji: "🪙", LarkColor: "carmine", SlackColor: "#8B0000"},
+	AlertInternalError:       {Title: "Monitor internal error", Emoji: "🛠️", LarkColor: "grey", SlackColor: "#868686"},
+	AlertUnexpectedRecipient: {Title: "Unexpected bridge recipient", Emoji: "🚨", LarkColor: "red", SlackColor: "#E01E5A"},
+}
+
+// AlertLeg 告警中的一条跨链记录，Label 为展示时的名称，如 From、To
+type AlertLeg struct {
+	Label  string
+	Chain  string
+	Action string
+	Amount *big.Int
+	// Decimals 该链代币的小数位数，Amount 为最小单位的整数，展示时按小数位数换算
+	Decimals uint8
+	TxHash   string
+	// Address 事件中的地址，Burn 为 proposer，Mint 为 recipient，为空时不展示
+	Address string
+}
+
+// Alert 结构化的告警内容，由各 Notifier 按各自渠道的格式发送
+type Alert struct {
+	Kind      AlertKind
+	ReqID     string
+	Timestamp int64
+	Legs      []AlertLeg
+	Note      string // 附加说明，为空时不展示
+	// Chain 没有跨链记录的链级告警（如监听停滞）涉及的链，与 Legs 中的链一起决定告警路由
+	Chain string
+}
+
+// FromMeson 根据 Meson 记录构建告警，类型由 classifyMeson 判断，burn 一侧为 From，mint 一侧为 To
+func FromMeson(m database.Meson) Alert {
+	legA := AlertLeg{Chain: m.ChainA, Action: displayAction(m.ActionA), Amount: m.AmountA, Decimals: tokenDecimals(m.ChainA, m.TokenIndex), TxHash: m.TxHashA, Address: m.AddressA}
+	legB := AlertLeg{Chain: m.ChainB, Action: displayAction(m.ActionB), Amount: m.AmountB, Decimals: tokenDecimals(m.ChainB, m.TokenIndex), TxHash: m.TxHashB, Address: m.AddressB}
+	if m.ActionA != actionBurn && m.ActionB == actionBurn {
+		legA, legB = legB, legA
+	}
+	legA.Label, legB.Label = "From", "To"
+
+	alert := Alert{
+		Kind:      classifyMeson(m),
+		ReqID:     m.ReqID,
+		Timestamp: m.Timestamp,
+		Legs:      []AlertLeg{legA, legB},
+	}
+	switch alert.Kind {
+	case AlertAmountMismatch:
+		alert.Note = "Delta: " + formatDelta(m.AmountA, m.AmountB, tokenDecimals(m.ChainA, m.TokenIndex))
+	case AlertTokenIndexMismatch:
+		alert.Note = fmt.Sprintf("Token index: %d on %s, %d on %s", m.TokenIndex, m.ChainA, *m.TokenIndexB, m.ChainB)
+	}
+	return alert
+}
+
+// classifyMeson 判断 Meson 记录的异常类型：缺少一边、动作组合无效、token index 不一致或金额不一致
+func classifyMeson(m database.Meson) AlertKind {
+	switch {
+	case m.ChainA == "" || m.ChainB == "":
+		return AlertMissingLeg
+	case !meson_event(m.ActionA, m.ActionB):
+		return AlertInvalidActionPair
+	case !tokenIndexMatches(m):
+		return AlertTokenIndexMismatch
+	default:
+		return AlertAmountMismatch
+	}
+}
+
+// tokenIndexMatches 判断两侧解析出的 token index 是否一致，B 边尚未记录或在加列之前记录时视为一致
+func tokenIndexMatches(m database.Meson) bool {
+	return m.TokenIndexB == nil || *m.TokenIndexB == m.TokenIndex
+}
+
+// displayAction 将事件名称转换为告警中展示的动作
+func displayAction(eventName string) string {
+	switch eventName {
+	case actionBurn:
+		return "Burn"
+	case actionMint:
+		return "Mint"
+	default:
+		return eventName
+	}
+}
+
+// AmountText 按代币小数位数展示的金额
+func (l AlertLeg) AmountText() string {
+	return formatTokenAmount(l.Amount, l.Decimals)
+}
+
+// ExplorerURL 交易在区块浏览器中的链接，链未配置 explorerTxUrl 时为空
+func (l AlertLeg) ExplorerURL() string {
+	return explorerTxURL(l.Chain, l.TxHash)
+}
+
+// AddressLabel 地址的展示名称，Burn 为 Proposer，Mint 为 Recipient
+func (l AlertLeg) AddressLabel() string {
+	switch l.Action {
+	case "Burn":
+		return "Proposer"
+	case "Mint":
+		return "Recipient"
+	default:
+		return "Address"
+	}
+}
+
+func (a Alert) style() alertStyle {
+	if style, ok := alertStyles[a.Kind]; ok {
+		return style
+	}
+	return alertStyle{Title: string(a.Kind), Emoji: "❗️", LarkColor: "red", SlackColor: "#E01E5A"}
+}
+
+// Title 告警标题，两侧带上告警类型对应的 emoji
+func (a Alert) Title() string {
+	style := a.style()
+	return fmt.Sprintf("*****%s%s%s%s%s*****", style.Emoji, style.Emoji, style.Title, style.Emoji, style.Emoji)
+}
+
+// Time 按 displayTimezone 格式化的告警时间
+func (a Alert) Time() string {
+	return formatDisplayTime(time.Unix(a.Timestamp, 0))
+}
+
+// Notifier 告警渠道，负责把 Alert 格式化并发送到对应的机器人
+// 发送失败时由实现自行保存失败记录等待重新发送，并返回错误
+type Notifier interface {
+	Name() string
+	Notify(alert Alert) error
+}
+
+// notifiers 根据配置启用的告警渠道
+var notifiers []Notifier
+
+// buildNotifiers 根据配置创建已启用的告警渠道
+func buildNotifiers(config *Config) []Notifier {
+	var result []Notifier
+	if config.Main.BotToken != "" && len(config.Main.ChatIDs) > 0 {
+		result = append(result, telegramNotifier{})
+	}
+	if config.Main.LarkBotURL != "" {
+		result = append(result, larkNotifier{})
+	}
+	if config.Main.SlackBotURL != "" {
+		result = append(result, slackNotifier{})
+	}
+	if config.Main.WebhookURL != "" {
+		result = append(result, webhookNotifier{})
+	}
+	if config.Main.PagerDutyRoutingKey != "" {
+		result = append(result, pagerDutyNotifier{})
+	}
+	return result
+}
+
+// notify 将告警发送到 notifiersFor 选出的 Notifier，某个渠道失败不影响其他渠道，返回的错误中列出所有失败的渠道
+func notify(alert Alert) error {
+	var failed []string
+	for _, notifier := range notifiersFor(alert) {
+		err := notifier.Notify(alert)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", notifier.Name(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to notify %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// alertFanout 将告警计数后按告警路由发送到已配置的渠道，是处理事件时默认使用的 Notifier
+// 启用限流时超出速率的告警不发送，之后合并为一条汇总
+type alertFanout struct{}
+
+func (alertFanout) Name() string {
+	return "all"
+}
+
+func (alertFanout) Notify(alert Alert) error {
+	observeAlert(alert.Kind)
+	if limiter := alertLimiter.Load(); limiter != nil {
+		ok, suppressed := limiter.allow(time.Now())
+		if suppressed > 0 {
+			sendSuppressedSummary(suppressed)
+		}
+		if !ok {
+			logrus.Warnf("Alert rate limit reached, suppressed %s alert for ReqID %s", alert.Kind, alert.ReqID)
+			return nil
+		}
+	}
+	return notify(alert)
+}
+
+// telegramNotifier 通过 telegramBot 发送告警，正文由 alertTemplates.telegram 渲染
+// route 不为空时发送到该告警路由的 chat，否则发送到 main.chatIDs
+type telegramNotifier struct {
+	route string
+}
+
+func (n telegramNotifier) Name() string {
+	return deliveryName(channelTelegram, n.route)
+}
+
+func (n telegramNotifier) Notify(alert Alert) error {
+	message, err := renderTemplate(alertTemplates.telegram, alert)
+	if err != nil {
+		logrus.Errorf("Failed to render Telegram message: %v", err)
+		return err
+	}
+	return sendTelegramRouted(n.route, message, telegramParseMode, telegramKeyboard(alert))
+}
+
+// larkNotifier 通过 larkBot 发送告警，卡片正文由 alertTemplates.lark 渲染
+// route 不为空时使用该告警路由的 Lark 机器人
+type larkNotifier struct {
+	route string
+}
+
+func (n larkNotifier) Name() string {
+	return deliveryName(channelLark, n.route)
+}
+
+func (n larkNotifier) Notify(alert Alert) error {
+	content, err := renderTemplate(alertTemplates.lark, alert)
+	if err != nil {
+		logrus.Errorf("Failed to render Lark message: %v", err)
+		return err
+	}
+	return sendLarkCardRouted(n.route, alert.Title(), alert.style().LarkColor, content)
+}
+
+// slackNotifier 通过 slackBot 发送告警，附件颜色由告警类型决定
+// route 不为空时使用该告警路由的 Slack 机器人
+type slackNotifier struct {
+	route string
+}
+
+func (n slackNotifier) Name() string {
+	return deliveryName(channelSlack, n.route)
+}
+
+func (n slackNotifier) Notify(alert Alert) error {
+	var fields []bot.SlackField
+	if alert.ReqID != "" {
+		fields = append(fields, bot.SlackField{Name: "ReqID", Value: alert.ReqID})
+	}
+	for _, leg := range alert.Legs {
+		fields = append(fields, bot.SlackField{
+			Name:  leg.Label,
+			Value: fmt.Sprintf("%s *%s* [%s]", leg.Chain, leg.Action, leg.AmountText()),
+		})
+	}
+	for _, leg := range alert.Legs {
+		fields = append(fields, bot.SlackField{Name: fmt.Sprintf("Tx hash (%s)", leg.Label), Value: leg.TxHash})
+	}
+	for _, leg := range alert.Legs {
+		if leg.Address != "" {
+			fields = append(fields, bot.SlackField{Name: fmt.Sprintf("%s (%s)", leg.AddressLabel(), leg.Label), Value: leg.Address})
+		}
+	}
+	if alert.Note != "" {
+		fields = append(fields, bot.SlackField{Name: "Note", Value: alert.Note})
+	}
+	return sendSlackFieldsRouted(n.route, alert.Title(), alert.Time(), fields, alert.style().SlackColor)
+}
+
+// webhookAlert Alert 发送到 Webhook 时的 JSON 结构，也是 webhookTemplate 渲染时的数据
+// 金额以最小单位的十进制字符串表示，避免接收方解析大整数时丢失精度
+type webhookAlert struct {
+	Kind      AlertKind    `json:"kind"`
+	Title     string       `json:"title"`
+	ReqID     string       `json:"reqId,omitempty"`
+	Timestamp int64        `json:"timestamp"`
+	Time      string       `json:"time"`
+	Legs      []webhookLeg `json:"legs"`
+	Note      string       `json:"note,omitempty"`
+}
+
+type webhookLeg struct {
+	Label  string `json:"label"`
+	Chain  string `json:"chain"`
+	Action string `json:"action"`
+	Amount string `json:"amount"` // 最小单位的整数
+	// Decimals 代币的小数位数，按代币单位展示时 amount 需除以 10^decimals
+	Decimals uint8  `json:"decimals"`
+	TxHash   string `json:"txHash"`
+	Address  string `json:"address,omitempty"`
+}
+
+func newWebhookAlert(alert Alert) webhookAlert {
+	legs := make([]webhookLeg, 0, len(alert.Legs))
+	for _, leg := range alert.Legs {
+		legs = append(legs, webhookLeg{
+			Label:    leg.Label,
+			Chain:    leg.Chain,
+			Action:   leg.Action,
+			Amount:   amountOrZero(leg.Amount).String(),
+			Decimals: leg.Decimals,
+			TxHash:   leg.TxHash,
+			Address:  leg.Address,
+		})
+	}
+	return webhookAlert{
+		Kind:      alert.Kind,
+		Title:     alert.style().Title,
+		ReqID:     alert.ReqID,
+		Timestamp: alert.Timestamp,
+		Time:      alert.Time(),
+		Legs:      legs,
+		Note:      alert.Note,
+	}
+}
+
+// webhookNotifier 通过 webhookBot 以 JSON 发送结构化的告警
+type webhookNotifier struct{}
+
+func (webhookNotifier) Name() string {
+	return channelWebhook
+}
+
+func (webhookNotifier) Notify(alert Alert) error {
+	return sendWebhook(newWebhookAlert(alert))
+}
+
+// pagerDutySeverities 会触发 PagerDuty incident 的告警类型及其 severity，其他类型只发送到聊天渠道
+// 另一边超时未出现是缺少一边最常见的情况，与 AlertMissingLeg 一样触发
+var pagerDutySeverities = map[AlertKind]string{
+	AlertAmountMismatch:      bot.PagerDutyCritical,
+	AlertMissingLeg:          bot.PagerDutyError,
+	AlertTimeout:             bot.PagerDutyError,
+	AlertUnexpectedRecipient: bot.PagerDutyCritical,
+}
+
+// pagerDutyDedupKey 告警对应的 incident 的 dedup_key，一般为 reqID
+// 接收地址异常使用单独的 incident，跨链完成时自动 resolve 的 incident 不包括它
+func pagerDutyDedupKey(alert Alert) string {
+	if alert.Kind == AlertUnexpectedRecipient {
+		return alert.ReqID + ":recipient"
+	}
+	return alert.ReqID
+}
+
+// pagerDutyNotifier 通过 pagerDutyBot 为需要值班处理的告警触发 incident，dedup_key 为 reqID
+type pagerDutyNotifier struct{}
+
+func (pagerDutyNotifier) Name() string {
+	return channelPagerDuty
+}
+
+func (pagerDutyNotifier) Notify(alert Alert) error {
+	severity, ok := pagerDutySeverities[alert.Kind]
+	if !ok || alert.ReqID == "" {
+		return nil
+	}
+
+	parts := []string{alert.style().Title}
+	for _, leg := range alert.Legs {
+		parts = append(parts, fmt.Sprintf("%s: %s %s %s", leg.Label, leg.Chain, leg.Action, leg.AmountText()))
+	}
+	if alert.Note != "" {
+		parts = append(parts, alert.Note)
+	}
+	return sendPagerDuty(bot.PagerDutyEvent{
+		DedupKey:      pagerDutyDedupKey(alert),
+		Summary:       strings.Join(parts, "; ") + " (ReqID " + alert.ReqID + ")",
+		Source:        "bridge_monitor",
+		Severity:      severity,
+		CustomDetails: newWebhookAlert(alert),
+	})
+}
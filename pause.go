@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// chainControl 单条链监听的暂停状态，用于 RPC 节点维护期间临时停止该链的监听
+// 暂停时取消当前一次监听，未提交的区块区间回滚，恢复后从保存的区块进度继续
+type chainControl struct {
+	chainName string
+
+	mu      sync.Mutex
+	paused  bool
+	since   time.Time          // 暂停开始的时间
+	resumed chan struct{}      // 暂停期间有效，恢复时关闭
+	cancel  context.CancelFunc // 当前一次监听的 cancel
+}
+
+var (
+	chainControls     = make(map[string]*chainControl)
+	chainControlsLock sync.Mutex
+)
+
+// registerChainControl 注册链的暂停控制，监听协程启动时调用
+func registerChainControl(chainName string) *chainControl {
+	chainControlsLock.Lock()
+	defer chainControlsLock.Unlock()
+
+	control, ok := chainControls[chainName]
+	if !ok {
+		control = &chainControl{chainName: chainName}
+		chainControls[chainName] = control
+	}
+	return control
+}
+
+// lookupChainControl 返回链的暂停控制，链未在监听时返回 false
+func lookupChainControl(chainName string) (*chainControl, bool) {
+	chainControlsLock.Lock()
+	defer chainControlsLock.Unlock()
+	control, ok := chainControls[chainName]
+	return control, ok
+}
+
+// chainControlList 返回按链名称排序的所有暂停控制
+func chainControlList() []*chainControl {
+	chainControlsLock.Lock()
+	defer chainControlsLock.Unlock()
+
+	controls := make([]*chainControl, 0, len(chainControls))
+	for _, control := range chainControls {
+		controls = append(controls, control)
+	}
+	sort.Slice(controls, func(i, j int) bool { return controls[i].chainName < controls[j].chainName })
+	return controls
+}
+
+// attach 记录当前一次监听的 cancel，已暂停时立即取消
+func (c *chainControl) attach(cancel context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancel = cancel
+	if c.paused {
+		cancel()
+	}
+}
+
+// waitIfPaused 暂停期间阻塞，直到恢复或 ctx 取消
+func (c *chainControl) waitIfPaused(ctx context.Context) {
+	c.mu.Lock()
+	resumed := c.resumed
+	c.mu.Unlock()
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// pause 暂停监听并取消当前一次监听，已经暂停时返回 false
+func (c *chainControl) pause() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return false
+	}
+	c.paused = true
+	c.since = time.Now()
+	c.resumed = make(chan struct{})
+	if c.cancel != nil {
+		c.cancel()
+	}
+	logrus.Warnf("Listener for chain %s paused", c.chainName)
+	return true
+}
+
+// resume 恢复监听，未暂停时返回 false
+func (c *chainControl) resume() bool {
+	c.mu.Lock()
+	if !c.paused {
+		c.mu.Unlock()
+		return false
+	}
+	c.paused = false
+	close(c.resumed)
+	c.resumed = nil
+	since := c.since
+	c.mu.Unlock()
+
+	// 暂停期间没有进度是预期的，恢复时重新开始计算停滞时间
+	// 在释放 c.mu 之后调用，watchdog 持有 chainProgressLock 时会查询暂停状态
+	markChainResumed(c.chainName)
+	logrus.Infof("Listener for chain %s resumed after %s", c.chainName, time.Since(since).Truncate(time.Second))
+	return true
+}
+
+// state 返回是否暂停以及暂停开始的时间
+func (c *chainControl) state() (bool, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused, c.since
+}
+
+// isChainPaused 判断链的监听是否已暂停
+func isChainPaused(chainName string) bool {
+	control, ok := lookupChainControl(chainName)
+	if !ok {
+		return false
+	}
+	paused, _ := control.state()
+	return paused
+}
+
+// sleepContext 等待 d 或 ctx 被取消，使暂停和退出不必等到长时间的等待结束
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
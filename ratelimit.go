@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// suppressedFlushInterval 检查是否可以发送被抑制告警汇总的间隔
+const suppressedFlushInterval = 10 * time.Second
+
+// rateLimiter 所有告警渠道共用的令牌桶，每分钟补充 perMinute 个令牌，最多积累 perMinute 个
+// 令牌用完时告警被抑制，有令牌后合并为一条 "N additional anomalies suppressed" 汇总发送
+type rateLimiter struct {
+	mu         sync.Mutex
+	capacity   float64
+	tokens     float64
+	perSecond  float64
+	last       time.Time
+	suppressed int    // 等待汇总发送的被抑制告警数
+	total      uint64 // 累计被抑制的告警数
+}
+
+// alertLimiter 告警限流，未配置 alertsPerMinute 时为 nil，不限流
+var alertLimiter atomic.Pointer[rateLimiter]
+
+func newRateLimiter(perMinute int, now time.Time) *rateLimiter {
+	return &rateLimiter{
+		capacity:  float64(perMinute),
+		tokens:    float64(perMinute),
+		perSecond: float64(perMinute) / 60,
+		last:      now,
+	}
+}
+
+// refill 按经过的时间补充令牌，调用方需持有锁
+func (l *rateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	if elapsed > 0 {
+		l.tokens += elapsed * l.perSecond
+		if l.tokens > l.capacity {
+			l.tokens = l.capacity
+		}
+	}
+	l.last = now
+}
+
+// takeSuppressed 有令牌时取出等待汇总的被抑制告警数并消耗一个令牌，调用方需持有锁
+func (l *rateLimiter) takeSuppressed() int {
+	if l.suppressed == 0 || l.tokens < 1 {
+		return 0
+	}
+	l.tokens--
+	n := l.suppressed
+	l.suppressed = 0
+	return n
+}
+
+// allow 为一条告警取令牌，取不到时计入被抑制的告警
+// 第二个返回值为需要先发送汇总的被抑制告警数，为 0 时不需要发送汇总
+func (l *rateLimiter) allow(now time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(now)
+	suppressed := l.takeSuppressed()
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, suppressed
+	}
+	l.suppressed++
+	l.total++
+	return false, suppressed
+}
+
+// flush 有令牌时返回等待汇总的被抑制告警数，用于没有新告警时也能及时发送汇总
+func (l *rateLimiter) flush(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(now)
+	return l.takeSuppressed()
+}
+
+// suppressedTotal 返回累计被抑制的告警数
+func (l *rateLimiter) suppressedTotal() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// startAlertLimiter 启用告警限流，并定期发送被抑制告警的汇总，ctx 取消后停止发送汇总
+// 返回的函数停止汇总协程并关闭限流
+func startAlertLimiter(ctx context.Context, perMinute int) func() {
+	limiter := newRateLimiter(perMinute, time.Now())
+	alertLimiter.Store(limiter)
+	logrus.Infof("Alert rate limit: %d per minute", perMinute)
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(suppressedFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if n := limiter.flush(now); n > 0 {
+					sendSuppressedSummary(n)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		alertLimiter.CompareAndSwap(limiter, nil)
+	}
+}
+
+// sendSuppressedSummary 发送被抑制告警的汇总，汇总本身不经过限流
+func sendSuppressedSummary(n int) {
+	err := notify(Alert{
+		Kind:      AlertSuppressed,
+		Timestamp: time.Now().Unix(),
+		Note:      fmt.Sprintf("%d additional anomalies suppressed by the alert rate limit", n),
+	})
+	if err != nil {
+		logrus.Errorf("Failed to deliver suppressed alert summary: %v", err)
+	}
+}
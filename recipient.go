@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+)
+
+// chainRecipientAllowlists 各链允许的 mint 接收地址，未配置 recipientAllowlist 的链不在其中，不检查
+var chainRecipientAllowlists = map[string]map[common.Address]bool{}
+
+// loadRecipientAllowlists 从链配置中读取允许的 mint 接收地址
+func loadRecipientAllowlists(chains map[string]ChainConfig) map[string]map[common.Address]bool {
+	result := make(map[string]map[common.Address]bool, len(chains))
+	for chainName, chainConfig := range chains {
+		if len(chainConfig.RecipientAllowlist) == 0 {
+			continue
+		}
+		allowed := make(map[common.Address]bool, len(chainConfig.RecipientAllowlist))
+		for _, address := range chainConfig.RecipientAllowlist {
+			allowed[common.HexToAddress(address)] = true
+		}
+		result[chainName] = allowed
+	}
+	return result
+}
+
+// recipientAllowed 判断 mint 的接收地址是否在链的白名单中，链未配置白名单时都视为允许
+func recipientAllowed(chainName, recipient string) bool {
+	allowed, ok := chainRecipientAllowlists[chainName]
+	if !ok {
+		return true
+	}
+	return allowed[common.HexToAddress(recipient)]
+}
+
+// checkRecipient 检查新记录的 mint 事件的接收地址，不在白名单中时发送告警
+// 与金额校验无关，两边金额一致时也告警，接收地址异常可能意味着跨链路径被篡改
+func checkRecipient(notifier Notifier, reqID, chainName, eventName string, tokenIndex uint8, createdTime int64, amount *big.Int, txHash, recipient string) {
+	if eventName != actionMint || recipientAllowed(chainName, recipient) {
+		return
+	}
+
+	logrus.Errorf("Unexpected recipient %s for ReqID %s on chain %s (tx %s)", recipient, reqID, chainName, txHash)
+	sendAlertTo(notifier, Alert{
+		Kind:      AlertUnexpectedRecipient,
+		ReqID:     reqID,
+		Timestamp: createdTime,
+		Legs: []AlertLeg{
+			{Label: "Mint", Chain: chainName, Action: displayAction(eventName), Amount: amount, Decimals: tokenDecimals(chainName, int(tokenIndex)), TxHash: txHash, Address: recipient},
+		},
+		Note: fmt.Sprintf("Recipient %s is not in the recipientAllowlist of chain %s", recipient, chainName),
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+)
+
+const (
+	reorgCheckInterval = 10 * time.Minute // 检查已记录交易是否被回滚的间隔
+	reorgCheckWindow   = 24 * time.Hour   // 只检查最近这段时间内创建的 Meson
+)
+
+// recordedLeg Meson 在某条链上记录的一边，blockHash 为记录时所在区块的哈希，加列之前的旧记录为空
+type recordedLeg struct {
+	txHash    string
+	block     uint64
+	blockHash string
+}
+
+// legOnChain 返回 Meson 在 chainName 上记录的一边
+func legOnChain(meson database.Meson, chainName string) recordedLeg {
+	if meson.ChainA != chainName {
+		return recordedLeg{txHash: meson.TxHashB, block: meson.BlockB, blockHash: meson.BlockHashB}
+	}
+	return recordedLeg{txHash: meson.TxHashA, block: meson.BlockA, blockHash: meson.BlockHashA}
+}
+
+// verifyRecordedTxs 检查指定链上最近记录的交易是否仍然存在
+// 记录了区块哈希的一边比较链上同一高度的区块哈希，哈希变化时再查询交易回执重新判断：
+// 交易被重新打包到其他区块时更新记录的区块，查不到时说明已被回滚，标记该 Meson 并发送告警
+// 没有区块哈希的旧记录直接查询交易回执
+func verifyRecordedTxs(ctx context.Context, client *rpcClient, db database.Store, chainName string) {
+	since := time.Now().Add(-reorgCheckWindow).Unix()
+	mesons, err := db.FindRecentMesonsByChain(chainName, since)
+	if err != nil {
+		logrus.Errorf("Failed to find recent Mesons for chain %s: %v", chainName, err)
+		return
+	}
+
+	for _, meson := range mesons {
+		leg := legOnChain(meson, chainName)
+		if leg.blockHash != "" {
+			hash, err := client.BlockHashByNumber(ctx, leg.block)
+			if err != nil && !errors.Is(err, ethereum.NotFound) {
+				logrus.Errorf("Failed to get block %d on chain %s: %v", leg.block, chainName, err)
+				continue
+			}
+			if err == nil && hash == common.HexToHash(leg.blockHash) {
+				continue
+			}
+			logrus.Warnf("Block %d on chain %s changed since tx %s of ReqID %s was recorded", leg.block, chainName, leg.txHash, meson.ReqID)
+		}
+
+		receipt, err := client.TransactionReceipt(ctx, common.HexToHash(leg.txHash))
+		if err == nil {
+			if leg.blockHash != "" {
+				relocateLeg(db, meson, chainName, leg, receipt)
+			}
+			continue
+		}
+		if err != ethereum.NotFound {
+			logrus.Errorf("Failed to get receipt for tx %s on chain %s: %v", leg.txHash, chainName, err)
+			continue
+		}
+
+		logrus.Errorf("Transaction %s of ReqID %s no longer exists on chain %s", leg.txHash, meson.ReqID, chainName)
+		err = db.MarkMesonReorged(meson.ReqID)
+		if err != nil {
+			continue
+		}
+		constructReorgMessage(meson, chainName, leg.txHash)
+	}
+}
+
+// relocateLeg 交易在回滚后被重新打包到其他区块时，更新记录的区块号、日志序号和区块哈希
+// 事件仍然存在，跨链的校验结果不变，不发送告警
+func relocateLeg(db database.Store, meson database.Meson, chainName string, leg recordedLeg, receipt *types.Receipt) {
+	reqID := common.HexToHash(meson.ReqID)
+	for _, vLog := range receipt.Logs {
+		if !logHasTopic(vLog, reqID) {
+			continue
+		}
+		logrus.Infof("Tx %s of ReqID %s on chain %s moved from block %d to block %d", leg.txHash, meson.ReqID, chainName, leg.block, vLog.BlockNumber)
+		err := db.MoveMesonLeg(meson.ReqID, chainName, leg.txHash, vLog.BlockNumber, vLog.Index, vLog.BlockHash.Hex())
+		if err != nil {
+			logrus.Errorf("Failed to record new block of tx %s on chain %s: %v", leg.txHash, chainName, err)
+		}
+		return
+	}
+	logrus.Errorf("Tx %s of ReqID %s on chain %s was re-included without the Meson event", leg.txHash, meson.ReqID, chainName)
+	err := db.MarkMesonReorged(meson.ReqID)
+	if err != nil {
+		return
+	}
+	constructReorgMessage(meson, chainName, leg.txHash)
+}
+
+// logHasTopic 判断日志的索引参数中是否包含 topic
+func logHasTopic(vLog *types.Log, topic common.Hash) bool {
+	for _, t := range vLog.Topics[min(1, len(vLog.Topics)):] {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// reorgNote 交易被回滚告警的说明，已经校验通过的跨链单独说明配对已失效
+func reorgNote(meson database.Meson, chainName, txHash string) string {
+	if meson.IsCheck {
+		return fmt.Sprintf("Reorged: %s tx %s; this crossing was already matched and is no longer valid", chainName, txHash)
+	}
+	return fmt.Sprintf("Reorged: %s tx %s", chainName, txHash)
+}
@@ -0,0 +1,77 @@
+package reqid
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLayoutUnmarshalDefaultsToMeson(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Layout
+	}{
+		{
+			name: "empty object",
+			json: `{}`,
+			want: Meson,
+		},
+		{
+			name: "amountDecimals omitted",
+			json: `{"amount": {"offset": 120, "width": 64}, "tokenIndex": {"offset": 192, "width": 8}, "createdTime": {"offset": 208, "width": 40}}`,
+			want: Layout{Amount: Field{Offset: 120, Width: 64}, TokenIndex: Meson.TokenIndex, CreatedTime: Meson.CreatedTime, AmountDecimals: 6},
+		},
+		{
+			name: "only amountDecimals",
+			json: `{"amountDecimals": 8}`,
+			want: Layout{Amount: Meson.Amount, TokenIndex: Meson.TokenIndex, CreatedTime: Meson.CreatedTime, AmountDecimals: 8},
+		},
+		{
+			name: "explicit zero decimals",
+			json: `{"amountDecimals": 0}`,
+			want: Layout{Amount: Meson.Amount, TokenIndex: Meson.TokenIndex, CreatedTime: Meson.CreatedTime, AmountDecimals: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Layout
+			if err := json.Unmarshal([]byte(tt.json), &got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if err := got.Validate(); err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+		})
+	}
+}
+
+func TestLayoutUnmarshalPointerField(t *testing.T) {
+	var chain struct {
+		ReqIDLayout *Layout `json:"reqIDLayout"`
+	}
+	if err := json.Unmarshal([]byte(`{"reqIDLayout": {"tokenIndex": {"offset": 200, "width": 8}}}`), &chain); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if chain.ReqIDLayout == nil {
+		t.Fatal("reqIDLayout is nil")
+	}
+	if chain.ReqIDLayout.AmountDecimals != Meson.AmountDecimals || chain.ReqIDLayout.Amount != Meson.Amount {
+		t.Errorf("omitted fields not defaulted: %+v", *chain.ReqIDLayout)
+	}
+	if chain.ReqIDLayout.TokenIndex != (Field{Offset: 200, Width: 8}) {
+		t.Errorf("tokenIndex = %+v", chain.ReqIDLayout.TokenIndex)
+	}
+}
+
+func TestLayoutValidateRejectsOverlapWithDefaults(t *testing.T) {
+	var layout Layout
+	if err := json.Unmarshal([]byte(`{"tokenIndex": {"offset": 130, "width": 8}}`), &layout); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if err := layout.Validate(); err == nil {
+		t.Error("expected overlap with the default amount field to be rejected")
+	}
+}
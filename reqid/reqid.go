@@ -0,0 +1,180 @@
+package reqid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// reqID 的总位数
+const hashBits = common.HashLength * 8
+
+// ErrZeroAmount reqID 中编码的金额为零
+var ErrZeroAmount = errors.New("amount must be greater than zero")
+
+// Field reqID 中一个字段的位置，Offset 为字段最低位的位置（从最低位 0 开始），Width 为位数
+type Field struct {
+	Offset uint `json:"offset"`
+	Width  uint `json:"width"`
+}
+
+// end 字段最高位之后的位置
+func (f Field) end() uint {
+	return f.Offset + f.Width
+}
+
+// overlaps 判断两个字段的位区间是否重叠
+func (f Field) overlaps(other Field) bool {
+	return f.Offset < other.end() && other.Offset < f.end()
+}
+
+// Layout reqID 中各字段的位置，不同版本的 Meson 或其他跨链桥可以通过配置不同的 Layout 解析
+type Layout struct {
+	Amount      Field `json:"amount"`
+	TokenIndex  Field `json:"tokenIndex"`
+	CreatedTime Field `json:"createdTime"`
+	// AmountDecimals reqID 中金额使用的小数位数
+	AmountDecimals uint8 `json:"amountDecimals"`
+}
+
+// Meson 当前 Meson 合约的 reqID 布局：
+//
+//	createdTime  [208, 248) 40 位
+//	tokenIndex   [192, 200)  8 位
+//	amount       [128, 192) 64 位，固定 6 位小数
+var Meson = Layout{
+	Amount:         Field{Offset: 128, Width: 64},
+	TokenIndex:     Field{Offset: 192, Width: 8},
+	CreatedTime:    Field{Offset: 208, Width: 40},
+	AmountDecimals: 6,
+}
+
+// UnmarshalJSON 以 Meson 布局为默认值解析配置，配置中省略的字段（包括 amountDecimals）沿用 Meson 布局，
+// 避免只配置部分字段时未配置的字段被静默地当作 0
+func (l *Layout) UnmarshalJSON(data []byte) error {
+	type plain Layout
+	layout := plain(Meson)
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return err
+	}
+	*l = Layout(layout)
+	return nil
+}
+
+// Validate 检查各字段的位置：位数不为 0 且不超过对应的类型，不超出 256 位，字段之间不重叠
+func (l Layout) Validate() error {
+	fields := []struct {
+		name     string
+		field    Field
+		maxWidth uint
+	}{
+		{"amount", l.Amount, 64},
+		{"tokenIndex", l.TokenIndex, 8},
+		{"createdTime", l.CreatedTime, 64},
+	}
+	for i, f := range fields {
+		if f.field.Width == 0 || f.field.Width > f.maxWidth {
+			return fmt.Errorf("%s.width must be between 1 and %d, got %d", f.name, f.maxWidth, f.field.Width)
+		}
+		if f.field.end() > hashBits {
+			return fmt.Errorf("%s [%d, %d) exceeds the %d-bit reqID", f.name, f.field.Offset, f.field.end(), hashBits)
+		}
+		for _, other := range fields[:i] {
+			if f.field.overlaps(other.field) {
+				return fmt.Errorf("%s [%d, %d) overlaps %s [%d, %d)", f.name, f.field.Offset, f.field.end(), other.name, other.field.Offset, other.field.end())
+			}
+		}
+	}
+	return nil
+}
+
+// ReqInfo reqID 中编码的信息
+type ReqInfo struct {
+	TokenIndex  uint8
+	Amount      uint64 // 按 AmountDecimals 位小数编码的原始金额
+	CreatedTime uint64 // Unix 时间戳（秒）
+}
+
+// Decode 按 Meson 布局解析 reqID，见 Layout.Decode
+func Decode(reqID common.Hash) (ReqInfo, error) {
+	return Meson.Decode(reqID)
+}
+
+// IsToken 判断 reqID 中的 token index 是否等于 tokenIndex
+func IsToken(reqID common.Hash, tokenIndex uint8) bool {
+	return DecodeTokenIndex(reqID) == tokenIndex
+}
+
+// DecodeTokenIndex 按 Meson 布局从 reqID 中提取 token index
+func DecodeTokenIndex(reqID common.Hash) uint8 {
+	return Meson.DecodeTokenIndex(reqID)
+}
+
+// DecodeAmount 按 Meson 布局从 reqID 中提取金额并换算为 decimals 位小数，见 Layout.DecodeAmount
+func DecodeAmount(reqID common.Hash, decimals uint8) (*big.Int, error) {
+	return Meson.DecodeAmount(reqID, decimals)
+}
+
+// DecodeCreatedTime 按 Meson 布局从 reqID 中提取创建时间
+func DecodeCreatedTime(reqID common.Hash) uint64 {
+	return Meson.DecodeCreatedTime(reqID)
+}
+
+// Decode 解析 reqID 中的 token index、原始金额和创建时间，金额为零时返回错误
+func (l Layout) Decode(reqID common.Hash) (ReqInfo, error) {
+	info := ReqInfo{
+		TokenIndex:  l.DecodeTokenIndex(reqID),
+		Amount:      l.rawAmount(reqID),
+		CreatedTime: l.DecodeCreatedTime(reqID),
+	}
+	if info.Amount == 0 {
+		return info, ErrZeroAmount
+	}
+	return info, nil
+}
+
+// DecodeTokenIndex 从 reqID 中提取 token index
+func (l Layout) DecodeTokenIndex(reqID common.Hash) uint8 {
+	return uint8(extract(reqID, l.TokenIndex))
+}
+
+// DecodeAmount 从 reqID 中提取金额并换算为 decimals 位小数
+// reqID 中的金额为 AmountDecimals 位小数，decimals 更大时乘以 10 的差值次方，否则除以 10 的差值次方
+// 18 位小数的代币换算后可能超出 uint64，因此全程使用 *big.Int 计算
+// 金额为零时返回值为 0 和 ErrZeroAmount，由调用方决定是否处理
+func (l Layout) DecodeAmount(reqID common.Hash, decimals uint8) (*big.Int, error) {
+	amount := new(big.Int).SetUint64(l.rawAmount(reqID))
+	if amount.Sign() == 0 {
+		return amount, ErrZeroAmount
+	}
+
+	if decimals > l.AmountDecimals {
+		multiplier := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals-l.AmountDecimals)), nil)
+		amount.Mul(amount, multiplier)
+	} else {
+		divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(l.AmountDecimals-decimals)), nil)
+		amount.Quo(amount, divisor)
+	}
+
+	return amount, nil
+}
+
+// DecodeCreatedTime 从 reqID 中提取创建时间
+func (l Layout) DecodeCreatedTime(reqID common.Hash) uint64 {
+	return extract(reqID, l.CreatedTime)
+}
+
+// rawAmount 从 reqID 中提取按 AmountDecimals 位小数编码的原始金额
+func (l Layout) rawAmount(reqID common.Hash) uint64 {
+	return extract(reqID, l.Amount)
+}
+
+// extract 将 reqID 右移 field.Offset 位，然后取最低 field.Width 位，Width 不超过 64
+func extract(reqID common.Hash, field Field) uint64 {
+	value := new(big.Int).Rsh(new(big.Int).SetBytes(reqID.Bytes()), field.Offset)
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), field.Width), big.NewInt(1))
+	return value.And(value, mask).Uint64()
+}
@@ -0,0 +1,312 @@
+package reqid
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// encode 按 layout 将各字段编码为 reqID，其余位为 0
+func encode(layout Layout, tokenIndex uint8, amount, createdTime uint64) common.Hash {
+	value := new(big.Int).Lsh(new(big.Int).SetUint64(createdTime), layout.CreatedTime.Offset)
+	value.Or(value, new(big.Int).Lsh(big.NewInt(int64(tokenIndex)), layout.TokenIndex.Offset))
+	value.Or(value, new(big.Int).Lsh(new(big.Int).SetUint64(amount), layout.Amount.Offset))
+	return common.BigToHash(value)
+}
+
+// maxCreatedTime Meson 布局中 40 位创建时间的最大值
+const maxCreatedTime = 1<<40 - 1
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		reqID   common.Hash
+		want    ReqInfo
+		wantErr error
+	}{
+		{
+			name:  "typical",
+			reqID: encode(Meson, 1, 1500000, 1700000000),
+			want:  ReqInfo{TokenIndex: 1, Amount: 1500000, CreatedTime: 1700000000},
+		},
+		{
+			name:  "smallest amount",
+			reqID: encode(Meson, 1, 1, 1700000000),
+			want:  ReqInfo{TokenIndex: 1, Amount: 1, CreatedTime: 1700000000},
+		},
+		{
+			name:  "all fields at their maximum",
+			reqID: encode(Meson, math.MaxUint8, math.MaxUint64, maxCreatedTime),
+			want:  ReqInfo{TokenIndex: math.MaxUint8, Amount: math.MaxUint64, CreatedTime: maxCreatedTime},
+		},
+		{
+			// 字段之外的位全部为 1 时不影响解析结果
+			name:  "surrounding bits set",
+			reqID: orHash(encode(Meson, 2, 42, 1700000000), outsideFields(Meson)),
+			want:  ReqInfo{TokenIndex: 2, Amount: 42, CreatedTime: 1700000000},
+		},
+		{
+			name:    "zero amount",
+			reqID:   encode(Meson, 1, 0, 1700000000),
+			want:    ReqInfo{TokenIndex: 1, Amount: 0, CreatedTime: 1700000000},
+			wantErr: ErrZeroAmount,
+		},
+		{
+			name:    "all zero",
+			reqID:   common.Hash{},
+			wantErr: ErrZeroAmount,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.reqID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decode error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Decode = %+v, want %+v", got, tt.want)
+			}
+			if index := DecodeTokenIndex(tt.reqID); index != tt.want.TokenIndex {
+				t.Errorf("DecodeTokenIndex = %d, want %d", index, tt.want.TokenIndex)
+			}
+			if created := DecodeCreatedTime(tt.reqID); created != tt.want.CreatedTime {
+				t.Errorf("DecodeCreatedTime = %d, want %d", created, tt.want.CreatedTime)
+			}
+		})
+	}
+}
+
+func TestDecodeAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   uint64
+		decimals uint8
+		want     string
+		wantErr  error
+	}{
+		{name: "same decimals", amount: 1500000, decimals: 6, want: "1500000"},
+		{name: "fewer decimals truncates", amount: 1500001, decimals: 2, want: "150"},
+		{name: "zero decimals", amount: 1999999, decimals: 0, want: "1"},
+		{name: "more decimals", amount: 1500000, decimals: 8, want: "150000000"},
+		{name: "max amount at 6 decimals", amount: math.MaxUint64, decimals: 6, want: "18446744073709551615"},
+		{
+			// 超过 0xFFFFFFFFFFFFFFFF 的结果不会回绕
+			name: "max amount past uint64", amount: math.MaxUint64, decimals: 7, want: "184467440737095516150",
+		},
+		{name: "zero amount", amount: 0, decimals: 6, want: "0", wantErr: ErrZeroAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeAmount(encode(Meson, 1, tt.amount, 1700000000), tt.decimals)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeAmount error = %v, want %v", err, tt.wantErr)
+			}
+			if got.String() != tt.want {
+				t.Errorf("DecodeAmount = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsToken(t *testing.T) {
+	reqID := encode(Meson, 3, 1000000, 1700000000)
+	if !IsToken(reqID, 3) {
+		t.Error("IsToken(3) = false for token index 3")
+	}
+	if IsToken(reqID, 2) {
+		t.Error("IsToken(2) = true for token index 3")
+	}
+}
+
+func TestLayoutDecodeCustomLayout(t *testing.T) {
+	layout := Layout{
+		Amount:         Field{Offset: 0, Width: 48},
+		TokenIndex:     Field{Offset: 48, Width: 8},
+		CreatedTime:    Field{Offset: 64, Width: 32},
+		AmountDecimals: 8,
+	}
+	if err := layout.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	reqID := encode(layout, 7, 1<<48-1, math.MaxUint32)
+
+	info, err := layout.Decode(reqID)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := ReqInfo{TokenIndex: 7, Amount: 1<<48 - 1, CreatedTime: math.MaxUint32}
+	if info != want {
+		t.Errorf("Decode = %+v, want %+v", info, want)
+	}
+	amount, err := layout.DecodeAmount(reqID, 6)
+	if err != nil {
+		t.Fatalf("DecodeAmount: %v", err)
+	}
+	if want := new(big.Int).SetUint64((1<<48 - 1) / 100); amount.Cmp(want) != 0 {
+		t.Errorf("DecodeAmount = %s, want %s", amount, want)
+	}
+}
+
+// outsideFields layout 中不属于任何字段的位全部为 1 的 reqID
+func outsideFields(layout Layout) common.Hash {
+	var hash common.Hash
+	for bit := uint(0); bit < hashBits; bit++ {
+		inField := false
+		for _, field := range []Field{layout.Amount, layout.TokenIndex, layout.CreatedTime} {
+			if bit >= field.Offset && bit < field.end() {
+				inField = true
+			}
+		}
+		if !inField {
+			hash[common.HashLength-1-bit/8] |= 1 << (bit % 8)
+		}
+	}
+	return hash
+}
+
+// orHash 按位或
+func orHash(a, b common.Hash) common.Hash {
+	for i := range a {
+		a[i] |= b[i]
+	}
+	return a
+}
+
+func TestDecodeAmountEighteenDecimals(t *testing.T) {
+	// 1,000,000 个代币：原始金额 10^12 按 6 位小数编码，换算为 18 位小数后为 10^24，远超 uint64
+	reqID := encode(Meson, 1, 1000000000000, 1700000000)
+	amount, err := DecodeAmount(reqID, 18)
+	if err != nil {
+		t.Fatalf("DecodeAmount: %v", err)
+	}
+	want, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+	if amount.Cmp(want) != 0 {
+		t.Errorf("DecodeAmount = %s, want %s", amount, want)
+	}
+
+	// 最大的原始金额换算后也不会回绕
+	amount, err = DecodeAmount(encode(Meson, 1, math.MaxUint64, 1700000000), 18)
+	if err != nil {
+		t.Fatalf("DecodeAmount: %v", err)
+	}
+	want, _ = new(big.Int).SetString("18446744073709551615000000000000", 10)
+	if amount.Cmp(want) != 0 {
+		t.Errorf("DecodeAmount = %s, want %s", amount, want)
+	}
+}
+
+func TestLayoutValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(l *Layout)
+		wantErr string
+	}{
+		{name: "meson", mutate: func(l *Layout) {}},
+		{name: "empty amount", mutate: func(l *Layout) { l.Amount.Width = 0 }, wantErr: "amount.width must be between 1 and 64, got 0"},
+		{name: "wide token index", mutate: func(l *Layout) { l.TokenIndex.Width = 9 }, wantErr: "tokenIndex.width must be between 1 and 8, got 9"},
+		{name: "past bit 256", mutate: func(l *Layout) { l.CreatedTime.Offset = 240 }, wantErr: "createdTime [240, 280) exceeds the 256-bit reqID"},
+		{name: "overlapping", mutate: func(l *Layout) { l.TokenIndex.Offset = 188 }, wantErr: "tokenIndex [188, 196) overlaps amount [128, 192)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout := Meson
+			tt.mutate(&layout)
+			err := layout.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Validate error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fixtureReqID testdata/reqids.json 中的一条 reqID 及其期望的解析结果
+type fixtureReqID struct {
+	Name        string `json:"name"`
+	ReqID       string `json:"reqID"`
+	TokenIndex  uint8  `json:"tokenIndex"`
+	Amount      uint64 `json:"amount"`
+	CreatedTime uint64 `json:"createdTime"`
+}
+
+// loadFixtureReqIDs 读取 testdata/reqids.json，其中的 reqID 按 Meson 布局手工构造，十六进制写死，布局的位置变化时测试失败
+func loadFixtureReqIDs(t *testing.T) []fixtureReqID {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "reqids.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixture struct {
+		ReqIDs []fixtureReqID `json:"reqIDs"`
+	}
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		t.Fatalf("parse testdata/reqids.json: %v", err)
+	}
+	if len(fixture.ReqIDs) == 0 {
+		t.Fatal("testdata/reqids.json has no reqIDs")
+	}
+	return fixture.ReqIDs
+}
+
+func TestDecodeFixtureReqIDs(t *testing.T) {
+	for _, tt := range loadFixtureReqIDs(t) {
+		t.Run(tt.Name, func(t *testing.T) {
+			if !strings.HasPrefix(tt.ReqID, "0x") || len(tt.ReqID) != 2+2*common.HashLength {
+				t.Fatalf("reqID %q is not a 32-byte hex string", tt.ReqID)
+			}
+			reqID := common.HexToHash(tt.ReqID)
+
+			info, err := Decode(reqID)
+			var wantErr error
+			if tt.Amount == 0 {
+				wantErr = ErrZeroAmount
+			}
+			if !errors.Is(err, wantErr) {
+				t.Fatalf("Decode error = %v, want %v", err, wantErr)
+			}
+			want := ReqInfo{TokenIndex: tt.TokenIndex, Amount: tt.Amount, CreatedTime: tt.CreatedTime}
+			if info != want {
+				t.Errorf("Decode = %+v, want %+v", info, want)
+			}
+			if got := DecodeTokenIndex(reqID); got != tt.TokenIndex {
+				t.Errorf("DecodeTokenIndex = %d, want %d", got, tt.TokenIndex)
+			}
+			if got := DecodeCreatedTime(reqID); got != tt.CreatedTime {
+				t.Errorf("DecodeCreatedTime = %d, want %d", got, tt.CreatedTime)
+			}
+			if !IsToken(reqID, tt.TokenIndex) || IsToken(reqID, tt.TokenIndex+1) {
+				t.Errorf("IsToken does not match token index %d", tt.TokenIndex)
+			}
+
+			raw := new(big.Int).SetUint64(tt.Amount)
+			for _, decimals := range []struct {
+				decimals uint8
+				want     *big.Int
+			}{
+				{decimals: 6, want: raw},
+				{decimals: 18, want: new(big.Int).Mul(raw, big.NewInt(1000000000000))},
+				{decimals: 0, want: new(big.Int).Quo(raw, big.NewInt(1000000))},
+			} {
+				got, err := DecodeAmount(reqID, decimals.decimals)
+				if !errors.Is(err, wantErr) {
+					t.Errorf("DecodeAmount(%d) error = %v, want %v", decimals.decimals, err, wantErr)
+				}
+				if got.Cmp(decimals.want) != 0 {
+					t.Errorf("DecodeAmount(%d) = %s, want %s", decimals.decimals, got, decimals.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+)
+
+// defaultRetentionInterval 归档任务的默认执行间隔
+const defaultRetentionInterval = time.Hour
+
+// RetentionConfig meson 表中记录的保留时间，超过的记录定期移到 meson_archive 表
+// 已完成和仍未完成的记录都会归档，maxAgeDays 应当远大于 pendingTimeoutMinutes，否则单边记录来不及告警
+type RetentionConfig struct {
+	// MaxAgeDays 按创建时间计算的保留天数，为 0 时不归档
+	MaxAgeDays int `json:"maxAgeDays"`
+	// IntervalMinutes 归档任务的执行间隔（分钟），为 0 时使用默认值 60
+	IntervalMinutes int `json:"intervalMinutes"`
+}
+
+// validate 检查保留时间配置
+func (c RetentionConfig) validate() error {
+	if c.MaxAgeDays < 0 {
+		return fmt.Errorf("maxAgeDays must not be negative, got %d", c.MaxAgeDays)
+	}
+	if c.IntervalMinutes < 0 {
+		return fmt.Errorf("intervalMinutes must not be negative, got %d", c.IntervalMinutes)
+	}
+	return nil
+}
+
+// maxAge 返回记录的保留时间，为 0 时不归档
+func (c RetentionConfig) maxAge() time.Duration {
+	return time.Duration(c.MaxAgeDays) * 24 * time.Hour
+}
+
+// retentionMaxAge 记录的保留时间，检查未完成的 Meson 时跳过即将归档的记录，为 0 时不限制
+var retentionMaxAge time.Duration
+
+// uncheckedSince 返回检查未完成的 Meson 时创建时间的下限，未配置保留时间时为 0
+func uncheckedSince(now time.Time) int64 {
+	if retentionMaxAge <= 0 {
+		return 0
+	}
+	return now.Add(-retentionMaxAge).Unix()
+}
+
+// runRetention 启动后立即归档一次，之后每隔 intervalMinutes 将超过保留时间的记录移到 meson_archive 表，ctx 取消后退出
+func runRetention(ctx context.Context, config RetentionConfig) {
+	interval := time.Duration(config.IntervalMinutes) * time.Minute
+	if interval == 0 {
+		interval = defaultRetentionInterval
+	}
+	logrus.Infof("Archiving Mesons older than %d day(s) every %s", config.MaxAgeDays, interval)
+
+	for ctx.Err() == nil {
+		archiveOldMesons(config.maxAge())
+		sleepContext(ctx, interval)
+	}
+}
+
+// archiveOldMesons 将创建时间早于 maxAge 之前的记录移到 meson_archive 表，失败时下个周期重试
+func archiveOldMesons(maxAge time.Duration) {
+	before := time.Now().Add(-maxAge)
+	archived, err := database.ArchiveMesons(before.Unix())
+	if err != nil {
+		logrus.Errorf("Failed to archive Mesons created before %s: %v", before.UTC().Format(time.RFC3339), err)
+		return
+	}
+	if archived > 0 {
+		logrus.Infof("Archived %d Meson(s) created before %s", archived, before.UTC().Format(time.RFC3339))
+	}
+}
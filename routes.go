@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"meson-monitor/database"
+)
+
+// WatchedRoute 需要校验和告警的跨链方向，From 为 burn 的一边，To 为 mint 的一边
+type WatchedRoute struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// watchedRoutes 配置的跨链方向白名单，为空时所有方向都校验和告警
+var watchedRoutes = map[chainPair]bool{}
+
+// loadWatchedRoutes 解析配置中的跨链方向白名单，链名未知或重复配置时报错
+func loadWatchedRoutes(config *Config) (map[chainPair]bool, error) {
+	result := make(map[chainPair]bool, len(config.Main.WatchedRoutes))
+	for i, route := range config.Main.WatchedRoutes {
+		for _, chainName := range []string{route.From, route.To} {
+			if _, ok := config.Chains[chainName]; !ok {
+				return nil, fmt.Errorf("main.watchedRoutes[%d]: unknown chain %q", i, chainName)
+			}
+		}
+		if route.From == route.To {
+			return nil, fmt.Errorf("main.watchedRoutes[%d]: from and to must be different chains, got %q", i, route.From)
+		}
+		key := chainPair{from: route.From, to: route.To}
+		if result[key] {
+			return nil, fmt.Errorf("main.watchedRoutes[%d]: duplicate route %s -> %s", i, route.From, route.To)
+		}
+		result[key] = true
+	}
+	return result, nil
+}
+
+// bridgeDirection 返回 Meson 的跨链方向：从 burn 的一边到 mint 的一边
+// 动作不是一个 burn 一个 mint 时无法判断方向，按记录的先后顺序返回
+func bridgeDirection(meson database.Meson) (string, string) {
+	if meson.ActionA == actionMint && meson.ActionB == actionBurn {
+		return meson.ChainB, meson.ChainA
+	}
+	return meson.ChainA, meson.ChainB
+}
+
+// routeWatched 判断两边都已记录的 Meson 的方向是否需要校验和告警，未配置白名单时总是返回 true
+func routeWatched(meson database.Meson) bool {
+	if len(watchedRoutes) == 0 {
+		return true
+	}
+	from, to := bridgeDirection(meson)
+	return watchedRoutes[chainPair{from: from, to: to}]
+}
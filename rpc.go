@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/sirupsen/logrus"
+)
+
+// maxConsecutiveRPCErrors 同一节点连续出错多少次后切换到下一个节点
+const maxConsecutiveRPCErrors = 3
+
+// rpcError 表示 RPC 节点返回的错误，用于和数据库等其他错误区分
+type rpcError struct {
+	err error
+}
+
+func (e *rpcError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rpcError) Unwrap() error {
+	return e.err
+}
+
+// isRPCError 判断错误是否来自 RPC 节点
+func isRPCError(err error) bool {
+	var target *rpcError
+	return errors.As(err, &target)
+}
+
+// rpcEndpoints 记录一条链的多个 RPC 节点以及当前使用的节点
+// 当前节点连接或查询失败时轮换到下一个，所有节点都失败过一轮后由调用方退避重试
+type rpcEndpoints struct {
+	chainName string
+	urls      []string
+
+	mu       sync.Mutex
+	current  int
+	failures int // 自上次成功以来失败过的节点数
+}
+
+func newRPCEndpoints(chainName string, urls []string) *rpcEndpoints {
+	return &rpcEndpoints{chainName: chainName, urls: urls}
+}
+
+// url 返回当前使用的节点
+func (e *rpcEndpoints) url() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.urls[e.current]
+}
+
+// markHealthy 当前节点请求成功，清零失败计数
+func (e *rpcEndpoints) markHealthy() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failures = 0
+}
+
+// markFailed 当前节点不可用，切换到下一个节点
+func (e *rpcEndpoints) markFailed() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	failed := e.urls[e.current]
+	e.current = (e.current + 1) % len(e.urls)
+	e.failures++
+	if len(e.urls) > 1 {
+		logrus.Warnf("RPC endpoint %s for chain %s failed, switching to %s", failed, e.chainName, e.urls[e.current])
+	}
+}
+
+// exhausted 判断是否所有节点都已失败过一轮
+func (e *rpcEndpoints) exhausted() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.failures >= len(e.urls)
+}
+
+// reset 在退避等待之后重新尝试整个节点列表
+func (e *rpcEndpoints) reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failures = 0
+}
+
+// rpcClient 包装 ethclient.Client，为 HeaderByNumber 和 FilterLogs 记录耗时和错误
+// batcher 不为 nil 时 FilterLogs 与使用同一节点的其他链合并为批量请求
+type rpcClient struct {
+	*ethclient.Client
+	chainName string
+	endpoint  string
+	batcher   *logBatcher
+}
+
+// dialRPC 连接 RPC 节点并返回带指标记录的客户端
+func dialRPC(chainName, rpcUrl string) (*rpcClient, error) {
+	client, err := ethclient.Dial(rpcUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcClient{Client: client, chainName: chainName, endpoint: endpointLabel(rpcUrl)}, nil
+}
+
+func (c *rpcClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	start := time.Now()
+	header, err := c.Client.HeaderByNumber(ctx, number)
+	c.observe("HeaderByNumber", start, err)
+	return header, err
+}
+
+// BlockHashByNumber 查询指定高度的区块哈希，区块不存在时返回 ethereum.NotFound
+// 直接使用节点返回的 hash 字段，不通过 types.Header 重新计算，L2 的区块头字段与以太坊不同时也能与日志中的 BlockHash 比较
+func (c *rpcClient) BlockHashByNumber(ctx context.Context, number uint64) (common.Hash, error) {
+	start := time.Now()
+	var block *struct {
+		Hash common.Hash `json:"hash"`
+	}
+	err := c.Client.Client().CallContext(ctx, &block, "eth_getBlockByNumber", hexutil.EncodeUint64(number), false)
+	if err == nil && block == nil {
+		err = ethereum.NotFound
+	}
+	c.observe("BlockHashByNumber", start, err)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return block.Hash, nil
+}
+
+func (c *rpcClient) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	start := time.Now()
+	var logs []types.Log
+	var err error
+	if c.batcher != nil {
+		logs, err = c.batcher.filterLogs(ctx, c.chainName, query)
+	}
+	if c.batcher == nil || errors.Is(err, errBatchRejected) {
+		logs, err = c.Client.FilterLogs(ctx, query)
+	}
+	c.observe("FilterLogs", start, err)
+	return logs, err
+}
+
+func (c *rpcClient) observe(method string, start time.Time, err error) {
+	duration := time.Since(start)
+	observeRPC(c.chainName, c.endpoint, method, duration, err)
+	logrus.WithFields(logrus.Fields{
+		"ChainName": c.chainName,
+		"Endpoint":  c.endpoint,
+		"Method":    method,
+		"Duration":  duration,
+		"Error":     err,
+	}).Debug("RPC request finished")
+}
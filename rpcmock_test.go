@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockRPCHandler 处理一个 JSON-RPC 调用，返回的错误作为 JSON-RPC 错误响应
+type mockRPCHandler func(method string, params json.RawMessage) (interface{}, error)
+
+// mockRPC 模拟的 JSON-RPC 节点，支持批量请求，记录收到的 HTTP 请求数和每个调用
+type mockRPC struct {
+	*httptest.Server
+	handler mockRPCHandler
+	// latency 每个 HTTP 请求的响应延迟，模拟到节点的往返时间
+	latency time.Duration
+
+	mu    sync.Mutex
+	trips int
+	calls []mockRPCCall
+}
+
+// mockRPCCall 节点收到的一个 JSON-RPC 调用
+type mockRPCCall struct {
+	Method string
+	Params json.RawMessage
+}
+
+type mockRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type mockRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type mockRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mockRPCError   `json:"error,omitempty"`
+}
+
+// newMockRPC 启动模拟节点，测试结束时关闭
+func newMockRPC(t testing.TB, handler mockRPCHandler) *mockRPC {
+	m := &mockRPC{handler: handler}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serveHTTP))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockRPC) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	m.trips++
+	m.mu.Unlock()
+	if m.latency > 0 {
+		time.Sleep(m.latency)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var requests []mockRPCRequest
+		if err := json.Unmarshal(body, &requests); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		responses := make([]mockRPCResponse, len(requests))
+		for i, req := range requests {
+			responses[i] = m.call(req)
+		}
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+
+	var req mockRPCRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(m.call(req))
+}
+
+func (m *mockRPC) call(req mockRPCRequest) mockRPCResponse {
+	m.mu.Lock()
+	m.calls = append(m.calls, mockRPCCall{Method: req.Method, Params: req.Params})
+	m.mu.Unlock()
+
+	resp := mockRPCResponse{JSONRPC: "2.0", ID: req.ID}
+	result, err := m.handler(req.Method, req.Params)
+	if err != nil {
+		resp.Error = &mockRPCError{Code: -32000, Message: err.Error()}
+		return resp
+	}
+	resp.Result = result
+	return resp
+}
+
+// Trips 收到的 HTTP 请求数，一个批量请求计为一次
+func (m *mockRPC) Trips() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.trips
+}
+
+// Calls 收到的所有 JSON-RPC 调用
+func (m *mockRPC) Calls() []mockRPCCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mockRPCCall(nil), m.calls...)
+}
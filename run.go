@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/bot"
+)
+
+// Run 按配置启动监控：连接数据库、创建告警渠道，启动各链的监听协程、定期检查和查询接口，直到 ctx 被取消
+// ctx 取消后停止监听、检查和其他后台协程，等待它们退出、发完告警队列中的告警后返回 nil；
+// 告警发送最多再等待 alertShutdownGrace，超过后取消，未发送的告警记录日志后丢弃
+// 初始化失败或查询接口无法监听时返回错误。config 需要先经过 Validate
+// 告警渠道、链进度等状态保存在包级变量中，同一时间只能运行一个 Run；Run 返回后可以再次调用
+func Run(ctx context.Context, config *Config) error {
+	db, cleanup, err := initServices(config)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	// 告警发送使用的上下文，ctx 取消后再等待 alertShutdownGrace 才取消，避免进行中的发送阻塞退出
+	sendCtx, cancelSends := context.WithCancel(context.Background())
+	defer cancelSends()
+	bot.SetContext(sendCtx)
+	stopGrace := context.AfterFunc(ctx, func() {
+		time.AfterFunc(alertShutdownGrace, func() {
+			if sendCtx.Err() != nil {
+				return
+			}
+			logrus.Warnf("Cancelling alert sends still in progress %s after shutdown", alertShutdownGrace)
+			cancelSends()
+		})
+	})
+	defer stopGrace()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 告警由单独的协程发送，不阻塞事件处理；返回前发完队列中的告警
+	stopAlertQueue := startAlertQueue(sendCtx, config.Main.AlertQueueSize)
+	defer stopAlertQueue()
+	if config.Main.AlertsPerMinute > 0 {
+		stopAlertLimiter := startAlertLimiter(runCtx, config.Main.AlertsPerMinute)
+		defer stopAlertLimiter()
+	}
+	stopErrorLogAlerts := startErrorLogAlerts(config.Main.ErrorLogAlerts)
+	defer stopErrorLogAlerts()
+
+	// 审计日志记录每个处理过的事件
+	stopAuditLog, err := startAuditLog(config.Main.AuditLog)
+	if err != nil {
+		return err
+	}
+	defer stopAuditLog()
+
+	// 其他后台协程，返回前等待它们退出
+	var background sync.WaitGroup
+	goBackground := func(fn func()) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			fn()
+		}()
+	}
+
+	// 监听长时间没有进度时主动告警
+	if config.Main.StallAlertMinutes > 0 {
+		goBackground(func() { runChainWatchdog(runCtx, time.Duration(config.Main.StallAlertMinutes)*time.Minute) })
+	}
+
+	// 启动查询接口，无法监听时停止监控
+	serverErr := make(chan error, 1)
+	if config.Main.APIListen != "" {
+		goBackground(func() {
+			serverErr <- startAPIServer(runCtx, config.Main.APIListen, config.Main.AdminToken, config.Main.HTTPServer)
+		})
+	}
+
+	// 启动每日汇总
+	if config.Main.SummaryTime != "" {
+		goBackground(func() { runDailySummary(runCtx, config.Main.SummaryTime) })
+	}
+
+	// 定期归档超过保留时间的记录
+	if config.Main.Retention.MaxAgeDays > 0 {
+		goBackground(func() { runRetention(runCtx, config.Main.Retention) })
+	}
+
+	// 启动数据库检查协程，退出前等待当前一轮检查完成
+	var checkWG sync.WaitGroup
+	checkWG.Add(1)
+	checkInterval := config.checkInterval()
+	if config.Main.CheckIntervalSeconds <= 0 {
+		logrus.Warnf("main.check_time is deprecated and is in milliseconds; use main.checkIntervalSeconds instead")
+	}
+	logrus.Infof("Checking unmatched Mesons every %s", checkInterval)
+	go checkDatabase(&checkWG, runCtx.Done(), db, checkInterval, time.Duration(config.Main.PendingTimeoutMinutes)*time.Minute)
+
+	// 使用 WaitGroup 来跟踪监听协程
+	var wg sync.WaitGroup
+
+	// 限制同时首次连接的链数量，相邻两条链之间间隔 stagger 启动，每条链再随机延迟不超过 jitter
+	gate := newStartupGate(config.Main.StartupConcurrency)
+	stagger := time.Duration(config.Main.StartupStaggerMillis) * time.Millisecond
+	jitter := time.Duration(config.Main.StartupJitterMillis) * time.Millisecond
+	grace := time.Duration(config.Main.StartupGraceSeconds) * time.Second
+	if grace == 0 {
+		grace = defaultStartupGrace
+	}
+
+	// 遍历配置文件中的所有链配置，按名称顺序启动监听协程
+	for i, chainName := range config.chainNames() {
+		if i > 0 && stagger > 0 {
+			sleepContext(runCtx, stagger)
+		}
+		if runCtx.Err() != nil {
+			break
+		}
+		logrus.Infof("Starting listener for chain: %s", chainName)
+		wg.Add(1) // 增加 WaitGroup 计数
+		// 启动一个新的协程执行 listenEvents 函数
+		go listenEvents(runCtx, &wg, db, chainName, config.Chains[chainName], gate, grace, jitter)
+	}
+
+	// 监听协程中是无限循环，ctx 取消或查询接口出错后停止监听，等待当前的区块区间和数据库检查结束后返回
+	// 未提交的区块区间会回滚，下次启动时重新处理
+	select {
+	case <-ctx.Done():
+	case err = <-serverErr:
+	}
+	cancel()
+	checkWG.Wait()
+	wg.Wait()
+	background.Wait()
+	closeLogBatchers()
+	logrus.Info("All listeners stopped")
+	return err
+}
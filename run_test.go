@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testRunConfig 不监听任何链、使用临时 SQLite 数据库的最小配置，启用所有需要在 Run 返回时停止的后台部分
+func testRunConfig(t *testing.T) *Config {
+	dir := t.TempDir()
+	config := &Config{}
+	config.Main.DBType = "sqlite"
+	config.Main.PostgresURI = testSQLiteURI(t)
+	config.Main.LastBlockDir = filepath.Join(dir, "last_block")
+	config.Main.CheckIntervalSeconds = 60
+	config.Main.AlertsPerMinute = 10
+	config.Main.ErrorLogAlerts.Enabled = true
+	config.Main.AuditLog.Dir = filepath.Join(dir, "audit")
+	return config
+}
+
+// logHookCount logrus 标准 logger 上 error 级别的 hook 数量
+func logHookCount() int {
+	return len(logrus.StandardLogger().Hooks[logrus.ErrorLevel])
+}
+
+// runUntilCancelled 启动 Run，等待 wait 后取消 ctx，返回 Run 的结果
+func runUntilCancelled(t *testing.T, config *Config, wait time.Duration) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- Run(ctx, config)
+	}()
+	time.Sleep(wait)
+	cancel()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return after ctx was cancelled")
+		return nil
+	}
+}
+
+func TestRunStopsBackgroundPartsAndCanRunAgain(t *testing.T) {
+	hooks := logHookCount()
+	config := testRunConfig(t)
+
+	for i := 0; i < 2; i++ {
+		if err := runUntilCancelled(t, config, 200*time.Millisecond); err != nil {
+			t.Fatalf("run %d returned %v", i+1, err)
+		}
+		if got := logHookCount(); got != hooks {
+			t.Errorf("run %d left %d error log hooks, want %d", i+1, got, hooks)
+		}
+		if len(auditSinks) != 0 {
+			t.Errorf("run %d left %d audit sinks", i+1, len(auditSinks))
+		}
+		if alertLimiter.Load() != nil {
+			t.Errorf("run %d left the alert limiter enabled", i+1)
+		}
+		if alerts.Load() != nil {
+			t.Errorf("run %d left the alert queue running", i+1)
+		}
+	}
+}
+
+func TestRunReturnsAuditLogError(t *testing.T) {
+	hooks := logHookCount()
+	config := testRunConfig(t)
+	// 审计目录的父路径是一个文件，无法创建
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Main.AuditLog.Dir = filepath.Join(file, "audit")
+
+	err := Run(context.Background(), config)
+	if err == nil {
+		t.Fatal("Run succeeded with an audit log directory that cannot be created")
+	}
+	if got := logHookCount(); got != hooks {
+		t.Errorf("failed Run left %d error log hooks, want %d", got, hooks)
+	}
+	if alerts.Load() != nil {
+		t.Error("failed Run left the alert queue running")
+	}
+}
+
+func TestAlertQueueDrainsOnStop(t *testing.T) {
+	recorder := &recordingNotifier{}
+	queue := newAlertQueue(16)
+	for i := 0; i < 5; i++ {
+		queue.enqueue(Alert{Kind: AlertTimeout})
+	}
+	go queue.run(context.Background(), recorder)
+	close(queue.stop)
+	<-queue.done
+
+	if got := len(recorder.Alerts()); got != 5 {
+		t.Errorf("sent %d queued alerts, want 5", got)
+	}
+}
+
+func TestAlertQueueDropsWhenSendContextCancelled(t *testing.T) {
+	recorder := &recordingNotifier{}
+	queue := newAlertQueue(16)
+	for i := 0; i < 5; i++ {
+		queue.enqueue(Alert{Kind: AlertTimeout})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	go queue.run(ctx, recorder)
+	close(queue.stop)
+	<-queue.done
+
+	if got := len(recorder.Alerts()); got != 0 {
+		t.Errorf("sent %d alerts after the send context was cancelled, want 0", got)
+	}
+}
+
+func TestAlertQueueSendsDirectlyAfterStop(t *testing.T) {
+	stop := startAlertQueue(context.Background(), 4)
+	queue := alerts.Load()
+	stop()
+
+	if alerts.Load() != nil {
+		t.Fatal("alert queue still installed after stop")
+	}
+	if alertNotifier() == Notifier(queue) {
+		t.Error("alertNotifier still returns the stopped queue")
+	}
+	// 持有旧队列的调用方改为同步发送，不会留在队列中
+	queue.Notify(Alert{Kind: AlertTimeout})
+	if got := len(queue.alerts); got != 0 {
+		t.Errorf("%d alerts left in the stopped queue", got)
+	}
+}
+
+func TestAlertLimiterStops(t *testing.T) {
+	stop := startAlertLimiter(context.Background(), 5)
+	if alertLimiter.Load() == nil {
+		t.Fatal("alert limiter not installed")
+	}
+	stop()
+	if alertLimiter.Load() != nil {
+		t.Error("alert limiter still installed after stop")
+	}
+}
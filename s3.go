@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// s3UploadTimeout 上传单个文件的超时时间
+const s3UploadTimeout = 2 * time.Minute
+
+// s3Uploader 使用 AWS Signature Version 4 签名的 PUT 请求上传文件，不依赖 AWS SDK
+type s3Uploader struct {
+	config S3Config
+	client *http.Client
+}
+
+func newS3Uploader(config S3Config) *s3Uploader {
+	return &s3Uploader{config: config, client: &http.Client{Timeout: s3UploadTimeout}}
+}
+
+// objectURL 返回对象的访问地址：AWS S3 使用虚拟主机方式，自定义 Endpoint 使用路径方式
+func (u *s3Uploader) objectURL(key string) (string, string) {
+	if u.config.Endpoint == "" {
+		host := fmt.Sprintf("%s.s3.%s.amazonaws.com", u.config.Bucket, u.config.Region)
+		return "https://" + host, "/" + s3EscapePath(key)
+	}
+	return strings.TrimRight(u.config.Endpoint, "/"), "/" + s3EscapePath(u.config.Bucket) + "/" + s3EscapePath(key)
+}
+
+// upload 上传文件，返回对象名
+func (u *s3Uploader) upload(path string) (string, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimPrefix(u.config.Prefix, "/") + filepath.Base(path)
+	base, escapedPath := u.objectURL(key)
+
+	req, err := http.NewRequest(http.MethodPut, base+escapedPath, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	u.sign(req, escapedPath, body, time.Now().UTC())
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return key, nil
+}
+
+// sign 按 Signature Version 4 为请求添加签名，签名包含 host、x-amz-content-sha256 和 x-amz-date 三个请求头
+func (u *s3Uploader) sign(req *http.Request, escapedPath string, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	req.Header.Set("x-amz-date", amzDate)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapedPath,
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + u.config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+u.config.SecretAccessKey), date)
+	key = hmacSHA256(key, u.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// s3EscapePath 按 S3 签名的要求编码对象路径，保留 "/" 和 RFC 3986 的非保留字符
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultStartupGrace 监听协程启动后连接成功的默认期限
+const defaultStartupGrace = 2 * time.Minute
+
+// startupGate 限制同时首次连接 RPC 节点的监听协程数量，避免链较多时同时建立大量连接被节点限流
+type startupGate struct {
+	slots chan struct{} // 为 nil 时不限制
+}
+
+// newStartupGate 创建启动限制，concurrency 为 0 时不限制
+func newStartupGate(concurrency int) *startupGate {
+	gate := &startupGate{}
+	if concurrency > 0 {
+		gate.slots = make(chan struct{}, concurrency)
+	}
+	return gate
+}
+
+// acquire 等待空闲的名额，返回的函数释放名额，可以多次调用
+// ctx 取消时不再等待，返回的函数不做任何事
+func (g *startupGate) acquire(ctx context.Context) func() {
+	if g == nil || g.slots == nil {
+		return func() {}
+	}
+	select {
+	case g.slots <- struct{}{}:
+	case <-ctx.Done():
+		return func() {}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-g.slots })
+	}
+}
+
+// startupWatch 记录一条链是否已经连接成功，超过期限仍未连接时告警
+type startupWatch struct {
+	chainName string
+
+	mu        sync.Mutex
+	connected bool
+	lastErr   error
+}
+
+// markConnected 记录链已经连接成功并开始监听
+func (w *startupWatch) markConnected() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.connected = true
+}
+
+// markFailed 记录最近一次连接失败的原因
+func (w *startupWatch) markFailed(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastErr = err
+}
+
+// check 期限到达时检查链是否已连接成功，未连接时记录错误并发送告警，监听协程继续重试
+func (w *startupWatch) check(grace time.Duration) {
+	w.mu.Lock()
+	connected, lastErr := w.connected, w.lastErr
+	w.mu.Unlock()
+	if connected {
+		return
+	}
+
+	reason := "no successful response from the RPC endpoint yet"
+	if lastErr != nil {
+		reason = lastErr.Error()
+	}
+	logrus.Errorf("Chain %s failed to start listening within %s: %s", w.chainName, grace, reason)
+	sendAlert(Alert{
+		Kind:      AlertChainStartupFailed,
+		Timestamp: time.Now().Unix(),
+		Chain:     w.chainName,
+		Note:      fmt.Sprintf("Chain %s: could not connect and start listening within %s, still retrying. Last error: %s", w.chainName, grace, reason),
+	})
+}
+
+// randomJitter 返回 [0, bound) 之间的随机延迟，bound 不大于 0 时返回 0
+// 各链在启动和轮询等待时加上该延迟，共用同一个 RPC 服务商的链不会在同一时刻集中查询
+func randomJitter(bound time.Duration) time.Duration {
+	if bound <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(bound)))
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRandomJitterStaysWithinBound(t *testing.T) {
+	for _, bound := range []time.Duration{time.Nanosecond, time.Millisecond, 500 * time.Millisecond, time.Minute} {
+		lower, upper := 0, 0
+		for i := 0; i < 2000; i++ {
+			got := randomJitter(bound)
+			if got < 0 || got >= bound {
+				t.Fatalf("randomJitter(%s) = %s, want within [0, %s)", bound, got, bound)
+			}
+			if got < bound/2 {
+				lower++
+			} else {
+				upper++
+			}
+		}
+		// 随机延迟应当分布在整个区间内，而不是集中在一端；bound 为 1ns 时只能是 0
+		if bound > time.Nanosecond && (lower == 0 || upper == 0) {
+			t.Errorf("randomJitter(%s): %d samples below half, %d above, want both halves covered", bound, lower, upper)
+		}
+	}
+}
+
+func TestRandomJitterDisabled(t *testing.T) {
+	for _, bound := range []time.Duration{0, -time.Second} {
+		if got := randomJitter(bound); got != 0 {
+			t.Errorf("randomJitter(%s) = %s, want 0", bound, got)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import "meson-monitor/database"
+
+// Store meson_handle 读写 Meson 记录所需的方法
+// database.Tx 实现了该接口，使处理逻辑不直接依赖数据库事务
+type Store interface {
+	FindMesonByReqID(reqID string) (*database.Meson, error)
+	InsertMeson(meson database.Meson) (bool, error)
+	UpdateMeson(meson *database.Meson) error
+	InsertMesonLeg(leg database.MesonLeg) (bool, error)
+}
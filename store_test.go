@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"meson-monitor/database"
+)
+
+// mockStore 按测试设定返回查询结果，记录插入的 Meson
+type mockStore struct {
+	findResults []*database.Meson // 依次作为 FindMesonByReqID 的结果，用完后返回 nil
+	findErr     error
+	insertOK    bool
+	insertErr   error
+
+	finds    int
+	inserted []database.Meson
+	updated  []*database.Meson
+}
+
+func (m *mockStore) FindMesonByReqID(reqID string) (*database.Meson, error) {
+	m.finds++
+	if m.findErr != nil {
+		return nil, m.findErr
+	}
+	if len(m.findResults) == 0 {
+		return nil, nil
+	}
+	result := m.findResults[0]
+	m.findResults = m.findResults[1:]
+	return result, nil
+}
+
+func (m *mockStore) InsertMeson(meson database.Meson) (bool, error) {
+	if m.insertErr != nil {
+		return false, m.insertErr
+	}
+	if m.insertOK {
+		m.inserted = append(m.inserted, meson)
+	}
+	return m.insertOK, nil
+}
+
+func (m *mockStore) UpdateMeson(meson *database.Meson) error {
+	m.updated = append(m.updated, meson)
+	return nil
+}
+
+func (m *mockStore) InsertMesonLeg(leg database.MesonLeg) (bool, error) {
+	return true, nil
+}
+
+// handleTestLeg 用 mockStore 处理 bsc 上的一边 burn 事件
+func handleTestLeg(store Store, notifier Notifier, reqID string) error {
+	return meson_handle(store, notifier, reqID, "bsc", actionBurn, testTokenIndex, 1700000000, big.NewInt(1000000),
+		"0xtx", testAddress.Hex(), testContract.Hex(), 100, 0, "0xblock")
+}
+
+func TestMesonHandleInsertsWhenRowIsMissing(t *testing.T) {
+	store := &mockStore{insertOK: true}
+	recorder := &recordingNotifier{}
+
+	if err := handleTestLeg(store, recorder, "0xmissing"); err != nil {
+		t.Fatalf("meson_handle: %v", err)
+	}
+	if len(store.inserted) != 1 {
+		t.Fatalf("inserted %d Mesons, want 1", len(store.inserted))
+	}
+	if got := store.inserted[0]; got.ReqID != "0xmissing" || got.ChainA != "bsc" || got.ActionA != actionBurn || got.AmountA.Cmp(big.NewInt(1000000)) != 0 {
+		t.Errorf("inserted %+v", got)
+	}
+	if alerts := recorder.Alerts(); len(alerts) != 0 {
+		t.Errorf("sent %d alerts, want 0", len(alerts))
+	}
+}
+
+func TestMesonHandleReturnsStoreErrorOnQueryError(t *testing.T) {
+	queryErr := errors.New("connection reset by peer")
+	store := &mockStore{findErr: queryErr, insertOK: true}
+	recorder := &recordingNotifier{}
+
+	err := handleTestLeg(store, recorder, "0xtransient")
+	var storeErr *storeError
+	if !errors.As(err, &storeErr) {
+		t.Fatalf("meson_handle error = %v, want *storeError so the range is processed again", err)
+	}
+	// 查询失败不能当作记录不存在，否则可能覆盖已有的一边
+	if len(store.inserted) != 0 {
+		t.Errorf("inserted %d Mesons after a query error, want 0", len(store.inserted))
+	}
+	if alerts := recorder.Alerts(); len(alerts) != 0 {
+		t.Errorf("sent %d alerts, want 0", len(alerts))
+	}
+}
+
+func TestMesonHandleReturnsStoreErrorOnInsertError(t *testing.T) {
+	store := &mockStore{insertErr: errors.New("disk full")}
+
+	err := handleTestLeg(store, &recordingNotifier{}, "0xinsert")
+	var storeErr *storeError
+	if !errors.As(err, &storeErr) {
+		t.Fatalf("meson_handle error = %v, want *storeError", err)
+	}
+}
+
+func TestMesonHandleInsertConflict(t *testing.T) {
+	t.Run("row appears on retry", func(t *testing.T) {
+		// 查询之后另一条链插入了同一 reqID，重试时查到已有的 mint 并配对
+		existing := &database.Meson{
+			ReqID: "0xconflict", ChainA: "eth", AmountA: big.NewInt(1000000), ActionA: actionMint,
+			TxHashA: "0xeth", TokenIndex: testTokenIndex, BlockA: 200, Timestamp: 1700000000,
+		}
+		store := &mockStore{findResults: []*database.Meson{nil, existing}}
+		if err := handleTestLeg(store, &recordingNotifier{}, "0xconflict"); err != nil {
+			t.Fatalf("meson_handle: %v", err)
+		}
+		if store.finds != 2 || len(store.updated) != 1 {
+			t.Fatalf("finds = %d, updates = %d; want 2 and 1", store.finds, len(store.updated))
+		}
+		if got := store.updated[0]; got.ChainB != "bsc" || !got.IsCheck {
+			t.Errorf("updated %+v", *got)
+		}
+	})
+	t.Run("row still missing", func(t *testing.T) {
+		store := &mockStore{}
+		err := handleTestLeg(store, &recordingNotifier{}, "0xinconsistent")
+		var storeErr *storeError
+		if !errors.As(err, &storeErr) {
+			t.Fatalf("meson_handle error = %v, want *storeError instead of dropping the event", err)
+		}
+		if store.finds != 2 {
+			t.Errorf("finds = %d, want 2", store.finds)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+)
+
+const (
+	resubscribeMinBackoff = 1 * time.Second
+	resubscribeMaxBackoff = 60 * time.Second
+	maxResubscribeRetries = 10
+)
+
+// isWebSocketURL 判断 RPC URL 是否为 WebSocket 地址
+func isWebSocketURL(rpcUrl string) bool {
+	return strings.HasPrefix(rpcUrl, "ws://") || strings.HasPrefix(rpcUrl, "wss://")
+}
+
+// listenMode 根据链配置确定监听方式
+// 订阅模式要求所有 RPC 节点都是 WebSocket 地址
+func listenMode(chainConfig ChainConfig) (string, error) {
+	allWebSocket := true
+	for _, url := range chainConfig.rpcURLs() {
+		if !isWebSocketURL(url) {
+			allWebSocket = false
+			break
+		}
+	}
+
+	switch chainConfig.Mode {
+	case "":
+		if allWebSocket {
+			return modeSubscribe, nil
+		}
+		return modePoll, nil
+	case modePoll:
+		return modePoll, nil
+	case modeSubscribe:
+		if !allWebSocket {
+			return "", fmt.Errorf("mode %q requires ws:// or wss:// RPC URLs, got %v", modeSubscribe, chainConfig.rpcURLs())
+		}
+		return modeSubscribe, nil
+	default:
+		return "", fmt.Errorf("unknown mode: %s", chainConfig.Mode)
+	}
+}
+
+// backfillLogs 使用轮询方式补齐 startBlock 到确认高度之间的日志
+// 订阅模式不按事件类型区分确认数，确认高度取 mint 和 burn 中较多的确认数，区间内的日志都已获得足够确认
+// 返回下一个待处理的区块号
+func backfillLogs(ctx context.Context, client *rpcClient, db database.Store, notifier Notifier, chainName string, chainConfig ChainConfig, parsedABI abi.ABI, contractAddresses []common.Address, startBlock uint64, stepper *blockStepper) (uint64, error) {
+	latestBlock, err := getLatestBlockNumber(ctx, client)
+	if err != nil {
+		return startBlock, err
+	}
+	confirmedBlock := chainConfig.confirmedHeight(latestBlock)
+
+	for startBlock <= confirmedBlock {
+		endBlock := startBlock + stepper.step()
+		if endBlock > confirmedBlock {
+			endBlock = confirmedBlock
+		}
+
+		startBlock, err = filterAndProcessLogs(ctx, client, db, notifier, chainName, chainConfig, parsedABI, contractAddresses, startBlock, endBlock, latestBlock)
+		if err != nil {
+			stepper.onError(err)
+			return startBlock, err
+		}
+		stepper.onSuccess()
+	}
+
+	logrus.Infof("Backfilled chain %s up to block %d", chainName, confirmedBlock)
+	return startBlock, nil
+}
+
+// subscribeAndListen 通过 SubscribeFilterLogs 实时接收日志
+// 订阅前先补齐断档区间，订阅中断后按指数退避重新补齐并订阅
+func subscribeAndListen(ctx context.Context, client *rpcClient, db database.Store, notifier Notifier, chainName string, chainConfig ChainConfig, parsedABI abi.ABI, contractAddresses []common.Address, startBlock uint64, stepper *blockStepper) error {
+	backoff := resubscribeMinBackoff
+	retries := 0
+
+	for {
+		nextBlock, err := backfillLogs(ctx, client, db, notifier, chainName, chainConfig, parsedABI, contractAddresses, startBlock, stepper)
+		startBlock = nextBlock
+		if err == nil {
+			var established bool
+			established, err = runSubscription(ctx, client, db, notifier, chainName, chainConfig, parsedABI, contractAddresses, &startBlock, stepper)
+			if err == nil {
+				return nil
+			}
+			if established {
+				// 订阅曾经成功建立，重置退避和重试次数
+				backoff = resubscribeMinBackoff
+				retries = 0
+			}
+		}
+
+		retries++
+		if retries > maxResubscribeRetries {
+			return fmt.Errorf("subscription for chain %s failed after %d retries: %v", chainName, maxResubscribeRetries, err)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"ChainName": chainName,
+			"Error":     err,
+		}).Warnf("Log subscription dropped. Resubscribing in %s...", backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > resubscribeMaxBackoff {
+			backoff = resubscribeMaxBackoff
+		}
+	}
+}
+
+// runSubscription 建立一次日志订阅并持续处理，直到订阅出错或上下文取消
+// 收到的日志先暂存，待其所在区块获得足够确认后再处理，处理完的区块推进 startBlock 并保存进度
+// 第一个返回值表示订阅是否成功建立
+func runSubscription(ctx context.Context, client *rpcClient, db database.Store, notifier Notifier, chainName string, chainConfig ChainConfig, parsedABI abi.ABI, contractAddresses []common.Address, startBlock *uint64, stepper *blockStepper) (bool, error) {
+	query := ethereum.FilterQuery{
+		Addresses: contractAddresses,
+	}
+
+	logsCh := make(chan types.Log)
+	sub, err := client.SubscribeFilterLogs(ctx, query, logsCh)
+	if err != nil {
+		logrus.Errorf("Failed to subscribe to logs: %v", err)
+		return false, err
+	}
+	defer sub.Unsubscribe()
+
+	logrus.Infof("Subscribed to logs for chain %s from block %d", chainName, *startBlock)
+
+	// 再补齐一次，覆盖首次补齐与订阅建立之间产生的区块
+	nextBlock, err := backfillLogs(ctx, client, db, notifier, chainName, chainConfig, parsedABI, contractAddresses, *startBlock, stepper)
+	*startBlock = nextBlock
+	if err != nil {
+		return true, err
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var pending []types.Log
+	var lastReorgCheck time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return true, nil
+		case err := <-sub.Err():
+			return true, err
+		case vLog := <-logsCh:
+			if vLog.Removed {
+				// 日志所在区块被回滚，从待确认列表中移除
+				pending = removePendingLog(pending, vLog)
+				continue
+			}
+			if vLog.BlockNumber < *startBlock {
+				// 已在补齐阶段处理过的日志
+				continue
+			}
+			pending = append(pending, vLog)
+		case <-ticker.C:
+			latestBlock, err := getLatestBlockNumber(ctx, client)
+			if err != nil {
+				continue
+			}
+			updateFinalizedHeight(ctx, client, chainName, chainConfig, latestBlock)
+			if time.Since(lastReorgCheck) >= reorgCheckInterval {
+				verifyRecordedTxs(ctx, client, db, chainName)
+				lastReorgCheck = time.Now()
+			}
+
+			confirmedBlock := chainConfig.confirmedHeight(latestBlock)
+			if confirmedBlock < *startBlock {
+				continue
+			}
+
+			var confirmed, remaining []types.Log
+			for _, vLog := range pending {
+				if vLog.BlockNumber <= confirmedBlock {
+					confirmed = append(confirmed, vLog)
+				} else {
+					remaining = append(remaining, vLog)
+				}
+			}
+
+			// 处理失败时保留待确认日志，下个周期重试
+			err = processLogs(db, notifier, chainName, chainConfig, parsedABI, confirmed, *startBlock, confirmedBlock+1)
+			if err != nil {
+				continue
+			}
+			pending = remaining
+			*startBlock = confirmedBlock + 1
+		}
+	}
+}
+
+// removePendingLog 从待确认列表中移除被回滚的日志
+func removePendingLog(pending []types.Log, removed types.Log) []types.Log {
+	remaining := pending[:0]
+	for _, vLog := range pending {
+		if vLog.TxHash == removed.TxHash && vLog.Index == removed.Index && vLog.BlockHash == removed.BlockHash {
+			continue
+		}
+		remaining = append(remaining, vLog)
+	}
+	return remaining
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"meson-monitor/database"
+)
+
+const (
+	summaryTimeLayout    = "15:04"
+	summaryCheckInterval = time.Minute
+	summaryWindow        = 24 * time.Hour
+)
+
+// runDailySummary 每天在 summaryTime（UTC）之后发送一次最近 24 小时的汇总
+// 发送记录保存在数据库中，重启后当天已发送的汇总不会重复发送，错过的汇总会在启动后补发；ctx 取消后退出
+func runDailySummary(ctx context.Context, summaryTime string) {
+	at, err := time.Parse(summaryTimeLayout, summaryTime)
+	if err != nil {
+		logrus.Errorf("Invalid summaryTime %q: %v", summaryTime, err)
+		return
+	}
+	logrus.Infof("Daily summary scheduled at %s UTC", summaryTime)
+
+	for ctx.Err() == nil {
+		now := time.Now().UTC()
+		scheduled := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, time.UTC)
+		if !now.Before(scheduled) {
+			sendDailySummary(scheduled)
+		}
+		sleepContext(ctx, summaryCheckInterval)
+	}
+}
+
+// sendDailySummary 发送截至 scheduled 的 24 小时汇总，当天已发送过时直接返回
+func sendDailySummary(scheduled time.Time) {
+	claimed, err := database.ClaimDailySummary(scheduled)
+	if err != nil || !claimed {
+		return
+	}
+
+	to := scheduled.Unix()
+	from := scheduled.Add(-summaryWindow).Unix()
+	total, byChain, err := database.SummarizeMesons(from, to)
+	if err != nil {
+		return
+	}
+	completed, err := database.CountCompletedMesons(from, to)
+	if err != nil {
+		return
+	}
+
+	logrus.Infof("Sending daily summary for %s", scheduled.Format(time.RFC3339))
+	constructSummaryMessage(scheduled, completed, total, byChain)
+}
+
+// constructSummaryMessage 构建并发送每日汇总
+// completed 为窗口内完成的跨链数量，total 和 byChain 按创建时间统计
+func constructSummaryMessage(end time.Time, completed int64, total database.MesonSummary, byChain []database.MesonSummary) {
+	title := "*****📊 Bridge daily summary 📊*****"
+	window := fmt.Sprintf("%s ~ %s", formatDisplayTime(end.Add(-summaryWindow)), formatDisplayTime(end))
+
+	var telegramChains, larkChains []string
+	for _, summary := range byChain {
+		telegramChains = append(telegramChains, formatTelegram(
+			"<b>%s</b>: %s total, %s completed, %s pending, %s mismatched",
+			summary.Chain, summaryCount(summary.Total), summaryCount(summary.Completed), summaryCount(summary.Pending), summaryCount(summary.Mismatched),
+		))
+		larkChains = append(larkChains, fmt.Sprintf("**%s**: %s total, %s completed, %s pending, %s mismatched",
+			summary.Chain, summaryCount(summary.Total), summaryCount(summary.Completed), summaryCount(summary.Pending), summaryCount(summary.Mismatched),
+		))
+	}
+
+	telegramMessage := formatTelegram(
+		"<b>%s</b>\n<b>Window:</b> %s\n\n<b>Crossings:</b> %s\n<b>Completed:</b> %s\n<b>Pending:</b> %s\n<b>Mismatched:</b> %s\n\n",
+		title, window,
+		summaryCount(total.Total), summaryCount(completed), summaryCount(total.Pending), summaryCount(total.Mismatched),
+	) + strings.Join(telegramChains, "\n")
+
+	// 发送消息到 Telegram
+	sendTelegram(telegramMessage, telegramParseMode)
+
+	// 发送消息到 Lark
+	larkContent := fmt.Sprintf("**Window:** %s\n\n**Crossings:** %s\n**Completed:** %s\n**Pending:** %s\n**Mismatched:** %s\n\n%s",
+		window,
+		summaryCount(total.Total), summaryCount(completed), summaryCount(total.Pending), summaryCount(total.Mismatched),
+		strings.Join(larkChains, "\n"),
+	)
+	sendLarkCard(title, "", larkContent)
+}
+
+func summaryCount(n int64) string {
+	return addCommas(fmt.Sprint(n))
+}
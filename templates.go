@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math/big"
+	"os"
+	"text/template"
+)
+
+// MessageTemplatesConfig Telegram 和 Lark 告警正文的 Go text/template 模板，模板的数据为 Alert
+// 每个渠道可以直接配置模板，或配置模板文件的路径，两者都为空时使用与默认格式相同的内置模板
+type MessageTemplatesConfig struct {
+	// Telegram Telegram 消息模板，需按 parseMode 的语法书写，值用 esc 函数转义，如 <b>ReqID:</b> {{esc .ReqID}}
+	Telegram     string `json:"telegram"`
+	TelegramFile string `json:"telegramFile"`
+	// Lark 飞书消息卡片的正文模板（Markdown），卡片标题和颜色仍由告警类型决定
+	Lark     string `json:"lark"`
+	LarkFile string `json:"larkFile"`
+}
+
+// defaultTelegramHTMLTemplate parseMode 为 HTML 时的内置 Telegram 模板
+const defaultTelegramHTMLTemplate = `<b>{{esc .Title}}</b>
+<b>Time:</b> {{esc .Time}}
+{{if .ReqID}}<b>ReqID:</b> {{esc .ReqID}}
+{{end}}
+{{range .Legs}}<b>{{esc .Label}}:</b> {{esc .Chain}} <b>{{esc .Action}}</b> [{{esc .AmountText}}]
+{{end}}{{if .Note}}{{esc .Note}}
+{{end}}
+{{range .Legs}}<b>Tx hash ({{esc .Label}}):</b> {{esc .TxHash}}
+{{end}}{{range .Legs}}{{if .Address}}<b>{{esc .AddressLabel}} ({{esc .Label}}):</b> {{esc .Address}}
+{{end}}{{end}}`
+
+// defaultTelegramMarkdownV2Template parseMode 为 MarkdownV2 时的内置 Telegram 模板
+const defaultTelegramMarkdownV2Template = `*{{esc .Title}}*
+*Time:* {{esc .Time}}
+{{if .ReqID}}*ReqID:* {{esc .ReqID}}
+{{end}}
+{{range .Legs}}*{{esc .Label}}:* {{esc .Chain}} *{{esc .Action}}* \[{{esc .AmountText}}\]
+{{end}}{{if .Note}}{{esc .Note}}
+{{end}}
+{{range .Legs}}*Tx hash \({{esc .Label}}\):* {{esc .TxHash}}
+{{end}}{{range .Legs}}{{if .Address}}*{{esc .AddressLabel}} \({{esc .Label}}\):* {{esc .Address}}
+{{end}}{{end}}`
+
+// defaultLarkTemplate 内置的飞书卡片正文模板，链配置了 explorerTxUrl 时交易哈希链接到区块浏览器
+const defaultLarkTemplate = `**Time:** {{.Time}}
+{{if .ReqID}}**ReqID:** {{.ReqID}}
+{{end}}
+{{range .Legs}}**{{.Label}}:** {{.Chain}} **{{.Action}}** [{{.AmountText}}]
+{{end}}{{if .Note}}{{.Note}}
+{{end}}
+{{range .Legs}}**Tx hash ({{.Label}}):** {{if .ExplorerURL}}[{{.TxHash}}]({{.ExplorerURL}}){{else}}{{.TxHash}}{{end}}
+{{end}}{{range .Legs}}{{if .Address}}**{{.AddressLabel}} ({{.Label}}):** {{.Address}}
+{{end}}{{end}}`
+
+// messageTemplates 解析后的各渠道告警模板
+type messageTemplates struct {
+	telegram *template.Template
+	lark     *template.Template
+}
+
+// alertTemplates 当前使用的告警模板，由 initNotifiers 根据配置加载
+var alertTemplates *messageTemplates
+
+// loadMessageTemplates 读取并解析告警模板，parseMode 决定 Telegram 内置模板和 esc 函数的转义方式
+// 解析后用示例告警渲染一次，引用了不存在的字段等错误在启动时就能发现，而不是等到第一条告警
+func loadMessageTemplates(config MessageTemplatesConfig, parseMode string) (*messageTemplates, error) {
+	if parseMode == "" {
+		parseMode = parseModeHTML
+	}
+	defaultTelegram := defaultTelegramHTMLTemplate
+	if parseMode == parseModeMarkdownV2 {
+		defaultTelegram = defaultTelegramMarkdownV2Template
+	}
+	escape := html.EscapeString
+	if parseMode == parseModeMarkdownV2 {
+		escape = escapeMarkdownV2
+	}
+
+	telegramText, err := templateSource("telegram", config.Telegram, config.TelegramFile, defaultTelegram)
+	if err != nil {
+		return nil, err
+	}
+	larkText, err := templateSource("lark", config.Lark, config.LarkFile, defaultLarkTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := &messageTemplates{}
+	templates.telegram, err = parseMessageTemplate("telegram", telegramText, template.FuncMap{
+		"esc": func(v interface{}) string { return escape(fmt.Sprint(v)) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	templates.lark, err = parseMessageTemplate("lark", larkText, nil)
+	if err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// templateSource 返回渠道的模板文本：直接配置的模板、模板文件的内容或内置模板，两者同时配置时返回错误
+func templateSource(name, text, file, defaultText string) (string, error) {
+	if text != "" && file != "" {
+		return "", fmt.Errorf("%s and %sFile must not both be set", name, name)
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("%sFile: %v", name, err)
+		}
+		return string(data), nil
+	}
+	if text != "" {
+		return text, nil
+	}
+	return defaultText, nil
+}
+
+// parseMessageTemplate 解析模板并用示例告警试渲染
+func parseMessageTemplate(name, text string, funcs template.FuncMap) (*template.Template, error) {
+	parsed, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	_, err = renderTemplate(parsed, sampleTemplateAlert())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return parsed, nil
+}
+
+// sampleTemplateAlert 校验模板时使用的示例告警，所有可选字段都有值，使模板中的每个分支都会被执行
+func sampleTemplateAlert() Alert {
+	return Alert{
+		Kind:      AlertAmountMismatch,
+		ReqID:     "0x0000000000000000000000000000000000000000000000000000000000000000",
+		Timestamp: 0,
+		Legs: []AlertLeg{
+			{Label: "From", Chain: "chainA", Action: "Burn", Amount: big.NewInt(1000000), Decimals: 6, TxHash: "0x01", Address: "0x0000000000000000000000000000000000000001"},
+			{Label: "To", Chain: "chainB", Action: "Mint", Amount: big.NewInt(999000), Decimals: 6, TxHash: "0x02", Address: "0x0000000000000000000000000000000000000002"},
+		},
+		Note: "Delta: -0.001 (-0.1%)",
+	}
+}
+
+// renderTemplate 用告警渲染模板
+func renderTemplate(tmpl *template.Template, alert Alert) (string, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, alert)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
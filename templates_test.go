@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultTemplatesRenderAlert(t *testing.T) {
+	templates, err := loadMessageTemplates(MessageTemplatesConfig{}, parseModeHTML)
+	if err != nil {
+		t.Fatalf("loadMessageTemplates: %v", err)
+	}
+	alert := sampleTemplateAlert()
+	alert.Legs[0].Address = "<a>"
+
+	telegram, err := renderTemplate(templates.telegram, alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTelegram := "<b>*****❗️❗️Bridge amount mismatch❗️❗️*****</b>\n" +
+		"<b>Time:</b> 1970-01-01T00:00:00Z\n" +
+		"<b>ReqID:</b> 0x0000000000000000000000000000000000000000000000000000000000000000\n" +
+		"\n" +
+		"<b>From:</b> chainA <b>Burn</b> [1]\n" +
+		"<b>To:</b> chainB <b>Mint</b> [0.999]\n" +
+		"Delta: -0.001 (-0.1%)\n" +
+		"\n" +
+		"<b>Tx hash (From):</b> 0x01\n" +
+		"<b>Tx hash (To):</b> 0x02\n" +
+		"<b>Proposer (From):</b> &lt;a&gt;\n" +
+		"<b>Recipient (To):</b> 0x0000000000000000000000000000000000000002\n"
+	if telegram != wantTelegram {
+		t.Errorf("Telegram message =\n%s\nwant\n%s", telegram, wantTelegram)
+	}
+
+	// 飞书卡片正文不转义
+	lark, err := renderTemplate(templates.lark, alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(lark, "**Time:** 1970-01-01T00:00:00Z\n") || !strings.Contains(lark, "**Proposer (From):** <a>\n") {
+		t.Errorf("Lark content =\n%s", lark)
+	}
+}
+
+func TestMarkdownV2TemplateEscapesValues(t *testing.T) {
+	templates, err := loadMessageTemplates(MessageTemplatesConfig{}, parseModeMarkdownV2)
+	if err != nil {
+		t.Fatalf("loadMessageTemplates: %v", err)
+	}
+	message, err := renderTemplate(templates.telegram, sampleTemplateAlert())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(message, `*From:* chainA *Burn* \[1\]`) || !strings.Contains(message, `Delta: \-0\.001 \(\-0\.1%\)`) {
+		t.Errorf("MarkdownV2 message =\n%s", message)
+	}
+}
+
+func TestCustomTemplates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lark.tmpl")
+	if err := os.WriteFile(file, []byte("{{.ReqID}} on {{(index .Legs 0).Chain}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := loadMessageTemplates(MessageTemplatesConfig{Telegram: "<b>{{esc .ReqID}}</b>", LarkFile: file}, parseModeHTML)
+	if err != nil {
+		t.Fatalf("loadMessageTemplates: %v", err)
+	}
+	alert := sampleTemplateAlert()
+	alert.ReqID = "a&b"
+	if got, _ := renderTemplate(templates.telegram, alert); got != "<b>a&amp;b</b>" {
+		t.Errorf("Telegram message = %q", got)
+	}
+	if got, _ := renderTemplate(templates.lark, alert); got != "a&b on chainA" {
+		t.Errorf("Lark content = %q", got)
+	}
+}
+
+func TestLoadMessageTemplatesRejectsInvalidTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  MessageTemplatesConfig
+		wantErr string
+	}{
+		{name: "syntax error", config: MessageTemplatesConfig{Telegram: "{{.ReqID"}, wantErr: "telegram:"},
+		// 解析时不会发现不存在的字段，试渲染示例告警时才报错
+		{name: "unknown field", config: MessageTemplatesConfig{Lark: "{{.Missing}}"}, wantErr: "lark:"},
+		{name: "template and file", config: MessageTemplatesConfig{Lark: "x", LarkFile: "lark.tmpl"}, wantErr: "lark and larkFile must not both be set"},
+		{name: "missing file", config: MessageTemplatesConfig{TelegramFile: filepath.Join(t.TempDir(), "missing.tmpl")}, wantErr: "telegramFile:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMessageTemplates(tt.config, parseModeHTML)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadMessageTemplates error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
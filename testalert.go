@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"meson-monitor/database"
+)
+
+// testAlertReqID 示例告警使用的 reqID
+const testAlertReqID = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+// runTestAlert 使用示例数据通过 constructMessage 构建一条金额不一致的告警，发送到所有已配置的渠道
+// 并打印每个渠道的发送结果，任一渠道失败或没有配置任何渠道时返回错误
+func runTestAlert(config *Config) error {
+	var channels []string
+	results := make(map[string]error)
+	deliveryRecorder = func(channel string, err error) {
+		channels = append(channels, channel)
+		results[channel] = err
+	}
+	defer func() {
+		deliveryRecorder = nil
+	}()
+
+	// 示例告警使用配置中的链名称，便于确认消息的展示效果
+	chainNames := config.chainNames()
+	fromChain, toChain := "test-from", "test-to"
+	if len(chainNames) >= 2 {
+		fromChain, toChain = chainNames[0], chainNames[1]
+	}
+
+	constructMessage(database.Meson{
+		ReqID:     testAlertReqID,
+		Timestamp: time.Now().Unix(),
+		ChainA:    fromChain,
+		ActionA:   actionBurn,
+		AmountA:   big.NewInt(1000000),
+		TxHashA:   "0x0000000000000000000000000000000000000000000000000000000000000001",
+		AddressA:  "0x000000000000000000000000000000000000dEaD",
+		ChainB:    toChain,
+		ActionB:   actionMint,
+		AmountB:   big.NewInt(999000),
+		TxHashB:   "0x0000000000000000000000000000000000000000000000000000000000000002",
+		AddressB:  "0x000000000000000000000000000000000000dEaD",
+	})
+
+	if len(channels) == 0 {
+		return fmt.Errorf("no alert channel is configured")
+	}
+
+	failed := 0
+	for _, channel := range channels {
+		if err := results[channel]; err != nil {
+			failed++
+			fmt.Printf("%-10s FAILED: %v\n", channel, err)
+		} else {
+			fmt.Printf("%-10s OK\n", channel)
+		}
+	}
+	// 示例告警触发的 PagerDuty incident 不需要值班处理，打印结果后立即解决，解决的结果不计入统计
+	if pagerDutyBot != nil {
+		resolvePagerDuty(testAlertReqID)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d channel(s) failed", failed, len(channels))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// maxToleranceBps toleranceBps 的上限，10000 个基点即 100%
+const maxToleranceBps = 10000
+
+// AmountTolerance 一对链之间允许的金额差，用于扣除手续费后两边金额不完全相等的跨链桥
+// 两边金额之差不超过较大金额的 ToleranceBps 个基点，或不超过 Absolute（代币最小单位）时视为一致
+type AmountTolerance struct {
+	Chains       []string `json:"chains"` // 两条链的名称，不区分先后
+	ToleranceBps int64    `json:"toleranceBps"`
+	Absolute     string   `json:"absolute"` // 十进制整数，为空时不限制绝对差额
+}
+
+// amountTolerance 解析后的金额容差
+type amountTolerance struct {
+	bps      int64
+	absolute *big.Int
+}
+
+// amountTolerances 按 chainPairKey 索引的金额容差，未配置的链对要求金额严格相等
+var amountTolerances = map[string]amountTolerance{}
+
+// chainPairKey 返回两条链不区分先后的索引
+func chainPairKey(chainA, chainB string) string {
+	if chainA > chainB {
+		chainA, chainB = chainB, chainA
+	}
+	return chainA + "|" + chainB
+}
+
+// validate 检查金额容差配置并返回解析后的容差
+func (t AmountTolerance) validate(chains map[string]ChainConfig) (amountTolerance, error) {
+	if len(t.Chains) != 2 || t.Chains[0] == t.Chains[1] {
+		return amountTolerance{}, fmt.Errorf("chains must name two different chains, got %v", t.Chains)
+	}
+	for _, chainName := range t.Chains {
+		if _, ok := chains[chainName]; !ok {
+			return amountTolerance{}, fmt.Errorf("chains: unknown chain %q", chainName)
+		}
+	}
+	if t.ToleranceBps < 0 || t.ToleranceBps > maxToleranceBps {
+		return amountTolerance{}, fmt.Errorf("toleranceBps must be between 0 and %d, got %d", maxToleranceBps, t.ToleranceBps)
+	}
+
+	tolerance := amountTolerance{bps: t.ToleranceBps}
+	if t.Absolute != "" {
+		absolute, ok := new(big.Int).SetString(t.Absolute, 10)
+		if !ok || absolute.Sign() < 0 {
+			return amountTolerance{}, fmt.Errorf("absolute must be a non-negative integer, got %q", t.Absolute)
+		}
+		tolerance.absolute = absolute
+	}
+	return tolerance, nil
+}
+
+// loadAmountTolerances 解析配置中的金额容差，同一对链重复配置时报错
+func loadAmountTolerances(config *Config) (map[string]amountTolerance, error) {
+	result := make(map[string]amountTolerance, len(config.Main.AmountTolerances))
+	for i, t := range config.Main.AmountTolerances {
+		tolerance, err := t.validate(config.Chains)
+		if err != nil {
+			return nil, fmt.Errorf("main.amountTolerances[%d].%v", i, err)
+		}
+		key := chainPairKey(t.Chains[0], t.Chains[1])
+		if _, ok := result[key]; ok {
+			return nil, fmt.Errorf("main.amountTolerances[%d]: duplicate chain pair %s", i, strings.Join(t.Chains, ", "))
+		}
+		result[key] = tolerance
+	}
+	return result, nil
+}
+
+// toleranceFor 返回两条链之间的金额容差
+func toleranceFor(chainA, chainB string) amountTolerance {
+	return amountTolerances[chainPairKey(chainA, chainB)]
+}
+
+// amountDelta 返回两边金额之差的绝对值，nil 视为 0
+func amountDelta(a, b *big.Int) *big.Int {
+	return new(big.Int).Abs(new(big.Int).Sub(amountOrZero(a), amountOrZero(b)))
+}
+
+// allows 判断两边金额是否在容差范围内，未配置容差时要求严格相等
+func (t amountTolerance) allows(a, b *big.Int) bool {
+	delta := amountDelta(a, b)
+	if delta.Sign() == 0 {
+		return true
+	}
+	if t.absolute != nil && delta.Cmp(t.absolute) <= 0 {
+		return true
+	}
+	// delta * 10000 <= max(a, b) * bps
+	if t.bps > 0 {
+		base := largerAmount(a, b)
+		lhs := new(big.Int).Mul(delta, big.NewInt(maxToleranceBps))
+		rhs := new(big.Int).Mul(base, big.NewInt(t.bps))
+		return lhs.Cmp(rhs) <= 0
+	}
+	return false
+}
+
+// signedDelta 返回 b - a，即另一边相对先记录一边多出（正）或少了（负）的金额，nil 视为 0
+func signedDelta(a, b *big.Int) *big.Int {
+	return new(big.Int).Sub(amountOrZero(b), amountOrZero(a))
+}
+
+// formatDelta 按代币小数位数格式化 b 相对 a 的差额和百分比，如 "-0.001 (-0.13%)"
+// 百分比以 a 为基数，a 为 0 时以较大金额为基数，两边都为 0 时不显示百分比
+func formatDelta(a, b *big.Int, decimals uint8) string {
+	delta := signedDelta(a, b)
+	base := amountOrZero(a)
+	if base.Sign() == 0 {
+		base = largerAmount(a, b)
+	}
+	if base.Sign() == 0 {
+		return formatTokenAmount(delta, decimals)
+	}
+
+	// 百分比乘以 100 保留两位小数，按绝对值截断后再加符号
+	hundredths := new(big.Int).Mul(new(big.Int).Abs(delta), big.NewInt(10000))
+	hundredths.Quo(hundredths, base)
+	whole, frac := new(big.Int).QuoRem(hundredths, big.NewInt(100), new(big.Int))
+	sign := ""
+	if delta.Sign() < 0 {
+		sign = "-"
+	} else if delta.Sign() > 0 {
+		sign = "+"
+	}
+	return fmt.Sprintf("%s%s (%s%s.%02d%%)", sign, formatTokenAmount(new(big.Int).Abs(delta), decimals), sign, whole, frac.Int64())
+}
+
+// largerAmount 返回两边金额中较大的一个，nil 视为 0
+func largerAmount(a, b *big.Int) *big.Int {
+	a, b = amountOrZero(a), amountOrZero(b)
+	if b.Cmp(a) > 0 {
+		return b
+	}
+	return a
+}
+
+func amountOrZero(amount *big.Int) *big.Int {
+	if amount == nil {
+		return new(big.Int)
+	}
+	return amount
+}
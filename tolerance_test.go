@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestAmountToleranceAllows(t *testing.T) {
+	tests := []struct {
+		name      string
+		tolerance amountTolerance
+		a, b      int64
+		want      bool
+	}{
+		{name: "no tolerance, equal", a: 1000000, b: 1000000, want: true},
+		{name: "no tolerance, differ by one", a: 1000000, b: 999999, want: false},
+		{name: "bps at the limit", tolerance: amountTolerance{bps: 10}, a: 1000000, b: 999000, want: true},
+		{name: "bps just over", tolerance: amountTolerance{bps: 10}, a: 1000000, b: 998999, want: false},
+		{name: "bps uses the larger amount", tolerance: amountTolerance{bps: 10}, a: 999000, b: 1000000, want: true},
+		{name: "absolute at the limit", tolerance: amountTolerance{absolute: big.NewInt(500)}, a: 1000000, b: 999500, want: true},
+		{name: "absolute just over", tolerance: amountTolerance{absolute: big.NewInt(500)}, a: 1000000, b: 999499, want: false},
+		{name: "either limit is enough", tolerance: amountTolerance{bps: 1, absolute: big.NewInt(500)}, a: 1000000, b: 999500, want: true},
+		{name: "zero amount", tolerance: amountTolerance{bps: 10}, a: 0, b: 1, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tolerance.allows(big.NewInt(tt.a), big.NewInt(tt.b)); got != tt.want {
+				t.Errorf("allows(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmountToleranceAllowsLargeAmounts(t *testing.T) {
+	// 18 位小数的金额超出 int64，差额为 0.1%
+	a, _ := new(big.Int).SetString("1000000000000000000000000", 10)
+	b, _ := new(big.Int).SetString("999000000000000000000000", 10)
+	if !(amountTolerance{bps: 10}).allows(a, b) {
+		t.Error("0.1% difference rejected with a 10 bps tolerance")
+	}
+	if (amountTolerance{bps: 9}).allows(a, b) {
+		t.Error("0.1% difference allowed with a 9 bps tolerance")
+	}
+}
+
+func TestFormatDelta(t *testing.T) {
+	tests := []struct {
+		a, b     int64
+		decimals uint8
+		want     string
+	}{
+		{a: 1000000, b: 999000, decimals: 6, want: "-0.001 (-0.10%)"},
+		{a: 1000000, b: 1002500, decimals: 6, want: "+0.0025 (+0.25%)"},
+		{a: 1000000, b: 1000000, decimals: 6, want: "0 (0.00%)"},
+		{a: 0, b: 500, decimals: 0, want: "+500 (+100.00%)"},
+		{a: 0, b: 0, decimals: 6, want: "0"},
+	}
+	for _, tt := range tests {
+		if got := formatDelta(big.NewInt(tt.a), big.NewInt(tt.b), tt.decimals); got != tt.want {
+			t.Errorf("formatDelta(%d, %d) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLoadAmountTolerances(t *testing.T) {
+	tests := []struct {
+		name       string
+		tolerances []AmountTolerance
+		wantErr    string
+	}{
+		{name: "valid", tolerances: []AmountTolerance{{Chains: []string{"bsc", "eth"}, ToleranceBps: 30, Absolute: "1000"}}},
+		{name: "one chain", tolerances: []AmountTolerance{{Chains: []string{"bsc"}}}, wantErr: "chains must name two different chains"},
+		{name: "same chain twice", tolerances: []AmountTolerance{{Chains: []string{"bsc", "bsc"}}}, wantErr: "chains must name two different chains"},
+		{name: "unknown chain", tolerances: []AmountTolerance{{Chains: []string{"bsc", "tron"}}}, wantErr: `unknown chain "tron"`},
+		{name: "negative bps", tolerances: []AmountTolerance{{Chains: []string{"bsc", "eth"}, ToleranceBps: -1}}, wantErr: "toleranceBps"},
+		{name: "bps over 100%", tolerances: []AmountTolerance{{Chains: []string{"bsc", "eth"}, ToleranceBps: 10001}}, wantErr: "toleranceBps"},
+		{name: "invalid absolute", tolerances: []AmountTolerance{{Chains: []string{"bsc", "eth"}, Absolute: "0.5"}}, wantErr: "absolute"},
+		{name: "negative absolute", tolerances: []AmountTolerance{{Chains: []string{"bsc", "eth"}, Absolute: "-1"}}, wantErr: "absolute"},
+		{
+			name: "duplicate pair in either order",
+			tolerances: []AmountTolerance{
+				{Chains: []string{"bsc", "eth"}, ToleranceBps: 30},
+				{Chains: []string{"eth", "bsc"}, ToleranceBps: 50},
+			},
+			wantErr: "main.amountTolerances[1]: duplicate chain pair",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validTestConfig()
+			config.Main.AmountTolerances = tt.tolerances
+			tolerances, err := loadAmountTolerances(config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("loadAmountTolerances: %v", err)
+				}
+				if got := tolerances[chainPairKey("eth", "bsc")]; got.bps != 30 || got.absolute.Int64() != 1000 {
+					t.Errorf("tolerance = %+v", got)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// setAmountTolerance 设置 bsc 和 eth 之间的金额容差，测试结束时恢复
+func setAmountTolerance(t *testing.T, bps int64) {
+	previous := amountTolerances
+	amountTolerances = map[string]amountTolerance{chainPairKey("bsc", "eth"): {bps: bps}}
+	t.Cleanup(func() {
+		amountTolerances = previous
+	})
+}
+
+func TestMesonHandleAppliesAmountTolerance(t *testing.T) {
+	// 两边金额相差 10%
+	tests := []struct {
+		name      string
+		bps       int64
+		wantAlert bool
+	}{
+		{name: "within tolerance", bps: 1000},
+		{name: "over tolerance", bps: 999, wantAlert: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemStore()
+			recorder := &recordingNotifier{}
+			setAmountTolerance(t, tt.bps)
+			reqID := "0x0100000000000f424001"
+
+			if err := meson_handle(store, recorder, reqID, "bsc", actionBurn, testTokenIndex, 1700000000, big.NewInt(1000000), "0xa", testAddress.Hex(), testContract.Hex(), 100, 0, "0xblock"); err != nil {
+				t.Fatalf("burn leg: %v", err)
+			}
+			err := meson_handle(store, recorder, reqID, "eth", actionMint, testTokenIndex, 1700000000, big.NewInt(900000), "0xb", testAddress.Hex(), testContract.Hex(), 200, 0, "0xblock")
+
+			alerts := recorder.Alerts()
+			meson, _ := store.FindMesonByReqID(reqID)
+			if !tt.wantAlert {
+				if err != nil || len(alerts) != 0 || !meson.IsCheck {
+					t.Errorf("err = %v, alerts = %v, isCheck = %v; want no alert and a completed pair", err, recorder.Kinds(), meson.IsCheck)
+				}
+				return
+			}
+			if len(alerts) != 1 || alerts[0].Kind != AlertAmountMismatch {
+				t.Fatalf("alerts = %v, want one %s", recorder.Kinds(), AlertAmountMismatch)
+			}
+			// 告警中给出实际的差额
+			if want := "Delta: -100,000 (-10.00%)"; alerts[0].Note != want {
+				t.Errorf("note = %q, want %q", alerts[0].Note, want)
+			}
+			if meson.IsCheck {
+				t.Error("pair over tolerance marked as completed")
+			}
+		})
+	}
+}
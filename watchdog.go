@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// watchdogInterval 检查各链监听进度的间隔
+const watchdogInterval = time.Minute
+
+// chainProgressState 一条链最近一次推进区块进度的情况
+type chainProgressState struct {
+	block     uint64    // 下一个待处理的区块号
+	updatedAt time.Time // 最近一次推进进度的时间
+	stalled   bool      // 是否已经发送过停滞告警，进度推进后重置
+	saveError bool      // 是否已经发送过进度保存失败告警，保存成功后重置
+}
+
+var (
+	chainProgress     = make(map[string]*chainProgressState)
+	chainProgressLock sync.Mutex
+)
+
+// markChainStarted 监听协程启动时记录开始时间，之后一直没有进度也能被检测到
+// 已有记录时不覆盖，避免节点反复重连掩盖停滞
+func markChainStarted(chainName string, block uint64) {
+	chainProgressLock.Lock()
+	defer chainProgressLock.Unlock()
+
+	if _, ok := chainProgress[chainName]; !ok {
+		chainProgress[chainName] = &chainProgressState{block: block, updatedAt: time.Now()}
+	}
+}
+
+// markChainProgress 记录链的区块进度推进到 nextBlock
+func markChainProgress(chainName string, nextBlock uint64) {
+	chainProgressLock.Lock()
+	defer chainProgressLock.Unlock()
+
+	state, ok := chainProgress[chainName]
+	if !ok {
+		chainProgress[chainName] = &chainProgressState{block: nextBlock, updatedAt: time.Now()}
+		return
+	}
+	if state.saveError {
+		logrus.Infof("Chain %s block progress saved again at block %d", chainName, nextBlock)
+		state.saveError = false
+	}
+	if nextBlock <= state.block {
+		return
+	}
+	if state.stalled {
+		logrus.Infof("Chain %s listener resumed at block %d", chainName, nextBlock)
+	}
+	state.block = nextBlock
+	state.updatedAt = time.Now()
+	state.stalled = false
+}
+
+// chainProgressSnapshot 返回链当前的进度状态，监听尚未开始时返回 false
+func chainProgressSnapshot(chainName string) (chainProgressState, bool) {
+	chainProgressLock.Lock()
+	defer chainProgressLock.Unlock()
+
+	state, ok := chainProgress[chainName]
+	if !ok {
+		return chainProgressState{}, false
+	}
+	return *state, true
+}
+
+// markChainResumed 链的监听恢复后重新开始计算停滞时间，暂停期间没有进度不算停滞
+func markChainResumed(chainName string) {
+	chainProgressLock.Lock()
+	defer chainProgressLock.Unlock()
+
+	if state, ok := chainProgress[chainName]; ok {
+		state.updatedAt = time.Now()
+		state.stalled = false
+	}
+}
+
+// reportProgressSaveFailure 区块进度保存失败时发送告警，连续失败只告警一次，保存成功后再次失败会重新告警
+// 进度没有保存时该区间会在下一轮和重启后被反复处理，只记录日志容易被忽略
+func reportProgressSaveFailure(chainName string, nextBlock uint64, err error) {
+	chainProgressLock.Lock()
+	state, ok := chainProgress[chainName]
+	if !ok {
+		state = &chainProgressState{updatedAt: time.Now()}
+		chainProgress[chainName] = state
+	}
+	alerted := state.saveError
+	state.saveError = true
+	chainProgressLock.Unlock()
+
+	if alerted {
+		return
+	}
+	sendAlert(Alert{
+		Kind:      AlertProgressNotSaved,
+		Timestamp: time.Now().Unix(),
+		Chain:     chainName,
+		Note:      fmt.Sprintf("Chain %s: failed to save block progress %d, the range will be processed again: %v", chainName, nextBlock, err),
+	})
+}
+
+// stalledChains 返回超过 threshold 没有推进进度、且尚未告警的链，并标记为已告警
+func stalledChains(threshold time.Duration, now time.Time) []string {
+	chainProgressLock.Lock()
+	defer chainProgressLock.Unlock()
+
+	var stalled []string
+	for chainName, state := range chainProgress {
+		if state.stalled || now.Sub(state.updatedAt) < threshold || isChainPaused(chainName) {
+			continue
+		}
+		state.stalled = true
+		stalled = append(stalled, chainName)
+	}
+	sort.Strings(stalled)
+	return stalled
+}
+
+// runChainWatchdog 定期检查各链的监听进度，超过 threshold 没有推进时发送停滞告警
+// 每次停滞只告警一次，进度恢复后再次停滞会重新告警；ctx 取消后退出
+func runChainWatchdog(ctx context.Context, threshold time.Duration) {
+	logrus.Infof("Alerting when a chain listener makes no progress for %s", threshold)
+
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+		for _, chainName := range stalledChains(threshold, now) {
+			chainProgressLock.Lock()
+			state := *chainProgress[chainName]
+			chainProgressLock.Unlock()
+
+			since := now.Sub(state.updatedAt).Truncate(time.Minute)
+			logrus.Errorf("Chain %s listener has made no progress for %s (next block %d)", chainName, since, state.block)
+			sendAlert(Alert{
+				Kind:      AlertChainStalled,
+				Timestamp: now.Unix(),
+				Chain:     chainName,
+				Note:      fmt.Sprintf("Chain %s: no new blocks processed for %s, stuck before block %d", chainName, since, state.block),
+			})
+		}
+	}
+}